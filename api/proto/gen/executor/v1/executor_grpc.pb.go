@@ -0,0 +1,258 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: executor/v1/executor.proto
+
+package executorv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ExecutorService_Run_FullMethodName     = "/executor.v1.ExecutorService/Run"
+	ExecutorService_Explore_FullMethodName = "/executor.v1.ExecutorService/Explore"
+	ExecutorService_Watch_FullMethodName   = "/executor.v1.ExecutorService/Watch"
+	ExecutorService_Stop_FullMethodName    = "/executor.v1.ExecutorService/Stop"
+)
+
+// ExecutorServiceClient is the client API for ExecutorService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ExecutorServiceClient interface {
+	// Run 执行任务
+	Run(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*ExecutionResult, error)
+	// Explore 查询任务的执行进度
+	Explore(ctx context.Context, in *ExploreRequest, opts ...grpc.CallOption) (*ExecutionResult, error)
+	// Watch 订阅任务的执行进度，业务方在进度变化时推送结果，
+	// 推送任务的最终结果（成功或失败）后关闭 stream
+	Watch(ctx context.Context, in *ExploreRequest, opts ...grpc.CallOption) (ExecutorService_WatchClient, error)
+	// Stop 停止执行任务
+	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error)
+}
+
+type executorServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExecutorServiceClient(cc grpc.ClientConnInterface) ExecutorServiceClient {
+	return &executorServiceClient{cc}
+}
+
+func (c *executorServiceClient) Run(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*ExecutionResult, error) {
+	out := new(ExecutionResult)
+	err := c.cc.Invoke(ctx, ExecutorService_Run_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorServiceClient) Explore(ctx context.Context, in *ExploreRequest, opts ...grpc.CallOption) (*ExecutionResult, error) {
+	out := new(ExecutionResult)
+	err := c.cc.Invoke(ctx, ExecutorService_Explore_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorServiceClient) Watch(ctx context.Context, in *ExploreRequest, opts ...grpc.CallOption) (ExecutorService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ExecutorService_ServiceDesc.Streams[0], ExecutorService_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &executorServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ExecutorService_WatchClient interface {
+	Recv() (*ExecutionResult, error)
+	grpc.ClientStream
+}
+
+type executorServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *executorServiceWatchClient) Recv() (*ExecutionResult, error) {
+	m := new(ExecutionResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *executorServiceClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error) {
+	out := new(StopResponse)
+	err := c.cc.Invoke(ctx, ExecutorService_Stop_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExecutorServiceServer is the server API for ExecutorService service.
+// All implementations must embed UnimplementedExecutorServiceServer
+// for forward compatibility
+type ExecutorServiceServer interface {
+	// Run 执行任务
+	Run(context.Context, *RunRequest) (*ExecutionResult, error)
+	// Explore 查询任务的执行进度
+	Explore(context.Context, *ExploreRequest) (*ExecutionResult, error)
+	// Watch 订阅任务的执行进度，业务方在进度变化时推送结果，
+	// 推送任务的最终结果（成功或失败）后关闭 stream
+	Watch(*ExploreRequest, ExecutorService_WatchServer) error
+	// Stop 停止执行任务
+	Stop(context.Context, *StopRequest) (*StopResponse, error)
+	mustEmbedUnimplementedExecutorServiceServer()
+}
+
+// UnimplementedExecutorServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedExecutorServiceServer struct {
+}
+
+func (UnimplementedExecutorServiceServer) Run(context.Context, *RunRequest) (*ExecutionResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Run not implemented")
+}
+func (UnimplementedExecutorServiceServer) Explore(context.Context, *ExploreRequest) (*ExecutionResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Explore not implemented")
+}
+func (UnimplementedExecutorServiceServer) Watch(*ExploreRequest, ExecutorService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedExecutorServiceServer) Stop(context.Context, *StopRequest) (*StopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+}
+func (UnimplementedExecutorServiceServer) mustEmbedUnimplementedExecutorServiceServer() {}
+
+// UnsafeExecutorServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ExecutorServiceServer will
+// result in compilation errors.
+type UnsafeExecutorServiceServer interface {
+	mustEmbedUnimplementedExecutorServiceServer()
+}
+
+func RegisterExecutorServiceServer(s grpc.ServiceRegistrar, srv ExecutorServiceServer) {
+	s.RegisterService(&ExecutorService_ServiceDesc, srv)
+}
+
+func _ExecutorService_Run_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServiceServer).Run(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExecutorService_Run_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServiceServer).Run(ctx, req.(*RunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExecutorService_Explore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExploreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServiceServer).Explore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExecutorService_Explore_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServiceServer).Explore(ctx, req.(*ExploreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExecutorService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExploreRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ExecutorServiceServer).Watch(m, &executorServiceWatchServer{stream})
+}
+
+type ExecutorService_WatchServer interface {
+	Send(*ExecutionResult) error
+	grpc.ServerStream
+}
+
+type executorServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *executorServiceWatchServer) Send(m *ExecutionResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ExecutorService_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServiceServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExecutorService_Stop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServiceServer).Stop(ctx, req.(*StopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ExecutorService_ServiceDesc is the grpc.ServiceDesc for ExecutorService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ExecutorService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "executor.v1.ExecutorService",
+	HandlerType: (*ExecutorServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Run",
+			Handler:    _ExecutorService_Run_Handler,
+		},
+		{
+			MethodName: "Explore",
+			Handler:    _ExecutorService_Explore_Handler,
+		},
+		{
+			MethodName: "Stop",
+			Handler:    _ExecutorService_Stop_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _ExecutorService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "executor/v1/executor.proto",
+}
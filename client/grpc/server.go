@@ -0,0 +1,176 @@
+package grpc
+
+import (
+	"context"
+	executorv1 "github.com/ecodeclub/ecron/api/proto/gen/executor/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"time"
+)
+
+const (
+	headerExecutionID = "execution_id"
+)
+
+var _ executorv1.ExecutorServiceServer = (*Server)(nil)
+
+// Server 业务方通过 gRPC 暴露任务时使用，实现了调度器调用的 ExecutorService
+type Server struct {
+	executorv1.UnimplementedExecutorServiceServer
+	registry *Registry
+	// 任务没有实现 Watcher 时，查询任务进度的间隔
+	watchInterval time.Duration
+}
+
+type ServerOption func(s *Server)
+
+func WithWatchInterval(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.watchInterval = interval
+	}
+}
+
+func NewServer(registry *Registry, opts ...ServerOption) *Server {
+	s := &Server{
+		registry:      registry,
+		watchInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register 将服务注册到 gRPC server 上
+func (s *Server) Register(server grpc.ServiceRegistrar) {
+	executorv1.RegisterExecutorServiceServer(server, s)
+}
+
+func (s *Server) Run(ctx context.Context, req *executorv1.RunRequest) (*executorv1.ExecutionResult, error) {
+	t, eid, err := s.prepare(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	st, progress := t.Execute(req.GetBody())
+	return s.result(eid, st, progress), nil
+}
+
+func (s *Server) Explore(ctx context.Context, req *executorv1.ExploreRequest) (*executorv1.ExecutionResult, error) {
+	t, eid, err := s.prepare(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	st, progress := t.Status()
+	return s.result(eid, st, progress), nil
+}
+
+func (s *Server) Watch(req *executorv1.ExploreRequest, stream executorv1.ExecutorService_WatchServer) error {
+	ctx := stream.Context()
+	t, eid, err := s.prepare(ctx, req.GetName())
+	if err != nil {
+		return err
+	}
+	var ch <-chan Progress
+	if w, ok := t.(Watcher); ok {
+		ch = w.Watch(ctx)
+	} else {
+		ch = s.pollStatus(ctx, t)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err = stream.Send(s.result(eid, p.Status, p.Progress)); err != nil {
+				return err
+			}
+			if p.Status != StatusRunning {
+				return nil
+			}
+		}
+	}
+}
+
+// pollStatus 定时调用 Task.Status，只有进度发生变化时才推送
+func (s *Server) pollStatus(ctx context.Context, t Task) <-chan Progress {
+	ch := make(chan Progress)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(s.watchInterval)
+		defer ticker.Stop()
+		var last Progress
+		for first := true; ; first = false {
+			st, progress := t.Status()
+			cur := Progress{Status: st, Progress: progress}
+			if first || cur != last {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- cur:
+				}
+				last = cur
+			}
+			if st != StatusRunning {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ch
+}
+
+func (s *Server) Stop(ctx context.Context, req *executorv1.StopRequest) (*executorv1.StopResponse, error) {
+	t, _, err := s.prepare(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if err = t.Stop(); err != nil {
+		return nil, status.Errorf(codes.Internal, "stop task failed: %s", err)
+	}
+	return &executorv1.StopResponse{}, nil
+}
+
+// prepare 找到对应的任务，并且从 metadata 中解析出 execution_id
+func (s *Server) prepare(ctx context.Context, name string) (Task, int64, error) {
+	t, exist := s.registry.GetTask(name)
+	if !exist {
+		return nil, 0, status.Errorf(codes.NotFound, "task not found: %s", name)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(headerExecutionID)
+	if len(values) == 0 {
+		return nil, 0, status.Error(codes.InvalidArgument, "miss metadata: execution_id")
+	}
+	eid, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return nil, 0, status.Errorf(codes.InvalidArgument, "unknown execution_id: %s", values[0])
+	}
+	return t, eid, nil
+}
+
+func (s *Server) result(eid int64, st Status, progress int) *executorv1.ExecutionResult {
+	res := &executorv1.ExecutionResult{
+		Eid:      eid,
+		Progress: int32(progress),
+	}
+	switch st {
+	case StatusSuccess:
+		res.Status = executorv1.ExecutionStatus_EXECUTION_STATUS_SUCCESS
+	case StatusRunning:
+		res.Status = executorv1.ExecutionStatus_EXECUTION_STATUS_RUNNING
+	case StatusFailed:
+		res.Status = executorv1.ExecutionStatus_EXECUTION_STATUS_FAILED
+	}
+	return res
+}
@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"context"
+	executorv1 "github.com/ecodeclub/ecron/api/proto/gen/executor/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	r := NewRegistry()
+	err := r.Register(new(MyTask))
+	require.NoError(t, err)
+
+	svr := NewServer(r)
+
+	testCases := []struct {
+		name           string
+		taskName       string
+		eid            string
+		wantCode       codes.Code
+		wantExecResult *executorv1.ExecutionResult
+		wantExploreRes *executorv1.ExecutionResult
+	}{
+		{
+			name:     "未知任务",
+			taskName: "unknown-task",
+			eid:      "1",
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "缺少eid",
+			taskName: "my-task",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "eid解析错误",
+			taskName: "my-task",
+			eid:      "abc",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "成功",
+			taskName: "my-task",
+			eid:      "1",
+			wantCode: codes.OK,
+			wantExecResult: &executorv1.ExecutionResult{
+				Eid:      1,
+				Status:   executorv1.ExecutionStatus_EXECUTION_STATUS_RUNNING,
+				Progress: 10,
+			},
+			wantExploreRes: &executorv1.ExecutionResult{
+				Eid:      1,
+				Status:   executorv1.ExecutionStatus_EXECUTION_STATUS_SUCCESS,
+				Progress: 100,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.eid != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(headerExecutionID, tc.eid))
+			}
+
+			// 执行
+			res, err := svr.Run(ctx, &executorv1.RunRequest{Name: tc.taskName, Body: "body"})
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			if err == nil {
+				assert.Equal(t, tc.wantExecResult.String(), res.String())
+			}
+
+			// 进度探查
+			res, err = svr.Explore(ctx, &executorv1.ExploreRequest{Name: tc.taskName})
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			if err == nil {
+				assert.Equal(t, tc.wantExploreRes.String(), res.String())
+			}
+
+			// 停止
+			_, err = svr.Stop(ctx, &executorv1.StopRequest{Name: tc.taskName})
+			assert.Equal(t, tc.wantCode, status.Code(err))
+		})
+	}
+}
+
+type MyTask struct {
+}
+
+func (m *MyTask) Execute(body string) (Status, int) {
+	return StatusRunning, 10
+}
+
+func (m *MyTask) Status() (Status, int) {
+	return StatusSuccess, 100
+}
+
+func (m *MyTask) Stop() error {
+	return nil
+}
+
+func (m *MyTask) Name() string {
+	return "my-task"
+}
+
+func TestServer_Watch(t *testing.T) {
+	r := NewRegistry()
+	err := r.Register(new(MyTask), new(MyWatchTask))
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	NewServer(r, WithWatchInterval(time.Millisecond*10)).Register(server)
+	go func() {
+		_ = server.Serve(l)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := executorv1.NewExecutorServiceClient(conn)
+
+	testCases := []struct {
+		name     string
+		taskName string
+		want     []string
+	}{
+		{
+			name:     "没有实现Watcher，轮询任务进度",
+			taskName: "my-task",
+			want: []string{
+				(&executorv1.ExecutionResult{Eid: 1, Status: executorv1.ExecutionStatus_EXECUTION_STATUS_SUCCESS, Progress: 100}).String(),
+			},
+		},
+		{
+			name:     "任务主动推送进度",
+			taskName: "my-watch-task",
+			want: []string{
+				(&executorv1.ExecutionResult{Eid: 1, Status: executorv1.ExecutionStatus_EXECUTION_STATUS_RUNNING, Progress: 50}).String(),
+				(&executorv1.ExecutionResult{Eid: 1, Status: executorv1.ExecutionStatus_EXECUTION_STATUS_FAILED, Progress: 60}).String(),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), headerExecutionID, "1")
+			stream, err := client.Watch(ctx, &executorv1.ExploreRequest{Name: tc.taskName})
+			require.NoError(t, err)
+			var got []string
+			for {
+				res, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, res.String())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+type MyWatchTask struct {
+	MyTask
+}
+
+func (m *MyWatchTask) Name() string {
+	return "my-watch-task"
+}
+
+func (m *MyWatchTask) Watch(ctx context.Context) <-chan Progress {
+	ch := make(chan Progress, 2)
+	ch <- Progress{Status: StatusRunning, Progress: 50}
+	ch <- Progress{Status: StatusFailed, Progress: 60}
+	close(ch)
+	return ch
+}
@@ -0,0 +1,32 @@
+package grpc
+
+import "context"
+
+//go:generate mockgen -source=./types.go -package=taskmocks -destination=./mocks/task.mock.go
+type Task interface {
+	// Execute 执行任务，body 是调度器传递过来的任务参数
+	Execute(body string) (Status, int)
+	Status() (Status, int)
+	Stop() error
+	Name() string
+}
+
+// Watcher 是可选接口。实现了该接口的任务可以在进度变化时主动推送，
+// 否则 Server 会按照固定间隔调用 Task.Status 获取进度。
+type Watcher interface {
+	// Watch 返回的 channel 在推送最终结果（成功或失败）后应当关闭
+	Watch(ctx context.Context) <-chan Progress
+}
+
+type Progress struct {
+	Status   Status
+	Progress int
+}
+
+type Status string
+
+const (
+	StatusSuccess Status = "SUCCESS"
+	StatusFailed  Status = "FAILED"
+	StatusRunning Status = "RUNNING"
+)
@@ -1,8 +1,13 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,12 +15,16 @@ import (
 
 const (
 	headerExecutionID = "Execution_id"
+	tracerName        = "github.com/ecodeclub/ecron/client/http"
 )
 
 type HttpClient struct {
 	registry *Registry
 	prefix   string // 本地监听路由
 	client   *http.Client
+	tracer   trace.Tracer
+	// 从请求头中提取调度节点的链路信息
+	propagator propagation.TextMapPropagator
 }
 
 type ClientOption func(c *HttpClient)
@@ -26,11 +35,20 @@ func WithPrefix(prefix string) ClientOption {
 	}
 }
 
+// WithTracerProvider 默认使用 otel 全局的 TracerProvider
+func WithTracerProvider(tp trace.TracerProvider) ClientOption {
+	return func(c *HttpClient) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
 func NewHttpClient(registry *Registry, opts ...ClientOption) *HttpClient {
 	c := &HttpClient{
-		registry: registry,
-		client:   http.DefaultClient,
-		prefix:   "/", // 默认监听地址是 /
+		registry:   registry,
+		client:     http.DefaultClient,
+		prefix:     "/", // 默认监听地址是 /
+		tracer:     otel.GetTracerProvider().Tracer(tracerName),
+		propagator: propagation.TraceContext{},
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -77,15 +95,24 @@ func (c *HttpClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 继续调度节点的链路
+	ctx := c.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := c.tracer.Start(ctx, "ecron.client "+name, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.Int64("ecron.execution.id", eid),
+		))
+	defer span.End()
+
 	var status Status
 	var progress int
 	switch r.Method {
 	case http.MethodGet:
-		status, progress = t.Status()
+		status, progress = taskStatus(ctx, t)
 	case http.MethodPost:
-		status, progress = t.Execute()
+		status, progress = execute(ctx, t)
 	case http.MethodDelete:
-		err := t.Stop()
+		err := stop(ctx, t)
 		if err != nil {
 			fmt.Fprintf(w, "stop task failed")
 		} else {
@@ -114,3 +141,24 @@ type result struct {
 	Status   Status `json:"status"`
 	Progress int    `json:"progress"`
 }
+
+func execute(ctx context.Context, t Task) (Status, int) {
+	if ct, ok := t.(ContextTask); ok {
+		return ct.ExecuteContext(ctx)
+	}
+	return t.Execute()
+}
+
+func taskStatus(ctx context.Context, t Task) (Status, int) {
+	if ct, ok := t.(ContextTask); ok {
+		return ct.StatusContext(ctx)
+	}
+	return t.Status()
+}
+
+func stop(ctx context.Context, t Task) error {
+	if ct, ok := t.(ContextTask); ok {
+		return ct.StopContext(ctx)
+	}
+	return t.Stop()
+}
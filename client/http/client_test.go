@@ -1,9 +1,13 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -106,6 +110,52 @@ func TestHttpClient_HandleFunc(t *testing.T) {
 	}
 }
 
+func TestHttpClient_Tracing(t *testing.T) {
+	myTask := &MyContextTask{}
+	r := NewRegistry()
+	require.NoError(t, r.Register(myTask))
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cli := NewHttpClient(r, WithPrefix("/ecron/"), WithTracerProvider(tp))
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodPost, "/ecron/my-context-task", nil)
+	req.Header.Set(headerExecutionID, "1")
+	req.Header.Set("traceparent", traceparent)
+	resp := httptest.NewRecorder()
+	cli.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// 业务方收到的 ctx 和调度节点在同一个链路中
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", myTask.sc.TraceID().String())
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "ecron.client my-context-task", spans[0].Name)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+}
+
+type MyContextTask struct {
+	MyTask
+	sc trace.SpanContext
+}
+
+func (m *MyContextTask) ExecuteContext(ctx context.Context) (Status, int) {
+	m.sc = trace.SpanContextFromContext(ctx)
+	return StatusRunning, 10
+}
+
+func (m *MyContextTask) StatusContext(ctx context.Context) (Status, int) {
+	return m.Status()
+}
+
+func (m *MyContextTask) StopContext(ctx context.Context) error {
+	return m.Stop()
+}
+
+func (m *MyContextTask) Name() string {
+	return "my-context-task"
+}
+
 type MyTask struct {
 }
 
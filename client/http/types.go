@@ -1,5 +1,7 @@
 package http
 
+import "context"
+
 //go:generate mockgen -source=./types.go -package=taskmocks -destination=./mocks/task.mock.go
 type Task interface {
 	Execute() (Status, int)
@@ -8,6 +10,15 @@ type Task interface {
 	Name() string
 }
 
+// ContextTask 实现了 ContextTask 的任务会收到带有调度节点链路信息的 ctx，
+// 业务方可以在同一个链路中继续记录。调用时优先使用 ContextTask 的方法
+type ContextTask interface {
+	Task
+	ExecuteContext(ctx context.Context) (Status, int)
+	StatusContext(ctx context.Context) (Status, int)
+	StopContext(ctx context.Context) error
+}
+
 type Status string
 
 const (
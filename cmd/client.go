@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiClient 调用调度节点的管理接口，接口的定义见 web 包
+type apiClient struct {
+	addr   string
+	client *http.Client
+}
+
+func newAPIClient(addr string) *apiClient {
+	return &apiClient{
+		addr:   strings.TrimSuffix(addr, "/"),
+		client: http.DefaultClient,
+	}
+}
+
+// result 和 web.Result 一致，Data 延迟到知道类型之后再解析
+type result struct {
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// do 发送请求并把返回结果中的 data 解析到 data 中，data 为 nil 时忽略返回的数据
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, body any, data any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var res result
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("解析管理接口的返回结果失败: %s %s, 状态码 %d: %w", method, path, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s 失败, 状态码 %d: %s", method, path, resp.StatusCode, res.Msg)
+	}
+	if data == nil || len(res.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Data, data)
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ecodeclub/ecron/internal/config"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/executor"
+	"github.com/ecodeclub/ecron/internal/scheduler"
+	"github.com/ecodeclub/ecron/internal/storage/backend"
+	ecronredis "github.com/ecodeclub/ecron/internal/storage/redis"
+	"github.com/ecodeclub/ecron/internal/storage/sqlite"
+	"github.com/ecodeclub/ecron/internal/web"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	sqliteCfg := fmt.Sprintf("storage:\n  driver: sqlite\n  dsn: %s\n", filepath.Join(dir, "ecron.db"))
+	testCases := []struct {
+		name    string
+		cfg     string
+		args    []string
+		wantOut string
+		wantErr error
+	}{
+		{
+			name:    "升级",
+			cfg:     sqliteCfg,
+			args:    []string{"migrate"},
+			wantOut: "已经迁移到版本 2\n",
+		},
+		{
+			name:    "查看版本",
+			cfg:     sqliteCfg,
+			args:    []string{"migrate", "version"},
+			wantOut: "当前版本 2，程序需要的版本 2\n",
+		},
+		{
+			// SQLite 打开时会自动升级，这里只确认回滚成功
+			name:    "回滚",
+			cfg:     sqliteCfg,
+			args:    []string{"migrate", "down", "--steps", "1"},
+			wantOut: "已经回滚到版本 1\n",
+		},
+		{
+			name:    "不支持的存储",
+			cfg:     "storage:\n  driver: mongo\n",
+			args:    []string{"migrate"},
+			wantErr: errs.ErrUnsupportedStorage,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ecron.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.cfg), 0o644))
+			out, err := run(append(tc.args, "-c", path)...)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantOut, out)
+		})
+	}
+}
+
+func TestTaskAndExec(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "ecron.db"))
+	require.NoError(t, err)
+	b, err := backend.New(backend.SQLite, db)
+	require.NoError(t, err)
+	gin.SetMode(gin.ReleaseMode)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	server := gin.New()
+	pe, err := b.NewPreempter(10, 15*time.Second, 5*time.Second)
+	require.NoError(t, err)
+	sche := scheduler.NewPreemptScheduler(b.ExecutionDAO, time.Second, semaphore.NewWeighted(1), logger, pe, b.TaskRepo)
+	web.NewTaskHandler(b.TaskRepo, b.ExecutionDAO, sche, logger,
+		executor.NewHttpExecutor(logger, http.DefaultClient, 1)).RegisterRoutes(server)
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "task.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+		"name": "test",
+		"executor": "HTTP",
+		"cfg": "{\"url\":\"http://localhost:8080/test\"}",
+		"cronExp": "0 0 8 * * *"
+	}`), 0o644))
+
+	out, err := run("task", "add", "-f", file, "--server", srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", out)
+
+	out, err = run("task", "list", "--server", srv.URL)
+	require.NoError(t, err)
+	assert.Contains(t, out, "0 0 8 * * *")
+	assert.Contains(t, out, "waiting")
+	assert.Contains(t, out, "共 1 个任务")
+
+	_, err = run("task", "pause", "1", "--server", srv.URL)
+	require.NoError(t, err)
+	out, err = run("task", "list", "--server", srv.URL)
+	require.NoError(t, err)
+	assert.Contains(t, out, "paused")
+
+	// 暂停的任务不能手动触发
+	_, err = run("task", "trigger", "1", "--server", srv.URL)
+	assert.ErrorContains(t, err, errs.ErrInvalidTaskStatus.Error())
+
+	_, err = run("task", "resume", "1", "--fire-once", "--server", srv.URL)
+	require.NoError(t, err)
+	_, err = run("task", "trigger", "1", "--server", srv.URL)
+	require.NoError(t, err)
+
+	out, err = run("exec", "list", "--task", "1", "--server", srv.URL)
+	require.NoError(t, err)
+	assert.Contains(t, out, "共 0 条执行记录")
+
+	_, err = run("task", "rm", "1", "--server", srv.URL)
+	require.NoError(t, err)
+	_, err = run("task", "trigger", "1", "--server", srv.URL)
+	assert.ErrorContains(t, err, errs.ErrTaskNotFound.Error())
+
+	_, err = run("task", "rm", "abc", "--server", srv.URL)
+	assert.ErrorContains(t, err, "任务 id 错误")
+}
+
+func TestUsePreempter(t *testing.T) {
+	m := miniredis.RunT(t)
+	testCases := []struct {
+		name      string
+		preempter string
+		addr      string
+		wantRedis bool
+		wantErr   error
+	}{
+		{
+			name: "默认使用数据库",
+		},
+		{
+			name:      "redis",
+			preempter: backend.PreempterRedis,
+			addr:      m.Addr(),
+			wantRedis: true,
+		},
+		{
+			name:      "不支持的 preempter",
+			preempter: "etcd",
+			wantErr:   errs.ErrInCorrectConfig,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := sqlite.Open(filepath.Join(t.TempDir(), "ecron.db"))
+			require.NoError(t, err)
+			b, err := backend.New(backend.SQLite, db)
+			require.NoError(t, err)
+			cfg := config.Default()
+			cfg.Storage.Preempter = tc.preempter
+			cfg.Storage.Redis.Addr = tc.addr
+			err = usePreempter(context.Background(), b, cfg)
+			assert.ErrorIs(t, err, tc.wantErr)
+			_, ok := b.TaskRepo.(*ecronredis.TaskCfgRepository)
+			assert.Equal(t, tc.wantRedis, ok)
+		})
+	}
+}
+
+// TestRedisPreempter 通过管理接口手动触发的任务会被 Redis 的 Preempter 调度执行
+func TestRedisPreempter(t *testing.T) {
+	var calls atomic.Int32
+	biz := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"status":"SUCCESS","progress":100}`))
+	}))
+	defer biz.Close()
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "ecron.db"))
+	require.NoError(t, err)
+	b, err := backend.New(backend.SQLite, db)
+	require.NoError(t, err)
+	cfg := config.Default()
+	cfg.Storage.Preempter = backend.PreempterRedis
+	cfg.Storage.Redis.Addr = miniredis.RunT(t).Addr()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, usePreempter(ctx, b, cfg))
+	require.NoError(t, b.Load(ctx))
+
+	gin.SetMode(gin.ReleaseMode)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	server := gin.New()
+	pe, err := b.NewPreempter(10, 15*time.Second, 5*time.Second)
+	require.NoError(t, err)
+	sche := scheduler.NewPreemptScheduler(b.ExecutionDAO, time.Second, semaphore.NewWeighted(1), logger, pe, b.TaskRepo,
+		scheduler.WithBackoff(10*time.Millisecond, 50*time.Millisecond))
+	exec := executor.NewHttpExecutor(logger, http.DefaultClient, 1)
+	sche.RegisterExecutor(exec)
+	web.NewTaskHandler(b.TaskRepo, b.ExecutionDAO, sche, logger, exec).RegisterRoutes(server)
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	go func() {
+		_ = sche.Schedule(ctx)
+	}()
+
+	file := filepath.Join(t.TempDir(), "task.json")
+	require.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf(`{
+		"name": "test",
+		"executor": "HTTP",
+		"cfg": "{\"url\":\"%s\",\"taskTimeout\":5000000000}",
+		"cronExp": "0 0 8 1 1 *"
+	}`, biz.URL)), 0o644))
+	_, err = run("task", "add", "-f", file, "--server", srv.URL)
+	require.NoError(t, err)
+	_, err = run("task", "trigger", "1", "--server", srv.URL)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return calls.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		out, er := run("exec", "list", "--task", "1", "--server", srv.URL)
+		return er == nil && bytes.Contains([]byte(out), []byte("共 1 条执行记录"))
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func run(args ...string) (string, error) {
+	root := NewRootCommand()
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs(args)
+	err := root.Execute()
+	return out.String(), err
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/web"
+	"github.com/spf13/cobra"
+	"net/http"
+	"text/tabwriter"
+	"time"
+)
+
+func newExecCommand() *cobra.Command {
+	var addr string
+	cmd := &cobra.Command{
+		Use:   "exec",
+		Short: "通过管理接口查询执行记录",
+	}
+	cmd.PersistentFlags().StringVar(&addr, "server", defaultServerAddr, "调度节点管理接口的地址")
+	cmd.AddCommand(newExecListCommand(func() *apiClient {
+		return newAPIClient(addr)
+	}))
+	return cmd
+}
+
+func newExecListCommand(client func() *apiClient) *cobra.Command {
+	var (
+		tid           int64
+		offset, limit int
+	)
+	cmd := &cobra.Command{
+		Use:   "list --task <id>",
+		Short: "查询任务的执行记录，最近开始的在前",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tid <= 0 {
+				return fmt.Errorf("任务 id 错误: %d", tid)
+			}
+			var res web.ListResp[web.ExecutionVO]
+			err := client().do(cmd.Context(), http.MethodGet, taskPath(tid, "executions"), pageQuery(offset, limit), nil, &res)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tATTEMPT\tTRIGGER\tSTATUS\tPROGRESS\tSTART\tDURATION\tNODE\tERROR")
+			for _, e := range res.List {
+				fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d%%\t%s\t%s\t%s\t%s\n",
+					e.ID, e.Attempt, e.TriggerType, e.Status, e.Progress, formatMilli(e.StartTime),
+					time.Duration(e.Duration)*time.Millisecond, e.Node, e.ErrMsg)
+			}
+			fmt.Fprintf(w, "共 %d 条执行记录\n", res.Total)
+			return w.Flush()
+		},
+	}
+	cmd.Flags().Int64Var(&tid, "task", 0, "任务 id")
+	_ = cmd.MarkFlagRequired("task")
+	pageFlags(cmd, &offset, &limit)
+	return cmd
+}
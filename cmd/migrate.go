@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/config"
+	"github.com/ecodeclub/ecron/internal/storage/migrate"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCommand() *cobra.Command {
+	var path string
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "把数据库的表结构升级到最新的版本",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := openMigrator(path)
+			if err != nil {
+				return err
+			}
+			if err = m.Up(cmd.Context()); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "已经迁移到版本 %d\n", m.Latest())
+			return err
+		},
+	}
+	cmd.PersistentFlags().StringVarP(&path, "config", "c", defaultConfigPath, "配置文件，支持 YAML 和 TOML")
+	cmd.AddCommand(newMigrateDownCommand(&path), newMigrateVersionCommand(&path))
+	return cmd
+}
+
+func newMigrateDownCommand(path *string) *cobra.Command {
+	var steps int
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "回滚最近的几个版本",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := openMigrator(*path)
+			if err != nil {
+				return err
+			}
+			if err = m.Down(cmd.Context(), steps); err != nil {
+				return err
+			}
+			version, _, err := m.Version(cmd.Context())
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "已经回滚到版本 %d\n", version)
+			return err
+		},
+	}
+	cmd.Flags().IntVar(&steps, "steps", 1, "回滚的版本数量")
+	return cmd
+}
+
+func newMigrateVersionCommand(path *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "查看数据库当前的版本和程序需要的版本",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := openMigrator(*path)
+			if err != nil {
+				return err
+			}
+			version, dirty, err := m.Version(cmd.Context())
+			if err != nil {
+				return err
+			}
+			out := fmt.Sprintf("当前版本 %d，程序需要的版本 %d", version, m.Latest())
+			if dirty {
+				out += "，迁移失败，需要手动修复"
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), out)
+			return err
+		},
+	}
+}
+
+func openMigrator(path string) (*migrate.Migrator, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := openBackend(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return b.NewMigrator()
+}
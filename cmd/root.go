@@ -0,0 +1,31 @@
+// Package cmd 实现 ecron 命令行。
+// server 和 migrate 直接读取配置文件，task 和 exec 通过调度节点的管理接口操作任务
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"os"
+)
+
+const (
+	defaultConfigPath = "ecron.yaml"
+	defaultServerAddr = "http://localhost:8080"
+)
+
+// NewRootCommand 每次调用都创建新的命令，方便测试
+func NewRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "ecron",
+		Short: "分布式任务调度",
+		// 出错时只输出错误信息，不输出用法
+		SilenceUsage: true,
+	}
+	root.AddCommand(newServerCommand(), newMigrateCommand(), newTaskCommand(), newExecCommand())
+	return root
+}
+
+func Execute() {
+	if err := NewRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/config"
+	"github.com/ecodeclub/ecron/internal/executor"
+	"github.com/ecodeclub/ecron/internal/metrics"
+	"github.com/ecodeclub/ecron/internal/scheduler"
+	"github.com/ecodeclub/ecron/internal/web"
+	"github.com/ecodeclub/ecron/internal/workflow"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/semaphore"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 探查业务方执行情况连续失败的次数上限
+const maxExploreFailCount = 5
+
+func newServerCommand() *cobra.Command {
+	var path string
+	cmd := &cobra.Command{
+		Use:   "server",
+		Short: "启动调度节点，同时提供管理接口和 /metrics",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(path)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return runServer(ctx, cfg)
+		},
+	}
+	cmd.Flags().StringVarP(&path, "config", "c", defaultConfigPath, "配置文件，支持 YAML 和 TOML")
+	return cmd
+}
+
+// runServer ctx 结束后停止接收请求和抢占任务，
+// 等待正在执行的任务结束，超过 ShutdownTimeout 后把任务交给其他调度节点
+func runServer(ctx context.Context, cfg config.Config) error {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	b, err := openBackend(cfg.Storage)
+	if err != nil {
+		return err
+	}
+	migrator, err := b.NewMigrator()
+	if err != nil {
+		return err
+	}
+	// 表结构和程序不一致时不启动，避免读写不存在的字段
+	if err = migrator.Check(ctx); err != nil {
+		return err
+	}
+	if err = usePreempter(ctx, b, cfg); err != nil {
+		return err
+	}
+	// Redis 的数据丢失时从任务表恢复等待调度的任务
+	if err = b.Load(ctx); err != nil {
+		return err
+	}
+	m := metrics.New()
+	m.SetSlotCapacity(metrics.SlotTask, cfg.Scheduler.MaxConcurrency)
+
+	execs := []executor.Executor{
+		executor.NewHttpExecutor(logger, &http.Client{}, maxExploreFailCount, executor.WithHttpMetrics(m)),
+		executor.NewGrpcExecutor(logger, maxExploreFailCount),
+	}
+	pe, err := b.NewPreempter(cfg.Preempter.BatchSize, cfg.Preempter.LeaseTTL, cfg.Preempter.RefreshInterval,
+		cfg.Preempter.MySQLOptions()...)
+	if err != nil {
+		return err
+	}
+	opts, err := cfg.Scheduler.Options()
+	if err != nil {
+		return err
+	}
+	sche := scheduler.NewPreemptScheduler(b.ExecutionDAO, cfg.Scheduler.RefreshInterval,
+		semaphore.NewWeighted(cfg.Scheduler.MaxConcurrency), logger, pe, b.TaskRepo,
+		append(opts, scheduler.WithMetrics(m))...)
+	sche.RegisterExecutor(execs...)
+	engine := workflow.NewEngine(b.WorkflowDAO, b.TaskRepo, logger)
+	sche.RegisterFinishedHandler(engine.OnFinished)
+
+	gin.SetMode(gin.ReleaseMode)
+	server := gin.New()
+	server.Use(gin.Recovery())
+	web.NewTaskHandler(b.TaskRepo, b.ExecutionDAO, sche, logger, execs...).RegisterRoutes(server)
+	web.NewWorkflowHandler(engine, b.WorkflowDAO, logger).RegisterRoutes(server)
+	m.RegisterRoutes(server)
+	srv := &http.Server{Addr: cfg.Server.Addr, Handler: server}
+
+	// 取消 scheduleCtx 会直接停止正在执行的任务，只在 Shutdown 之后取消
+	scheduleCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- sche.Schedule(scheduleCtx)
+	}()
+	go func() {
+		if er := srv.ListenAndServe(); !errors.Is(er, http.ErrServerClosed) {
+			errCh <- er
+		}
+	}()
+	logger.Info("调度节点已经启动", slog.String("addr", cfg.Server.Addr))
+
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+		logger.Error("调度节点异常退出", slog.Any("error", err))
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.Server.ShutdownTimeout)
+	defer shutdownCancel()
+	if er := srv.Shutdown(shutdownCtx); er != nil {
+		logger.Error("关闭管理接口失败", slog.Any("error", er))
+	}
+	// 超时的话 Shutdown 会交还任务的租约，这里不需要再处理
+	_ = sche.Shutdown(shutdownCtx)
+	return err
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/config"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/storage/backend"
+	"github.com/ecodeclub/ecron/internal/storage/sqlite"
+	"github.com/redis/go-redis/v9"
+	gormmysql "gorm.io/driver/mysql"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openDB 按照配置的驱动打开数据库，SQLite 打开时会执行所有的迁移
+func openDB(cfg config.StorageConfig) (*gorm.DB, error) {
+	switch cfg.Driver {
+	case backend.MySQL:
+		return gorm.Open(gormmysql.Open(cfg.DSN))
+	case backend.Postgres:
+		return gorm.Open(gormpostgres.Open(cfg.DSN))
+	case backend.SQLite:
+		return sqlite.Open(cfg.DSN)
+	default:
+		return nil, fmt.Errorf("%w: %s", errs.ErrUnsupportedStorage, cfg.Driver)
+	}
+}
+
+// openBackend 打开存储任务的数据库
+func openBackend(cfg config.StorageConfig) (*backend.Backend, error) {
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return backend.New(cfg.Driver, db)
+}
+
+// usePreempter storage.preempter 为 redis 时连接 Redis，使用 Redis 抢占任务，为空时使用数据库抢占
+func usePreempter(ctx context.Context, b *backend.Backend, cfg config.Config) error {
+	switch cfg.Storage.Preempter {
+	case "", backend.PreempterDB:
+		return nil
+	case backend.PreempterRedis:
+		rc := cfg.Storage.Redis
+		client := redis.NewClient(&redis.Options{Addr: rc.Addr, Password: rc.Password, DB: rc.DB})
+		if err := client.Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("连接 Redis %s 失败: %w", rc.Addr, err)
+		}
+		b.UseRedis(client, rc.Prefix, cfg.Preempter.RedisOptions()...)
+		return nil
+	default:
+		return fmt.Errorf("%w: 不支持的 preempter %s", errs.ErrInCorrectConfig, cfg.Storage.Preempter)
+	}
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/ecodeclub/ecron/internal/web"
+	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func newTaskCommand() *cobra.Command {
+	var addr string
+	cmd := &cobra.Command{
+		Use:   "task",
+		Short: "通过管理接口管理任务",
+	}
+	cmd.PersistentFlags().StringVar(&addr, "server", defaultServerAddr, "调度节点管理接口的地址")
+	client := func() *apiClient {
+		return newAPIClient(addr)
+	}
+	cmd.AddCommand(newTaskAddCommand(client), newTaskListCommand(client),
+		newTaskPauseCommand(client), newTaskResumeCommand(client),
+		newTaskTriggerCommand(client), newTaskRmCommand(client))
+	return cmd
+}
+
+func newTaskAddCommand(client func() *apiClient) *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "add -f task.json",
+		Short: "创建任务，文件的内容和创建任务接口的请求体一致",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				data []byte
+				err  error
+			)
+			if file == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return err
+			}
+			var req web.TaskReq
+			if err = json.Unmarshal(data, &req); err != nil {
+				return fmt.Errorf("解析任务 %s 失败: %w", file, err)
+			}
+			var id int64
+			if err = client().do(cmd.Context(), http.MethodPost, "/tasks", nil, req, &id); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), id)
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "任务的 JSON 文件，- 表示从标准输入读取")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func newTaskListCommand(client func() *apiClient) *cobra.Command {
+	var offset, limit int
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "分页查询任务",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var res web.ListResp[web.TaskVO]
+			if err := client().do(cmd.Context(), http.MethodGet, "/tasks", pageQuery(offset, limit), nil, &res); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tEXECUTOR\tSCHEDULE\tSTATUS\tNEXT")
+			for _, t := range res.List {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+					t.ID, t.Name, t.Executor, schedule(t), t.Status, formatMilli(t.NextExecTime))
+			}
+			fmt.Fprintf(w, "共 %d 个任务\n", res.Total)
+			return w.Flush()
+		},
+	}
+	pageFlags(cmd, &offset, &limit)
+	return cmd
+}
+
+func newTaskPauseCommand(client func() *apiClient) *cobra.Command {
+	var stop bool
+	cmd := &cobra.Command{
+		Use:   "pause <id>",
+		Short: "暂停任务",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			q := url.Values{"stop": []string{strconv.FormatBool(stop)}}
+			return client().do(cmd.Context(), http.MethodPost, taskPath(id, "pause"), q, nil, nil)
+		},
+	}
+	cmd.Flags().BoolVar(&stop, "stop", false, "同时停止正在执行的任务")
+	return cmd
+}
+
+func newTaskResumeCommand(client func() *apiClient) *cobra.Command {
+	var fireOnce bool
+	cmd := &cobra.Command{
+		Use:   "resume <id>",
+		Short: "恢复暂停的任务",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			var q url.Values
+			if fireOnce {
+				q = url.Values{"policy": []string{"fire_once"}}
+			}
+			return client().do(cmd.Context(), http.MethodPost, taskPath(id, "resume"), q, nil, nil)
+		},
+	}
+	cmd.Flags().BoolVar(&fireOnce, "fire-once", false, "暂停期间错过的执行立刻补执行一次，默认跳过")
+	return cmd
+}
+
+func newTaskTriggerCommand(client func() *apiClient) *cobra.Command {
+	var params string
+	cmd := &cobra.Command{
+		Use:   "trigger <id>",
+		Short: "让任务立刻执行一次，不影响原本的调度计划",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			// 没有参数时不发送请求体，使用任务本身的配置
+			var req any
+			if params != "" {
+				if !json.Valid([]byte(params)) {
+					return fmt.Errorf("参数不是合法的 JSON: %s", params)
+				}
+				req = web.TriggerReq{Params: json.RawMessage(params)}
+			}
+			return client().do(cmd.Context(), http.MethodPost, taskPath(id, "trigger"), nil, req, nil)
+		},
+	}
+	cmd.Flags().StringVar(&params, "params", "", "覆盖本次执行的任务配置，必须是 JSON 对象")
+	return cmd
+}
+
+func newTaskRmCommand(client func() *apiClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <id>",
+		Short: "删除任务",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return client().do(cmd.Context(), http.MethodDelete, taskPath(id, ""), nil, nil, nil)
+		},
+	}
+}
+
+func taskPath(id int64, action string) string {
+	p := "/tasks/" + strconv.FormatInt(id, 10)
+	if action != "" {
+		p += "/" + action
+	}
+	return p
+}
+
+func parseID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("任务 id 错误: %s", s)
+	}
+	return id, nil
+}
+
+func pageFlags(cmd *cobra.Command, offset, limit *int) {
+	cmd.Flags().IntVar(offset, "offset", 0, "跳过的记录数")
+	cmd.Flags().IntVar(limit, "limit", 20, "返回的记录数，最多 100")
+}
+
+func pageQuery(offset, limit int) url.Values {
+	return url.Values{
+		"offset": []string{strconv.Itoa(offset)},
+		"limit":  []string{strconv.Itoa(limit)},
+	}
+}
+
+// schedule 调度计划的简短描述
+func schedule(t web.TaskVO) string {
+	st := task.ScheduleType(t.ScheduleType)
+	switch st {
+	case task.ScheduleTypeCron:
+		return t.CronExp
+	case task.ScheduleTypeOnce:
+		return st.String() + " " + formatMilli(t.ExecAt)
+	case task.ScheduleTypeFixedRate, task.ScheduleTypeFixedDelay:
+		return st.String() + " " + (time.Duration(t.Interval) * time.Millisecond).String()
+	default:
+		return st.String()
+	}
+}
+
+func formatMilli(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return time.UnixMilli(ms).Format(time.DateTime)
+}
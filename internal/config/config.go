@@ -0,0 +1,184 @@
+// Package config 从 YAML 或者 TOML 文件中加载调度节点的配置。
+// 时间使用 Go 的格式，例如 "500ms"、"3s"，没有配置的字段使用默认值
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/scheduler"
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	ecronredis "github.com/ecodeclub/ecron/internal/storage/redis"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Scheduler SchedulerConfig `yaml:"scheduler" toml:"scheduler"`
+	Preempter PreempterConfig `yaml:"preempter" toml:"preempter"`
+}
+
+type ServerConfig struct {
+	// 管理接口和 /metrics 的监听地址
+	Addr string `yaml:"addr" toml:"addr"`
+	// 收到退出信号后等待正在执行的任务结束的时间，超时后把任务交给其他调度节点
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type StorageConfig struct {
+	// mysql、postgres 或者 sqlite
+	Driver string `yaml:"driver" toml:"driver"`
+	// 使用 sqlite 时是数据库文件的路径
+	DSN string `yaml:"dsn" toml:"dsn"`
+	// 抢占任务的方式，db 使用存储任务的数据库，redis 使用 Redis
+	Preempter string `yaml:"preempter" toml:"preempter"`
+	// Preempter 为 redis 时使用
+	Redis RedisConfig `yaml:"redis" toml:"redis"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" toml:"addr"`
+	Password string `yaml:"password" toml:"password"`
+	DB       int    `yaml:"db" toml:"db"`
+	// 多个集群共用一个 Redis 时使用不同的前缀，前缀需要包含 hash tag，例如 "{ecron}"
+	Prefix string `yaml:"prefix" toml:"prefix"`
+}
+
+type SchedulerConfig struct {
+	// 同时执行的任务数量上限
+	MaxConcurrency int64 `yaml:"max_concurrency" toml:"max_concurrency"`
+	// 同时执行的分片数量上限
+	ShardLimit int64 `yaml:"shard_limit" toml:"shard_limit"`
+	// 汇总分片执行情况和分片续约的间隔
+	RefreshInterval time.Duration `yaml:"refresh_interval" toml:"refresh_interval"`
+	// 分片租约的有效期，分片超过这个时间没有续约的话可以被其他调度节点接手，需要大于 RefreshInterval。
+	// 默认是 3 个 RefreshInterval
+	ShardLeaseTTL  time.Duration `yaml:"shard_lease_ttl" toml:"shard_lease_ttl"`
+	PreemptTimeout time.Duration `yaml:"preempt_timeout" toml:"preempt_timeout"`
+	OpTimeout      time.Duration `yaml:"op_timeout" toml:"op_timeout"`
+	// 抢占不到任务时的轮询间隔，从 MinBackoff 开始翻倍，最长为 MaxBackoff
+	MinBackoff      time.Duration `yaml:"min_backoff" toml:"min_backoff"`
+	MaxBackoff      time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+	MaxPreemptBatch int           `yaml:"max_preempt_batch" toml:"max_preempt_batch"`
+}
+
+type PreempterConfig struct {
+	// 每次查询的候选任务数量
+	BatchSize int `yaml:"batch_size" toml:"batch_size"`
+	// 租约的有效期，持有者超过这个时间没有续约的话，任务可以被其他调度节点抢占
+	LeaseTTL time.Duration `yaml:"lease_ttl" toml:"lease_ttl"`
+	// 自动续约的间隔，需要小于 LeaseTTL
+	RefreshInterval time.Duration `yaml:"refresh_interval" toml:"refresh_interval"`
+	RefreshTimeout  time.Duration `yaml:"refresh_timeout" toml:"refresh_timeout"`
+	BuffSize        int           `yaml:"buff_size" toml:"buff_size"`
+	MaxRetryTimes   int           `yaml:"max_retry_times" toml:"max_retry_times"`
+	RetrySleepTime  time.Duration `yaml:"retry_sleep_time" toml:"retry_sleep_time"`
+}
+
+// Default 配置文件中没有出现的字段保留这里的值。
+// 其余字段为零值时使用 scheduler 和 Preempter 的默认值
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Storage: StorageConfig{
+			Driver:    "mysql",
+			Preempter: "db",
+		},
+		Scheduler: SchedulerConfig{
+			MaxConcurrency:  100,
+			RefreshInterval: 5 * time.Second,
+		},
+		Preempter: PreempterConfig{
+			BatchSize:       10,
+			LeaseTTL:        15 * time.Second,
+			RefreshInterval: 5 * time.Second,
+		},
+	}
+}
+
+// Load 按照扩展名解析配置文件，支持 .yaml、.yml 和 .toml
+func Load(path string) (Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, &cfg)
+	default:
+		return Config{}, fmt.Errorf("%w: %s", errs.ErrUnsupportedConfigFormat, ext)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Options 配置了 ShardLeaseTTL 但是不大于 RefreshInterval 时返回 errs.ErrInCorrectConfig
+func (c SchedulerConfig) Options() ([]scheduler.Option, error) {
+	var opts []scheduler.Option
+	if c.ShardLeaseTTL > 0 {
+		if c.RefreshInterval <= 0 || c.RefreshInterval >= c.ShardLeaseTTL {
+			return nil, fmt.Errorf("%w: 分片续约间隔 %s 需要大于 0 并且小于分片租约的有效期 %s",
+				errs.ErrInCorrectConfig, c.RefreshInterval, c.ShardLeaseTTL)
+		}
+		opts = append(opts, scheduler.WithShardLeaseTTL(c.ShardLeaseTTL))
+	}
+	if c.ShardLimit > 0 {
+		opts = append(opts, scheduler.WithShardLimit(c.ShardLimit))
+	}
+	if c.PreemptTimeout > 0 {
+		opts = append(opts, scheduler.WithPreemptTimeout(c.PreemptTimeout))
+	}
+	if c.OpTimeout > 0 {
+		opts = append(opts, scheduler.WithOpTimeout(c.OpTimeout))
+	}
+	if c.MinBackoff > 0 && c.MaxBackoff >= c.MinBackoff {
+		opts = append(opts, scheduler.WithBackoff(c.MinBackoff, c.MaxBackoff))
+	}
+	if c.MaxPreemptBatch > 0 {
+		opts = append(opts, scheduler.WithMaxPreemptBatch(c.MaxPreemptBatch))
+	}
+	return opts, nil
+}
+
+// MySQLOptions 用于 MySQL、PostgreSQL 和 SQLite 的 Preempter，LeaseTTL 和 RefreshInterval 直接传给 backend.NewPreempter
+func (c PreempterConfig) MySQLOptions() []mysql.PreempterOption {
+	var opts []mysql.PreempterOption
+	if c.RefreshTimeout > 0 {
+		opts = append(opts, mysql.WithRefreshTimeout(c.RefreshTimeout))
+	}
+	if c.BuffSize > 0 {
+		opts = append(opts, mysql.WithBuffSize(uint8(min(c.BuffSize, 255))))
+	}
+	if c.MaxRetryTimes > 0 {
+		opts = append(opts, mysql.WithMaxRetryTimes(uint8(min(c.MaxRetryTimes, 255))))
+	}
+	if c.RetrySleepTime > 0 {
+		opts = append(opts, mysql.WithRetrySleepTime(c.RetrySleepTime))
+	}
+	return opts
+}
+
+// RedisOptions 用于 Redis 的 Preempter。续约的超时时间是 LeaseTTL 的十分之一，超时后马上重试，
+// 所以不使用 RefreshTimeout 和 RetrySleepTime
+func (c PreempterConfig) RedisOptions() []ecronredis.Option {
+	var opts []ecronredis.Option
+	if c.BuffSize > 0 {
+		opts = append(opts, ecronredis.WithBuffSize(c.BuffSize))
+	}
+	if c.MaxRetryTimes > 0 {
+		opts = append(opts, ecronredis.WithMaxRetryTimes(c.MaxRetryTimes))
+	}
+	return opts
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	want := Config{
+		Server: ServerConfig{
+			Addr:            ":9090",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Storage: StorageConfig{
+			Driver:    "sqlite",
+			DSN:       "ecron.db",
+			Preempter: "redis",
+			Redis: RedisConfig{
+				Addr:   "localhost:6379",
+				Prefix: "{ecron-test}",
+			},
+		},
+		Scheduler: SchedulerConfig{
+			MaxConcurrency:  50,
+			RefreshInterval: 5 * time.Second,
+			ShardLeaseTTL:   20 * time.Second,
+			PreemptTimeout:  time.Second,
+			MinBackoff:      100 * time.Millisecond,
+			MaxBackoff:      5 * time.Second,
+		},
+		Preempter: PreempterConfig{
+			BatchSize:       20,
+			LeaseTTL:        30 * time.Second,
+			RefreshInterval: 10 * time.Second,
+		},
+	}
+	testCases := []struct {
+		name    string
+		path    string
+		wantCfg Config
+		wantErr error
+	}{
+		{
+			name:    "yaml",
+			path:    "testdata/ecron.yaml",
+			wantCfg: want,
+		},
+		{
+			name:    "toml",
+			path:    "testdata/ecron.toml",
+			wantCfg: want,
+		},
+		{
+			name:    "不支持的格式",
+			path:    writeFile(t, "ecron.json", "{}"),
+			wantErr: errs.ErrUnsupportedConfigFormat,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := Load(tc.path)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantCfg, cfg)
+			opts, err := cfg.Scheduler.Options()
+			require.NoError(t, err)
+			assert.Len(t, opts, 3)
+			assert.Empty(t, cfg.Preempter.MySQLOptions())
+			assert.Empty(t, cfg.Preempter.RedisOptions())
+		})
+	}
+}
+
+func TestSchedulerConfig_Options(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cfg      SchedulerConfig
+		wantOpts int
+		wantErr  error
+	}{
+		{
+			name:     "使用默认的分片租约",
+			cfg:      SchedulerConfig{RefreshInterval: 5 * time.Second},
+			wantOpts: 0,
+		},
+		{
+			name:     "分片续约间隔小于租约的有效期",
+			cfg:      SchedulerConfig{RefreshInterval: 5 * time.Second, ShardLeaseTTL: 6 * time.Second},
+			wantOpts: 1,
+		},
+		{
+			name:    "分片续约间隔等于租约的有效期",
+			cfg:     SchedulerConfig{RefreshInterval: 5 * time.Second, ShardLeaseTTL: 5 * time.Second},
+			wantErr: errs.ErrInCorrectConfig,
+		},
+		{
+			name:    "分片续约间隔为 0",
+			cfg:     SchedulerConfig{ShardLeaseTTL: 5 * time.Second},
+			wantErr: errs.ErrInCorrectConfig,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tc.cfg.Options()
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Len(t, opts, tc.wantOpts)
+		})
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
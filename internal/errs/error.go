@@ -8,9 +8,38 @@ var (
 	ErrRequestFailed     = errors.New("发起任务请求失败")
 	ErrRequestTimeout    = errors.New("发起任务请求超时")
 	ErrUnknownTask       = errors.New("未知的任务类型")
+	ErrUnknownExecutor   = errors.New("未知的执行器")
+	ErrInvalidSchedule   = errors.New("任务调度配置错误")
 
 	ErrNoExecutableTask      = errors.New("当前没有可执行的任务")
 	ErrTaskNotSupportExplore = errors.New("不支持任务探查")
 	ErrStopTaskFailed        = errors.New("停止任务失败")
 	ErrExecutionNotFound     = errors.New("未找到任务执行记录")
+	ErrTaskNotFound          = errors.New("未找到任务")
+	ErrInvalidTaskStatus     = errors.New("任务当前的状态不允许该操作")
+	ErrTaskPaused            = errors.New("任务已暂停")
+
+	ErrInvalidWorkflow     = errors.New("工作流配置错误")
+	ErrWorkflowNotFound    = errors.New("未找到工作流")
+	ErrWorkflowRunNotFound = errors.New("未找到工作流的运行记录")
+	// ErrConcurrentUpdate 乐观锁更新失败，数据已经被其他调度节点修改
+	ErrConcurrentUpdate = errors.New("数据已经被修改")
+	// ErrStaleFencingToken 任务已经被其他调度节点重新抢占，持有过期租约的调度节点不能再写入执行记录
+	ErrStaleFencingToken = errors.New("任务租约已经过期")
+	// ErrShardReclaimed 分片续约失败，已经被其他调度节点接手或者已经结束
+	ErrShardReclaimed = errors.New("分片已经被其他调度节点接手")
+	// ErrSchedulerShutdown 调度节点关闭时还没有执行完的任务交给其他调度节点继续探查
+	ErrSchedulerShutdown = errors.New("调度节点已经关闭")
+
+	ErrUnsupportedConfigFormat = errors.New("不支持的配置文件格式")
+	ErrUnsupportedStorage      = errors.New("不支持的存储类型")
+
+	ErrInvalidMigration = errors.New("迁移脚本错误")
+	// ErrDirtySchema 不支持事务 DDL 的数据库迁移到一半失败了，需要手动修复
+	ErrDirtySchema = errors.New("数据库表结构迁移失败，需要手动修复")
+	// ErrSchemaVersionMismatch 数据库表结构的版本和程序内嵌的迁移脚本不一致
+	ErrSchemaVersionMismatch = errors.New("数据库表结构的版本和程序不一致")
+	ErrMigrationLocked       = errors.New("其他节点正在执行迁移")
+
+	ErrAlreadyStarted = errors.New("调度器已经启动")
 )
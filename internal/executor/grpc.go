@@ -2,17 +2,48 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	executorv1 "github.com/ecodeclub/ecron/api/proto/gen/executor/v1"
+	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/ecodeclub/ecron/internal/task"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 )
 
 var _ Executor = (*GrpcExecutor)(nil)
 
 type GrpcExecutor struct {
+	logger *slog.Logger
+	// 任务探查最大失败次数
+	maxFailCount int
+	dialOpts     []grpc.DialOption
+
+	mu sync.Mutex
+	// 同一个业务方的所有任务共用一个连接
+	conns map[string]*grpc.ClientConn
 }
 
-func NewGrpcExecutor() Executor {
-	return &GrpcExecutor{}
+// NewGrpcExecutor 创建 gRPC 执行器。如果没有传入 opts，默认使用不加密的连接。
+func NewGrpcExecutor(logger *slog.Logger, maxFailCount int, opts ...grpc.DialOption) *GrpcExecutor {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &GrpcExecutor{
+		logger:       logger,
+		maxFailCount: maxFailCount,
+		dialOpts:     opts,
+		conns:        make(map[string]*grpc.ClientConn),
+	}
 }
 
 func (g *GrpcExecutor) Name() string {
@@ -20,27 +51,315 @@ func (g *GrpcExecutor) Name() string {
 }
 
 func (g *GrpcExecutor) Run(ctx context.Context, t task.Task, eid int64) (task.ExecStatus, error) {
-	//TODO implement me
-	panic("implement me")
+	cfg, err := g.parseCfg(t.Cfg)
+	if err != nil {
+		g.logger.Error("任务配置信息错误",
+			slog.Int64("ID", t.ID), slog.String("Cfg", t.Cfg))
+		return task.ExecStatusFailed, errs.ErrInCorrectConfig
+	}
+	client, err := g.client(cfg)
+	if err != nil {
+		g.logger.Error("连接业务方失败", slog.Int64("task_id", t.ID),
+			slog.String("target", cfg.target()), slog.Any("error", err))
+		return task.ExecStatusFailed, errs.ErrRequestFailed
+	}
+
+	resp, err := client.Run(g.withFencingToken(g.withShard(g.withEid(ctx, eid), t.Shard), t.FencingToken), &executorv1.RunRequest{
+		Name: cfg.Method,
+		Body: cfg.Body,
+	})
+	if err != nil {
+		g.logger.Error("发起任务请求失败", slog.Int64("task_id", t.ID),
+			slog.Int64("execution_id", eid), slog.Any("error", err))
+		switch status.Code(err) {
+		case codes.DeadlineExceeded:
+			return task.ExecStatusDeadlineExceeded, errs.ErrRequestTimeout
+		case codes.Canceled:
+			return task.ExecStatusCancelled, context.Canceled
+		default:
+			return task.ExecStatusFailed, errs.ErrRequestFailed
+		}
+	}
+
+	switch resp.GetStatus() {
+	case executorv1.ExecutionStatus_EXECUTION_STATUS_SUCCESS:
+		return task.ExecStatusSuccess, nil
+	case executorv1.ExecutionStatus_EXECUTION_STATUS_RUNNING:
+		return task.ExecStatusRunning, nil
+	default:
+		return task.ExecStatusFailed, nil
+	}
 }
 
 func (g *GrpcExecutor) Explore(ctx context.Context, eid int64, t task.Task) <-chan Result {
-	//TODO implement me
-	panic("implement me")
+	resultChan := make(chan Result, 1)
+	go g.explore(ctx, resultChan, t, eid)
+	return resultChan
+}
+
+// explore 通过 Watch 订阅业务方推送的进度。stream 因为网络等原因断开时会重新订阅，
+// 连续失败 maxFailCount 次后认为任务执行失败。
+// 如果业务方没有实现 Watch，则退化为按照 ExploreInterval 轮询 Explore。
+func (g *GrpcExecutor) explore(ctx context.Context, ch chan Result, t task.Task, eid int64) {
+	defer close(ch)
+
+	failCount := 0
+	cfg, _ := g.parseCfg(t.Cfg)
+	interval := g.exploreInterval(cfg)
+
+	for failCount < g.maxFailCount {
+		received, finished, err := g.watch(ctx, ch, cfg, eid)
+		if finished || ctx.Err() != nil {
+			return
+		}
+		if status.Code(err) == codes.Unimplemented {
+			g.poll(ctx, ch, cfg, eid)
+			return
+		}
+		if received {
+			failCount = 0
+		}
+		if !g.isTransient(err) {
+			break
+		}
+		failCount++
+		g.logger.Warn("订阅任务执行进度中断，准备重连", slog.Int64("execution_id", eid),
+			slog.Int("fail_count", failCount), slog.Any("error", err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+	g.exploreFailed(ch, eid)
+}
+
+// watch 订阅一次任务进度，直到 stream 结束。
+// received 表示本次订阅是否收到过结果，finished 表示是否已经收到任务的最终结果。
+func (g *GrpcExecutor) watch(ctx context.Context, ch chan Result, cfg GrpcCfg, eid int64) (received, finished bool, err error) {
+	client, err := g.client(cfg)
+	if err != nil {
+		return false, false, err
+	}
+	nctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(g.withEid(nctx, eid), &executorv1.ExploreRequest{Name: cfg.Method})
+	if err != nil {
+		return false, false, err
+	}
+	for {
+		resp, er := stream.Recv()
+		if er != nil {
+			// 业务方在没有推送最终结果前就关闭了 stream，当作一次失败重新订阅
+			if errors.Is(er, io.EOF) {
+				er = status.Error(codes.Unavailable, "stream closed before final result")
+			}
+			return received, false, er
+		}
+		received = true
+		result := Result{
+			Eid:      eid,
+			Status:   g.from(resp.GetStatus()),
+			Progress: int(resp.GetProgress()),
+		}
+		select {
+		case <-ctx.Done():
+			return received, false, ctx.Err()
+		case ch <- result:
+		}
+		if result.Status != StatusRunning {
+			return received, true, nil
+		}
+	}
+}
+
+// poll 兼容没有实现 Watch 的业务方，定时调用 Explore 查询进度
+func (g *GrpcExecutor) poll(ctx context.Context, ch chan Result, cfg GrpcCfg, eid int64) {
+	failCount := 0
+	ticker := time.NewTicker(g.exploreInterval(cfg))
+	defer ticker.Stop()
+
+	for failCount < g.maxFailCount {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := g.exploreOnce(ctx, cfg, eid)
+			if err != nil {
+				failCount++
+				continue
+			}
+
+			failCount = 0
+			ch <- result
+			if result.Status != StatusRunning {
+				return
+			}
+		}
+	}
+	g.exploreFailed(ch, eid)
+}
+
+// exploreFailed failCount >= g.maxFailCount，任务执行失败
+func (g *GrpcExecutor) exploreFailed(ch chan Result, eid int64) {
+	g.logger.Error("探查任务执行进度失败，达到最大错误次数", slog.Int64("execution_id", eid))
+	ch <- Result{
+		Eid:    eid,
+		Status: StatusFailed,
+	}
+}
+
+// isTransient 判断错误是否可以通过重新订阅恢复
+func (g *GrpcExecutor) isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted,
+		codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *GrpcExecutor) exploreInterval(cfg GrpcCfg) time.Duration {
+	if cfg.ExploreInterval <= 0 {
+		return time.Second
+	}
+	return cfg.ExploreInterval
+}
+
+func (g *GrpcExecutor) exploreOnce(ctx context.Context, cfg GrpcCfg, eid int64) (Result, error) {
+	client, err := g.client(cfg)
+	if err != nil {
+		return Result{}, err
+	}
+	resp, err := client.Explore(g.withEid(ctx, eid), &executorv1.ExploreRequest{Name: cfg.Method})
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Eid:      eid,
+		Status:   g.from(resp.GetStatus()),
+		Progress: int(resp.GetProgress()),
+	}, nil
 }
 
 func (g *GrpcExecutor) TaskTimeout(t task.Task) time.Duration {
-	//TODO implement me
-	panic("implement me")
+	result, err := g.parseCfg(t.Cfg)
+	if err != nil || result.TaskTimeout < 0 {
+		return time.Minute
+	}
+	return result.TaskTimeout
 }
 
 func (g *GrpcExecutor) Stop(ctx context.Context, t task.Task, eid int64) error {
-	//TODO implement me
-	panic("implement me")
+	cfg, err := g.parseCfg(t.Cfg)
+	if err != nil {
+		return err
+	}
+	client, err := g.client(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = client.Stop(g.withEid(ctx, eid), &executorv1.StopRequest{Name: cfg.Method})
+	if err != nil {
+		g.logger.Error("停止任务失败", slog.Int64("task_id", t.ID),
+			slog.Int64("execution_id", eid), slog.Any("error", err))
+		return errs.ErrStopTaskFailed
+	}
+	return nil
+}
+
+// Close 关闭所有的连接
+func (g *GrpcExecutor) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var err error
+	for target, conn := range g.conns {
+		if er := conn.Close(); er != nil {
+			err = er
+		}
+		delete(g.conns, target)
+	}
+	return err
+}
+
+func (g *GrpcExecutor) client(cfg GrpcCfg) (executorv1.ExecutorServiceClient, error) {
+	target := cfg.target()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	conn, ok := g.conns[target]
+	if !ok {
+		var err error
+		conn, err = grpc.NewClient(target, g.dialOpts...)
+		if err != nil {
+			return nil, err
+		}
+		g.conns[target] = conn
+	}
+	return executorv1.NewExecutorServiceClient(conn), nil
+}
+
+func (g *GrpcExecutor) withEid(ctx context.Context, eid int64) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "execution_id", strconv.FormatInt(eid, 10))
+}
+
+// withShard 分片执行时在 metadata 中带上分片的序号和分片总数
+func (g *GrpcExecutor) withShard(ctx context.Context, s task.Shard) context.Context {
+	if s.Total == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx,
+		"shard_index", strconv.Itoa(s.Index), "shard_total", strconv.Itoa(s.Total))
+}
+
+// withFencingToken 在 metadata 中带上租约的 fencing token，业务方可以拒绝 token 更小的请求
+func (g *GrpcExecutor) withFencingToken(ctx context.Context, token int64) context.Context {
+	if token == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "fencing_token", strconv.FormatInt(token, 10))
+}
+
+func (g *GrpcExecutor) from(s executorv1.ExecutionStatus) Status {
+	switch s {
+	case executorv1.ExecutionStatus_EXECUTION_STATUS_SUCCESS:
+		return StatusSuccess
+	case executorv1.ExecutionStatus_EXECUTION_STATUS_RUNNING:
+		return StatusRunning
+	default:
+		return StatusFailed
+	}
+}
+
+func (g *GrpcExecutor) Validate(t task.Task) error {
+	cfg, err := g.parseCfg(t.Cfg)
+	if err != nil || cfg.ServiceName == "" || cfg.Method == "" || cfg.Port <= 0 {
+		return errs.ErrInCorrectConfig
+	}
+	return nil
+}
+
+func (g *GrpcExecutor) parseCfg(cfg string) (GrpcCfg, error) {
+	var result GrpcCfg
+	err := json.Unmarshal([]byte(cfg), &result)
+	return result, err
 }
 
 type GrpcCfg struct {
+	// 业务方的服务地址，可以是域名，也可以是 IP
 	ServiceName string `json:"service_name"`
-	Method      string `json:"method"`
-	Port        int    `json:"port"`
+	// 业务方注册的任务名称
+	Method string `json:"method"`
+	Port   int    `json:"port"`
+	// 任务参数，原样传递给业务方
+	Body string `json:"body"`
+	// 预计任务执行时长
+	TaskTimeout time.Duration `json:"task_timeout"`
+	// 任务探查间隔。
+	// 订阅进度的 stream 断开后，会等待这么长时间再重新订阅；业务方不支持订阅时，按照这个间隔轮询
+	ExploreInterval time.Duration `json:"explore_interval"`
+}
+
+func (c GrpcCfg) target() string {
+	return fmt.Sprintf("%s:%d", c.ServiceName, c.Port)
 }
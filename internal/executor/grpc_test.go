@@ -0,0 +1,276 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	executorv1 "github.com/ecodeclub/ecron/api/proto/gen/executor/v1"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGrpcExecutor_Run(t *testing.T) {
+	port := startGrpcServer(t)
+	testCases := []struct {
+		name           string
+		inTask         task.Task
+		wantErr        error
+		wantTaskStatus task.ExecStatus
+	}{
+		{
+			name: "任务配置格式错误",
+			inTask: task.Task{
+				ID:  1,
+				Cfg: `{dfasfdfads`,
+			},
+			wantErr:        errs.ErrInCorrectConfig,
+			wantTaskStatus: task.ExecStatusFailed,
+		},
+		{
+			name: "业务方返回任务执行成功",
+			inTask: task.Task{
+				ID:  2,
+				Cfg: marshalGrpc(t, port, "success"),
+			},
+			wantTaskStatus: task.ExecStatusSuccess,
+		},
+		{
+			name: "业务方返回任务执行失败",
+			inTask: task.Task{
+				ID:  3,
+				Cfg: marshalGrpc(t, port, "failed"),
+			},
+			wantTaskStatus: task.ExecStatusFailed,
+		},
+		{
+			name: "业务方返回任务执行中",
+			inTask: task.Task{
+				ID:  4,
+				Cfg: marshalGrpc(t, port, "running"),
+			},
+			wantTaskStatus: task.ExecStatusRunning,
+		},
+		{
+			name: "业务方返回错误",
+			inTask: task.Task{
+				ID:  5,
+				Cfg: marshalGrpc(t, port, "error"),
+			},
+			wantErr:        errs.ErrRequestFailed,
+			wantTaskStatus: task.ExecStatusFailed,
+		},
+		{
+			name: "调用超时",
+			inTask: task.Task{
+				ID:  6,
+				Cfg: marshalGrpc(t, port, "timeout"),
+			},
+			wantErr:        errs.ErrRequestTimeout,
+			wantTaskStatus: task.ExecStatusDeadlineExceeded,
+		},
+	}
+	exec := newGrpcExecutor()
+	defer exec.Close()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			status, err := exec.Run(ctx, tc.inTask, 1)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantTaskStatus, status)
+		})
+	}
+}
+
+func TestGrpcExecutor_Explore(t *testing.T) {
+	port := startGrpcServer(t)
+	testCases := []struct {
+		name         string
+		maxFailCount int
+		inTask       task.Task
+		wantResults  []Result
+	}{
+		{
+			name:         "订阅进度，任务执行成功",
+			maxFailCount: 1,
+			inTask: task.Task{
+				ID:  1,
+				Cfg: marshalGrpc(t, port, "success"),
+			},
+			wantResults: []Result{
+				{Eid: 1, Status: StatusRunning, Progress: 50},
+				{Eid: 1, Status: StatusSuccess, Progress: 100},
+			},
+		},
+		{
+			name:         "订阅进度，任务执行失败",
+			maxFailCount: 1,
+			inTask: task.Task{
+				ID:  2,
+				Cfg: marshalGrpc(t, port, "failed"),
+			},
+			wantResults: []Result{
+				{Eid: 1, Status: StatusFailed},
+			},
+		},
+		{
+			name:         "stream中断后重新订阅",
+			maxFailCount: 2,
+			inTask: task.Task{
+				ID:  3,
+				Cfg: marshalGrpc(t, port, "broken"),
+			},
+			wantResults: []Result{
+				{Eid: 1, Status: StatusRunning, Progress: 50},
+				{Eid: 1, Status: StatusSuccess, Progress: 100},
+			},
+		},
+		{
+			name:         "业务方返回错误，达到最大次数",
+			maxFailCount: 2,
+			inTask: task.Task{
+				ID:  4,
+				Cfg: marshalGrpc(t, port, "error"),
+			},
+			wantResults: []Result{
+				{Eid: 1, Status: StatusFailed},
+			},
+		},
+		{
+			name:         "业务方不支持订阅，退化为轮询",
+			maxFailCount: 1,
+			inTask: task.Task{
+				ID:  5,
+				Cfg: marshalGrpc(t, port, "legacy"),
+			},
+			wantResults: []Result{
+				{Eid: 1, Status: StatusSuccess, Progress: 100},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exec := newGrpcExecutor()
+			defer exec.Close()
+			exec.maxFailCount = tc.maxFailCount
+			ch := exec.Explore(context.Background(), 1, tc.inTask)
+			var results []Result
+			for result := range ch {
+				results = append(results, result)
+			}
+			assert.Equal(t, tc.wantResults, results)
+		})
+	}
+}
+
+func TestGrpcExecutor_Stop(t *testing.T) {
+	port := startGrpcServer(t)
+	exec := newGrpcExecutor()
+	defer exec.Close()
+
+	err := exec.Stop(context.Background(), task.Task{Cfg: marshalGrpc(t, port, "success")}, 1)
+	assert.NoError(t, err)
+	err = exec.Stop(context.Background(), task.Task{Cfg: marshalGrpc(t, port, "error")}, 1)
+	assert.Equal(t, errs.ErrStopTaskFailed, err)
+}
+
+func marshalGrpc(t *testing.T, port int, method string) string {
+	res, err := json.Marshal(GrpcCfg{
+		ServiceName:     "127.0.0.1",
+		Port:            port,
+		Method:          method,
+		TaskTimeout:     time.Second,
+		ExploreInterval: time.Millisecond * 10,
+	})
+	require.NoError(t, err)
+	return string(res)
+}
+
+func newGrpcExecutor() *GrpcExecutor {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return NewGrpcExecutor(logger, 5)
+}
+
+// startGrpcServer 启动一个模拟业务方的 gRPC 服务，返回监听的端口
+func startGrpcServer(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	executorv1.RegisterExecutorServiceServer(server, &mockExecutorServer{})
+	go func() {
+		_ = server.Serve(l)
+	}()
+	t.Cleanup(server.Stop)
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// mockExecutorServer 根据任务名称返回不同的结果
+type mockExecutorServer struct {
+	executorv1.UnimplementedExecutorServiceServer
+	// 记录 broken 任务被订阅的次数
+	brokenCnt atomic.Int32
+}
+
+func (m *mockExecutorServer) Watch(req *executorv1.ExploreRequest, stream executorv1.ExecutorService_WatchServer) error {
+	running := &executorv1.ExecutionResult{Eid: 1, Status: executorv1.ExecutionStatus_EXECUTION_STATUS_RUNNING, Progress: 50}
+	switch req.GetName() {
+	case "legacy":
+		return status.Error(codes.Unimplemented, "method Watch not implemented")
+	case "broken":
+		if m.brokenCnt.Add(1) == 1 {
+			_ = stream.Send(running)
+			return status.Error(codes.Unavailable, "mock broken stream")
+		}
+	case "success":
+		_ = stream.Send(running)
+	}
+	res, err := m.result(stream.Context(), req.GetName())
+	if err != nil {
+		return err
+	}
+	return stream.Send(res)
+}
+
+func (m *mockExecutorServer) Run(ctx context.Context, req *executorv1.RunRequest) (*executorv1.ExecutionResult, error) {
+	return m.result(ctx, req.GetName())
+}
+
+func (m *mockExecutorServer) Explore(ctx context.Context, req *executorv1.ExploreRequest) (*executorv1.ExecutionResult, error) {
+	return m.result(ctx, req.GetName())
+}
+
+func (m *mockExecutorServer) Stop(ctx context.Context, req *executorv1.StopRequest) (*executorv1.StopResponse, error) {
+	_, err := m.result(ctx, req.GetName())
+	return &executorv1.StopResponse{}, err
+}
+
+func (m *mockExecutorServer) result(ctx context.Context, name string) (*executorv1.ExecutionResult, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("execution_id")) == 0 || md.Get("execution_id")[0] != "1" {
+		return nil, status.Error(codes.InvalidArgument, "miss metadata: execution_id")
+	}
+	switch name {
+	case "success", "broken", "legacy":
+		return &executorv1.ExecutionResult{Eid: 1, Status: executorv1.ExecutionStatus_EXECUTION_STATUS_SUCCESS, Progress: 100}, nil
+	case "failed":
+		return &executorv1.ExecutionResult{Eid: 1, Status: executorv1.ExecutionStatus_EXECUTION_STATUS_FAILED}, nil
+	case "running":
+		return &executorv1.ExecutionResult{Eid: 1, Status: executorv1.ExecutionStatus_EXECUTION_STATUS_RUNNING, Progress: 10}, nil
+	case "timeout":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	default:
+		return nil, status.Error(codes.Internal, "mock error")
+	}
+}
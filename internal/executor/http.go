@@ -7,24 +7,63 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/metrics"
 	"github.com/ecodeclub/ecron/internal/task"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 )
 
 var _ Executor = (*HttpExecutor)(nil)
 
+const tracerName = "github.com/ecodeclub/ecron/internal/executor"
+
 type HttpExecutor struct {
 	logger *slog.Logger
 	client *http.Client
 	// 任务探查最大失败次数
 	maxFailCount int
+	metrics      *metrics.Metrics
+	tracer       trace.Tracer
+	// 通过请求头传递链路信息，业务方可以在同一个链路中继续记录
+	propagator propagation.TextMapPropagator
+}
+
+type HttpOption func(h *HttpExecutor)
+
+// WithHttpMetrics 记录调用业务方的耗时
+func WithHttpMetrics(m *metrics.Metrics) HttpOption {
+	return func(h *HttpExecutor) {
+		h.metrics = m
+	}
 }
 
-func NewHttpExecutor(logger *slog.Logger, client *http.Client, maxFailCount int) *HttpExecutor {
-	return &HttpExecutor{logger: logger, client: client, maxFailCount: maxFailCount}
+// WithHttpTracerProvider 默认使用 otel 全局的 TracerProvider
+func WithHttpTracerProvider(tp trace.TracerProvider) HttpOption {
+	return func(h *HttpExecutor) {
+		h.tracer = tp.Tracer(tracerName)
+	}
+}
+
+func NewHttpExecutor(logger *slog.Logger, client *http.Client, maxFailCount int, opts ...HttpOption) *HttpExecutor {
+	h := &HttpExecutor{
+		logger:       logger,
+		client:       client,
+		maxFailCount: maxFailCount,
+		tracer:       otel.GetTracerProvider().Tracer(tracerName),
+		propagator:   propagation.TraceContext{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *HttpExecutor) Name() string {
@@ -38,6 +77,21 @@ func (h *HttpExecutor) Run(ctx context.Context, t task.Task, eid int64) (task.Ex
 			slog.Int64("ID", t.ID), slog.String("Cfg", t.Cfg))
 		return task.ExecStatusFailed, errs.ErrInCorrectConfig
 	}
+	if t.Shard.Total > 0 {
+		// 分片执行时告诉业务方当前执行的是哪一个分片
+		if cfg.Header == nil {
+			cfg.Header = make(http.Header)
+		}
+		cfg.Header.Set("shard_index", strconv.Itoa(t.Shard.Index))
+		cfg.Header.Set("shard_total", strconv.Itoa(t.Shard.Total))
+	}
+	if t.FencingToken > 0 {
+		// 业务方可以拒绝 token 更小的请求，避免持有过期租约的调度节点重复执行
+		if cfg.Header == nil {
+			cfg.Header = make(http.Header)
+		}
+		cfg.Header.Set("fencing_token", strconv.FormatInt(t.FencingToken, 10))
+	}
 
 	result, err := h.request(ctx, http.MethodPost, cfg, eid)
 	if err != nil {
@@ -113,6 +167,14 @@ func (h *HttpExecutor) TaskTimeout(t task.Task) time.Duration {
 	return result.TaskTimeout
 }
 
+func (h *HttpExecutor) Validate(t task.Task) error {
+	cfg, err := h.parseCfg(t.Cfg)
+	if err != nil || cfg.Url == "" {
+		return errs.ErrInCorrectConfig
+	}
+	return nil
+}
+
 func (h *HttpExecutor) parseCfg(cfg string) (HttpCfg, error) {
 	var result HttpCfg
 	err := json.Unmarshal([]byte(cfg), &result)
@@ -134,7 +196,21 @@ func (h *HttpExecutor) Stop(ctx context.Context, t task.Task, eid int64) error {
 	return nil
 }
 
-func (h *HttpExecutor) request(ctx context.Context, method string, cfg HttpCfg, eid int64) (Result, error) {
+func (h *HttpExecutor) request(ctx context.Context, method string, cfg HttpCfg, eid int64) (res Result, err error) {
+	ctx, span := h.tracer.Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.full", cfg.Url),
+			attribute.Int64("ecron.execution.id", eid),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	request, err := http.NewRequestWithContext(ctx, method, cfg.Url, bytes.NewBuffer([]byte(cfg.Body)))
 	if err != nil {
 		return Result{}, err
@@ -147,8 +223,16 @@ func (h *HttpExecutor) request(ctx context.Context, method string, cfg HttpCfg,
 	}
 	request.Header.Add("execution_id", fmt.Sprintf("%v", eid))
 	request.Header.Add("Content-Type", "application/json")
+	h.propagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
 
+	start := time.Now()
 	resp, err := h.client.Do(request)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	h.metrics.ObserveHTTPRequest(method, code, time.Since(start))
 
 	if os.IsTimeout(err) {
 		return Result{}, errs.ErrRequestTimeout
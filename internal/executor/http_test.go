@@ -9,6 +9,8 @@ import (
 	"github.com/h2non/gock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"log/slog"
 	"net/http"
 	"os"
@@ -137,6 +139,52 @@ func TestHttpExecutor_Run(t *testing.T) {
 	}
 }
 
+func TestHttpExecutor_RunShard(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost:8080").Post("/test_run").
+		MatchHeader("execution_id", "1").
+		MatchHeader("shard_index", "1").
+		MatchHeader("shard_total", "3").
+		MatchHeader("fencing_token", "5").
+		Reply(http.StatusOK).JSON(`{"eid":1,"status":"SUCCESS","progress":100}`)
+
+	exec := newHttpExecutor()
+	status, err := exec.Run(context.Background(), task.Task{
+		ID: 1,
+		Cfg: marshal(t, HttpCfg{
+			Url: "http://localhost:8080/test_run",
+		}),
+		Shard:        task.Shard{Index: 1, Total: 3},
+		FencingToken: 5,
+	}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, task.ExecStatusSuccess, status)
+}
+
+func TestHttpExecutor_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "ecron.run")
+	defer gock.Off()
+	// 业务方通过 W3C 的 traceparent 请求头继续同一个链路
+	gock.New("http://localhost:8080").Post("/test_run").
+		MatchHeader("traceparent", "^00-"+parent.SpanContext().TraceID().String()+"-[0-9a-f]{16}-01$").
+		Reply(http.StatusOK).JSON(`{"eid":1,"status":"SUCCESS","progress":100}`)
+
+	exec := newHttpExecutor()
+	WithHttpTracerProvider(tp)(exec)
+	status, err := exec.Run(ctx, task.Task{
+		ID:  1,
+		Cfg: marshal(t, HttpCfg{Url: "http://localhost:8080/test_run"}),
+	}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, task.ExecStatusSuccess, status)
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "HTTP POST", spans[0].Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+}
+
 func marshal(t *testing.T, cfg HttpCfg) string {
 	res, err := json.Marshal(cfg)
 	require.NoError(t, err)
@@ -291,6 +339,35 @@ func TestHttpExecutor_Explore(t *testing.T) {
 	}
 }
 
+func TestHttpExecutor_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     string
+		wantErr error
+	}{
+		{
+			name:    "任务配置格式错误",
+			cfg:     `{dfasfdfads`,
+			wantErr: errs.ErrInCorrectConfig,
+		},
+		{
+			name:    "缺少url",
+			cfg:     `{"body":"{}"}`,
+			wantErr: errs.ErrInCorrectConfig,
+		},
+		{
+			name: "合法的配置",
+			cfg:  `{"url":"http://localhost:8080/test"}`,
+		},
+	}
+	exec := newHttpExecutor()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantErr, exec.Validate(task.Task{Cfg: tc.cfg}))
+		})
+	}
+}
+
 func newHttpExecutor() *HttpExecutor {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	client := &http.Client{
@@ -7,28 +7,40 @@ import (
 	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/ecodeclub/ecron/internal/task"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var _ Executor = (*LocalExecutor)(nil)
 
+// LocalFunc 本地任务的执行方法，ctx 结束时应该尽快返回，返回 error 表示执行失败
+type LocalFunc func(ctx context.Context, e *LocalExecution) error
+
 type LocalExecutor struct {
 	logger *slog.Logger
-	fn     map[string]func(ctx context.Context, t task.Task) error
+	fn     map[string]LocalFunc
+	// 本节点正在执行的任务，key 是 eid，value 是 *LocalExecution
+	running sync.Map
 }
 
+// Stop 取消 eid 对应的执行，执行已经结束或者不在本节点时什么都不做
 func (l *LocalExecutor) Stop(ctx context.Context, t task.Task, eid int64) error {
+	if e, ok := l.running.LoadAndDelete(eid); ok {
+		e.(*LocalExecution).cancel(nil)
+	}
 	return nil
 }
 
 func NewLocalExecutor(logger *slog.Logger) *LocalExecutor {
 	return &LocalExecutor{
 		logger: logger,
-		fn:     make(map[string]func(ctx context.Context, t task.Task) error),
+		fn:     make(map[string]LocalFunc),
 	}
 }
 
-func (l *LocalExecutor) RegisterFunc(name string, fn func(ctx context.Context, t task.Task) error) {
+// RegisterFunc 注册名称为 name 的任务的执行方法
+func (l *LocalExecutor) RegisterFunc(name string, fn LocalFunc) {
 	l.fn[name] = fn
 }
 
@@ -36,6 +48,7 @@ func (l *LocalExecutor) Name() string {
 	return "LOCAL"
 }
 
+// Run 在新的 goroutine 中执行任务，立刻返回 task.ExecStatusRunning，执行进度和结果通过 Explore 获取
 func (l *LocalExecutor) Run(ctx context.Context, t task.Task, eid int64) (task.ExecStatus, error) {
 	fn, ok := l.fn[t.Name]
 	if !ok {
@@ -44,22 +57,56 @@ func (l *LocalExecutor) Run(ctx context.Context, t task.Task, eid int64) (task.E
 			slog.String("Name", t.Name))
 		return task.ExecStatusFailed, errs.ErrUnknownTask
 	}
-	err := fn(ctx, t)
-	switch {
-	case err == nil:
-		return task.ExecStatusSuccess, nil
-	case errors.Is(err, context.Canceled):
-		return task.ExecStatusCancelled, nil
-	case errors.Is(err, context.DeadlineExceeded):
-		return task.ExecStatusDeadlineExceeded, nil
-	default:
-		return task.ExecStatusFailed, err
-	}
+	e := newLocalExecution(ctx, t, eid, l.logger)
+	l.running.Store(eid, e)
+	go func() {
+		defer close(e.done)
+		e.err = fn(e.ctx, e)
+		if e.ctx.Err() != nil {
+			// 被取消的执行由调度器记录结果，不需要再探查
+			l.running.Delete(eid)
+		}
+	}()
+	return task.ExecStatusRunning, nil
 }
 
+// Explore 把执行方法上报的进度发送到返回的 channel 中，执行结束后发送最终的结果。
+// 执行不在本节点或者已经结束时返回 nil，例如调度节点重启后
 func (l *LocalExecutor) Explore(ctx context.Context, eid int64, t task.Task) <-chan Result {
-	// 在我们的默认实现中，本地任务不支持任务探查，需要的用户可以自己实现
-	return nil
+	v, ok := l.running.Load(eid)
+	if !ok {
+		return nil
+	}
+	ch := make(chan Result, 1)
+	go l.explore(ctx, ch, v.(*LocalExecution))
+	return ch
+}
+
+func (l *LocalExecutor) explore(ctx context.Context, ch chan<- Result, e *LocalExecution) {
+	defer close(ch)
+	for {
+		var res Result
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.reported:
+			res = Result{Eid: e.eid, Status: StatusRunning, Progress: e.Progress()}
+		case <-e.done:
+			if e.ctx.Err() != nil {
+				return
+			}
+			l.running.Delete(e.eid)
+			res = e.result()
+		}
+		select {
+		case ch <- res:
+		case <-ctx.Done():
+			return
+		}
+		if res.Status != StatusRunning {
+			return
+		}
+	}
 }
 
 func (l *LocalExecutor) TaskTimeout(t task.Task) time.Duration {
@@ -71,8 +118,118 @@ func (l *LocalExecutor) TaskTimeout(t task.Task) time.Duration {
 	return result.TaskTimeout
 }
 
+func (l *LocalExecutor) Validate(t task.Task) error {
+	if _, ok := l.fn[t.Name]; !ok {
+		return errs.ErrUnknownTask
+	}
+	// 本地任务可以不配置
+	if t.Cfg == "" {
+		return nil
+	}
+	var result LocalCfg
+	if err := json.Unmarshal([]byte(t.Cfg), &result); err != nil {
+		return errs.ErrInCorrectConfig
+	}
+	return nil
+}
+
 type LocalCfg struct {
 	TaskTimeout time.Duration `json:"taskTimeout"`
 	// 任务探查间隔
 	ExploreInterval time.Duration `json:"exploreInterval"`
 }
+
+// LocalExecution 本地任务的一次执行，执行方法通过它获取执行的信息、上报进度和记录日志
+type LocalExecution struct {
+	task    task.Task
+	eid     int64
+	attempt int
+	logger  *slog.Logger
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	// 最近一次上报的进度
+	progress atomic.Int32
+	// 上报进度后通知探查，还没有被探查的通知会合并成一个
+	reported chan struct{}
+	// 执行方法返回后关闭，err 是执行方法的返回值
+	done chan struct{}
+	err  error
+}
+
+func newLocalExecution(ctx context.Context, t task.Task, eid int64, logger *slog.Logger) *LocalExecution {
+	attempt := t.Attempt + 1
+	if t.Triggered() {
+		// 手动触发的执行不会重试
+		attempt = 1
+	}
+	e := &LocalExecution{
+		task:    t,
+		eid:     eid,
+		attempt: attempt,
+		logger: logger.With(slog.Int64("task_id", t.ID), slog.String("task_name", t.Name),
+			slog.Int64("execution_id", eid), slog.Int("attempt", attempt)),
+		reported: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	e.ctx, e.cancel = context.WithCancelCause(ctx)
+	return e
+}
+
+func (e *LocalExecution) Task() task.Task {
+	return e.task
+}
+
+// Eid 执行记录的 id
+func (e *LocalExecution) Eid() int64 {
+	return e.eid
+}
+
+// Attempt 本次调度的第几次执行，从 1 开始
+func (e *LocalExecution) Attempt() int {
+	return e.attempt
+}
+
+// Logger 带有任务和执行信息的日志
+func (e *LocalExecution) Logger() *slog.Logger {
+	return e.logger
+}
+
+// ReportProgress 上报执行进度，pct 超出 [0, 100] 时取最近的边界值。
+// 调度器按照探查的节奏记录进度，频繁上报时只会记录最近的一次
+func (e *LocalExecution) ReportProgress(pct int) {
+	pct = max(0, min(pct, 100))
+	e.progress.Store(int32(pct))
+	select {
+	case e.reported <- struct{}{}:
+	default:
+	}
+}
+
+// Progress 最近一次上报的进度
+func (e *LocalExecution) Progress() int {
+	return int(e.progress.Load())
+}
+
+// CancelCause 执行被取消的原因，例如 errs.ErrTaskPaused、errs.ErrSchedulerShutdown 和 context.DeadlineExceeded。
+// 没有被取消时返回 nil
+func (e *LocalExecution) CancelCause() error {
+	return context.Cause(e.ctx)
+}
+
+// result 执行方法返回后的最终结果
+func (e *LocalExecution) result() Result {
+	res := Result{Eid: e.eid, Progress: e.Progress()}
+	switch {
+	case e.err == nil:
+		res.Status, res.Progress = StatusSuccess, 100
+		return res
+	case errors.Is(e.err, context.Canceled):
+		res.Status = StatusCancelled
+	case errors.Is(e.err, context.DeadlineExceeded):
+		res.Status = StatusDeadlineExceeded
+	default:
+		res.Status = StatusFailed
+	}
+	res.ErrMsg = e.err.Error()
+	return res
+}
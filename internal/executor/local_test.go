@@ -0,0 +1,120 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLocalExecutor_Explore(t *testing.T) {
+	// 收到执行中的结果后通知执行方法继续执行
+	next := make(chan struct{})
+	testCases := []struct {
+		name    string
+		inTask  task.Task
+		fn      LocalFunc
+		wantRes []Result
+	}{
+		{
+			name:   "执行成功",
+			inTask: task.Task{ID: 1, Name: "success", Attempt: 1},
+			fn: func(ctx context.Context, e *LocalExecution) error {
+				if e.Eid() != 11 || e.Attempt() != 2 || e.Task().ID != 1 {
+					return errors.New("执行信息错误")
+				}
+				return nil
+			},
+			wantRes: []Result{{Eid: 11, Status: StatusSuccess, Progress: 100}},
+		},
+		{
+			name:   "上报进度后执行失败",
+			inTask: task.Task{ID: 2, Name: "failed"},
+			fn: func(ctx context.Context, e *LocalExecution) error {
+				e.ReportProgress(30)
+				<-next
+				return errors.New("mock error")
+			},
+			wantRes: []Result{
+				{Eid: 11, Status: StatusRunning, Progress: 30},
+				{Eid: 11, Status: StatusFailed, Progress: 30, ErrMsg: "mock error"},
+			},
+		},
+		{
+			name:   "执行方法返回超时",
+			inTask: task.Task{ID: 3, Name: "timeout"},
+			fn: func(ctx context.Context, e *LocalExecution) error {
+				e.ReportProgress(120)
+				<-next
+				return context.DeadlineExceeded
+			},
+			wantRes: []Result{
+				{Eid: 11, Status: StatusRunning, Progress: 100},
+				{Eid: 11, Status: StatusDeadlineExceeded, Progress: 100, ErrMsg: context.DeadlineExceeded.Error()},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLocalExecutor(slog.New(slog.NewTextHandler(io.Discard, nil)))
+			l.RegisterFunc(tc.inTask.Name, tc.fn)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			status, err := l.Run(ctx, tc.inTask, 11)
+			require.NoError(t, err)
+			assert.Equal(t, task.ExecStatusRunning, status)
+
+			ch := l.Explore(ctx, 11, tc.inTask)
+			require.NotNil(t, ch)
+			var res []Result
+			for r := range ch {
+				res = append(res, r)
+				if r.Status == StatusRunning {
+					next <- struct{}{}
+				}
+			}
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestLocalExecutor_Stop(t *testing.T) {
+	l := NewLocalExecutor(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	causes := make(chan error, 1)
+	l.RegisterFunc("paused", func(ctx context.Context, e *LocalExecution) error {
+		<-ctx.Done()
+		causes <- e.CancelCause()
+		return ctx.Err()
+	})
+	tk := task.Task{ID: 1, Name: "paused"}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	_, err := l.Run(ctx, tk, 1)
+	require.NoError(t, err)
+	cancel(errs.ErrTaskPaused)
+	assert.ErrorIs(t, <-causes, errs.ErrTaskPaused)
+
+	_, err = l.Run(context.Background(), tk, 2)
+	require.NoError(t, err)
+	require.NoError(t, l.Stop(context.Background(), tk, 2))
+	assert.ErrorIs(t, <-causes, context.Canceled)
+	// 被取消的执行由调度器记录结果，不能再探查
+	assert.Eventually(t, func() bool {
+		return l.Explore(context.Background(), 2, tk) == nil
+	}, time.Second, 10*time.Millisecond)
+	// 不在本节点的执行
+	assert.Nil(t, l.Explore(context.Background(), 3, tk))
+}
+
+func TestLocalExecutor_Run(t *testing.T) {
+	l := NewLocalExecutor(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	status, err := l.Run(context.Background(), task.Task{ID: 1, Name: "unknown"}, 1)
+	assert.ErrorIs(t, err, errs.ErrUnknownTask)
+	assert.Equal(t, task.ExecStatusFailed, status)
+}
@@ -112,3 +112,17 @@ func (mr *MockExecutorMockRecorder) TaskTimeout(t any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TaskTimeout", reflect.TypeOf((*MockExecutor)(nil).TaskTimeout), t)
 }
+
+// Validate mocks base method.
+func (m *MockExecutor) Validate(t task.Task) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Validate", t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Validate indicates an expected call of Validate.
+func (mr *MockExecutorMockRecorder) Validate(t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Validate", reflect.TypeOf((*MockExecutor)(nil).Validate), t)
+}
@@ -24,6 +24,8 @@ type Executor interface {
 	// TaskTimeout 返回任务的最大执行时间。当任务执行时长超过这个时间后，调度器会立刻取消执行任务。
 	// 如果任务没有配置，实现可以设置一个默认值。
 	TaskTimeout(t task.Task) time.Duration
+	// Validate 校验任务配置是否合法，创建和修改任务时调用
+	Validate(t task.Task) error
 
 	// Stop 取消任务执行
 	Stop(ctx context.Context, t task.Task, eid int64) error
@@ -36,6 +38,8 @@ type Result struct {
 	Status Status `json:"status"`
 	// 任务执行进度
 	Progress int `json:"progress"`
+	// 执行失败的原因，业务方可以不返回
+	ErrMsg string `json:"errMsg,omitempty"`
 }
 
 type Status string
@@ -44,4 +48,7 @@ const (
 	StatusSuccess Status = "SUCCESS"
 	StatusFailed  Status = "FAILED"
 	StatusRunning Status = "RUNNING"
+	// StatusCancelled 和 StatusDeadlineExceeded 目前只有本地任务会返回
+	StatusCancelled        Status = "CANCELLED"
+	StatusDeadlineExceeded Status = "DEADLINE_EXCEEDED"
 )
@@ -18,6 +18,7 @@ import (
 	"gorm.io/gorm/logger"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -41,7 +42,7 @@ func (s *SchedulerTestSuite) SetupSuite() {
 	gormTaskCfgDAO := mysql.NewGormTaskCfgRepository(s.db)
 	limiter := semaphore.NewWeighted(1)
 	s.logger = startup.InitLogger()
-	p := mysql.NewPreempter(s.db, 10, time.Second*5)
+	p := mysql.NewPreempter(s.db, 10, time.Second*5, mysql.WithRefreshInterval(time.Second))
 
 	s.s = scheduler.NewPreemptScheduler(executionDAO, time.Second*5, limiter, s.logger, p, gormTaskCfgDAO)
 
@@ -49,9 +50,10 @@ func (s *SchedulerTestSuite) SetupSuite() {
 
 func (s *SchedulerTestSuite) TearDownTest() {
 	//清空所有数据库，并将自增主键恢复为1
-	err := s.db.Exec("TRUNCATE TABLE `task_info`").Error
+	err := s.db.Exec("DELETE FROM task_info").Error
 	assert.NoError(s.T(), err)
-	s.db.Exec("TRUNCATE TABLE `execution`")
+	s.db.Exec("DELETE FROM execution")
+	s.db.Exec("DELETE FROM sqlite_sequence")
 }
 
 func (s *SchedulerTestSuite) TestScheduleLocalTask() {
@@ -72,7 +74,7 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       1,
 					Name:     "Task1",
 					Type:     task.TypeLocal,
@@ -85,8 +87,8 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				}).Error
 				require.NoError(t, err)
 				// 注册执行函数
-				local.RegisterFunc("Task1", func(ctx context.Context, t task.Task) error {
-					fmt.Println("执行任务了", t.ID)
+				local.RegisterFunc("Task1", func(ctx context.Context, e *executor.LocalExecution) error {
+					fmt.Println("执行任务了", e.Task().ID)
 					return nil
 				})
 			},
@@ -110,7 +112,7 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:           2,
 					Name:         "Task2",
 					Type:         task.TypeLocal,
@@ -121,8 +123,8 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				}).Error
 				require.NoError(t, err)
 				// 注册执行函数
-				local.RegisterFunc("Task2", func(ctx context.Context, t task.Task) error {
-					fmt.Println("执行任务了", t.ID)
+				local.RegisterFunc("Task2", func(ctx context.Context, e *executor.LocalExecution) error {
+					fmt.Println("执行任务了", e.Task().ID)
 					return nil
 				})
 			},
@@ -164,7 +166,7 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:           3,
 					Name:         "Task3",
 					Type:         task.TypeLocal,
@@ -175,8 +177,8 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				}).Error
 				require.NoError(t, err)
 				// 注册执行函数
-				local.RegisterFunc("Task3", func(ctx context.Context, t task.Task) error {
-					fmt.Println("执行任务了", t.ID)
+				local.RegisterFunc("Task3", func(ctx context.Context, e *executor.LocalExecution) error {
+					fmt.Println("执行任务了", e.Task().ID)
 					return errors.New("执行任务失败")
 				})
 			},
@@ -199,6 +201,7 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				require.NoError(t, err)
 				assert.Len(t, history, 1)
 				assert.True(t, history[0].Status == uint8(task.ExecStatusFailed))
+				assert.Equal(t, "执行任务失败", history[0].ErrMsg)
 			},
 			ctxFn: func(t *testing.T) context.Context {
 				ctx, cancel := context.WithCancel(context.Background())
@@ -216,7 +219,7 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:           4,
 					Name:         "Task4",
 					Type:         task.TypeLocal,
@@ -229,8 +232,8 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				}).Error
 				require.NoError(t, err)
 				// 注册执行函数
-				local.RegisterFunc("Task4", func(ctx context.Context, t task.Task) error {
-					fmt.Println("执行任务了", t.ID)
+				local.RegisterFunc("Task4", func(ctx context.Context, e *executor.LocalExecution) error {
+					fmt.Println("执行任务了", e.Task().ID)
 					return nil
 				})
 			},
@@ -270,7 +273,7 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:           5,
 					Name:         "Task5",
 					Type:         task.TypeLocal,
@@ -282,8 +285,8 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				}).Error
 				require.NoError(t, err)
 				// 注册执行函数
-				local.RegisterFunc("Task5", func(ctx context.Context, t task.Task) error {
-					fmt.Println("执行任务了", t.ID)
+				local.RegisterFunc("Task5", func(ctx context.Context, e *executor.LocalExecution) error {
+					fmt.Println("执行任务了", e.Task().ID)
 					return context.DeadlineExceeded
 				})
 			},
@@ -322,7 +325,7 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:           6,
 					Name:         "Task6",
 					Type:         task.TypeLocal,
@@ -334,8 +337,8 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 					Utime: now.Add(-6 * time.Second).UnixMilli(),
 				}).Error
 				require.NoError(t, err)
-				local.RegisterFunc("Task6", func(ctx context.Context, t task.Task) error {
-					fmt.Println("执行任务了", t.ID)
+				local.RegisterFunc("Task6", func(ctx context.Context, e *executor.LocalExecution) error {
+					fmt.Println("执行任务了", e.Task().ID)
 					return context.Canceled
 				})
 			},
@@ -384,6 +387,74 @@ func (s *SchedulerTestSuite) TestScheduleLocalTask() {
 	}
 }
 
+// TestScheduleMisfire 通过批量抢占调度错过了执行时间的任务，按照任务的策略处理错过的执行
+func (s *SchedulerTestSuite) TestScheduleMisfire() {
+	local := executor.NewLocalExecutor(s.logger)
+	s.s.RegisterExecutor(local)
+	repo := mysql.NewGormTaskCfgRepository(s.db)
+	t := s.T()
+	testCases := []struct {
+		name       string
+		policy     task.MisfirePolicy
+		wantRun    bool
+		wantStatus task.ExecStatus
+	}{
+		{
+			name:       "跳过错过的执行",
+			policy:     task.MisfirePolicy{Strategy: task.MisfireStrategySkip},
+			wantStatus: task.ExecStatusSkipped,
+		},
+		{
+			name:       "补执行一次",
+			policy:     task.MisfirePolicy{Strategy: task.MisfireStrategyFireOnce},
+			wantRun:    true,
+			wantStatus: task.ExecStatusSuccess,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer s.TearDownTest()
+			var run atomic.Bool
+			local.RegisterFunc("misfire", func(ctx context.Context, e *executor.LocalExecution) error {
+				run.Store(true)
+				return nil
+			})
+			// 每分钟执行一次，已经错过了五分钟
+			next := time.Now().Truncate(time.Minute).Add(-5 * time.Minute)
+			tid, err := repo.Add(context.Background(), task.Task{
+				Name:          "misfire",
+				Type:          task.TypeLocal,
+				Executor:      local.Name(),
+				CronExp:       "0 * * * * *",
+				NextExecTime:  next,
+				MisfirePolicy: tc.policy,
+			})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- s.s.Schedule(ctx)
+			}()
+			// 执行结束后任务被释放，下一次执行时间在当前时间之后
+			require.Eventually(t, func() bool {
+				tk, err := repo.Get(context.Background(), tid)
+				return err == nil && tk.LastStatus == task.TaskStatusWaiting && tk.NextExecTime.After(next)
+			}, 5*time.Second, 50*time.Millisecond)
+			cancel()
+			assert.Equal(t, context.Canceled, <-done)
+
+			var history []mysql.Execution
+			err = s.db.Where("tid = ?", tid).Find(&history).Error
+			require.NoError(t, err)
+			require.Len(t, history, 1)
+			assert.Equal(t, uint8(tc.wantStatus), history[0].Status)
+			assert.GreaterOrEqual(t, history[0].Misfired, 6)
+			assert.Equal(t, tc.wantRun, run.Load())
+		})
+	}
+}
+
 func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 	client := &http.Client{}
 	httpExec := executor.NewHttpExecutor(s.logger, client, 5)
@@ -409,7 +480,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       1,
 					Name:     "Task1",
 					Type:     task.TypeHttp,
@@ -439,7 +510,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:           2,
 					Name:         "Task2",
 					Type:         task.TypeHttp,
@@ -491,7 +562,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       3,
 					Name:     "Task3",
 					Type:     task.TypeHttp,
@@ -543,7 +614,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       4,
 					Name:     "Task4",
 					Type:     task.TypeHttp,
@@ -562,7 +633,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				require.NoError(t, err)
 
 				ctime := time.Now().UnixMilli()
-				err = s.db.WithContext(ctx).Create(mysql.Execution{
+				err = s.db.WithContext(ctx).Create(&mysql.Execution{
 					ID:       4,
 					Tid:      4,
 					Progress: 0,
@@ -608,7 +679,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       5,
 					Name:     "Task5",
 					Type:     task.TypeHttp,
@@ -659,7 +730,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:           6,
 					Name:         "Task6",
 					Type:         task.TypeHttp,
@@ -709,7 +780,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       7,
 					Name:     "Task7",
 					Type:     task.TypeHttp,
@@ -762,7 +833,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       8,
 					Name:     "Task8",
 					Type:     task.TypeHttp,
@@ -815,7 +886,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       9,
 					Name:     "Task9",
 					Type:     task.TypeHttp,
@@ -868,7 +939,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       10,
 					Name:     "Task10",
 					Type:     task.TypeHttp,
@@ -921,7 +992,7 @@ func (s *SchedulerTestSuite) TestScheduleHttpTask() {
 				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 				defer cancel()
 
-				err := s.db.WithContext(ctx).Create(mysql.TaskInfo{
+				err := s.db.WithContext(ctx).Create(&mysql.TaskInfo{
 					ID:       11,
 					Name:     "Task11",
 					Type:     task.TypeHttp,
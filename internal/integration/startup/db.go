@@ -1,14 +1,27 @@
 package startup
 
 import (
+	"github.com/ecodeclub/ecron/internal/storage/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"os"
+	"path/filepath"
 )
 
+// InitDB 使用 SQLite，不需要启动外部的数据库
 func InitDB() *gorm.DB {
-	db, err := gorm.Open(mysql.Open("root:root@tcp(localhost:13316)/ecron"))
+	dir, err := os.MkdirTemp("", "ecron")
+	if err != nil {
+		panic(err)
+	}
+	db, err := sqlite.Open(filepath.Join(dir, "ecron.db"))
 	if err != nil {
 		panic(err)
 	}
 	return db
 }
+
+// InitMySQL 需要先通过 docker-compose 启动 MySQL
+func InitMySQL() (*gorm.DB, error) {
+	return gorm.Open(mysql.Open("root:root@tcp(localhost:13316)/ecron"))
+}
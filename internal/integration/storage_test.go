@@ -0,0 +1,20 @@
+package integration
+
+import (
+	"github.com/ecodeclub/ecron/internal/integration/startup"
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"github.com/ecodeclub/ecron/internal/storage/storagetest"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+// TestMySQLStorage 和其他存储实现运行同样的测试，没有启动 MySQL 时跳过
+func TestMySQLStorage(t *testing.T) {
+	db, err := startup.InitMySQL()
+	if err != nil {
+		t.Skipf("连接 MySQL 失败: %v", err)
+	}
+	suite.Run(t, storagetest.NewStorageSuite(db, mysql.NewGormTaskCfgRepository(db), mysql.NewGormExecutionDAO(db),
+		mysql.NewGormWorkflowDAO(db), mysql.NewPreempter(db, 10, time.Minute)))
+}
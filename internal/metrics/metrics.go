@@ -0,0 +1,178 @@
+// Package metrics 调度节点的 Prometheus 指标，通过 /metrics 以 Prometheus 的文本格式暴露。
+// 所有方法在 *Metrics 为 nil 时什么都不做，没有开启指标的组件不需要判断
+package metrics
+
+import (
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "ecron"
+
+// 抢占的结果
+const (
+	PreemptSuccess  = "success"
+	PreemptEmpty    = "empty"
+	PreemptConflict = "conflict"
+	PreemptError    = "error"
+)
+
+// 执行槽位的类型，分别对应 PreemptScheduler 的 limiter 和 shardLimiter
+const (
+	SlotTask  = "task"
+	SlotShard = "shard"
+)
+
+type Metrics struct {
+	registry             *prometheus.Registry
+	preemptAttempts      *prometheus.CounterVec
+	preemptedTasks       prometheus.Counter
+	leaseRefreshFailures prometheus.Counter
+	slotsInUse           *prometheus.GaugeVec
+	slotsCapacity        *prometheus.GaugeVec
+	executions           *prometheus.CounterVec
+	executionDuration    *prometheus.HistogramVec
+	exploreFailures      *prometheus.CounterVec
+	httpRequestDuration  *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		preemptAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "preempt",
+			Name:      "attempts_total",
+			Help:      "抢占任务的次数，result 是抢占的结果",
+		}, []string{"result"}),
+		preemptedTasks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "preempt",
+			Name:      "tasks_total",
+			Help:      "抢占到的任务数量",
+		}),
+		leaseRefreshFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "lease",
+			Name:      "refresh_failures_total",
+			Help:      "续约失败的次数，续约失败后会取消任务的执行",
+		}),
+		slotsInUse: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scheduler",
+			Name:      "slots_in_use",
+			Help:      "正在使用的执行槽位",
+		}, []string{"kind"}),
+		slotsCapacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scheduler",
+			Name:      "slots_capacity",
+			Help:      "执行槽位的总数",
+		}, []string{"kind"}),
+		executions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "execution",
+			Name:      "total",
+			Help:      "任务执行的次数，status 是执行的最终状态",
+		}, []string{"executor", "status"}),
+		executionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "execution",
+			Name:      "duration_seconds",
+			Help:      "从抢占到任务到执行结束的时间",
+			Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600},
+		}, []string{"executor", "status"}),
+		exploreFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "execution",
+			Name:      "explore_failures_total",
+			Help:      "探查任务执行进度失败的次数",
+		}, []string{"executor"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http_executor",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP 执行器调用业务方的耗时，code 是响应码，请求失败时是 error",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+	}
+	m.registry.MustRegister(
+		m.preemptAttempts, m.preemptedTasks, m.leaseRefreshFailures,
+		m.slotsInUse, m.slotsCapacity,
+		m.executions, m.executionDuration, m.exploreFailures, m.httpRequestDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Registerer 用于注册其他的指标
+func (m *Metrics) Registerer() prometheus.Registerer {
+	return m.registry
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) RegisterRoutes(server *gin.Engine) {
+	server.GET("/metrics", gin.WrapH(m.Handler()))
+}
+
+// ObservePreempt 记录一次抢占，n 是抢占到的任务数量
+func (m *Metrics) ObservePreempt(result string, n int) {
+	if m == nil {
+		return
+	}
+	m.preemptAttempts.WithLabelValues(result).Inc()
+	m.preemptedTasks.Add(float64(n))
+}
+
+func (m *Metrics) LeaseRefreshFailed() {
+	if m == nil {
+		return
+	}
+	m.leaseRefreshFailures.Inc()
+}
+
+func (m *Metrics) AddSlotsInUse(kind string, delta int) {
+	if m == nil {
+		return
+	}
+	m.slotsInUse.WithLabelValues(kind).Add(float64(delta))
+}
+
+func (m *Metrics) SetSlotCapacity(kind string, n int64) {
+	if m == nil {
+		return
+	}
+	m.slotsCapacity.WithLabelValues(kind).Set(float64(n))
+}
+
+// ObserveExecution 记录一次执行的最终状态和耗时
+func (m *Metrics) ObserveExecution(executor string, status task.ExecStatus, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.executions.WithLabelValues(executor, status.String()).Inc()
+	m.executionDuration.WithLabelValues(executor, status.String()).Observe(d.Seconds())
+}
+
+func (m *Metrics) ExploreFailed(executor string) {
+	if m == nil {
+		return
+	}
+	m.exploreFailures.WithLabelValues(executor).Inc()
+}
+
+func (m *Metrics) ObserveHTTPRequest(method string, code string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpRequestDuration.WithLabelValues(method, code).Observe(d.Seconds())
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.ObservePreempt(PreemptSuccess, 3)
+	m.ObservePreempt(PreemptConflict, 0)
+	m.LeaseRefreshFailed()
+	m.SetSlotCapacity(SlotTask, 10)
+	m.AddSlotsInUse(SlotTask, 3)
+	m.AddSlotsInUse(SlotTask, -1)
+	m.ObserveExecution("HTTP", task.ExecStatusSuccess, time.Second)
+	m.ExploreFailed("HTTP")
+	m.ObserveHTTPRequest(http.MethodPost, "200", time.Millisecond)
+
+	server := gin.New()
+	m.RegisterRoutes(server)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	for _, line := range []string{
+		`ecron_preempt_attempts_total{result="success"} 1`,
+		`ecron_preempt_attempts_total{result="conflict"} 1`,
+		`ecron_preempt_tasks_total 3`,
+		`ecron_lease_refresh_failures_total 1`,
+		`ecron_scheduler_slots_capacity{kind="task"} 10`,
+		`ecron_scheduler_slots_in_use{kind="task"} 2`,
+		`ecron_execution_total{executor="HTTP",status="` + task.ExecStatusSuccess.String() + `"} 1`,
+		`ecron_execution_explore_failures_total{executor="HTTP"} 1`,
+		`ecron_http_executor_request_duration_seconds_count{code="200",method="POST"} 1`,
+	} {
+		assert.Contains(t, string(body), line)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.ObservePreempt(PreemptSuccess, 1)
+		m.AddSlotsInUse(SlotShard, 1)
+		m.ObserveExecution("HTTP", task.ExecStatusFailed, time.Second)
+	})
+}
@@ -12,6 +12,7 @@ package preemptmocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	preempt "github.com/ecodeclub/ecron/internal/preempt"
 	task "github.com/ecodeclub/ecron/internal/task"
@@ -56,6 +57,21 @@ func (mr *MockPreempterMockRecorder) Preempt(ctx any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Preempt", reflect.TypeOf((*MockPreempter)(nil).Preempt), ctx)
 }
 
+// PreemptBatch mocks base method.
+func (m *MockPreempter) PreemptBatch(ctx context.Context, n int) ([]preempt.TaskLeaser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreemptBatch", ctx, n)
+	ret0, _ := ret[0].([]preempt.TaskLeaser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreemptBatch indicates an expected call of PreemptBatch.
+func (mr *MockPreempterMockRecorder) PreemptBatch(ctx, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreemptBatch", reflect.TypeOf((*MockPreempter)(nil).PreemptBatch), ctx, n)
+}
+
 // MockTaskLeaser is a mock of TaskLeaser interface.
 type MockTaskLeaser struct {
 	ctrl     *gomock.Controller
@@ -94,6 +110,20 @@ func (mr *MockTaskLeaserMockRecorder) AutoRefresh(ctx any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AutoRefresh", reflect.TypeOf((*MockTaskLeaser)(nil).AutoRefresh), ctx)
 }
 
+// FencingToken mocks base method.
+func (m *MockTaskLeaser) FencingToken() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FencingToken")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// FencingToken indicates an expected call of FencingToken.
+func (mr *MockTaskLeaserMockRecorder) FencingToken() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FencingToken", reflect.TypeOf((*MockTaskLeaser)(nil).FencingToken))
+}
+
 // GetTask mocks base method.
 func (m *MockTaskLeaser) GetTask() task.Task {
 	m.ctrl.T.Helper()
@@ -108,6 +138,20 @@ func (mr *MockTaskLeaserMockRecorder) GetTask() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTask", reflect.TypeOf((*MockTaskLeaser)(nil).GetTask))
 }
 
+// Handover mocks base method.
+func (m *MockTaskLeaser) Handover(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Handover", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Handover indicates an expected call of Handover.
+func (mr *MockTaskLeaserMockRecorder) Handover(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Handover", reflect.TypeOf((*MockTaskLeaser)(nil).Handover), ctx)
+}
+
 // Refresh mocks base method.
 func (m *MockTaskLeaser) Refresh(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -136,6 +180,20 @@ func (mr *MockTaskLeaserMockRecorder) Release(ctx any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockTaskLeaser)(nil).Release), ctx)
 }
 
+// Retry mocks base method.
+func (m *MockTaskLeaser) Retry(ctx context.Context, attempt int, next time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Retry", ctx, attempt, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Retry indicates an expected call of Retry.
+func (mr *MockTaskLeaserMockRecorder) Retry(ctx, attempt, next any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Retry", reflect.TypeOf((*MockTaskLeaser)(nil).Retry), ctx, attempt, next)
+}
+
 // MockStatus is a mock of Status interface.
 type MockStatus struct {
 	ctrl     *gomock.Controller
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/ecodeclub/ecron/internal/task"
+	"time"
 )
 
 //go:generate mockgen -source=./types.go -package=preemptmocks -destination=./mocks/preempt.mock.go
@@ -15,16 +16,28 @@ var (
 // Preempter 成功会返回TaskLeaser
 type Preempter interface {
 	Preempt(ctx context.Context) (TaskLeaser, error)
+	// PreemptBatch 一次抢占最多 n 个任务，至少抢占到一个任务时才返回 nil。
+	// 没有可以执行的任务时返回 errs.ErrNoExecutableTask
+	PreemptBatch(ctx context.Context, n int) ([]TaskLeaser, error)
 }
 
 // TaskLeaser 租约
 type TaskLeaser interface {
 	GetTask() task.Task
+	// FencingToken 本次租约的 fencing token，同一个任务后抢占到的租约 token 更大。
+	// 写入执行记录和调用业务方时都需要带上，用于拒绝持有过期租约的调度节点
+	FencingToken() int64
 
 	// Refresh 保证幂等
 	Refresh(ctx context.Context) error
 	// Release 保证幂等，调用后，释放租约，不再能调用 Refresh/AutoRefresh
 	Release(ctx context.Context) error
+	// Retry 和 Release 一样会释放租约，但是任务会在 next 重新执行，而不是按照调度方式计算下一次执行时间。
+	// attempt 是本次调度已经执行的次数
+	Retry(ctx context.Context, attempt int, next time.Time) error
+	// Handover 释放租约，但是不结束本次执行。其他调度节点可以马上抢占任务，然后继续探查本次执行的结果，
+	// 用于调度节点关闭时还有没执行完的任务
+	Handover(ctx context.Context) error
 
 	// AutoRefresh 如果err不为nil，则不会返回ch
 	// 返回一个Status 的ch,有一定缓存，需要自行取走数据
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// lostRaceDelay 有可以执行的任务，只是被其他调度节点抢先时，等待这个固定的时间后马上重试
+const lostRaceDelay = 10 * time.Millisecond
+
+// backoff 抢占不到任务时的退避策略。等待时间从 min 开始每次翻倍，直到 max，抢占到任务后重置。
+// 实际等待时间在 [d/2, d] 之间随机，避免多个调度节点同时发起抢占
+type backoff struct {
+	min time.Duration
+	max time.Duration
+	cur time.Duration
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max}
+}
+
+func (b *backoff) next() time.Duration {
+	if b.cur == 0 {
+		b.cur = b.min
+	} else {
+		b.cur = min(b.cur*2, b.max)
+	}
+	half := b.cur / 2
+	return half + time.Duration(rand.Int63n(int64(b.cur-half)+1))
+}
+
+func (b *backoff) reset() {
+	b.cur = 0
+}
+
+// wait 等待下一个退避时间，ctx 结束时提前返回 ctx.Err()
+func (b *backoff) wait(ctx context.Context) error {
+	return sleep(ctx, b.next())
+}
+
+// retry 抢占冲突说明还有可以执行的任务，重置退避时间，只等待 lostRaceDelay
+func (b *backoff) retry(ctx context.Context) error {
+	b.reset()
+	return sleep(ctx, lostRaceDelay)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, time.Second)
+	for _, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond,
+		400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		d := b.next()
+		assert.GreaterOrEqual(t, d, want/2)
+		assert.LessOrEqual(t, d, want)
+	}
+	b.reset()
+	assert.LessOrEqual(t, b.next(), 100*time.Millisecond)
+
+	b.next()
+	assert.NoError(t, b.retry(context.Background()))
+	// 抢占冲突后重新从 min 开始退避
+	assert.LessOrEqual(t, b.next(), 100*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, b.wait(ctx))
+	assert.Equal(t, context.Canceled, b.retry(ctx))
+}
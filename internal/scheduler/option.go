@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"github.com/ecodeclub/ecron/internal/metrics"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+type Option func(p *PreemptScheduler)
+
+// WithPreemptTimeout 抢占任务和分片的超时时间
+func WithPreemptTimeout(timeout time.Duration) Option {
+	return func(p *PreemptScheduler) {
+		p.preemptTimeout = timeout
+	}
+}
+
+// WithOpTimeout 释放任务、更新执行记录和关停任务等操作的超时时间
+func WithOpTimeout(timeout time.Duration) Option {
+	return func(p *PreemptScheduler) {
+		p.opTimeout = timeout
+	}
+}
+
+// WithBackoff 抢占不到任务时的退避时间，从 min 开始翻倍，最长为 max
+func WithBackoff(min, max time.Duration) Option {
+	return func(p *PreemptScheduler) {
+		p.minBackoff = min
+		p.maxBackoff = max
+	}
+}
+
+// WithMaxPreemptBatch 一次最多抢占的任务数量
+func WithMaxPreemptBatch(n int) Option {
+	return func(p *PreemptScheduler) {
+		p.maxPreemptBatch = n
+	}
+}
+
+// WithShardLimit 本节点同时执行的分片数量上限
+func WithShardLimit(n int64) Option {
+	return func(p *PreemptScheduler) {
+		p.shardLimit = n
+	}
+}
+
+// WithShardLeaseTTL 分片超过 ttl 没有续约时，其他调度节点认为执行分片的节点已经崩溃并接手分片。
+// 执行分片时每隔 refreshInterval 续约一次，ttl 需要大于 refreshInterval，默认是 3 个 refreshInterval
+func WithShardLeaseTTL(ttl time.Duration) Option {
+	return func(p *PreemptScheduler) {
+		p.shardLeaseTTL = ttl
+	}
+}
+
+// WithMetrics 记录抢占、续约和执行的指标。limiter 的大小由创建者决定，
+// 需要通过 metrics.Metrics 的 SetSlotCapacity 设置
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(p *PreemptScheduler) {
+		p.metrics = m
+	}
+}
+
+// WithTracerProvider 默认使用 otel 全局的 TracerProvider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(p *PreemptScheduler) {
+		p.tracer = tp.Tracer(tracerName)
+	}
+}
@@ -3,30 +3,83 @@ package scheduler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/ecodeclub/ecron/internal/executor"
+	"github.com/ecodeclub/ecron/internal/metrics"
 	"github.com/ecodeclub/ecron/internal/preempt"
 	"github.com/ecodeclub/ecron/internal/storage"
 	"github.com/ecodeclub/ecron/internal/task"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/semaphore"
 	"log/slog"
+	"os"
+	"sync"
 	"time"
 )
 
+const (
+	// 每个调度节点同时执行的分片数量上限
+	defaultShardLimit = 10
+	// 默认分片超过 3 个 refreshInterval 没有续约时可以被其他调度节点接手
+	defaultShardLeaseTTLFactor = 3
+	// 一次最多抢占的任务数量
+	defaultMaxPreemptBatch = 100
+	// 抢占不到任务或者分片时的退避时间
+	defaultMinBackoff = 50 * time.Millisecond
+	defaultMaxBackoff = 3 * time.Second
+	defaultTimeout    = 3 * time.Second
+)
+
+// FinishedHandler 任务的一次调度执行结束后的回调，等待重试的执行不算结束，例如用于推进工作流
+type FinishedHandler func(ctx context.Context, t task.Task, status task.ExecStatus)
+
 type PreemptScheduler struct {
 	executionDAO      storage.ExecutionDAO
 	taskCfgRepository storage.TaskCfgRepository
 	executors         map[string]executor.Executor
 	refreshInterval   time.Duration
 	limiter           *semaphore.Weighted
-	logger            *slog.Logger
-	pe                preempt.Preempter
+	// 限制本节点同时执行的分片数量，和 limiter 分开，避免等待分片的任务占满 limiter 后分片无法执行
+	shardLimiter *semaphore.Weighted
+	logger       *slog.Logger
+	pe           preempt.Preempter
+	// 当前调度节点的标识，记录在执行记录中
+	node string
+	// 本节点正在执行的任务，key 是任务 id，value 是取消执行的 context.CancelCauseFunc
+	running          sync.Map
+	finishedHandlers []FinishedHandler
+	// 正在执行的任务和分片，Shutdown 时等待它们结束
+	wg sync.WaitGroup
+	// 保证 Shutdown 关闭 closing 之后 Schedule 不会再向 wg 中添加
+	closeMu sync.Mutex
+	// Shutdown 时关闭，不再抢占新的任务和分片
+	closing   chan struct{}
+	closeOnce sync.Once
+	// Shutdown 等待超时后关闭，正在执行的任务交给其他调度节点，分片直接停止
+	aborting  chan struct{}
+	abortOnce sync.Once
+	// with options
+	// 抢占任务和分片的超时时间
+	preemptTimeout time.Duration
+	// 释放任务、更新执行记录、通知执行器等操作的超时时间
+	opTimeout       time.Duration
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	maxPreemptBatch int
+	shardLimit      int64
+	// 分片超过这个时间没有续约时，其他调度节点可以接手
+	shardLeaseTTL time.Duration
+	metrics       *metrics.Metrics
+	tracer        trace.Tracer
 }
 
 func NewPreemptScheduler(executionDAO storage.ExecutionDAO,
 	refreshInterval time.Duration, limiter *semaphore.Weighted, logger *slog.Logger,
-	preempter preempt.Preempter, taskCfgRepository storage.TaskCfgRepository) *PreemptScheduler {
-	return &PreemptScheduler{
+	preempter preempt.Preempter, taskCfgRepository storage.TaskCfgRepository, opts ...Option) *PreemptScheduler {
+	p := &PreemptScheduler{
 		executionDAO:      executionDAO,
 		refreshInterval:   refreshInterval,
 		limiter:           limiter,
@@ -34,7 +87,35 @@ func NewPreemptScheduler(executionDAO storage.ExecutionDAO,
 		logger:            logger,
 		pe:                preempter,
 		taskCfgRepository: taskCfgRepository,
+		node:              nodeName(),
+		preemptTimeout:    defaultTimeout,
+		opTimeout:         defaultTimeout,
+		minBackoff:        defaultMinBackoff,
+		maxBackoff:        defaultMaxBackoff,
+		maxPreemptBatch:   defaultMaxPreemptBatch,
+		shardLimit:        defaultShardLimit,
+		tracer:            otel.GetTracerProvider().Tracer(tracerName),
+	}
+	p.closing = make(chan struct{})
+	p.aborting = make(chan struct{})
+	for _, opt := range opts {
+		opt(p)
 	}
+	if p.shardLeaseTTL <= 0 {
+		p.shardLeaseTTL = defaultShardLeaseTTLFactor * refreshInterval
+	}
+	p.shardLimiter = semaphore.NewWeighted(p.shardLimit)
+	p.metrics.SetSlotCapacity(metrics.SlotShard, p.shardLimit)
+	return p
+}
+
+// nodeName 使用 hostname-pid 作为调度节点的标识
+func nodeName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
 }
 
 func (p *PreemptScheduler) RegisterExecutor(execs ...executor.Executor) {
@@ -43,7 +124,92 @@ func (p *PreemptScheduler) RegisterExecutor(execs ...executor.Executor) {
 	}
 }
 
+func (p *PreemptScheduler) RegisterFinishedHandler(hs ...FinishedHandler) {
+	p.finishedHandlers = append(p.finishedHandlers, hs...)
+}
+
+// Schedule 等到有空闲的位置后，一次抢占的任务数量和空闲的位置一样多。
+// 没有可以执行的任务或者抢占出错时按照 backoff 退避，抢占到任务或者被其他调度节点抢先后马上开始下一次抢占。
+// ctx 结束时正在执行的任务也会被取消。调用 Shutdown 后只是不再抢占新的任务，这时返回 nil
 func (p *PreemptScheduler) Schedule(ctx context.Context) error {
+	// 抢占的循环也计入 wg，循环结束前添加的任务和分片都能被 Shutdown 等到
+	p.closeMu.Lock()
+	select {
+	case <-p.closing:
+		p.closeMu.Unlock()
+		return nil
+	default:
+	}
+	p.wg.Add(1)
+	p.closeMu.Unlock()
+	defer p.wg.Done()
+
+	// 任务和分片的执行不受 Shutdown 影响，只有等待超时后才取消
+	taskCtx, cancelTasks := context.WithCancelCause(ctx)
+	shardCtx, cancelShards := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-p.aborting:
+			cancelTasks(errs.ErrSchedulerShutdown)
+			cancelShards()
+		case <-ctx.Done():
+			cancelTasks(nil)
+			cancelShards()
+		}
+	}()
+
+	loopCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.closing:
+			cancel()
+		case <-loopCtx.Done():
+		}
+	}()
+	err := p.schedule(loopCtx, taskCtx, shardCtx)
+	select {
+	case <-p.closing:
+		return nil
+	default:
+		return err
+	}
+}
+
+// Shutdown 停止抢占新的任务和分片，等待正在执行的任务和分片结束。
+// ctx 结束时还没有执行完的任务不会被停止，租约交还给其他调度节点继续探查，还没有执行完的分片会被停止
+func (p *PreemptScheduler) Shutdown(ctx context.Context) error {
+	p.closeMu.Lock()
+	p.closeOnce.Do(func() {
+		close(p.closing)
+	})
+	p.closeMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.logger.Warn("等待任务执行结束超时，交还任务的租约", slog.Any("error", ctx.Err()))
+		p.abortOnce.Do(func() {
+			close(p.aborting)
+		})
+		<-done
+		return ctx.Err()
+	}
+}
+
+// schedule 在 ctx 结束前一直抢占任务，抢占到的任务在 taskCtx 中执行
+func (p *PreemptScheduler) schedule(ctx, taskCtx, shardCtx context.Context) error {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.scheduleShards(ctx, shardCtx)
+	}()
+	bo := newBackoff(p.minBackoff, p.maxBackoff)
 	for {
 		if ctx.Err() != nil {
 			return ctx.Err()
@@ -53,42 +219,209 @@ func (p *PreemptScheduler) Schedule(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		n := 1
+		for n < p.maxPreemptBatch && p.limiter.TryAcquire(1) {
+			n++
+		}
 
-		timeout, cancel := context.WithTimeout(ctx, time.Second*3)
-		leaser, err := p.pe.Preempt(timeout)
+		pctx, span := p.tracer.Start(ctx, "ecron.preempt",
+			trace.WithAttributes(attribute.Int("ecron.preempt.requested", n)))
+		timeout, cancel := context.WithTimeout(pctx, p.preemptTimeout)
+		leasers, err := p.pe.PreemptBatch(timeout, n)
 		cancel()
+		// 没有用到的位置还给 limiter
+		p.limiter.Release(int64(n - len(leasers)))
+		result := preemptResult(err)
+		p.metrics.ObservePreempt(result, len(leasers))
+		p.metrics.AddSlotsInUse(metrics.SlotTask, len(leasers))
+		span.SetAttributes(attribute.String("ecron.preempt.result", result),
+			attribute.Int("ecron.preempt.acquired", len(leasers)))
+		if result == metrics.PreemptError {
+			endSpan(span, err)
+		} else {
+			span.End()
+		}
 		if err != nil {
-			p.logger.Error("抢占任务失败,可能没有任务了",
-				slog.Any("error", err))
-			p.limiter.Release(1)
-			time.Sleep(time.Second * 3)
+			switch {
+			case errors.Is(err, preempt.ErrNoTaskToPreempt):
+				// 任务被其他调度节点抢先，还有可以执行的任务，不需要退避
+				err = bo.retry(ctx)
+			case errors.Is(err, errs.ErrNoExecutableTask):
+				err = bo.wait(ctx)
+			default:
+				p.logger.Error("抢占任务失败", slog.Any("error", err))
+				err = bo.wait(ctx)
+			}
+			if err != nil {
+				return ctx.Err()
+			}
 			continue
 		}
+		bo.reset()
+
+		for _, leaser := range leasers {
+			t := leaser.GetTask()
+			exec, ok := p.executors[t.Executor]
+			if !ok {
+				p.logger.Error("找不到任务的执行器",
+					slog.Int64("TaskID", t.ID),
+					slog.String("Executor", t.Executor))
+				p.ReleaseTask(pctx, leaser, t)
+				continue
+			}
+			// 每个任务的执行是一个新的链路，通过 link 关联到抢占
+			execCtx := trace.ContextWithSpan(taskCtx, span)
+			p.wg.Add(1)
+			go func(leaser preempt.TaskLeaser) {
+				defer p.wg.Done()
+				p.doTaskWithAutoRefresh(execCtx, leaser, exec)
+			}(leaser)
+		}
+	}
+}
+
+// scheduleShards 抢占并执行等待执行的分片，分片可能属于任意一个调度节点上正在执行的任务。
+// 抢占到的分片在 shardCtx 中执行
+func (p *PreemptScheduler) scheduleShards(ctx, shardCtx context.Context) {
+	bo := newBackoff(p.minBackoff, p.maxBackoff)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
 
-		t := leaser.GetTask()
-		exec, ok := p.executors[t.Executor]
-		if !ok {
-			p.logger.Error("找不到任务的执行器",
-				slog.Int64("TaskID", t.ID),
-				slog.String("Executor", t.Executor))
-			p.ReleaseTask(leaser, t)
+		err := p.shardLimiter.Acquire(ctx, 1)
+		if err != nil {
+			return
+		}
+
+		timeout, cancel := context.WithTimeout(ctx, p.preemptTimeout)
+		e, err := p.executionDAO.PreemptShard(timeout, p.node, p.shardLeaseTTL)
+		cancel()
+		if err != nil {
+			if !errors.Is(err, errs.ErrNoExecutableTask) {
+				p.logger.Error("抢占分片失败", slog.Any("error", err))
+			}
+			p.shardLimiter.Release(1)
+			if bo.wait(ctx) != nil {
+				return
+			}
 			continue
 		}
+		bo.reset()
+
+		p.metrics.AddSlotsInUse(metrics.SlotShard, 1)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.doShard(shardCtx, e)
+		}()
+	}
+}
+
+// doShard 执行抢占到的分片，分片的执行结果记录在分片自己的执行记录上，由分片所属的执行汇总
+func (p *PreemptScheduler) doShard(ctx context.Context, e task.Execution) {
+	defer func() {
+		p.shardLimiter.Release(1)
+		p.metrics.AddSlotsInUse(metrics.SlotShard, -1)
+	}()
+
+	t, err := p.taskCfgRepository.Get(ctx, e.Tid)
+	if err != nil {
+		_ = p.finishExecution(e.ID, e.FencingToken, 0, task.ExecStatusFailed, err)
+		return
+	}
+	if e.TriggerType == task.TriggerTypeManual {
+		cfg, err := task.MergeCfg(t.Cfg, t.TriggerParams)
+		if err != nil {
+			_ = p.finishExecution(e.ID, e.FencingToken, 0, task.ExecStatusFailed, err)
+			return
+		}
+		t.Cfg = cfg
+	}
+	exec, ok := p.executors[t.Executor]
+	if !ok {
+		_ = p.finishExecution(e.ID, e.FencingToken, 0, task.ExecStatusFailed, errs.ErrUnknownExecutor)
+		return
+	}
+	t.Shard = task.Shard{Index: e.ShardIndex, Total: e.ShardTotal}
+	// 分片使用创建分片时的租约的 token
+	t.FencingToken = e.FencingToken
+
+	ctx, span := p.tracer.Start(ctx, "ecron.shard", taskAttributes(t),
+		trace.WithAttributes(attribute.Int64("ecron.execution.id", e.ID), attribute.Int("ecron.shard.index", e.ShardIndex)))
+	defer span.End()
+	refreshCtx, cancelCause := context.WithCancelCause(ctx)
+	defer cancelCause(nil)
+	go p.refreshShard(refreshCtx, cancelCause, e.ID)
+	execCtx, cancel := context.WithTimeout(refreshCtx, exec.TaskTimeout(t))
+	defer cancel()
+	// 分片的执行记录拒绝写入时只取消这个分片，不影响本节点上同一个任务的执行
+	setExecStatus(span, p.run(execCtx, t, exec, e.ID, cancelCause))
+}
 
-		go p.doTaskWithAutoRefresh(ctx, leaser, exec)
+// refreshShard 每隔 refreshInterval 为正在执行的分片续约，分片被其他调度节点接手后取消本节点的执行
+func (p *PreemptScheduler) refreshShard(ctx context.Context, cancel context.CancelCauseFunc, eid int64) {
+	ticker := time.NewTicker(p.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rctx, rcancel := context.WithTimeout(ctx, p.opTimeout)
+			err := p.executionDAO.RefreshShard(rctx, eid, p.node)
+			rcancel()
+			if errors.Is(err, errs.ErrShardReclaimed) {
+				p.logger.Warn("分片已经被其他调度节点接手", slog.Int64("execution_id", eid))
+				cancel(err)
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				p.logger.Error("分片续约失败", slog.Int64("execution_id", eid), slog.Any("error", err))
+			}
+		}
 	}
 }
 
+// doTaskWithAutoRefresh 执行抢占到的任务，ctx 中的 span 是抢占任务的 span
 func (p *PreemptScheduler) doTaskWithAutoRefresh(ctx context.Context, l preempt.TaskLeaser, exec executor.Executor) {
 	t := l.GetTask()
+	// 本次执行的最终状态，用于判断是否需要重试
+	status := task.ExecStatusUnknown
+	start := time.Now()
+
+	ctx, span := p.tracer.Start(ctx, "ecron.task", trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)), taskAttributes(t))
+	defer span.End()
 
+	cancelCtx, cancelCause := context.WithCancelCause(ctx)
 	defer func() {
-		p.ReleaseTask(l, t)
+		if errors.Is(context.Cause(cancelCtx), errs.ErrStaleFencingToken) {
+			// 任务已经被其他调度节点接手，由新的持有者处理执行结果
+			span.AddEvent("stale fencing token")
+			p.releaseSlot()
+			return
+		}
+		if p.shuttingDown(cancelCtx) {
+			p.handoverTask(ctx, l, t)
+			return
+		}
+		setExecStatus(span, status)
+		p.metrics.ObserveExecution(exec.Name(), status, time.Since(start))
+		attempt := t.Attempt + 1
+		// 手动触发的执行不重试，重试会改变任务原本的调度计划
+		if !t.Triggered() && t.RetryPolicy.ShouldRetry(status, attempt) {
+			p.retryTask(ctx, l, t, attempt)
+			return
+		}
+		p.ReleaseTask(ctx, l, t)
+		p.onFinished(t, status)
 	}()
 
-	cancelCtx, cancelCause := context.WithCancelCause(ctx)
 	ch, err := l.AutoRefresh(cancelCtx)
 	defer cancelCause(nil)
+	p.running.Store(t.ID, cancelCause)
+	defer p.running.Delete(t.ID)
 
 	if err != nil {
 		cancelCause(err)
@@ -96,85 +429,356 @@ func (p *PreemptScheduler) doTaskWithAutoRefresh(ctx context.Context, l preempt.
 	}
 
 	go func() {
-		for {
-			s, ok := <-ch
-			if ok && s.Err() != nil {
+		for s := range ch {
+			if s.Err() != nil {
+				if cancelCtx.Err() == nil && !errors.Is(s.Err(), preempt.ErrLeaserHasRelease) {
+					p.metrics.LeaseRefreshFailed()
+				}
 				cancelCause(s.Err())
 				return
 			}
 		}
 	}()
 
+	if t.Triggered() {
+		// 手动触发时传入的参数覆盖任务配置中的同名字段
+		cfg, err := task.MergeCfg(t.Cfg, t.TriggerParams)
+		if err != nil {
+			status = p.createFinished(cancelCtx, t, 0, task.ExecStatusFailed, err)
+			return
+		}
+		t.Cfg = cfg
+	}
+
+	misfired := p.misfired(t)
+	if misfired > 0 && t.MisfirePolicy.Strategy == task.MisfireStrategySkip {
+		status = p.createFinished(cancelCtx, t, misfired, task.ExecStatusSkipped, nil)
+		return
+	}
+
 	timeout := exec.TaskTimeout(t)
 	execCtx, execCancel := context.WithTimeout(cancelCtx, timeout)
 	defer execCancel()
 
-	needRun := p.exploreLastExecution(execCtx, t, exec)
+	needRun, lastStatus := p.exploreLastExecution(execCtx, t, exec, cancelCause)
 	if needRun {
-		p.doTask(execCtx, t, exec)
+		status = p.doTask(execCtx, t, exec, misfired, cancelCause)
+		return
+	}
+	status = lastStatus
+}
+
+// misfired 计算本次调度错过了多少次执行。
+// 只有按照计划调度的任务才需要计算，接手其他节点没有执行完的任务、重试和手动触发都不算错过
+func (p *PreemptScheduler) misfired(t task.Task) int {
+	if t.LastStatus != task.TaskStatusWaiting || t.Attempt > 0 || t.Triggered() {
+		return 0
 	}
+	misfired := t.Misfired(time.Now())
+	if misfired > 0 {
+		p.logger.Warn("任务错过了执行时间", slog.Int64("task_id", t.ID),
+			slog.Time("next_exec_time", t.NextExecTime), slog.Int("misfired", misfired),
+			slog.Int("misfire_strategy", int(t.MisfirePolicy.Strategy)))
+	}
+	return misfired
+}
 
+// createFinished 不执行任务，只记录一条已经结束的执行记录，例如按照 MisfireStrategySkip 跳过的执行
+func (p *PreemptScheduler) createFinished(ctx context.Context, t task.Task, misfired int,
+	status task.ExecStatus, execErr error) task.ExecStatus {
+	e := p.newExecution(t, misfired, status)
+	e.EndTime = time.Now()
+	if execErr != nil {
+		e.ErrMsg = execErr.Error()
+	}
+	_, err := p.executionDAO.Create(ctx, e)
+	if err != nil {
+		p.logger.Error("创建执行记录失败", slog.Int64("task_id", t.ID), slog.Any("error", err))
+	}
+	return status
 }
 
-func (p *PreemptScheduler) exploreLastExecution(ctx context.Context, t task.Task, exec executor.Executor) bool {
+// newExecution 创建本次执行的执行记录
+func (p *PreemptScheduler) newExecution(t task.Task, misfired int, status task.ExecStatus) task.Execution {
+	e := task.Execution{
+		Tid:      t.ID,
+		Attempt:  t.Attempt + 1,
+		Misfired: misfired,
+		Status:   status,
+		Node:     p.node,
+		// 新的持有者写入执行记录后，持有过期租约的调度节点不能再写入
+		FencingToken: t.FencingToken,
+	}
+	if t.Triggered() {
+		// 手动触发的执行不属于任何一次调度，也不会重试
+		e.Attempt = 1
+		e.TriggerType = task.TriggerTypeManual
+	}
+	return e
+}
+
+// exploreLastExecution 探查上一次没有结束的执行。
+// 返回是否需要重新执行任务，以及不需要重新执行时上一次执行的最终状态
+func (p *PreemptScheduler) exploreLastExecution(ctx context.Context, t task.Task, exec executor.Executor,
+	cancel context.CancelCauseFunc) (bool, task.ExecStatus) {
 	if t.LastStatus != task.TaskStatusRunning {
-		return true
+		return true, task.ExecStatusUnknown
 	}
 
 	lastExecution, err := p.executionDAO.GetLastExecution(ctx, t.ID)
 	if err != nil {
-		return true
+		return true, task.ExecStatusUnknown
 	}
 	if lastExecution.Status != task.ExecStatusRunning && lastExecution.Status != task.ExecStatusUnknown {
-		return true
+		return true, task.ExecStatusUnknown
 	}
 	eid := lastExecution.ID
+	//  调整 执行超时时间 = 任务记录 创建时间 + 最大执行时间
+	expectStopTime := lastExecution.Ctime.Add(exec.TaskTimeout(t))
+	if lastExecution.ShardTotal > 0 {
+		// 分片由各个调度节点执行，只需要继续等待所有分片结束
+		nctx, ncancel := context.WithDeadline(ctx, expectStopTime)
+		defer ncancel()
+		return false, p.waitShards(nctx, t, eid, cancel)
+	}
 	status, progress, err := p.exploreOnce(ctx, t, exec, eid)
+	if err != nil && p.shuttingDown(ctx) {
+		return false, task.ExecStatusRunning
+	}
 	if err != nil {
+		p.metrics.ExploreFailed(exec.Name())
 		p.logger.Error("探查上次执行结果失败", slog.Int64("task_id", t.ID), slog.Int64("execution_id", eid), slog.Any("err", err))
-		_ = p.updateProgressStatus(eid, 0, task.ExecStatusUnknown)
-		return true
+		_ = p.finishExecution(eid, t.FencingToken, int(lastExecution.Progress), task.ExecStatusUnknown, err)
+		return true, task.ExecStatusUnknown
 	}
 	if status != task.ExecStatusRunning {
-		_ = p.updateProgressStatus(eid, progress, status)
-		return true
+		_ = p.finishExecution(eid, t.FencingToken, progress, status, nil)
+		return true, task.ExecStatusUnknown
 	}
 
-	//  调整 执行超时时间 = 任务记录 创建时间 + 最大执行时间
-	expectStopTime := lastExecution.Ctime.Add(exec.TaskTimeout(t))
-	nctx, cancel := context.WithDeadline(ctx, expectStopTime)
-	defer cancel()
-	p.explore(nctx, exec, t, eid)
-	return false
+	nctx, ncancel := context.WithDeadline(ctx, expectStopTime)
+	defer ncancel()
+	return false, p.explore(nctx, exec, t, eid, cancel)
 }
 
-func (p *PreemptScheduler) ReleaseTask(l preempt.TaskLeaser, t task.Task) {
-	p.limiter.Release(1)
-	nctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+// Pause 暂停任务。stop 为 true 时会停止正在执行的任务：
+// 任务在本节点执行的话立刻停止，在其他节点执行的话，那个节点会在续约失败后停止
+func (p *PreemptScheduler) Pause(ctx context.Context, tid int64, stop bool) error {
+	err := p.taskCfgRepository.Pause(ctx, tid, stop)
+	if err != nil {
+		return err
+	}
+	if !stop {
+		return nil
+	}
+	if cancel, ok := p.running.Load(tid); ok {
+		cancel.(context.CancelCauseFunc)(errs.ErrTaskPaused)
+	}
+	return nil
+}
+
+// Resume 恢复暂停的任务，policy 决定暂停期间错过的执行是否需要补执行
+func (p *PreemptScheduler) Resume(ctx context.Context, tid int64, policy task.ResumePolicy) error {
+	t, err := p.taskCfgRepository.Get(ctx, tid)
+	if err != nil {
+		return err
+	}
+	if t.LastStatus != task.TaskStatusPaused {
+		return errs.ErrInvalidTaskStatus
+	}
+	next, err := t.ResumeTime(time.Now(), policy)
+	if err != nil {
+		return err
+	}
+	return p.taskCfgRepository.Resume(ctx, tid, next)
+}
+
+// ReleaseTask 释放任务，ctx 只用来传递链路信息，已经取消也不影响释放
+func (p *PreemptScheduler) ReleaseTask(ctx context.Context, l preempt.TaskLeaser, t task.Task) {
+	p.releaseSlot()
+	ctx, span := p.tracer.Start(context.WithoutCancel(ctx), "ecron.release")
+	nctx, cancel := context.WithTimeout(ctx, p.opTimeout)
 	defer cancel()
 	err := l.Release(nctx)
+	endSpan(span, err)
 	if err != nil {
 		p.logger.Error("任务释放失败", slog.Int64("task_id", t.ID),
 			slog.Any("err", err))
 	}
 }
 
-func (p *PreemptScheduler) doTask(ctx context.Context, t task.Task, exec executor.Executor) {
-	eid, err := p.executionDAO.Upsert(ctx, t.ID, task.ExecStatusRunning, 0)
+// releaseSlot 任务结束后把位置还给 limiter
+func (p *PreemptScheduler) releaseSlot() {
+	p.limiter.Release(1)
+	p.metrics.AddSlotsInUse(metrics.SlotTask, -1)
+}
+
+// handoverTask 交还任务的租约，本次执行保持执行中，不通知 FinishedHandler
+func (p *PreemptScheduler) handoverTask(ctx context.Context, l preempt.TaskLeaser, t task.Task) {
+	p.releaseSlot()
+	ctx, span := p.tracer.Start(context.WithoutCancel(ctx), "ecron.handover")
+	nctx, cancel := context.WithTimeout(ctx, p.opTimeout)
+	defer cancel()
+	err := l.Handover(nctx)
+	endSpan(span, err)
+	if err != nil {
+		p.logger.Error("任务交还失败，等待租约过期", slog.Int64("task_id", t.ID),
+			slog.Any("err", err))
+		return
+	}
+	p.logger.Info("调度节点关闭，任务交给其他调度节点继续探查", slog.Int64("task_id", t.ID))
+}
+
+// shuttingDown 调度节点关闭时取消的执行不需要停止任务，也不需要记录执行结果
+func (p *PreemptScheduler) shuttingDown(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errs.ErrSchedulerShutdown)
+}
+
+// detached 调度节点关闭或者分片被其他调度节点接手，执行交给其他调度节点，本节点不停止任务，也不记录执行结果
+func (p *PreemptScheduler) detached(ctx context.Context) bool {
+	return p.shuttingDown(ctx) || errors.Is(context.Cause(ctx), errs.ErrShardReclaimed)
+}
+
+// onFinished 释放任务之后通知所有的 FinishedHandler
+func (p *PreemptScheduler) onFinished(t task.Task, status task.ExecStatus) {
+	if len(p.finishedHandlers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.opTimeout)
+	defer cancel()
+	for _, h := range p.finishedHandlers {
+		h(ctx, t, status)
+	}
+}
+
+// retryTask 释放任务，任务会按照重试策略在退避时间后再次执行。attempt 是已经执行的次数
+func (p *PreemptScheduler) retryTask(ctx context.Context, l preempt.TaskLeaser, t task.Task, attempt int) {
+	p.releaseSlot()
+	ctx, span := p.tracer.Start(context.WithoutCancel(ctx), "ecron.retry",
+		trace.WithAttributes(attribute.Int("ecron.attempt", attempt)))
+	nctx, cancel := context.WithTimeout(ctx, p.opTimeout)
+	defer cancel()
+	next := time.Now().Add(t.RetryPolicy.NextInterval(attempt))
+	err := l.Retry(nctx, attempt, next)
+	endSpan(span, err)
 	if err != nil {
+		p.logger.Error("任务释放失败", slog.Int64("task_id", t.ID),
+			slog.Int("attempt", attempt), slog.Any("err", err))
 		return
 	}
-	status, err := exec.Run(ctx, t, eid)
+	p.logger.Info("任务执行失败，等待重试", slog.Int64("task_id", t.ID),
+		slog.Int("attempt", attempt), slog.Time("next_exec_time", next))
+}
+
+// doTask 执行任务，返回任务的最终状态。misfired 是开始执行时错过的执行次数，
+// cancel 在执行记录拒绝写入时取消本次执行。任务有多个分片时只创建分片，然后等待所有分片执行结束
+func (p *PreemptScheduler) doTask(ctx context.Context, t task.Task, exec executor.Executor, misfired int,
+	cancel context.CancelCauseFunc) task.ExecStatus {
+	e := p.newExecution(t, misfired, task.ExecStatusRunning)
+	if t.ShardCount > 1 {
+		e.ShardTotal = t.ShardCount
+	}
+	eid, err := p.executionDAO.Create(ctx, e)
+	if err != nil {
+		p.logger.Error("创建执行记录失败", slog.Int64("task_id", t.ID), slog.Any("error", err))
+		p.onStale(cancel, err)
+		return task.ExecStatusUnknown
+	}
+	if e.ShardTotal == 0 {
+		return p.run(ctx, t, exec, eid, cancel)
+	}
+	e.ID = eid
+	err = p.executionDAO.CreateShards(ctx, e)
+	if err != nil {
+		p.logger.Error("创建分片失败", slog.Int64("task_id", t.ID), slog.Int64("execution_id", eid),
+			slog.Any("error", err))
+		_ = p.finishExecution(eid, t.FencingToken, 0, task.ExecStatusFailed, err)
+		return task.ExecStatusFailed
+	}
+	return p.waitShards(ctx, t, eid, cancel)
+}
+
+// waitShards 定时汇总分片的执行情况，直到所有分片执行结束，返回执行的最终状态。
+// 超时或者被取消时，还没有被抢占的分片不会再执行
+func (p *PreemptScheduler) waitShards(ctx context.Context, t task.Task, eid int64, cancel context.CancelCauseFunc) task.ExecStatus {
+	ticker := time.NewTicker(p.refreshInterval)
+	defer ticker.Stop()
+	progress := 0
+	for {
+		select {
+		case <-ctx.Done():
+			if p.shuttingDown(ctx) {
+				// 分片继续执行，由下一个持有者汇总
+				return task.ExecStatusRunning
+			}
+			status := task.ExecStatusCancelled
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				status = task.ExecStatusDeadlineExceeded
+			}
+			cause := context.Cause(ctx)
+			p.finishWaitingShards(eid, t.FencingToken, status, cause)
+			_ = p.finishExecution(eid, t.FencingToken, progress, status, cause)
+			return status
+		case <-ticker.C:
+			shards, err := p.executionDAO.ListShards(ctx, eid)
+			if err != nil {
+				p.logger.Error("查询分片失败", slog.Int64("task_id", t.ID), slog.Int64("execution_id", eid),
+					slog.Any("error", err))
+				continue
+			}
+			status, pg := task.AggregateShards(shards)
+			progress = int(pg)
+			if status != task.ExecStatusRunning {
+				_ = p.finishExecution(eid, t.FencingToken, progress, status, nil)
+				return status
+			}
+			if p.onStale(cancel, p.updateProgressStatus(eid, t.FencingToken, progress, status)) {
+				return task.ExecStatusCancelled
+			}
+		}
+	}
+}
+
+func (p *PreemptScheduler) finishWaitingShards(eid int64, token int64, status task.ExecStatus, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opTimeout)
+	defer cancel()
+	errMsg := ""
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+	err := p.executionDAO.FinishWaitingShards(ctx, eid, token, status, errMsg)
+	if err != nil {
+		p.logger.Error("结束等待执行的分片失败", slog.Int64("execution_id", eid), slog.Any("error", err))
+	}
+}
+
+// run 在执行记录 eid 上执行任务，任务没有立刻结束时会一直探查到任务结束，返回任务的最终状态。
+// cancel 取消的是这条执行记录所属的执行，任务或者分片
+func (p *PreemptScheduler) run(ctx context.Context, t task.Task, exec executor.Executor, eid int64,
+	cancel context.CancelCauseFunc) task.ExecStatus {
+	rctx, span := p.tracer.Start(ctx, "ecron.run",
+		trace.WithAttributes(attribute.Int64("ecron.execution.id", eid)))
+	status, err := exec.Run(rctx, t, eid)
+	span.SetAttributes(attribute.String("ecron.execution.status", status.String()))
+	endSpan(span, err)
 	progress := 0
 	if status == task.ExecStatusSuccess {
 		progress = 100
 	}
-	_ = p.updateProgressStatus(eid, progress, status)
+	if p.detached(ctx) && status != task.ExecStatusSuccess && status != task.ExecStatusFailed {
+		return task.ExecStatusRunning
+	}
+	if err == nil && status == task.ExecStatusCancelled {
+		err = context.Cause(ctx)
+	}
 	if err != nil || status != task.ExecStatusRunning {
-		return
+		_ = p.finishExecution(eid, t.FencingToken, progress, status, err)
+		return status
 	}
-	p.explore(ctx, exec, t, eid)
-
+	if p.onStale(cancel, p.updateProgressStatus(eid, t.FencingToken, progress, status)) {
+		return task.ExecStatusCancelled
+	}
+	return p.explore(ctx, exec, t, eid, cancel)
 }
 
 func (p *PreemptScheduler) exploreOnce(ctx context.Context, t task.Task, exec executor.Executor, eid int64) (task.ExecStatus, int, error) {
@@ -194,18 +798,27 @@ func (p *PreemptScheduler) exploreOnce(ctx context.Context, t task.Task, exec ex
 
 }
 
-func (p *PreemptScheduler) explore(ctx context.Context, exec executor.Executor, t task.Task, eid int64) {
-
-	ch := exec.Explore(ctx, eid, t)
+// explore 探查任务的执行进度，直到任务结束，返回任务的最终状态
+func (p *PreemptScheduler) explore(ctx context.Context, exec executor.Executor, t task.Task, eid int64,
+	cancel context.CancelCauseFunc) task.ExecStatus {
+	ectx, span := p.tracer.Start(ctx, "ecron.explore",
+		trace.WithAttributes(attribute.Int64("ecron.execution.id", eid)))
+	defer span.End()
+	ch := exec.Explore(ectx, eid, t)
 	if ch == nil {
-		return
+		return task.ExecStatusUnknown
 	}
 	// 保存每一次探查时的进度，确保执行ctx.Done()分支时进度不会更新为零值
 	progress := 0
 	status := task.ExecStatusUnknown
+	// 任务被取消的原因，例如任务被暂停
+	var cause error
 	for {
 		select {
 		case <-ctx.Done():
+			if p.detached(ctx) {
+				return task.ExecStatusRunning
+			}
 			// 主动取消或者超时
 			err := ctx.Err()
 			if errors.Is(err, context.DeadlineExceeded) {
@@ -213,6 +826,7 @@ func (p *PreemptScheduler) explore(ctx context.Context, exec executor.Executor,
 			} else {
 				status = task.ExecStatusCancelled
 			}
+			cause = context.Cause(ctx)
 			_ = p.stopTask(exec, t, eid)
 
 		case res, ok := <-ch:
@@ -221,37 +835,83 @@ func (p *PreemptScheduler) explore(ctx context.Context, exec executor.Executor,
 				case <-ctx.Done():
 					continue
 				default:
+					// 执行器没有给出最终结果就结束了探查
+					p.metrics.ExploreFailed(exec.Name())
 					status = task.ExecStatusUnknown
 				}
 			} else {
 				progress = res.Progress
 				status = p.from(res.Status)
+				if res.ErrMsg != "" {
+					cause = errors.New(res.ErrMsg)
+				}
+				span.AddEvent("explored", trace.WithAttributes(
+					attribute.Int("ecron.execution.progress", progress),
+					attribute.String("ecron.execution.status", status.String())))
 			}
 
 		}
 
-		_ = p.updateProgressStatus(eid, progress, status)
 		if status != task.ExecStatusRunning {
-			return
+			setExecStatus(span, status)
+			_ = p.finishExecution(eid, t.FencingToken, progress, status, cause)
+			return status
+		}
+		if p.onStale(cancel, p.updateProgressStatus(eid, t.FencingToken, progress, status)) {
+			return task.ExecStatusCancelled
 		}
 	}
 }
 
+func preemptResult(err error) string {
+	switch {
+	case err == nil:
+		return metrics.PreemptSuccess
+	case errors.Is(err, errs.ErrNoExecutableTask):
+		return metrics.PreemptEmpty
+	case errors.Is(err, preempt.ErrNoTaskToPreempt):
+		return metrics.PreemptConflict
+	default:
+		return metrics.PreemptError
+	}
+}
+
 func (p *PreemptScheduler) from(status executor.Status) task.ExecStatus {
 	switch status {
 	case executor.StatusSuccess:
 		return task.ExecStatusSuccess
 	case executor.StatusFailed:
 		return task.ExecStatusFailed
+	case executor.StatusCancelled:
+		return task.ExecStatusCancelled
+	case executor.StatusDeadlineExceeded:
+		return task.ExecStatusDeadlineExceeded
 	default:
 		return task.ExecStatusRunning
 	}
 }
 
-func (p *PreemptScheduler) updateProgressStatus(eid int64, progress int, status task.ExecStatus) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+func (p *PreemptScheduler) updateProgressStatus(eid int64, token int64, progress int, status task.ExecStatus) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opTimeout)
+	defer cancel()
+	err := p.executionDAO.UpdateProgressStatus(ctx, eid, token, uint8(progress), status)
+	if err != nil {
+		p.logger.Error("更新任务记录失败", slog.Int64("execution_id", eid),
+			slog.String("exec_status", status.String()), slog.Int("progress", progress),
+			slog.Any("error", err))
+	}
+	return err
+}
+
+// finishExecution 记录执行的最终状态，execErr 不为 nil 时会作为错误信息保存下来
+func (p *PreemptScheduler) finishExecution(eid int64, token int64, progress int, status task.ExecStatus, execErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opTimeout)
 	defer cancel()
-	eid, err := p.executionDAO.Upsert(ctx, eid, status, uint8(progress))
+	errMsg := ""
+	if execErr != nil {
+		errMsg = execErr.Error()
+	}
+	err := p.executionDAO.Finish(ctx, eid, token, uint8(progress), status, errMsg)
 	if err != nil {
 		p.logger.Error("更新任务记录失败", slog.Int64("execution_id", eid),
 			slog.String("exec_status", status.String()), slog.Int("progress", progress),
@@ -260,8 +920,18 @@ func (p *PreemptScheduler) updateProgressStatus(eid int64, progress int, status
 	return err
 }
 
+// onStale 执行记录拒绝了写入的话，说明任务或者分片已经被其他调度节点重新抢占，
+// 通过 cancel 取消本节点的执行，但是不停止业务方的任务，新的持有者会继续探查执行结果
+func (p *PreemptScheduler) onStale(cancel context.CancelCauseFunc, err error) bool {
+	if !errors.Is(err, errs.ErrStaleFencingToken) {
+		return false
+	}
+	cancel(err)
+	return true
+}
+
 func (p *PreemptScheduler) stopTask(exec executor.Executor, t task.Task, eid int64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(context.Background(), p.opTimeout)
 	defer cancel()
 	err := exec.Stop(ctx, t, eid)
 	if err != nil {
@@ -0,0 +1,499 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/executor"
+	executormocks "github.com/ecodeclub/ecron/internal/executor/mocks"
+	"github.com/ecodeclub/ecron/internal/metrics"
+	"github.com/ecodeclub/ecron/internal/preempt"
+	preemptmocks "github.com/ecodeclub/ecron/internal/preempt/mocks"
+	daomocks "github.com/ecodeclub/ecron/internal/storage/mocks"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/sync/semaphore"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPreemptScheduler_Pause(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	repo.EXPECT().Pause(gomock.Any(), int64(1), true).Return(nil)
+	s := newPreemptScheduler(repo)
+
+	// 模拟任务正在本节点执行
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	s.running.Store(int64(1), cancel)
+
+	err := s.Pause(context.Background(), 1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, errs.ErrTaskPaused, context.Cause(ctx))
+}
+
+func TestPreemptScheduler_Resume(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) *daomocks.MockTaskCfgRepository
+		policy  task.ResumePolicy
+		wantErr error
+	}{
+		{
+			name: "补执行错过的执行",
+			mock: func(ctrl *gomock.Controller) *daomocks.MockTaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{
+					ID:           1,
+					ScheduleType: task.ScheduleTypeFixedDelay,
+					Interval:     time.Hour,
+					NextExecTime: time.Now().Add(-time.Hour),
+					LastStatus:   task.TaskStatusPaused,
+				}, nil)
+				repo.EXPECT().Resume(gomock.Any(), int64(1), gomock.Cond(func(x any) bool {
+					return time.Until(x.(time.Time)) <= 0
+				})).Return(nil)
+				return repo
+			},
+			policy: task.ResumePolicyFireOnce,
+		},
+		{
+			name: "跳过错过的执行",
+			mock: func(ctrl *gomock.Controller) *daomocks.MockTaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{
+					ID:           1,
+					ScheduleType: task.ScheduleTypeFixedDelay,
+					Interval:     time.Hour,
+					NextExecTime: time.Now().Add(-time.Hour),
+					LastStatus:   task.TaskStatusPaused,
+				}, nil)
+				repo.EXPECT().Resume(gomock.Any(), int64(1), gomock.Cond(func(x any) bool {
+					return time.Until(x.(time.Time)) > time.Minute*59
+				})).Return(nil)
+				return repo
+			},
+			policy: task.ResumePolicySkip,
+		},
+		{
+			name: "任务没有暂停",
+			mock: func(ctrl *gomock.Controller) *daomocks.MockTaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{
+					ID:         1,
+					LastStatus: task.TaskStatusWaiting,
+				}, nil)
+				return repo
+			},
+			wantErr: errs.ErrInvalidTaskStatus,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := newPreemptScheduler(tc.mock(ctrl))
+			err := s.Resume(context.Background(), 1, tc.policy)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestPreemptScheduler_Misfire(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tk := task.Task{
+		ID:            1,
+		CronExp:       "0 * * * * *",
+		NextExecTime:  time.Now().Truncate(time.Minute).Add(-5 * time.Minute),
+		LastStatus:    task.TaskStatusWaiting,
+		MisfirePolicy: task.MisfirePolicy{Strategy: task.MisfireStrategySkip},
+	}
+	leaser := preemptmocks.NewMockTaskLeaser(ctrl)
+	leaser.EXPECT().GetTask().Return(tk)
+	leaser.EXPECT().AutoRefresh(gomock.Any()).Return(make(chan preempt.Status), nil)
+	leaser.EXPECT().Release(gomock.Any()).Return(nil)
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	// 跳过本次执行，只记录执行记录
+	executionDAO.EXPECT().Create(gomock.Any(), gomock.Cond(func(x any) bool {
+		e := x.(task.Execution)
+		return e.Status == task.ExecStatusSkipped && e.Misfired == 6 && !e.EndTime.IsZero()
+	})).Return(int64(1), nil)
+
+	s := newPreemptScheduler(daomocks.NewMockTaskCfgRepository(ctrl))
+	s.executionDAO = executionDAO
+	var finished task.ExecStatus
+	s.RegisterFinishedHandler(func(_ context.Context, _ task.Task, status task.ExecStatus) {
+		finished = status
+	})
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().Name().Return("HTTP")
+	_ = s.limiter.Acquire(context.Background(), 1)
+	s.doTaskWithAutoRefresh(context.Background(), leaser, exec)
+	assert.Equal(t, task.ExecStatusSkipped, finished)
+}
+
+func TestPreemptScheduler_Trigger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tk := task.Task{
+		ID:            1,
+		CronExp:       "0 * * * * *",
+		Cfg:           `{"url":"http://localhost:8080/test","body":"{}"}`,
+		NextExecTime:  time.Now().Add(-5 * time.Minute),
+		RetryPolicy:   task.RetryPolicy{MaxAttempts: 3},
+		MisfirePolicy: task.MisfirePolicy{Strategy: task.MisfireStrategySkip},
+		TriggerTime:   time.Now(),
+		TriggerParams: `{"body":"{\"id\":1}"}`,
+		LastStatus:    task.TaskStatusWaiting,
+	}
+	leaser := preemptmocks.NewMockTaskLeaser(ctrl)
+	leaser.EXPECT().GetTask().Return(tk)
+	leaser.EXPECT().AutoRefresh(gomock.Any()).Return(make(chan preempt.Status), nil)
+	// 手动触发的执行失败后不重试
+	leaser.EXPECT().Release(gomock.Any()).Return(nil)
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	// 手动触发的执行不算错过执行
+	executionDAO.EXPECT().Create(gomock.Any(), gomock.Cond(func(x any) bool {
+		e := x.(task.Execution)
+		return e.TriggerType == task.TriggerTypeManual && e.Attempt == 1 && e.Misfired == 0
+	})).Return(int64(1), nil)
+	executionDAO.EXPECT().Finish(gomock.Any(), int64(1), int64(0), uint8(0), task.ExecStatusFailed, "").Return(nil)
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().Name().Return("HTTP")
+	exec.EXPECT().TaskTimeout(gomock.Any()).Return(time.Minute)
+	// 执行时使用覆盖后的配置
+	exec.EXPECT().Run(gomock.Any(), gomock.Cond(func(x any) bool {
+		return x.(task.Task).Cfg == `{"body":"{\"id\":1}","url":"http://localhost:8080/test"}`
+	}), int64(1)).Return(task.ExecStatusFailed, nil)
+
+	s := newPreemptScheduler(daomocks.NewMockTaskCfgRepository(ctrl))
+	s.executionDAO = executionDAO
+	_ = s.limiter.Acquire(context.Background(), 1)
+	s.doTaskWithAutoRefresh(context.Background(), leaser, exec)
+}
+
+// TestPreemptScheduler_StaleFencingToken 任务被其他调度节点接手后，本节点不再写入执行记录，也不重试
+func TestPreemptScheduler_StaleFencingToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tk := task.Task{
+		ID:           1,
+		CronExp:      "0 * * * * *",
+		NextExecTime: time.Now(),
+		RetryPolicy:  task.RetryPolicy{MaxAttempts: 3},
+		LastStatus:   task.TaskStatusWaiting,
+		FencingToken: 2,
+	}
+	leaser := preemptmocks.NewMockTaskLeaser(ctrl)
+	leaser.EXPECT().GetTask().Return(tk)
+	leaser.EXPECT().AutoRefresh(gomock.Any()).Return(make(chan preempt.Status), nil)
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().Create(gomock.Any(), gomock.Cond(func(x any) bool {
+		return x.(task.Execution).FencingToken == 2
+	})).Return(int64(1), nil)
+	executionDAO.EXPECT().UpdateProgressStatus(gomock.Any(), int64(1), int64(2), uint8(0), task.ExecStatusRunning).
+		Return(errs.ErrStaleFencingToken)
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().TaskTimeout(gomock.Any()).Return(time.Minute)
+	// 不会停止业务方的任务，新的持有者会继续探查
+	exec.EXPECT().Run(gomock.Any(), gomock.Any(), int64(1)).Return(task.ExecStatusRunning, nil)
+
+	s := newPreemptScheduler(daomocks.NewMockTaskCfgRepository(ctrl))
+	s.executionDAO = executionDAO
+	finished := false
+	s.RegisterFinishedHandler(func(_ context.Context, _ task.Task, _ task.ExecStatus) {
+		finished = true
+	})
+	_ = s.limiter.Acquire(context.Background(), 1)
+	s.doTaskWithAutoRefresh(context.Background(), leaser, exec)
+	assert.False(t, finished)
+	assert.True(t, s.limiter.TryAcquire(1))
+}
+
+func TestPreemptScheduler_Shard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tk := task.Task{
+		ID:         1,
+		Executor:   "http",
+		ShardCount: 2,
+		LastStatus: task.TaskStatusWaiting,
+	}
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().Create(gomock.Any(), gomock.Cond(func(x any) bool {
+		return x.(task.Execution).ShardTotal == 2
+	})).Return(int64(1), nil)
+	executionDAO.EXPECT().CreateShards(gomock.Any(), gomock.Cond(func(x any) bool {
+		e := x.(task.Execution)
+		return e.ID == 1 && e.ShardTotal == 2
+	})).Return(nil)
+	// 第一次汇总时还有分片没有执行结束
+	gomock.InOrder(
+		executionDAO.EXPECT().ListShards(gomock.Any(), int64(1)).Return([]task.Execution{
+			{ID: 2, ParentID: 1, ShardIndex: 0, ShardTotal: 2, Status: task.ExecStatusSuccess},
+			{ID: 3, ParentID: 1, ShardIndex: 1, ShardTotal: 2, Status: task.ExecStatusWaiting},
+		}, nil),
+		executionDAO.EXPECT().ListShards(gomock.Any(), int64(1)).Return([]task.Execution{
+			{ID: 2, ParentID: 1, ShardIndex: 0, ShardTotal: 2, Status: task.ExecStatusSuccess},
+			{ID: 3, ParentID: 1, ShardIndex: 1, ShardTotal: 2, Status: task.ExecStatusSuccess},
+		}, nil),
+	)
+	executionDAO.EXPECT().UpdateProgressStatus(gomock.Any(), int64(1), int64(0), uint8(50), task.ExecStatusRunning).Return(nil)
+	executionDAO.EXPECT().Finish(gomock.Any(), int64(1), int64(0), uint8(100), task.ExecStatusSuccess, "").Return(nil)
+	executionDAO.EXPECT().Finish(gomock.Any(), int64(3), int64(0), uint8(100), task.ExecStatusSuccess, "").Return(nil)
+	executionDAO.EXPECT().RefreshShard(gomock.Any(), int64(3), gomock.Any()).Return(nil).AnyTimes()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(tk, nil)
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().Name().Return("http").AnyTimes()
+	exec.EXPECT().TaskTimeout(gomock.Any()).Return(time.Minute)
+	// 分片在执行时带上分片的序号
+	exec.EXPECT().Run(gomock.Any(), gomock.Cond(func(x any) bool {
+		return x.(task.Task).Shard == task.Shard{Index: 1, Total: 2}
+	}), int64(3)).Return(task.ExecStatusSuccess, nil)
+
+	s := newPreemptScheduler(repo)
+	s.executionDAO = executionDAO
+	s.refreshInterval = time.Millisecond * 10
+	s.RegisterExecutor(exec)
+
+	status := s.doTask(context.Background(), tk, exec, 0, func(error) {})
+	assert.Equal(t, task.ExecStatusSuccess, status)
+	_ = s.shardLimiter.Acquire(context.Background(), 1)
+	s.doShard(context.Background(), task.Execution{ID: 3, Tid: 1, ParentID: 1, ShardIndex: 1, ShardTotal: 2})
+}
+
+func TestPreemptScheduler_ShardReclaimed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tk := task.Task{ID: 1, Executor: "http", ShardCount: 2}
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	gomock.InOrder(
+		executionDAO.EXPECT().RefreshShard(gomock.Any(), int64(3), gomock.Any()).Return(nil),
+		// 本节点续约失败的期间分片被其他调度节点接手
+		executionDAO.EXPECT().RefreshShard(gomock.Any(), int64(3), gomock.Any()).Return(errs.ErrShardReclaimed),
+	)
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(tk, nil)
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().Name().Return("http").AnyTimes()
+	exec.EXPECT().TaskTimeout(gomock.Any()).Return(time.Minute)
+	exec.EXPECT().Run(gomock.Any(), gomock.Any(), int64(3)).Return(task.ExecStatusRunning, nil)
+	exec.EXPECT().Explore(gomock.Any(), int64(3), gomock.Any()).Return(make(chan executor.Result))
+	executionDAO.EXPECT().UpdateProgressStatus(gomock.Any(), int64(3), int64(0), uint8(0), task.ExecStatusRunning).Return(nil)
+
+	s := newPreemptScheduler(repo)
+	s.executionDAO = executionDAO
+	s.refreshInterval = time.Millisecond * 10
+	s.RegisterExecutor(exec)
+
+	// 接手分片的调度节点会继续执行，本节点不停止任务，也不记录执行结果
+	_ = s.shardLimiter.Acquire(context.Background(), 1)
+	s.doShard(context.Background(), task.Execution{ID: 3, Tid: 1, ParentID: 1, ShardIndex: 1, ShardTotal: 2})
+}
+
+func TestPreemptScheduler_ShardStale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tk := task.Task{ID: 1, Executor: "http", ShardCount: 2}
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().RefreshShard(gomock.Any(), int64(3), gomock.Any()).Return(nil).AnyTimes()
+	// 分片所属的执行已经被其他调度节点接手，分片的执行记录拒绝写入
+	executionDAO.EXPECT().UpdateProgressStatus(gomock.Any(), int64(3), int64(1), uint8(0), task.ExecStatusRunning).
+		Return(errs.ErrStaleFencingToken)
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(tk, nil)
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().Name().Return("http").AnyTimes()
+	exec.EXPECT().TaskTimeout(gomock.Any()).Return(time.Minute)
+	exec.EXPECT().Run(gomock.Any(), gomock.Any(), int64(3)).Return(task.ExecStatusRunning, nil)
+
+	s := newPreemptScheduler(repo)
+	s.executionDAO = executionDAO
+	s.RegisterExecutor(exec)
+	// 本节点上同一个任务的执行不受影响
+	taskCtx, cancelTask := context.WithCancelCause(context.Background())
+	defer cancelTask(nil)
+	s.running.Store(tk.ID, cancelTask)
+
+	_ = s.shardLimiter.Acquire(context.Background(), 1)
+	s.doShard(context.Background(), task.Execution{ID: 3, Tid: 1, ParentID: 1, ShardIndex: 1, ShardTotal: 2, FencingToken: 1})
+	assert.NoError(t, taskCtx.Err())
+}
+
+func TestPreemptScheduler_Schedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leaser := preemptmocks.NewMockTaskLeaser(ctrl)
+	leaser.EXPECT().GetTask().Return(task.Task{ID: 1, Executor: "unknown"})
+	// 找不到执行器的任务直接释放
+	leaser.EXPECT().Release(gomock.Any()).Return(nil)
+	pe := preemptmocks.NewMockPreempter(ctrl)
+	// 每次抢占的数量都和空闲的位置一样多，释放的任务会归还位置
+	gomock.InOrder(
+		pe.EXPECT().PreemptBatch(gomock.Any(), 2).Return(nil, errs.ErrNoExecutableTask),
+		pe.EXPECT().PreemptBatch(gomock.Any(), 2).Return([]preempt.TaskLeaser{leaser}, nil),
+		pe.EXPECT().PreemptBatch(gomock.Any(), 2).DoAndReturn(func(context.Context, int) ([]preempt.TaskLeaser, error) {
+			cancel()
+			return nil, context.Canceled
+		}),
+	)
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().PreemptShard(gomock.Any(), gomock.Any(), gomock.Any()).Return(task.Execution{}, errs.ErrNoExecutableTask).AnyTimes()
+
+	s := newPreemptScheduler(daomocks.NewMockTaskCfgRepository(ctrl))
+	s.executionDAO = executionDAO
+	s.limiter = semaphore.NewWeighted(2)
+	s.pe = pe
+	s.metrics = metrics.New()
+	assert.Equal(t, context.Canceled, s.Schedule(ctx))
+
+	recorder := httptest.NewRecorder()
+	s.metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), `ecron_preempt_attempts_total{result="empty"} 1`)
+	assert.Contains(t, recorder.Body.String(), `ecron_preempt_attempts_total{result="success"} 1`)
+	assert.Contains(t, recorder.Body.String(), `ecron_scheduler_slots_in_use{kind="task"} 0`)
+}
+
+func TestPreemptScheduler_ScheduleLostRace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// 退避的时间比测试的超时时间长，抢占冲突后必须马上重试
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pe := preemptmocks.NewMockPreempter(ctrl)
+	gomock.InOrder(
+		pe.EXPECT().PreemptBatch(gomock.Any(), 1).Return(nil, preempt.ErrNoTaskToPreempt).Times(2),
+		pe.EXPECT().PreemptBatch(gomock.Any(), 1).DoAndReturn(func(context.Context, int) ([]preempt.TaskLeaser, error) {
+			cancel()
+			return nil, context.Canceled
+		}),
+	)
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().PreemptShard(gomock.Any(), gomock.Any(), gomock.Any()).Return(task.Execution{}, errs.ErrNoExecutableTask).AnyTimes()
+
+	s := newPreemptScheduler(daomocks.NewMockTaskCfgRepository(ctrl))
+	s.executionDAO = executionDAO
+	s.pe = pe
+	s.minBackoff, s.maxBackoff = time.Minute, time.Minute
+	assert.Equal(t, context.Canceled, s.Schedule(ctx))
+}
+
+func TestPreemptScheduler_Shutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	started := make(chan struct{})
+	tk := task.Task{ID: 1, Executor: "local", LastStatus: task.TaskStatusWaiting}
+	leaser := preemptmocks.NewMockTaskLeaser(ctrl)
+	leaser.EXPECT().GetTask().Return(tk).AnyTimes()
+	leaser.EXPECT().AutoRefresh(gomock.Any()).Return(make(chan preempt.Status), nil)
+	// 等待超时后交还租约，不释放也不重试
+	leaser.EXPECT().Handover(gomock.Any()).Return(nil)
+	pe := preemptmocks.NewMockPreempter(ctrl)
+	gomock.InOrder(
+		pe.EXPECT().PreemptBatch(gomock.Any(), 1).Return([]preempt.TaskLeaser{leaser}, nil),
+		pe.EXPECT().PreemptBatch(gomock.Any(), gomock.Any()).Return(nil, errs.ErrNoExecutableTask).AnyTimes(),
+	)
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().PreemptShard(gomock.Any(), gomock.Any(), gomock.Any()).Return(task.Execution{}, errs.ErrNoExecutableTask).AnyTimes()
+	executionDAO.EXPECT().Create(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+	executionDAO.EXPECT().UpdateProgressStatus(gomock.Any(), int64(1), int64(0), uint8(0), task.ExecStatusRunning).Return(nil)
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().Name().Return("local").AnyTimes()
+	exec.EXPECT().TaskTimeout(gomock.Any()).Return(time.Minute)
+	exec.EXPECT().Run(gomock.Any(), gomock.Any(), int64(1)).Return(task.ExecStatusRunning, nil)
+	// 业务方的任务不会被停止，执行记录保持执行中
+	exec.EXPECT().Explore(gomock.Any(), int64(1), gomock.Any()).DoAndReturn(
+		func(context.Context, int64, task.Task) <-chan executor.Result {
+			close(started)
+			return make(chan executor.Result)
+		})
+
+	s := newPreemptScheduler(daomocks.NewMockTaskCfgRepository(ctrl))
+	s.executionDAO = executionDAO
+	s.pe = pe
+	s.RegisterExecutor(exec)
+	scheduled := make(chan error)
+	go func() {
+		scheduled <- s.Schedule(context.Background())
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+	assert.NoError(t, <-scheduled)
+}
+
+func TestPreemptScheduler_Tracing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tk := task.Task{ID: 1, Name: "test", Executor: "HTTP", LastStatus: task.TaskStatusWaiting}
+	leaser := preemptmocks.NewMockTaskLeaser(ctrl)
+	leaser.EXPECT().GetTask().Return(tk)
+	leaser.EXPECT().AutoRefresh(gomock.Any()).Return(make(chan preempt.Status), nil)
+	leaser.EXPECT().Release(gomock.Any()).Return(nil)
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().Create(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+	executionDAO.EXPECT().Finish(gomock.Any(), int64(1), int64(0), uint8(100), task.ExecStatusSuccess, "").Return(nil)
+	exec := executormocks.NewMockExecutor(ctrl)
+	exec.EXPECT().Name().Return("HTTP")
+	exec.EXPECT().TaskTimeout(gomock.Any()).Return(time.Minute)
+	// 执行器收到的 ctx 中带有 ecron.run 的 span
+	exec.EXPECT().Run(gomock.Cond(func(x any) bool {
+		return trace.SpanContextFromContext(x.(context.Context)).IsValid()
+	}), gomock.Any(), int64(1)).Return(task.ExecStatusSuccess, nil)
+
+	s := newPreemptScheduler(daomocks.NewMockTaskCfgRepository(ctrl))
+	s.executionDAO = executionDAO
+	WithTracerProvider(tp)(s)
+	ctx, preemptSpan := tp.Tracer("test").Start(context.Background(), "ecron.preempt")
+	preemptSpan.End()
+	_ = s.limiter.Acquire(context.Background(), 1)
+	s.doTaskWithAutoRefresh(ctx, leaser, exec)
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	require.Contains(t, spans, "ecron.task")
+	require.Contains(t, spans, "ecron.run")
+	require.Contains(t, spans, "ecron.release")
+	root := spans["ecron.task"]
+	// 任务的执行是新的链路，通过 link 关联到抢占
+	assert.NotEqual(t, preemptSpan.SpanContext().TraceID(), root.SpanContext.TraceID())
+	require.Len(t, root.Links, 1)
+	assert.Equal(t, preemptSpan.SpanContext().SpanID(), root.Links[0].SpanContext.SpanID())
+	assert.Equal(t, root.SpanContext.SpanID(), spans["ecron.run"].Parent.SpanID())
+	assert.Equal(t, root.SpanContext.SpanID(), spans["ecron.release"].Parent.SpanID())
+}
+
+func newPreemptScheduler(repo *daomocks.MockTaskCfgRepository) *PreemptScheduler {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return NewPreemptScheduler(nil, time.Second, semaphore.NewWeighted(1), logger, nil, repo)
+}
@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"github.com/ecodeclub/ecron/internal/task"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ecodeclub/ecron/internal/scheduler"
+
+func taskAttributes(t task.Task) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.Int64("ecron.task.id", t.ID),
+		attribute.String("ecron.task.name", t.Name),
+		attribute.String("ecron.executor", t.Executor),
+		attribute.Int64("ecron.fencing_token", t.FencingToken),
+		attribute.Int("ecron.attempt", t.Attempt),
+	)
+}
+
+// endSpan 结束 span，err 不为 nil 时记录为错误
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setExecStatus 记录执行的最终状态，执行失败或者超时的 span 标记为错误
+func setExecStatus(span trace.Span, status task.ExecStatus) {
+	span.SetAttributes(attribute.String("ecron.execution.status", status.String()))
+	switch status {
+	case task.ExecStatusFailed, task.ExecStatusDeadlineExceeded, task.ExecStatusUnknown:
+		span.SetStatus(codes.Error, status.String())
+	}
+}
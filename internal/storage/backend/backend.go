@@ -0,0 +1,126 @@
+// Package backend 按照驱动的名称创建对应的存储实现，供命令行和 lib 包组装调度节点
+package backend
+
+import (
+	"context"
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/preempt"
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/storage/migrate"
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"github.com/ecodeclub/ecron/internal/storage/postgres"
+	ecronredis "github.com/ecodeclub/ecron/internal/storage/redis"
+	"github.com/ecodeclub/ecron/internal/storage/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// 抢占任务的方式
+const (
+	// PreempterDB 使用存储任务的数据库抢占
+	PreempterDB = "db"
+	// PreempterRedis 使用 Redis 抢占，修改任务时同步修改 Redis
+	PreempterRedis = "redis"
+)
+
+type Backend struct {
+	driver string
+	db     *gorm.DB
+	// 没有经过 Redis 包装的任务表
+	taskRepo     storage.TaskCfgRepository
+	redis        redis.Cmdable
+	redisPrefix  string
+	redisOpts    []ecronredis.Option
+	TaskRepo     storage.TaskCfgRepository
+	ExecutionDAO storage.ExecutionDAO
+	WorkflowDAO  storage.WorkflowDAO
+}
+
+// New driver 为空时使用 db 的方言名称，不支持的驱动返回 errs.ErrUnsupportedStorage
+func New(driver string, db *gorm.DB) (*Backend, error) {
+	if driver == "" {
+		driver = db.Dialector.Name()
+	}
+	b := &Backend{driver: driver, db: db}
+	switch driver {
+	case MySQL:
+		b.TaskRepo = mysql.NewGormTaskCfgRepository(db)
+		b.ExecutionDAO = mysql.NewGormExecutionDAO(db)
+		b.WorkflowDAO = mysql.NewGormWorkflowDAO(db)
+	case Postgres:
+		b.TaskRepo = postgres.NewGormTaskCfgRepository(db)
+		b.ExecutionDAO = postgres.NewGormExecutionDAO(db)
+		b.WorkflowDAO = postgres.NewGormWorkflowDAO(db)
+	case SQLite:
+		b.TaskRepo = sqlite.NewGormTaskCfgRepository(db)
+		b.ExecutionDAO = sqlite.NewGormExecutionDAO(db)
+		b.WorkflowDAO = sqlite.NewGormWorkflowDAO(db)
+	default:
+		return nil, fmt.Errorf("%w: %s", errs.ErrUnsupportedStorage, driver)
+	}
+	b.taskRepo = b.TaskRepo
+	return b, nil
+}
+
+// UseRedis 使用 Redis 抢占任务，TaskRepo 修改任务后会同步修改 Redis，prefix 为空时使用 redis.DefaultPrefix。
+// 需要在使用 TaskRepo 之前调用
+func (b *Backend) UseRedis(client redis.Cmdable, prefix string, opts ...ecronredis.Option) {
+	if prefix == "" {
+		prefix = ecronredis.DefaultPrefix
+	}
+	b.redis, b.redisPrefix, b.redisOpts = client, prefix, opts
+	b.TaskRepo = ecronredis.NewTaskCfgRepository(b.taskRepo, client, prefix)
+}
+
+// Load 使用 Redis 抢占时，把任务表中没有结束的任务加入 Redis，启动调度之前调用
+func (b *Backend) Load(ctx context.Context) error {
+	repo, ok := b.TaskRepo.(*ecronredis.TaskCfgRepository)
+	if !ok {
+		return nil
+	}
+	return repo.Load(ctx)
+}
+
+// NewPreempter 使用存储任务的数据库抢占任务，调用过 UseRedis 时使用 Redis 抢占，忽略 opts。
+// 持有者每隔 refreshInterval 续约一次，超过 leaseTTL 没有续约的任务可以被其他调度节点抢占，
+// 所以 refreshInterval 需要小于 leaseTTL
+func (b *Backend) NewPreempter(batchSize int, leaseTTL, refreshInterval time.Duration,
+	opts ...mysql.PreempterOption) (preempt.Preempter, error) {
+	if refreshInterval <= 0 || refreshInterval >= leaseTTL {
+		return nil, fmt.Errorf("%w: 续约间隔 %s 需要大于 0 并且小于租约的有效期 %s",
+			errs.ErrInCorrectConfig, refreshInterval, leaseTTL)
+	}
+	if b.redis != nil {
+		ropts := append([]ecronredis.Option{ecronredis.WithPrefix(b.redisPrefix),
+			ecronredis.WithRefreshInterval(refreshInterval)}, b.redisOpts...)
+		return ecronredis.NewPreempter(b.redis, b.taskRepo, batchSize, leaseTTL, ropts...), nil
+	}
+	opts = append(opts, mysql.WithRefreshInterval(refreshInterval))
+	switch b.driver {
+	case Postgres:
+		return postgres.NewPreempter(b.db, batchSize, leaseTTL, opts...), nil
+	case SQLite:
+		return sqlite.NewPreempter(b.db, batchSize, leaseTTL, opts...), nil
+	default:
+		return mysql.NewPreempter(b.db, batchSize, leaseTTL, opts...), nil
+	}
+}
+
+func (b *Backend) NewMigrator() (*migrate.Migrator, error) {
+	switch b.driver {
+	case Postgres:
+		return postgres.NewMigrator(b.db)
+	case SQLite:
+		return sqlite.NewMigrator(b.db)
+	default:
+		return mysql.NewMigrator(b.db)
+	}
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/errs"
+)
+
+const (
+	lockName = "ecron_migrate"
+	// 等待其他节点迁移结束的时间，单位秒
+	lockTimeout = 300
+	// PostgreSQL advisory lock 的 key，随意选取的常量，只需要不和其他程序冲突
+	advisoryLockKey int64 = 0x6563726f6e
+)
+
+// Dialect 不同数据库获取迁移锁和执行迁移的方式
+type Dialect struct {
+	// lock 获取全局的迁移锁，返回释放锁的函数。锁和 conn 绑定，conn 断开时数据库也会释放锁
+	lock func(ctx context.Context, conn *sql.Conn) (func(ctx context.Context), error)
+	// 迁移是否在事务中执行。MySQL 的 DDL 会隐式提交事务，执行失败时版本会停留在 dirty 状态
+	transactional bool
+}
+
+var (
+	MySQL = Dialect{
+		lock:          mysqlLock,
+		transactional: false,
+	}
+	Postgres = Dialect{
+		lock:          postgresLock,
+		transactional: true,
+	}
+	// SQLite 只用于单节点部署，同一时间只有一个写事务，不需要额外的锁
+	SQLite = Dialect{
+		lock: func(ctx context.Context, conn *sql.Conn) (func(ctx context.Context), error) {
+			return func(ctx context.Context) {}, nil
+		},
+		transactional: true,
+	}
+)
+
+func mysqlLock(ctx context.Context, conn *sql.Conn) (func(ctx context.Context), error) {
+	var res sql.NullInt64
+	err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT GET_LOCK('%s', %d)", lockName, lockTimeout)).Scan(&res)
+	if err != nil {
+		return nil, err
+	}
+	// 超时返回 0，出错返回 NULL
+	if res.Int64 != 1 {
+		return nil, errs.ErrMigrationLocked
+	}
+	return func(ctx context.Context) {
+		_, _ = conn.ExecContext(ctx, fmt.Sprintf("SELECT RELEASE_LOCK('%s')", lockName))
+	}, nil
+}
+
+// postgresLock 一直等待到获取锁或者 ctx 结束
+func postgresLock(ctx context.Context, conn *sql.Conn) (func(ctx context.Context), error) {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SELECT pg_advisory_lock(%d)", advisoryLockKey)); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) {
+		_, _ = conn.ExecContext(ctx, fmt.Sprintf("SELECT pg_advisory_unlock(%d)", advisoryLockKey))
+	}, nil
+}
@@ -0,0 +1,298 @@
+// Package migrate 执行各个存储内嵌的版本化迁移脚本。
+// 脚本的文件名是 {version}_{name}.up.sql 和 {version}_{name}.down.sql，version 从 1 开始连续递增，
+// 每个版本都需要同时提供 up 和 down 两个脚本。已经执行的版本记录在 schema_migrations 表中
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const versionTable = "schema_migrations"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+type Migrator struct {
+	db      *sql.DB
+	dialect Dialect
+	// 按照版本排序，第 i 个迁移的版本是 i+1
+	migrations []migration
+}
+
+// New 从 source 的根目录读取迁移脚本，脚本不完整或者版本不连续时返回 errs.ErrInvalidMigration
+func New(db *sql.DB, dialect Dialect, source fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+	ms := make(map[int64]*migration, len(entries)/2)
+	for _, e := range entries {
+		matches := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || matches == nil {
+			return nil, fmt.Errorf("%w: 文件名 %s 不符合 {version}_{name}.{up|down}.sql", errs.ErrInvalidMigration, e.Name())
+		}
+		version, _ := strconv.ParseInt(matches[1], 10, 64)
+		data, err := fs.ReadFile(source, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := ms[version]
+		if !ok {
+			m = &migration{version: version, name: matches[2]}
+			ms[version] = m
+		}
+		if m.name != matches[2] {
+			return nil, fmt.Errorf("%w: 版本 %d 有多个名称 %s 和 %s", errs.ErrInvalidMigration, version, m.name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+	res := &Migrator{db: db, dialect: dialect, migrations: make([]migration, 0, len(ms))}
+	for _, m := range ms {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("%w: 版本 %d 缺少 up 或者 down 脚本", errs.ErrInvalidMigration, m.version)
+		}
+		res.migrations = append(res.migrations, *m)
+	}
+	sort.Slice(res.migrations, func(i, j int) bool {
+		return res.migrations[i].version < res.migrations[j].version
+	})
+	for i, m := range res.migrations {
+		if m.version != int64(i+1) {
+			return nil, fmt.Errorf("%w: 缺少版本 %d", errs.ErrInvalidMigration, i+1)
+		}
+	}
+	return res, nil
+}
+
+// Latest 程序内嵌的迁移脚本的最新版本
+func (m *Migrator) Latest() int64 {
+	return int64(len(m.migrations))
+}
+
+// Version 返回数据库当前的版本，还没有执行过迁移时返回 0。
+// dirty 为 true 表示这个版本的迁移执行失败了，需要手动修复之后删除 schema_migrations 中对应的记录
+func (m *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	if err = m.createVersionTable(ctx, m.db); err != nil {
+		return 0, false, err
+	}
+	return m.version(ctx, m.db)
+}
+
+// Check 确认数据库的版本和程序内嵌的迁移脚本一致，调度节点启动前调用
+func (m *Migrator) Check(ctx context.Context) error {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w: 版本 %d", errs.ErrDirtySchema, version)
+	}
+	if version != m.Latest() {
+		return fmt.Errorf("%w: 数据库的版本是 %d，程序需要的版本是 %d，请先执行 ecron migrate",
+			errs.ErrSchemaVersionMismatch, version, m.Latest())
+	}
+	return nil
+}
+
+// Up 执行所有还没有执行的迁移。多个调度节点同时执行时只有一个节点会真正执行，其余节点等待
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn, version int64) error {
+		for _, mg := range m.migrations[version:] {
+			if err := m.apply(ctx, conn, mg, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down 回滚最近的 steps 个版本
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn, version int64) error {
+		for ; steps > 0 && version > 0; steps, version = steps-1, version-1 {
+			if err := m.apply(ctx, conn, m.migrations[version-1], false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withLock 获取迁移锁之后，在同一个连接上读取当前的版本并调用 fn
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, version int64) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	unlock, err := m.dialect.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer unlock(context.WithoutCancel(ctx))
+	if err = m.createVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	version, dirty, err := m.version(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w: 版本 %d", errs.ErrDirtySchema, version)
+	}
+	if version > m.Latest() {
+		return fmt.Errorf("%w: 数据库的版本 %d 比程序的版本 %d 新",
+			errs.ErrSchemaVersionMismatch, version, m.Latest())
+	}
+	return fn(conn, version)
+}
+
+// apply 执行一个迁移并修改版本记录。
+// 不支持在事务中执行 DDL 的数据库先把版本标记为 dirty，执行成功之后再清除
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg migration, up bool) error {
+	script := mg.down
+	if up {
+		script = mg.up
+	}
+	if m.dialect.transactional {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err = m.exec(ctx, tx, mg, script); err == nil {
+			if up {
+				err = insertVersion(ctx, tx, mg.version, false)
+			} else {
+				err = deleteVersion(ctx, tx, mg.version)
+			}
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if up {
+		if err := insertVersion(ctx, conn, mg.version, true); err != nil {
+			return err
+		}
+		if err := m.exec(ctx, conn, mg, script); err != nil {
+			return err
+		}
+		return markVersion(ctx, conn, mg.version, false)
+	}
+	if err := markVersion(ctx, conn, mg.version, true); err != nil {
+		return err
+	}
+	if err := m.exec(ctx, conn, mg, script); err != nil {
+		return err
+	}
+	return deleteVersion(ctx, conn, mg.version)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (m *Migrator) exec(ctx context.Context, e execer, mg migration, script string) error {
+	for _, stmt := range statements(script) {
+		if _, err := e.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("执行迁移 %d_%s 失败: %w", mg.version, mg.name, err)
+		}
+	}
+	return nil
+}
+
+// 版本记录只有整数和布尔值，直接拼接到 SQL 中，避免处理不同数据库的占位符
+
+func insertVersion(ctx context.Context, e execer, version int64, dirty bool) error {
+	_, err := e.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version, dirty, applied_at) VALUES (%d, %s, %d)",
+		versionTable, version, boolean(dirty), time.Now().UnixMilli()))
+	return err
+}
+
+func markVersion(ctx context.Context, e execer, version int64, dirty bool) error {
+	_, err := e.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET dirty = %s WHERE version = %d",
+		versionTable, boolean(dirty), version))
+	return err
+}
+
+func deleteVersion(ctx context.Context, e execer, version int64) error {
+	_, err := e.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %d", versionTable, version))
+	return err
+}
+
+func boolean(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (m *Migrator) createVersionTable(ctx context.Context, e execer) error {
+	_, err := e.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+versionTable+
+		" (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL, applied_at BIGINT NOT NULL)")
+	return err
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m *Migrator) version(ctx context.Context, q querier) (int64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := q.QueryRowContext(ctx, "SELECT version, dirty FROM "+versionTable+
+		" ORDER BY version DESC LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// statements 按照行尾的分号拆分脚本，驱动不一定支持一次执行多条语句
+func statements(script string) []string {
+	var (
+		res []string
+		sb  strings.Builder
+	)
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if sb.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+		if strings.HasSuffix(trimmed, ";") {
+			res = append(res, strings.TrimSpace(sb.String()))
+			sb.Reset()
+		}
+	}
+	if s := strings.TrimSpace(sb.String()); s != "" {
+		res = append(res, s)
+	}
+	return res
+}
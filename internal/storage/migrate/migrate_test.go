@@ -0,0 +1,291 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name       string
+		source     fstest.MapFS
+		wantLatest int64
+		wantErr    error
+	}{
+		{
+			name: "多个版本",
+			source: fstest.MapFS{
+				"0001_init.up.sql":     {Data: []byte("CREATE TABLE a (id INT);")},
+				"0001_init.down.sql":   {Data: []byte("DROP TABLE a;")},
+				"0002_add_b.up.sql":    {Data: []byte("CREATE TABLE b (id INT);")},
+				"0002_add_b.down.sql":  {Data: []byte("DROP TABLE b;")},
+				"0003_add_c.up.sql":    {Data: []byte("CREATE TABLE c (id INT);")},
+				"0003_add_c.down.sql":  {Data: []byte("DROP TABLE c;")},
+				"0004_drop_c.up.sql":   {Data: []byte("DROP TABLE c;")},
+				"0004_drop_c.down.sql": {Data: []byte("CREATE TABLE c (id INT);")},
+			},
+			wantLatest: 4,
+		},
+		{
+			name:       "没有迁移脚本",
+			source:     fstest.MapFS{},
+			wantLatest: 0,
+		},
+		{
+			name: "文件名错误",
+			source: fstest.MapFS{
+				"init.sql": {Data: []byte("CREATE TABLE a (id INT);")},
+			},
+			wantErr: errs.ErrInvalidMigration,
+		},
+		{
+			name: "缺少 down 脚本",
+			source: fstest.MapFS{
+				"0001_init.up.sql": {Data: []byte("CREATE TABLE a (id INT);")},
+			},
+			wantErr: errs.ErrInvalidMigration,
+		},
+		{
+			name: "版本不连续",
+			source: fstest.MapFS{
+				"0001_init.up.sql":    {Data: []byte("CREATE TABLE a (id INT);")},
+				"0001_init.down.sql":  {Data: []byte("DROP TABLE a;")},
+				"0003_add_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+				"0003_add_b.down.sql": {Data: []byte("DROP TABLE b;")},
+			},
+			wantErr: errs.ErrInvalidMigration,
+		},
+		{
+			name: "同一个版本的名称不一致",
+			source: fstest.MapFS{
+				"0001_init.up.sql":     {Data: []byte("CREATE TABLE a (id INT);")},
+				"0001_create.down.sql": {Data: []byte("DROP TABLE a;")},
+			},
+			wantErr: errs.ErrInvalidMigration,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := New(nil, SQLite, tc.source)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantLatest, m.Latest())
+		})
+	}
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	db := openSQLite(t)
+	m, err := New(db, SQLite, fstest.MapFS{
+		"0001_init.up.sql":    {Data: []byte("CREATE TABLE a (id INT);\nCREATE INDEX idx_id ON a (id);")},
+		"0001_init.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"0002_add_b.up.sql":   {Data: []byte("-- 第二个版本\nCREATE TABLE b\n(\n    id INT\n);")},
+		"0002_add_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, m.Check(ctx), errs.ErrSchemaVersionMismatch)
+	require.NoError(t, m.Up(ctx))
+	assertVersion(t, m, 2)
+	assert.NoError(t, m.Check(ctx))
+	assert.True(t, tableExists(t, db, "a"))
+	assert.True(t, tableExists(t, db, "b"))
+	// 已经是最新的版本，再次执行不会有任何影响
+	require.NoError(t, m.Up(ctx))
+	assertVersion(t, m, 2)
+
+	require.NoError(t, m.Down(ctx, 1))
+	assertVersion(t, m, 1)
+	assert.ErrorIs(t, m.Check(ctx), errs.ErrSchemaVersionMismatch)
+	assert.True(t, tableExists(t, db, "a"))
+	assert.False(t, tableExists(t, db, "b"))
+
+	// 回滚的版本数量超过已经执行的版本时回滚到 0
+	require.NoError(t, m.Down(ctx, 5))
+	assertVersion(t, m, 0)
+	assert.False(t, tableExists(t, db, "a"))
+}
+
+func TestMigrator_UpFailed(t *testing.T) {
+	db := openSQLite(t)
+	m, err := New(db, SQLite, fstest.MapFS{
+		"0001_init.up.sql":    {Data: []byte("CREATE TABLE a (id INT);")},
+		"0001_init.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"0002_add_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT);\nCREATE TABLE a (id INT);")},
+		"0002_add_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	})
+	require.NoError(t, err)
+
+	assert.Error(t, m.Up(context.Background()))
+	// 失败的迁移在事务中回滚，停留在上一个版本
+	assertVersion(t, m, 1)
+	assert.False(t, tableExists(t, db, "b"))
+}
+
+func TestMigrator_DatabaseNewer(t *testing.T) {
+	db := openSQLite(t)
+	source := fstest.MapFS{
+		"0001_init.up.sql":    {Data: []byte("CREATE TABLE a (id INT);")},
+		"0001_init.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"0002_add_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+		"0002_add_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	newer, err := New(db, SQLite, source)
+	require.NoError(t, err)
+	require.NoError(t, newer.Up(context.Background()))
+
+	delete(source, "0002_add_b.up.sql")
+	delete(source, "0002_add_b.down.sql")
+	older, err := New(db, SQLite, source)
+	require.NoError(t, err)
+	// 旧版本的程序不能修改新版本的表结构
+	assert.ErrorIs(t, older.Up(context.Background()), errs.ErrSchemaVersionMismatch)
+	assert.ErrorIs(t, older.Check(context.Background()), errs.ErrSchemaVersionMismatch)
+}
+
+func TestMigrator_MySQL(t *testing.T) {
+	source := fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte("CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);")},
+		"0001_init.down.sql": {Data: []byte("DROP TABLE b;\nDROP TABLE a;")},
+	}
+	testCases := []struct {
+		name    string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "迁移成功",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}))
+				// 先标记为 dirty，执行成功之后再清除
+				mock.ExpectExec("INSERT INTO schema_migrations .+ VALUES \\(1, TRUE, \\d+\\)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("CREATE TABLE a").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE schema_migrations SET dirty = FALSE WHERE version = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name: "执行失败后保持 dirty",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}))
+				mock.ExpectExec("INSERT INTO schema_migrations .+ VALUES \\(1, TRUE, \\d+\\)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("CREATE TABLE a").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("CREATE TABLE b").WillReturnError(errors.New("mock db error"))
+				mock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: errors.New("执行迁移 1_init 失败: mock db error"),
+		},
+		{
+			name: "上一次迁移失败",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").
+					WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(1, true))
+				mock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: errs.ErrDirtySchema,
+		},
+		{
+			name: "获取锁超时",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+			},
+			wantErr: errs.ErrMigrationLocked,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			tc.mock(mock)
+			m, err := New(db, MySQL, source)
+			require.NoError(t, err)
+
+			err = m.Up(context.Background())
+			switch {
+			case tc.wantErr == nil:
+				assert.NoError(t, err)
+			case errors.Is(err, tc.wantErr):
+			default:
+				assert.EqualError(t, err, tc.wantErr.Error())
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestStatements(t *testing.T) {
+	testCases := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "多条语句",
+			script: "CREATE TABLE a\n(\n    id INT\n);\n\nCREATE INDEX idx_id ON a (id);\n",
+			want:   []string{"CREATE TABLE a\n(\n    id INT\n);", "CREATE INDEX idx_id ON a (id);"},
+		},
+		{
+			name:   "跳过注释和空行",
+			script: "-- 注释\n\nDROP TABLE a;\n-- 结尾的注释\n",
+			want:   []string{"DROP TABLE a;"},
+		},
+		{
+			name:   "最后一条语句没有分号",
+			script: "DROP TABLE a;\nDROP TABLE b",
+			want:   []string{"DROP TABLE a;", "DROP TABLE b"},
+		},
+		{
+			name:   "分号不在行尾",
+			script: "INSERT INTO a VALUES ('a;b');\n",
+			want:   []string{"INSERT INTO a VALUES ('a;b');"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, statements(tc.script))
+		})
+	}
+}
+
+func openSQLite(t *testing.T) *sql.DB {
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "ecron.db")))
+	require.NoError(t, err)
+	db, err := gdb.DB()
+	require.NoError(t, err)
+	return db
+}
+
+func assertVersion(t *testing.T, m *Migrator, want int64) {
+	version, dirty, err := m.Version(context.Background())
+	require.NoError(t, err)
+	assert.False(t, dirty)
+	assert.Equal(t, want, version)
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var cnt int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&cnt)
+	require.NoError(t, err)
+	return cnt > 0
+}
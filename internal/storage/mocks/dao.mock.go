@@ -14,6 +14,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	storage "github.com/ecodeclub/ecron/internal/storage"
 	task "github.com/ecodeclub/ecron/internal/task"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -42,11 +43,12 @@ func (m *MockTaskCfgRepository) EXPECT() *MockTaskCfgRepositoryMockRecorder {
 }
 
 // Add mocks base method.
-func (m *MockTaskCfgRepository) Add(ctx context.Context, t task.Task) error {
+func (m *MockTaskCfgRepository) Add(ctx context.Context, t task.Task) (int64, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Add", ctx, t)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Add indicates an expected call of Add.
@@ -55,6 +57,122 @@ func (mr *MockTaskCfgRepositoryMockRecorder) Add(ctx, t any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockTaskCfgRepository)(nil).Add), ctx, t)
 }
 
+// ClearTrigger mocks base method.
+func (m *MockTaskCfgRepository) ClearTrigger(ctx context.Context, id int64, triggerTime time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearTrigger", ctx, id, triggerTime)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearTrigger indicates an expected call of ClearTrigger.
+func (mr *MockTaskCfgRepositoryMockRecorder) ClearTrigger(ctx, id, triggerTime any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearTrigger", reflect.TypeOf((*MockTaskCfgRepository)(nil).ClearTrigger), ctx, id, triggerTime)
+}
+
+// Delete mocks base method.
+func (m *MockTaskCfgRepository) Delete(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockTaskCfgRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockTaskCfgRepository)(nil).Delete), ctx, id)
+}
+
+// Get mocks base method.
+func (m *MockTaskCfgRepository) Get(ctx context.Context, id int64) (task.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(task.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockTaskCfgRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockTaskCfgRepository)(nil).Get), ctx, id)
+}
+
+// GetByName mocks base method.
+func (m *MockTaskCfgRepository) GetByName(ctx context.Context, name string) (task.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByName", ctx, name)
+	ret0, _ := ret[0].(task.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByName indicates an expected call of GetByName.
+func (mr *MockTaskCfgRepositoryMockRecorder) GetByName(ctx, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByName", reflect.TypeOf((*MockTaskCfgRepository)(nil).GetByName), ctx, name)
+}
+
+// List mocks base method.
+func (m *MockTaskCfgRepository) List(ctx context.Context, offset, limit int) ([]task.Task, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, offset, limit)
+	ret0, _ := ret[0].([]task.Task)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockTaskCfgRepositoryMockRecorder) List(ctx, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockTaskCfgRepository)(nil).List), ctx, offset, limit)
+}
+
+// Pause mocks base method.
+func (m *MockTaskCfgRepository) Pause(ctx context.Context, id int64, stop bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pause", ctx, id, stop)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockTaskCfgRepositoryMockRecorder) Pause(ctx, id, stop any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockTaskCfgRepository)(nil).Pause), ctx, id, stop)
+}
+
+// Ready mocks base method.
+func (m *MockTaskCfgRepository) Ready(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ready", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ready indicates an expected call of Ready.
+func (mr *MockTaskCfgRepositoryMockRecorder) Ready(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ready", reflect.TypeOf((*MockTaskCfgRepository)(nil).Ready), ctx, id)
+}
+
+// Resume mocks base method.
+func (m *MockTaskCfgRepository) Resume(ctx context.Context, id int64, next time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resume", ctx, id, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Resume indicates an expected call of Resume.
+func (mr *MockTaskCfgRepositoryMockRecorder) Resume(ctx, id, next any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockTaskCfgRepository)(nil).Resume), ctx, id, next)
+}
+
 // Stop mocks base method.
 func (m *MockTaskCfgRepository) Stop(ctx context.Context, id int64) error {
 	m.ctrl.T.Helper()
@@ -69,6 +187,34 @@ func (mr *MockTaskCfgRepositoryMockRecorder) Stop(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockTaskCfgRepository)(nil).Stop), ctx, id)
 }
 
+// Trigger mocks base method.
+func (m *MockTaskCfgRepository) Trigger(ctx context.Context, id int64, params string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Trigger", ctx, id, params)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Trigger indicates an expected call of Trigger.
+func (mr *MockTaskCfgRepositoryMockRecorder) Trigger(ctx, id, params any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Trigger", reflect.TypeOf((*MockTaskCfgRepository)(nil).Trigger), ctx, id, params)
+}
+
+// Update mocks base method.
+func (m *MockTaskCfgRepository) Update(ctx context.Context, t task.Task) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockTaskCfgRepositoryMockRecorder) Update(ctx, t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockTaskCfgRepository)(nil).Update), ctx, t)
+}
+
 // UpdateNextTime mocks base method.
 func (m *MockTaskCfgRepository) UpdateNextTime(ctx context.Context, id int64, next time.Time) error {
 	m.ctrl.T.Helper()
@@ -106,6 +252,63 @@ func (m *MockExecutionDAO) EXPECT() *MockExecutionDAOMockRecorder {
 	return m.recorder
 }
 
+// Create mocks base method.
+func (m *MockExecutionDAO) Create(ctx context.Context, e task.Execution) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, e)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockExecutionDAOMockRecorder) Create(ctx, e any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockExecutionDAO)(nil).Create), ctx, e)
+}
+
+// CreateShards mocks base method.
+func (m *MockExecutionDAO) CreateShards(ctx context.Context, parent task.Execution) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateShards", ctx, parent)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateShards indicates an expected call of CreateShards.
+func (mr *MockExecutionDAOMockRecorder) CreateShards(ctx, parent any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateShards", reflect.TypeOf((*MockExecutionDAO)(nil).CreateShards), ctx, parent)
+}
+
+// Finish mocks base method.
+func (m *MockExecutionDAO) Finish(ctx context.Context, eid, token int64, progress uint8, status task.ExecStatus, errMsg string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Finish", ctx, eid, token, progress, status, errMsg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Finish indicates an expected call of Finish.
+func (mr *MockExecutionDAOMockRecorder) Finish(ctx, eid, token, progress, status, errMsg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Finish", reflect.TypeOf((*MockExecutionDAO)(nil).Finish), ctx, eid, token, progress, status, errMsg)
+}
+
+// FinishWaitingShards mocks base method.
+func (m *MockExecutionDAO) FinishWaitingShards(ctx context.Context, parentID, token int64, status task.ExecStatus, errMsg string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishWaitingShards", ctx, parentID, token, status, errMsg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishWaitingShards indicates an expected call of FinishWaitingShards.
+func (mr *MockExecutionDAOMockRecorder) FinishWaitingShards(ctx, parentID, token, status, errMsg any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishWaitingShards", reflect.TypeOf((*MockExecutionDAO)(nil).FinishWaitingShards), ctx, parentID, token, status, errMsg)
+}
+
 // GetLastExecution mocks base method.
 func (m *MockExecutionDAO) GetLastExecution(ctx context.Context, tid int64) (task.Execution, error) {
 	m.ctrl.T.Helper()
@@ -121,17 +324,204 @@ func (mr *MockExecutionDAOMockRecorder) GetLastExecution(ctx, tid any) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastExecution", reflect.TypeOf((*MockExecutionDAO)(nil).GetLastExecution), ctx, tid)
 }
 
-// Upsert mocks base method.
-func (m *MockExecutionDAO) Upsert(ctx context.Context, id int64, status task.ExecStatus, progress uint8) (int64, error) {
+// ListByTask mocks base method.
+func (m *MockExecutionDAO) ListByTask(ctx context.Context, tid int64, q storage.ExecutionQuery) ([]task.Execution, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByTask", ctx, tid, q)
+	ret0, _ := ret[0].([]task.Execution)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListByTask indicates an expected call of ListByTask.
+func (mr *MockExecutionDAOMockRecorder) ListByTask(ctx, tid, q any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByTask", reflect.TypeOf((*MockExecutionDAO)(nil).ListByTask), ctx, tid, q)
+}
+
+// ListShards mocks base method.
+func (m *MockExecutionDAO) ListShards(ctx context.Context, parentID int64) ([]task.Execution, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListShards", ctx, parentID)
+	ret0, _ := ret[0].([]task.Execution)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListShards indicates an expected call of ListShards.
+func (mr *MockExecutionDAOMockRecorder) ListShards(ctx, parentID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListShards", reflect.TypeOf((*MockExecutionDAO)(nil).ListShards), ctx, parentID)
+}
+
+// PreemptShard mocks base method.
+func (m *MockExecutionDAO) PreemptShard(ctx context.Context, node string, leaseTTL time.Duration) (task.Execution, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreemptShard", ctx, node, leaseTTL)
+	ret0, _ := ret[0].(task.Execution)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreemptShard indicates an expected call of PreemptShard.
+func (mr *MockExecutionDAOMockRecorder) PreemptShard(ctx, node, leaseTTL any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreemptShard", reflect.TypeOf((*MockExecutionDAO)(nil).PreemptShard), ctx, node, leaseTTL)
+}
+
+// RefreshShard mocks base method.
+func (m *MockExecutionDAO) RefreshShard(ctx context.Context, eid int64, node string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshShard", ctx, eid, node)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefreshShard indicates an expected call of RefreshShard.
+func (mr *MockExecutionDAOMockRecorder) RefreshShard(ctx, eid, node any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshShard", reflect.TypeOf((*MockExecutionDAO)(nil).RefreshShard), ctx, eid, node)
+}
+
+// UpdateProgressStatus mocks base method.
+func (m *MockExecutionDAO) UpdateProgressStatus(ctx context.Context, eid, token int64, progress uint8, status task.ExecStatus) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Upsert", ctx, id, status, progress)
+	ret := m.ctrl.Call(m, "UpdateProgressStatus", ctx, eid, token, progress, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProgressStatus indicates an expected call of UpdateProgressStatus.
+func (mr *MockExecutionDAOMockRecorder) UpdateProgressStatus(ctx, eid, token, progress, status any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProgressStatus", reflect.TypeOf((*MockExecutionDAO)(nil).UpdateProgressStatus), ctx, eid, token, progress, status)
+}
+
+// MockWorkflowDAO is a mock of WorkflowDAO interface.
+type MockWorkflowDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockWorkflowDAOMockRecorder
+}
+
+// MockWorkflowDAOMockRecorder is the mock recorder for MockWorkflowDAO.
+type MockWorkflowDAOMockRecorder struct {
+	mock *MockWorkflowDAO
+}
+
+// NewMockWorkflowDAO creates a new mock instance.
+func NewMockWorkflowDAO(ctrl *gomock.Controller) *MockWorkflowDAO {
+	mock := &MockWorkflowDAO{ctrl: ctrl}
+	mock.recorder = &MockWorkflowDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWorkflowDAO) EXPECT() *MockWorkflowDAOMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockWorkflowDAO) Create(ctx context.Context, w task.Workflow) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, w)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// Upsert indicates an expected call of Upsert.
-func (mr *MockExecutionDAOMockRecorder) Upsert(ctx, id, status, progress any) *gomock.Call {
+// Create indicates an expected call of Create.
+func (mr *MockWorkflowDAOMockRecorder) Create(ctx, w any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockWorkflowDAO)(nil).Create), ctx, w)
+}
+
+// CreateRun mocks base method.
+func (m *MockWorkflowDAO) CreateRun(ctx context.Context, r task.WorkflowRun) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRun", ctx, r)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRun indicates an expected call of CreateRun.
+func (mr *MockWorkflowDAOMockRecorder) CreateRun(ctx, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRun", reflect.TypeOf((*MockWorkflowDAO)(nil).CreateRun), ctx, r)
+}
+
+// Get mocks base method.
+func (m *MockWorkflowDAO) Get(ctx context.Context, id int64) (task.Workflow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(task.Workflow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockWorkflowDAOMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockWorkflowDAO)(nil).Get), ctx, id)
+}
+
+// GetByTask mocks base method.
+func (m *MockWorkflowDAO) GetByTask(ctx context.Context, tid int64) (task.Workflow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByTask", ctx, tid)
+	ret0, _ := ret[0].(task.Workflow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByTask indicates an expected call of GetByTask.
+func (mr *MockWorkflowDAOMockRecorder) GetByTask(ctx, tid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByTask", reflect.TypeOf((*MockWorkflowDAO)(nil).GetByTask), ctx, tid)
+}
+
+// GetRunningRun mocks base method.
+func (m *MockWorkflowDAO) GetRunningRun(ctx context.Context, wid int64) (task.WorkflowRun, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRunningRun", ctx, wid)
+	ret0, _ := ret[0].(task.WorkflowRun)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRunningRun indicates an expected call of GetRunningRun.
+func (mr *MockWorkflowDAOMockRecorder) GetRunningRun(ctx, wid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRunningRun", reflect.TypeOf((*MockWorkflowDAO)(nil).GetRunningRun), ctx, wid)
+}
+
+// ListRuns mocks base method.
+func (m *MockWorkflowDAO) ListRuns(ctx context.Context, wid int64, offset, limit int) ([]task.WorkflowRun, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRuns", ctx, wid, offset, limit)
+	ret0, _ := ret[0].([]task.WorkflowRun)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListRuns indicates an expected call of ListRuns.
+func (mr *MockWorkflowDAOMockRecorder) ListRuns(ctx, wid, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRuns", reflect.TypeOf((*MockWorkflowDAO)(nil).ListRuns), ctx, wid, offset, limit)
+}
+
+// UpdateRun mocks base method.
+func (m *MockWorkflowDAO) UpdateRun(ctx context.Context, r task.WorkflowRun) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRun", ctx, r)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRun indicates an expected call of UpdateRun.
+func (mr *MockWorkflowDAOMockRecorder) UpdateRun(ctx, r any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockExecutionDAO)(nil).Upsert), ctx, id, status, progress)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRun", reflect.TypeOf((*MockWorkflowDAO)(nil).UpdateRun), ctx, r)
 }
@@ -2,6 +2,8 @@ package mysql
 
 import (
 	"context"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/ecodeclub/ecron/internal/storage"
 	"github.com/ecodeclub/ecron/internal/task"
 	"gorm.io/gorm"
@@ -9,46 +11,264 @@ import (
 	"time"
 )
 
+// 抢占分片时一次查询的分片数量
+const shardBatchSize = 10
+
+// forUpdate 锁住查询到的记录直到事务结束
+var forUpdate = clause.Locking{Strength: "UPDATE"}
+
+var _ storage.ExecutionDAO = (*GormExecutionDAO)(nil)
+
 type GormExecutionDAO struct {
 	db *gorm.DB
 }
 
 func (h *GormExecutionDAO) ToDomain(e Execution) task.Execution {
 	return task.Execution{
-		ID:       e.ID,
-		Tid:      e.Tid,
-		Status:   task.ExecStatus(e.Status),
-		Progress: e.Progress,
-		Ctime:    time.UnixMilli(e.Ctime),
-		Utime:    time.UnixMilli(e.Utime),
+		ID:           e.ID,
+		Tid:          e.Tid,
+		Attempt:      e.Attempt,
+		Misfired:     e.Misfired,
+		TriggerType:  task.TriggerType(e.TriggerType),
+		Status:       task.ExecStatus(e.Status),
+		Progress:     e.Progress,
+		StartTime:    fromMilli(e.StartTime),
+		EndTime:      fromMilli(e.EndTime),
+		ErrMsg:       e.ErrMsg,
+		Node:         e.Node,
+		ParentID:     e.ParentID,
+		ShardIndex:   e.ShardIndex,
+		ShardTotal:   e.ShardTotal,
+		FencingToken: e.FencingToken,
+		Ctime:        time.UnixMilli(e.Ctime),
+		Utime:        time.UnixMilli(e.Utime),
 	}
 }
 
 func (h *GormExecutionDAO) GetLastExecution(ctx context.Context, tid int64) (task.Execution, error) {
 	var exec Execution
-	err := h.db.WithContext(ctx).Where("tid = ?", tid).Last(&exec).Error
+	err := h.db.WithContext(ctx).Where("tid = ? AND parent_id = ?", tid, 0).Last(&exec).Error
 	return h.ToDomain(exec), err
 }
 
-func NewGormExecutionDAO(db *gorm.DB) storage.ExecutionDAO {
+func NewGormExecutionDAO(db *gorm.DB) *GormExecutionDAO {
 	return &GormExecutionDAO{db: db}
 }
 
-func (h *GormExecutionDAO) Upsert(ctx context.Context, id int64, status task.ExecStatus, progress uint8) (int64, error) {
+// Create 先检查任务有没有 token 更大的执行记录，新的持有者接手后，旧的持有者不能再创建执行记录。
+// 检查和插入在同一个事务中，并且锁住任务，同一个任务的 Create 串行执行，
+// 避免旧的持有者检查通过后、插入之前，新的持有者插入了执行记录
+func (h *GormExecutionDAO) Create(ctx context.Context, e task.Execution) (int64, error) {
 	now := time.Now().UnixMilli()
 	exec := Execution{
-		Tid:      id,
-		Status:   status.ToUint8(),
-		Progress: progress,
-		Ctime:    now,
-		Utime:    now,
-	}
-	err := h.db.WithContext(ctx).Clauses(clause.OnConflict{
-		DoUpdates: clause.Assignments(map[string]any{
+		Tid:         e.Tid,
+		Attempt:     e.Attempt,
+		Misfired:    e.Misfired,
+		TriggerType: e.TriggerType.ToUint8(),
+		Status:      e.Status.ToUint8(),
+		Progress:    e.Progress,
+		StartTime:   now,
+		// 跳过的执行在创建时就已经结束了
+		EndTime:      toMilli(e.EndTime),
+		ErrMsg:       e.ErrMsg,
+		Node:         e.Node,
+		ShardTotal:   e.ShardTotal,
+		FencingToken: e.FencingToken,
+		Ctime:        now,
+		Utime:        now,
+	}
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// SQLite 忽略 FOR UPDATE，写事务本身是串行的
+		err := tx.Select("id").Where("id = ?", e.Tid).Clauses(forUpdate).Find(&[]TaskInfo{}).Error
+		if err != nil {
+			return err
+		}
+		// MySQL 的一致性读在拿到锁之后才建立快照，能看到之前的 Create 插入的执行记录
+		var cnt int64
+		err = tx.Model(&Execution{}).
+			Where("tid = ? AND fencing_token > ?", e.Tid, e.FencingToken).Count(&cnt).Error
+		if err != nil {
+			return err
+		}
+		if cnt > 0 {
+			return errs.ErrStaleFencingToken
+		}
+		return tx.Create(&exec).Error
+	})
+	return exec.ID, err
+}
+
+func (h *GormExecutionDAO) UpdateProgressStatus(ctx context.Context, eid int64, token int64, progress uint8, status task.ExecStatus) error {
+	return h.update(ctx, eid, token, map[string]any{
+		"status":   status.ToUint8(),
+		"progress": progress,
+		"utime":    time.Now().UnixMilli(),
+	})
+}
+
+func (h *GormExecutionDAO) Finish(ctx context.Context, eid int64, token int64, progress uint8, status task.ExecStatus, errMsg string) error {
+	now := time.Now().UnixMilli()
+	return h.update(ctx, eid, token, map[string]any{
+		"status":   status.ToUint8(),
+		"progress": progress,
+		"end_time": now,
+		"err_msg":  errMsg,
+		"utime":    now,
+	})
+}
+
+// update 只有 token 不小于执行记录中的 token 时才会更新，并且把执行记录的 token 更新为 token
+func (h *GormExecutionDAO) update(ctx context.Context, eid int64, token int64, updates map[string]any) error {
+	updates["fencing_token"] = token
+	res := h.db.WithContext(ctx).Model(&Execution{}).
+		Where("id = ? AND fencing_token <= ?", eid, token).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	// MySQL 在数据没有变化时影响行数也是 0，需要再确认一次是不是 token 过期了
+	var exec Execution
+	err := h.db.WithContext(ctx).Select("fencing_token").Where("id = ?", eid).First(&exec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errs.ErrExecutionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if exec.FencingToken > token {
+		return errs.ErrStaleFencingToken
+	}
+	return nil
+}
+
+func (h *GormExecutionDAO) ListByTask(ctx context.Context, tid int64, q storage.ExecutionQuery) ([]task.Execution, int64, error) {
+	where := func() *gorm.DB {
+		// 分片通过 ListShards 查询
+		db := h.db.WithContext(ctx).Model(&Execution{}).Where("tid = ?", tid).Where("parent_id = ?", 0)
+		if !q.Start.IsZero() {
+			db = db.Where("start_time >= ?", q.Start.UnixMilli())
+		}
+		if !q.End.IsZero() {
+			db = db.Where("start_time < ?", q.End.UnixMilli())
+		}
+		return db
+	}
+	var total int64
+	err := where().Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var execs []Execution
+	err = where().Order("start_time DESC, id DESC").
+		Offset(q.Offset).Limit(q.Limit).Find(&execs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	res := make([]task.Execution, 0, len(execs))
+	for _, e := range execs {
+		res = append(res, h.ToDomain(e))
+	}
+	return res, total, nil
+}
+
+func (h *GormExecutionDAO) CreateShards(ctx context.Context, parent task.Execution) error {
+	now := time.Now().UnixMilli()
+	shards := make([]Execution, 0, parent.ShardTotal)
+	for i := 0; i < parent.ShardTotal; i++ {
+		shards = append(shards, Execution{
+			Tid:          parent.Tid,
+			Attempt:      parent.Attempt,
+			TriggerType:  parent.TriggerType.ToUint8(),
+			Status:       task.ExecStatusWaiting.ToUint8(),
+			ParentID:     parent.ID,
+			ShardIndex:   i,
+			ShardTotal:   parent.ShardTotal,
+			FencingToken: parent.FencingToken,
+			Ctime:        now,
+			Utime:        now,
+		})
+	}
+	return h.db.WithContext(ctx).Create(&shards).Error
+}
+
+// ShardPreemptable 可以抢占的分片：等待执行的分片，或者超过 leaseTTL 没有续约的分片
+func ShardPreemptable(db *gorm.DB, now time.Time, leaseTTL time.Duration) *gorm.DB {
+	// 续约的最晚时间
+	t := now.UnixMilli() - leaseTTL.Milliseconds()
+	return db.Where("status = ?", task.ExecStatusWaiting.ToUint8()).
+		Or("status = ? AND parent_id > 0 AND utime < ?", task.ExecStatusRunning.ToUint8(), t)
+}
+
+// PreemptShard 按照创建的顺序抢占分片，通过状态和 utime 控制每个分片只会被一个调度节点抢到
+func (h *GormExecutionDAO) PreemptShard(ctx context.Context, node string, leaseTTL time.Duration) (task.Execution, error) {
+	var shards []Execution
+	err := h.db.WithContext(ctx).Where(ShardPreemptable(h.db, time.Now(), leaseTTL)).
+		Order("id").Limit(shardBatchSize).Find(&shards).Error
+	if err != nil {
+		return task.Execution{}, err
+	}
+	for _, s := range shards {
+		now := time.Now().UnixMilli()
+		res := h.db.WithContext(ctx).Model(&Execution{}).
+			Where("id = ? AND status = ? AND utime = ?", s.ID, s.Status, s.Utime).
+			Updates(map[string]any{
+				"status":     task.ExecStatusRunning.ToUint8(),
+				"node":       node,
+				"start_time": now,
+				"utime":      now,
+			})
+		if res.Error != nil {
+			return task.Execution{}, res.Error
+		}
+		if res.RowsAffected > 0 {
+			s.Status = task.ExecStatusRunning.ToUint8()
+			s.Node = node
+			s.StartTime = now
+			s.Utime = now
+			return h.ToDomain(s), nil
+		}
+	}
+	return task.Execution{}, errs.ErrNoExecutableTask
+}
+
+func (h *GormExecutionDAO) RefreshShard(ctx context.Context, eid int64, node string) error {
+	res := h.db.WithContext(ctx).Model(&Execution{}).
+		Where("id = ? AND node = ? AND status = ?", eid, node, task.ExecStatusRunning.ToUint8()).
+		Update("utime", time.Now().UnixMilli())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrShardReclaimed
+	}
+	return nil
+}
+
+func (h *GormExecutionDAO) ListShards(ctx context.Context, parentID int64) ([]task.Execution, error) {
+	var shards []Execution
+	err := h.db.WithContext(ctx).Where("parent_id = ?", parentID).
+		Order("shard_index").Find(&shards).Error
+	if err != nil {
+		return nil, err
+	}
+	res := make([]task.Execution, 0, len(shards))
+	for _, s := range shards {
+		res = append(res, h.ToDomain(s))
+	}
+	return res, nil
+}
+
+// FinishWaitingShards 分片的 token 和创建分片时的执行记录一致
+func (h *GormExecutionDAO) FinishWaitingShards(ctx context.Context, parentID int64, token int64, status task.ExecStatus, errMsg string) error {
+	now := time.Now().UnixMilli()
+	return h.db.WithContext(ctx).Model(&Execution{}).
+		Where("parent_id = ? AND status = ? AND fencing_token <= ?", parentID, task.ExecStatusWaiting.ToUint8(), token).
+		Updates(map[string]any{
 			"status":   status.ToUint8(),
-			"progress": progress,
+			"end_time": now,
+			"err_msg":  errMsg,
 			"utime":    now,
-		}),
-	}).Create(&exec).Error
-	return exec.ID, err
+		}).Error
 }
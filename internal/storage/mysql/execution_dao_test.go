@@ -3,68 +3,413 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/storage"
 	"github.com/ecodeclub/ecron/internal/task"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"testing"
+	"time"
 )
 
-func TestGormExecutionDAO_Upsert(t *testing.T) {
+func TestGormExecutionDAO_Create(t *testing.T) {
 	testCase := []struct {
-		name       string
-		sqlMock    func(t *testing.T) *sql.DB
-		id         int64
-		taskStatus task.ExecStatus
-		wantErr    error
-		wantID     int64
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		exec    task.Execution
+		wantErr error
+		wantID  int64
 	}{
 		{
-			name: "启动任务，insert一条记录",
+			name: "每次执行都insert一条记录",
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
-				mock.ExpectExec("INSERT INTO `execution` .* ON DUPLICATE KEY UPDATE").
-					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `id` FROM `task_info` WHERE id = \\? FOR UPDATE").
+					WithArgs(int64(1)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `execution` WHERE tid = \\? AND fencing_token > \\?").
+					WithArgs(int64(1), int64(3)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec("INSERT INTO `execution`").
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
 				return mockDB
 			},
-			id:         1,
-			taskStatus: task.ExecStatusRunning,
-			wantErr:    nil,
-			wantID:     1,
+			exec: task.Execution{
+				Tid:          1,
+				Attempt:      1,
+				Status:       task.ExecStatusRunning,
+				Node:         "node-1",
+				FencingToken: 3,
+			},
+			wantID: 2,
 		},
 		{
-			name: "任务执行成功，更新执行记录",
+			name: "任务已经被其他调度节点接手",
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
-				mock.ExpectExec("INSERT INTO `execution` .* ON DUPLICATE KEY UPDATE").
-					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `id` FROM `task_info`").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `execution`").
+					WithArgs(int64(1), int64(1)).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+				return mockDB
+			},
+			exec: task.Execution{
+				Tid:          1,
+				Status:       task.ExecStatusRunning,
+				FencingToken: 1,
+			},
+			wantErr: errs.ErrStaleFencingToken,
+		},
+		{
+			name: "insert失败",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `id` FROM `task_info`").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `execution`").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec("INSERT INTO `execution`").
+					WillReturnError(errors.New("mock db error"))
+				mock.ExpectRollback()
 				return mockDB
 			},
-			id:         1,
-			taskStatus: task.ExecStatusSuccess,
-			wantErr:    nil,
-			wantID:     2,
+			exec: task.Execution{
+				Tid:    1,
+				Status: task.ExecStatusRunning,
+			},
+			wantErr: errors.New("mock db error"),
 		},
 	}
 	for _, tc := range testCase {
 		t.Run(tc.name, func(t *testing.T) {
-			sqlDB := tc.sqlMock(t)
-			db, err := gorm.Open(mysql.New(mysql.Config{
-				Conn:                      sqlDB,
-				SkipInitializeWithVersion: true,
-			}), &gorm.Config{
-				DisableAutomaticPing:   true,
-				SkipDefaultTransaction: true,
-			})
-			require.NoError(t, err)
-			dao := NewGormExecutionDAO(db)
-			id, err := dao.Upsert(context.Background(), tc.id, tc.taskStatus, 0)
+			dao := NewGormExecutionDAO(newMockGormDB(t, tc.sqlMock(t)))
+			id, err := dao.Create(context.Background(), tc.exec)
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantID, id)
 		})
 	}
 }
+
+func TestGormExecutionDAO_UpdateProgressStatus(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "更新成功",
+			sqlMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `execution` SET `fencing_token`=\\?,`progress`=\\?,`status`=\\?,`utime`=\\? WHERE id = \\? AND fencing_token <= \\?").
+					WithArgs(int64(2), uint8(50), task.ExecStatusRunning.ToUint8(), sqlmock.AnyArg(), int64(1), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "数据没有变化",
+			sqlMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `execution`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT `fencing_token` FROM `execution` WHERE id = \\?").
+					WithArgs(int64(1), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"fencing_token"}).AddRow(2))
+			},
+		},
+		{
+			name: "token过期",
+			sqlMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `execution`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT `fencing_token` FROM `execution`").
+					WillReturnRows(sqlmock.NewRows([]string{"fencing_token"}).AddRow(3))
+			},
+			wantErr: errs.ErrStaleFencingToken,
+		},
+		{
+			name: "执行记录不存在",
+			sqlMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `execution`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT `fencing_token` FROM `execution`").
+					WillReturnRows(sqlmock.NewRows([]string{"fencing_token"}))
+			},
+			wantErr: errs.ErrExecutionNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.sqlMock(mock)
+
+			dao := NewGormExecutionDAO(newMockGormDB(t, sqlDB))
+			err = dao.UpdateProgressStatus(context.Background(), 1, 2, 50, task.ExecStatusRunning)
+			assert.Equal(t, tc.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGormExecutionDAO_Finish(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectExec("UPDATE `execution` SET `end_time`=\\?,`err_msg`=\\?,`fencing_token`=\\?,`progress`=\\?,`status`=\\?,`utime`=\\? WHERE id = \\? AND fencing_token <= \\?").
+		WithArgs(sqlmock.AnyArg(), "request failed", int64(2), uint8(0), task.ExecStatusFailed.ToUint8(), sqlmock.AnyArg(), int64(1), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	dao := NewGormExecutionDAO(newMockGormDB(t, sqlDB))
+	err = dao.Finish(context.Background(), 1, 2, 0, task.ExecStatusFailed, "request failed")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormExecutionDAO_ListByTask(t *testing.T) {
+	start := time.UnixMilli(1000)
+	end := time.UnixMilli(5000)
+	testCase := []struct {
+		name      string
+		sqlMock   func(t *testing.T) *sql.DB
+		query     storage.ExecutionQuery
+		wantErr   error
+		wantTotal int64
+		wantExecs []task.Execution
+	}{
+		{
+			name: "按照时间范围分页查询",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `execution` WHERE tid = \\? AND parent_id = \\? AND start_time >= \\? AND start_time < \\?").
+					WithArgs(int64(1), 0, start.UnixMilli(), end.UnixMilli()).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectQuery("SELECT \\* FROM `execution` WHERE tid = \\? AND parent_id = \\? AND start_time >= \\? AND start_time < \\? ORDER BY start_time DESC, id DESC LIMIT \\? OFFSET \\?").
+					WithArgs(int64(1), 0, start.UnixMilli(), end.UnixMilli(), 2, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "tid", "attempt", "status", "progress",
+						"start_time", "end_time", "err_msg", "node", "ctime", "utime"}).
+						AddRow(3, 1, 1, task.ExecStatusRunning.ToUint8(), 10, 3000, 0, "", "node-1", 3000, 3000).
+						AddRow(2, 1, 2, task.ExecStatusFailed.ToUint8(), 0, 2000, 2500, "request failed", "node-2", 2000, 2500))
+				return mockDB
+			},
+			query: storage.ExecutionQuery{
+				Start:  start,
+				End:    end,
+				Offset: 1,
+				Limit:  2,
+			},
+			wantTotal: 3,
+			wantExecs: []task.Execution{
+				{
+					ID:        3,
+					Tid:       1,
+					Attempt:   1,
+					Status:    task.ExecStatusRunning,
+					Progress:  10,
+					StartTime: time.UnixMilli(3000),
+					Node:      "node-1",
+					Ctime:     time.UnixMilli(3000),
+					Utime:     time.UnixMilli(3000),
+				},
+				{
+					ID:        2,
+					Tid:       1,
+					Attempt:   2,
+					Status:    task.ExecStatusFailed,
+					StartTime: time.UnixMilli(2000),
+					EndTime:   time.UnixMilli(2500),
+					ErrMsg:    "request failed",
+					Node:      "node-2",
+					Ctime:     time.UnixMilli(2000),
+					Utime:     time.UnixMilli(2500),
+				},
+			},
+		},
+		{
+			name: "查询总数失败",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `execution` WHERE tid = \\?").
+					WillReturnError(errors.New("mock db error"))
+				return mockDB
+			},
+			query:   storage.ExecutionQuery{Limit: 10},
+			wantErr: errors.New("mock db error"),
+		},
+	}
+	for _, tc := range testCase {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormExecutionDAO(newMockGormDB(t, tc.sqlMock(t)))
+			execs, total, err := dao.ListByTask(context.Background(), 1, tc.query)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantTotal, total)
+			assert.Equal(t, tc.wantExecs, execs)
+			assert.Equal(t, 500*time.Millisecond, execs[1].Duration())
+		})
+	}
+}
+
+func newMockGormDB(t *testing.T, sqlDB *sql.DB) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestGormExecutionDAO_CreateShards(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectExec("INSERT INTO `execution`").
+		WithArgs(int64(1), 1, 0, uint8(0), uint8(0), task.ExecStatusWaiting.ToUint8(),
+			int64(0), int64(0), "", "", int64(2), 0, 2, int64(3), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			int64(1), 1, 0, uint8(0), uint8(0), task.ExecStatusWaiting.ToUint8(),
+			int64(0), int64(0), "", "", int64(2), 1, 2, int64(3), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 2))
+
+	dao := NewGormExecutionDAO(newMockGormDB(t, sqlDB))
+	err = dao.CreateShards(context.Background(), task.Execution{ID: 2, Tid: 1, Attempt: 1, ShardTotal: 2, FencingToken: 3})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormExecutionDAO_PreemptShard(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sqlMock  func(t *testing.T) *sql.DB
+		wantErr  error
+		wantExec task.Execution
+	}{
+		{
+			name: "第一个分片被其他节点抢占",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `execution` WHERE status = \\? OR \\(status = \\? AND parent_id > 0 AND utime < \\?\\) ORDER BY id LIMIT \\?").
+					WithArgs(task.ExecStatusWaiting.ToUint8(), task.ExecStatusRunning.ToUint8(), sqlmock.AnyArg(), shardBatchSize).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "tid", "status", "parent_id", "shard_index", "shard_total", "utime"}).
+						AddRow(3, 1, task.ExecStatusWaiting.ToUint8(), 2, 0, 2, 1000).
+						AddRow(4, 1, task.ExecStatusWaiting.ToUint8(), 2, 1, 2, 1000))
+				mock.ExpectExec("UPDATE `execution` SET `node`=\\?,`start_time`=\\?,`status`=\\?,`utime`=\\? WHERE id = \\? AND status = \\? AND utime = \\?").
+					WithArgs("node-1", sqlmock.AnyArg(), task.ExecStatusRunning.ToUint8(), sqlmock.AnyArg(),
+						int64(3), task.ExecStatusWaiting.ToUint8(), int64(1000)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE `execution` SET").
+					WithArgs("node-1", sqlmock.AnyArg(), task.ExecStatusRunning.ToUint8(), sqlmock.AnyArg(),
+						int64(4), task.ExecStatusWaiting.ToUint8(), int64(1000)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+			wantExec: task.Execution{
+				ID:         4,
+				Tid:        1,
+				Status:     task.ExecStatusRunning,
+				Node:       "node-1",
+				ParentID:   2,
+				ShardIndex: 1,
+				ShardTotal: 2,
+			},
+		},
+		{
+			name: "接手没有续约的分片",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `execution`").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "tid", "status", "parent_id", "shard_index", "shard_total", "node", "utime"}).
+						AddRow(3, 1, task.ExecStatusRunning.ToUint8(), 2, 0, 2, "node-2", 1000))
+				mock.ExpectExec("UPDATE `execution` SET").
+					WithArgs("node-1", sqlmock.AnyArg(), task.ExecStatusRunning.ToUint8(), sqlmock.AnyArg(),
+						int64(3), task.ExecStatusRunning.ToUint8(), int64(1000)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+			wantExec: task.Execution{
+				ID:         3,
+				Tid:        1,
+				Status:     task.ExecStatusRunning,
+				Node:       "node-1",
+				ParentID:   2,
+				ShardIndex: 0,
+				ShardTotal: 2,
+			},
+		},
+		{
+			name: "没有等待执行的分片",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `execution` WHERE").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return mockDB
+			},
+			wantErr: errs.ErrNoExecutableTask,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormExecutionDAO(newMockGormDB(t, tc.sqlMock(t)))
+			e, err := dao.PreemptShard(context.Background(), "node-1", time.Minute)
+			assert.Equal(t, tc.wantErr, err)
+			// 开始执行的时间由数据库层生成
+			e.StartTime, e.Utime, e.Ctime = time.Time{}, time.Time{}, time.Time{}
+			assert.Equal(t, tc.wantExec, e)
+		})
+	}
+}
+
+func TestGormExecutionDAO_RefreshShard(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		wantErr error
+	}{
+		{
+			name: "续约成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `execution` SET `utime`=\\? WHERE id = \\? AND node = \\? AND status = \\?").
+					WithArgs(sqlmock.AnyArg(), int64(3), "node-1", task.ExecStatusRunning.ToUint8()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+		},
+		{
+			name: "分片已经被其他节点接手",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `execution` SET `utime`=\\?").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			wantErr: errs.ErrShardReclaimed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormExecutionDAO(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.RefreshShard(context.Background(), 3, "node-1")
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package mysql
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// TestNewMigrator 确认内嵌的脚本可以解析，并且每张表的 DDL 被拆分成一条语句执行
+func TestNewMigrator(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, dirty FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}))
+	mock.ExpectExec("INSERT INTO schema_migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	for _, table := range []string{"task_info", "execution", "workflow", "workflow_node", "workflow_run"} {
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS " + table + "\\s").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("UPDATE schema_migrations SET dirty = FALSE").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO schema_migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("ALTER TABLE workflow_run ADD COLUMN running_wid").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE workflow_run r JOIN").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE UNIQUE INDEX uk_running_wid").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE schema_migrations SET dirty = FALSE").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), m.Latest())
+	require.NoError(t, m.Up(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,88 @@
+CREATE TABLE IF NOT EXISTS task_info
+(
+    id                BIGINT AUTO_INCREMENT PRIMARY KEY ,
+    name              VARCHAR(128)  NOT NULL COMMENT '任务名称',
+    type              VARCHAR(32)   NOT NULL COMMENT '任务类型',
+    cron              VARCHAR(32)   NOT NULL COMMENT 'cron表达式',
+    timezone          VARCHAR(64)   NOT NULL DEFAULT '' COMMENT 'cron表达式使用的时区，为空时使用调度节点的本地时区',
+    schedule_type     TINYINT NOT NULL DEFAULT 0 COMMENT '调度方式，0-cron，1-执行一次，2-固定频率，3-固定延迟，4-依赖上游',
+    exec_at           BIGINT NOT NULL DEFAULT 0 COMMENT '执行一次的任务的执行时间',
+    schedule_interval BIGINT NOT NULL DEFAULT 0 COMMENT '固定频率和固定延迟任务的调度间隔，单位毫秒',
+    executor          VARCHAR(32)  NOT NULL COMMENT '执行器名称',
+    owner             VARCHAR(64)   NOT NULL COMMENT '用于实现乐观锁',
+    status            TINYINT NOT NULL DEFAULT 1 COMMENT '任务状态，1-等待调度，2-正在执行，3-暂停，4-结束',
+    cfg               TEXT          NOT NULL COMMENT '任务配置',
+    retry_policy      TEXT          NOT NULL COMMENT '重试策略，JSON格式',
+    misfire_policy    TEXT          NOT NULL COMMENT '错过执行时间后的处理策略，JSON格式',
+    attempt           INT NOT NULL DEFAULT 0 COMMENT '本次调度已经执行的次数',
+    shard_count       INT NOT NULL DEFAULT 0 COMMENT '分片数量，大于1时每次执行都会拆分成多个分片',
+    fencing_token     BIGINT NOT NULL DEFAULT 0 COMMENT '每次抢占任务都会加一',
+    next_exec_time    BIGINT COMMENT '下一次执行时间',
+    trigger_time      BIGINT NOT NULL DEFAULT 0 COMMENT '手动触发的时间，0表示没有等待执行的手动触发',
+    trigger_params    TEXT          NOT NULL COMMENT '手动触发时传入的参数，JSON格式',
+    ctime       BIGINT        NOT NULL ,
+    utime      BIGINT        NOT NULL ,
+    INDEX idx_status_next_exec_time(status, next_exec_time),
+    INDEX idx_status_utime(status, utime),
+    INDEX idx_status_trigger_time(status, trigger_time)
+) COMMENT '任务信息';
+
+
+CREATE TABLE IF NOT EXISTS execution
+(
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY ,
+    tid         BIGINT NOT NULL COMMENT '任务id',
+    attempt     INT NOT NULL DEFAULT 0 COMMENT '本次调度的第几次执行',
+    misfired    INT NOT NULL DEFAULT 0 COMMENT '开始执行时一共错过了多少次执行',
+    trigger_type TINYINT NOT NULL DEFAULT 0 COMMENT '触发方式，0-按照调度计划执行，1-手动触发',
+    status      TINYINT COMMENT '执行状态，0-未知，1-运行中，2-成功，3-失败，4-超时，5-主动取消，6-跳过，7-分片等待执行',
+    progress    INT COMMENT '执行进度，取值0-100',
+    start_time  BIGINT NOT NULL DEFAULT 0 COMMENT '开始执行的时间',
+    end_time    BIGINT NOT NULL DEFAULT 0 COMMENT '执行结束的时间，没有结束时为0',
+    err_msg     VARCHAR(1024) NOT NULL DEFAULT '' COMMENT '执行失败时的错误信息',
+    node        VARCHAR(128) NOT NULL DEFAULT '' COMMENT '执行任务的调度节点',
+    parent_id   BIGINT NOT NULL DEFAULT 0 COMMENT '分片所属的执行记录的id，不是分片时为0',
+    shard_index INT NOT NULL DEFAULT 0 COMMENT '分片的序号，从0开始',
+    shard_total INT NOT NULL DEFAULT 0 COMMENT '分片总数，执行没有分片时为0',
+    fencing_token BIGINT NOT NULL DEFAULT 0 COMMENT '最后一次写入的租约的fencing token，更小的token写入时会被拒绝',
+    ctime       BIGINT        NOT NULL ,
+    utime       bigint        NOT NULL,
+    INDEX idx_tid_start_time(tid, start_time),
+    INDEX idx_parent_id(parent_id),
+    INDEX idx_status(status)
+) comment '任务执行记录，每一次执行对应一条记录';
+
+CREATE TABLE IF NOT EXISTS workflow
+(
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY ,
+    name        VARCHAR(128)  NOT NULL COMMENT '工作流名称',
+    ctime       BIGINT        NOT NULL ,
+    utime       BIGINT        NOT NULL
+) COMMENT '工作流';
+
+CREATE TABLE IF NOT EXISTS workflow_node
+(
+    id             BIGINT AUTO_INCREMENT PRIMARY KEY ,
+    wid            BIGINT NOT NULL COMMENT '工作流id',
+    tid            BIGINT NOT NULL COMMENT '任务id，一个任务只能属于一个工作流',
+    upstreams      TEXT   NOT NULL COMMENT '上游任务的id，JSON数组',
+    failure_policy TINYINT NOT NULL DEFAULT 0 COMMENT '上游任务没有全部执行成功时的处理策略，0-跳过，1-停止工作流，2-依旧执行',
+    ctime          BIGINT        NOT NULL ,
+    utime          BIGINT        NOT NULL ,
+    INDEX idx_wid(wid),
+    UNIQUE INDEX uniq_tid(tid)
+) COMMENT '工作流的节点';
+
+CREATE TABLE IF NOT EXISTS workflow_run
+(
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY ,
+    wid         BIGINT NOT NULL COMMENT '工作流id',
+    status      TINYINT NOT NULL COMMENT '1-运行中，2-成功，3-失败，4-停止',
+    nodes       TEXT   NOT NULL COMMENT '每个节点的执行状态，JSON格式，key是任务id',
+    start_time  BIGINT NOT NULL DEFAULT 0 COMMENT '开始运行的时间',
+    end_time    BIGINT NOT NULL DEFAULT 0 COMMENT '运行结束的时间，没有结束时为0',
+    version     BIGINT NOT NULL DEFAULT 0 COMMENT '用于实现乐观锁',
+    ctime       BIGINT        NOT NULL ,
+    utime       BIGINT        NOT NULL ,
+    INDEX idx_wid_status(wid, status)
+) COMMENT '工作流的运行记录';
@@ -0,0 +1,2 @@
+DROP INDEX uk_running_wid ON workflow_run;
+ALTER TABLE workflow_run DROP COLUMN running_wid;
@@ -0,0 +1,5 @@
+-- 运行中的记录 running_wid 等于 wid，结束后为 NULL，唯一索引保证每个工作流最多只有一个运行中的记录
+ALTER TABLE workflow_run ADD COLUMN running_wid BIGINT NULL COMMENT '运行中时等于wid，结束后为NULL';
+UPDATE workflow_run r JOIN (SELECT MAX(id) AS id FROM workflow_run WHERE status = 1 GROUP BY wid) l ON r.id = l.id
+SET r.running_wid = r.wid;
+CREATE UNIQUE INDEX uk_running_wid ON workflow_run (running_wid);
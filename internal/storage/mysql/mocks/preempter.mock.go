@@ -12,50 +12,80 @@ package daomysqlmocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	task "github.com/ecodeclub/ecron/internal/task"
 	gomock "go.uber.org/mock/gomock"
 )
 
-// MocktaskRepository is a mock of taskRepository interface.
-type MocktaskRepository struct {
+// MockTaskRepository is a mock of TaskRepository interface.
+type MockTaskRepository struct {
 	ctrl     *gomock.Controller
-	recorder *MocktaskRepositoryMockRecorder
+	recorder *MockTaskRepositoryMockRecorder
 }
 
-// MocktaskRepositoryMockRecorder is the mock recorder for MocktaskRepository.
-type MocktaskRepositoryMockRecorder struct {
-	mock *MocktaskRepository
+// MockTaskRepositoryMockRecorder is the mock recorder for MockTaskRepository.
+type MockTaskRepositoryMockRecorder struct {
+	mock *MockTaskRepository
 }
 
-// NewMocktaskRepository creates a new mock instance.
-func NewMocktaskRepository(ctrl *gomock.Controller) *MocktaskRepository {
-	mock := &MocktaskRepository{ctrl: ctrl}
-	mock.recorder = &MocktaskRepositoryMockRecorder{mock}
+// NewMockTaskRepository creates a new mock instance.
+func NewMockTaskRepository(ctrl *gomock.Controller) *MockTaskRepository {
+	mock := &MockTaskRepository{ctrl: ctrl}
+	mock.recorder = &MockTaskRepositoryMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MocktaskRepository) EXPECT() *MocktaskRepositoryMockRecorder {
+func (m *MockTaskRepository) EXPECT() *MockTaskRepositoryMockRecorder {
 	return m.recorder
 }
 
+// HandoverTask mocks base method.
+func (m *MockTaskRepository) HandoverTask(ctx context.Context, tid int64, owner string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandoverTask", ctx, tid, owner)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HandoverTask indicates an expected call of HandoverTask.
+func (mr *MockTaskRepositoryMockRecorder) HandoverTask(ctx, tid, owner any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandoverTask", reflect.TypeOf((*MockTaskRepository)(nil).HandoverTask), ctx, tid, owner)
+}
+
+// PreemptBatch mocks base method.
+func (m *MockTaskRepository) PreemptBatch(ctx context.Context, owner string, n int) ([]task.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreemptBatch", ctx, owner, n)
+	ret0, _ := ret[0].([]task.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreemptBatch indicates an expected call of PreemptBatch.
+func (mr *MockTaskRepositoryMockRecorder) PreemptBatch(ctx, owner, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreemptBatch", reflect.TypeOf((*MockTaskRepository)(nil).PreemptBatch), ctx, owner, n)
+}
+
 // PreemptTask mocks base method.
-func (m *MocktaskRepository) PreemptTask(ctx context.Context, tid int64, oldOwner, newOwner string) error {
+func (m *MockTaskRepository) PreemptTask(ctx context.Context, tid int64, oldOwner, newOwner string, token int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PreemptTask", ctx, tid, oldOwner, newOwner)
+	ret := m.ctrl.Call(m, "PreemptTask", ctx, tid, oldOwner, newOwner, token)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // PreemptTask indicates an expected call of PreemptTask.
-func (mr *MocktaskRepositoryMockRecorder) PreemptTask(ctx, tid, oldOwner, newOwner any) *gomock.Call {
+func (mr *MockTaskRepositoryMockRecorder) PreemptTask(ctx, tid, oldOwner, newOwner, token any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreemptTask", reflect.TypeOf((*MocktaskRepository)(nil).PreemptTask), ctx, tid, oldOwner, newOwner)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreemptTask", reflect.TypeOf((*MockTaskRepository)(nil).PreemptTask), ctx, tid, oldOwner, newOwner, token)
 }
 
 // RefreshTask mocks base method.
-func (m *MocktaskRepository) RefreshTask(ctx context.Context, tid int64, owner string) error {
+func (m *MockTaskRepository) RefreshTask(ctx context.Context, tid int64, owner string) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "RefreshTask", ctx, tid, owner)
 	ret0, _ := ret[0].(error)
@@ -63,13 +93,13 @@ func (m *MocktaskRepository) RefreshTask(ctx context.Context, tid int64, owner s
 }
 
 // RefreshTask indicates an expected call of RefreshTask.
-func (mr *MocktaskRepositoryMockRecorder) RefreshTask(ctx, tid, owner any) *gomock.Call {
+func (mr *MockTaskRepositoryMockRecorder) RefreshTask(ctx, tid, owner any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshTask", reflect.TypeOf((*MocktaskRepository)(nil).RefreshTask), ctx, tid, owner)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshTask", reflect.TypeOf((*MockTaskRepository)(nil).RefreshTask), ctx, tid, owner)
 }
 
 // ReleaseTask mocks base method.
-func (m *MocktaskRepository) ReleaseTask(ctx context.Context, t task.Task, owner string) error {
+func (m *MockTaskRepository) ReleaseTask(ctx context.Context, t task.Task, owner string) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ReleaseTask", ctx, t, owner)
 	ret0, _ := ret[0].(error)
@@ -77,13 +107,27 @@ func (m *MocktaskRepository) ReleaseTask(ctx context.Context, t task.Task, owner
 }
 
 // ReleaseTask indicates an expected call of ReleaseTask.
-func (mr *MocktaskRepositoryMockRecorder) ReleaseTask(ctx, t, owner any) *gomock.Call {
+func (mr *MockTaskRepositoryMockRecorder) ReleaseTask(ctx, t, owner any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseTask", reflect.TypeOf((*MockTaskRepository)(nil).ReleaseTask), ctx, t, owner)
+}
+
+// RetryTask mocks base method.
+func (m *MockTaskRepository) RetryTask(ctx context.Context, tid int64, owner string, attempt int, next time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryTask", ctx, tid, owner, attempt, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryTask indicates an expected call of RetryTask.
+func (mr *MockTaskRepositoryMockRecorder) RetryTask(ctx, tid, owner, attempt, next any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseTask", reflect.TypeOf((*MocktaskRepository)(nil).ReleaseTask), ctx, t, owner)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryTask", reflect.TypeOf((*MockTaskRepository)(nil).RetryTask), ctx, tid, owner, attempt, next)
 }
 
 // TryPreempt mocks base method.
-func (m *MocktaskRepository) TryPreempt(ctx context.Context, f func(context.Context, []task.Task) (task.Task, error)) (task.Task, error) {
+func (m *MockTaskRepository) TryPreempt(ctx context.Context, f func(context.Context, []task.Task) (task.Task, error)) (task.Task, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "TryPreempt", ctx, f)
 	ret0, _ := ret[0].(task.Task)
@@ -92,7 +136,7 @@ func (m *MocktaskRepository) TryPreempt(ctx context.Context, f func(context.Cont
 }
 
 // TryPreempt indicates an expected call of TryPreempt.
-func (mr *MocktaskRepositoryMockRecorder) TryPreempt(ctx, f any) *gomock.Call {
+func (mr *MockTaskRepositoryMockRecorder) TryPreempt(ctx, f any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryPreempt", reflect.TypeOf((*MocktaskRepository)(nil).TryPreempt), ctx, f)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryPreempt", reflect.TypeOf((*MockTaskRepository)(nil).TryPreempt), ctx, f)
 }
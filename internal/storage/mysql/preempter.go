@@ -8,6 +8,7 @@ import (
 	"github.com/ecodeclub/ecron/internal/task"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -17,7 +18,7 @@ import (
 //go:generate mockgen -source=./preempter.go -package=daomysqlmocks -destination=./mocks/preempter.mock.go
 
 type Preempter struct {
-	taskRepository taskRepository
+	taskRepository TaskRepository
 	// with options
 	refreshTimeout  time.Duration
 	refreshInterval time.Duration
@@ -27,14 +28,56 @@ type Preempter struct {
 	randIndex       func(num int) int
 }
 
-func NewPreempter(db *gorm.DB, batchSize int, refreshInterval time.Duration) *Preempter {
-	taskRepository := newGormTaskRepository(db, batchSize, refreshInterval)
-	return newPreempter(taskRepository)
+type PreempterOption func(p *Preempter)
+
+// WithRefreshTimeout 每一次续约的超时时间
+func WithRefreshTimeout(timeout time.Duration) PreempterOption {
+	return func(p *Preempter) {
+		p.refreshTimeout = timeout
+	}
+}
+
+// WithRefreshInterval 自动续约的间隔，需要小于 NewPreempter 中租约的有效期 leaseTTL
+func WithRefreshInterval(interval time.Duration) PreempterOption {
+	return func(p *Preempter) {
+		p.refreshInterval = interval
+	}
+}
+
+// WithBuffSize 自动续约时状态 channel 的缓冲大小
+func WithBuffSize(size uint8) PreempterOption {
+	return func(p *Preempter) {
+		p.buffSize = size
+	}
+}
+
+// WithMaxRetryTimes 续约超时后的最大重试次数
+func WithMaxRetryTimes(times uint8) PreempterOption {
+	return func(p *Preempter) {
+		p.maxRetryTimes = times
+	}
+}
+
+// WithRetrySleepTime 续约超时后重试的间隔
+func WithRetrySleepTime(sleepTime time.Duration) PreempterOption {
+	return func(p *Preempter) {
+		p.retrySleepTime = sleepTime
+	}
+}
+
+func NewPreempter(db *gorm.DB, batchSize int, leaseTTL time.Duration, opts ...PreempterOption) *Preempter {
+	taskRepository := NewGormTaskRepository(db, batchSize, leaseTTL)
+	return newPreempter(taskRepository, opts...)
+}
+
+// NewPreempterWithRepository 使用其他存储实现的 TaskRepository 创建 Preempter，例如 PostgreSQL
+func NewPreempterWithRepository(tr TaskRepository, opts ...PreempterOption) *Preempter {
+	return newPreempter(tr, opts...)
 }
 
 // newPreempter 用于测试
-func newPreempter(tr taskRepository) *Preempter {
-	return &Preempter{
+func newPreempter(tr TaskRepository, opts ...PreempterOption) *Preempter {
+	p := &Preempter{
 		taskRepository:  tr,
 		refreshTimeout:  2 * time.Second,
 		refreshInterval: time.Second * 5,
@@ -45,6 +88,10 @@ func newPreempter(tr taskRepository) *Preempter {
 			return rand.Intn(num)
 		},
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 func (p *Preempter) Preempt(ctx context.Context) (preempt.TaskLeaser, error) {
@@ -55,10 +102,11 @@ func (p *Preempter) Preempt(ctx context.Context) (preempt.TaskLeaser, error) {
 		for i := index % size; i < size; i++ {
 			t := tasks[i]
 			value := uuid.New().String()
-			err = p.taskRepository.PreemptTask(ctx, t.ID, t.Owner, value)
+			err = p.taskRepository.PreemptTask(ctx, t.ID, t.Owner, value, t.FencingToken)
 			switch {
 			case err == nil:
 				t.Owner = value
+				t.FencingToken++
 				return t, nil
 			case errors.Is(err, ErrFailedToPreempt):
 				continue
@@ -71,8 +119,23 @@ func (p *Preempter) Preempt(ctx context.Context) (preempt.TaskLeaser, error) {
 	if err != nil {
 		return nil, err
 	}
-	var b atomic.Bool
-	b.Store(false)
+	return p.newTaskLeaser(t), nil
+}
+
+// PreemptBatch 一次抢占最多 n 个任务，同一批任务的 owner 相同，释放和续约时依旧按照任务区分
+func (p *Preempter) PreemptBatch(ctx context.Context, n int) ([]preempt.TaskLeaser, error) {
+	ts, err := p.taskRepository.PreemptBatch(ctx, uuid.New().String(), n)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]preempt.TaskLeaser, 0, len(ts))
+	for _, t := range ts {
+		res = append(res, p.newTaskLeaser(t))
+	}
+	return res, nil
+}
+
+func (p *Preempter) newTaskLeaser(t task.Task) *taskLeaser {
 	return &taskLeaser{
 		t:               t,
 		taskRepository:  p.taskRepository,
@@ -82,14 +145,12 @@ func (p *Preempter) Preempt(ctx context.Context) (preempt.TaskLeaser, error) {
 		maxRetryTimes:   p.maxRetryTimes,
 		retrySleepTime:  p.retrySleepTime,
 		done:            make(chan struct{}),
-		ones:            sync.Once{},
-		hasDone:         b,
-	}, err
+	}
 }
 
 type taskLeaser struct {
 	t               task.Task
-	taskRepository  taskRepository
+	taskRepository  TaskRepository
 	refreshTimeout  time.Duration
 	refreshInterval time.Duration
 	buffSize        uint8
@@ -119,10 +180,36 @@ func (d *taskLeaser) Release(ctx context.Context) error {
 	return d.taskRepository.ReleaseTask(ctx, d.t, d.t.Owner)
 }
 
+func (d *taskLeaser) Retry(ctx context.Context, attempt int, next time.Time) error {
+	if d.hasDone.Load() {
+		return preempt.ErrLeaserHasRelease
+	}
+	d.ones.Do(func() {
+		d.hasDone.Store(true)
+		close(d.done)
+	})
+	return d.taskRepository.RetryTask(ctx, d.t.ID, d.t.Owner, attempt, next)
+}
+
+func (d *taskLeaser) Handover(ctx context.Context) error {
+	if d.hasDone.Load() {
+		return preempt.ErrLeaserHasRelease
+	}
+	d.ones.Do(func() {
+		d.hasDone.Store(true)
+		close(d.done)
+	})
+	return d.taskRepository.HandoverTask(ctx, d.t.ID, d.t.Owner)
+}
+
 func (d *taskLeaser) GetTask() task.Task {
 	return d.t
 }
 
+func (d *taskLeaser) FencingToken() int64 {
+	return d.t.FencingToken
+}
+
 func (d *taskLeaser) AutoRefresh(ctx context.Context) (s <-chan preempt.Status, err error) {
 	if d.hasDone.Load() {
 		return nil, preempt.ErrLeaserHasRelease
@@ -189,28 +276,36 @@ var (
 	ErrTaskNotHold     = errors.New("未持有任务")
 )
 
-type taskRepository interface {
+// TaskRepository Preempter 依赖的任务存储，不同的数据库可以使用不同的抢占方式
+type TaskRepository interface {
 	//TryPreempt 抢占接口，会返回一批task给f方法
 	TryPreempt(ctx context.Context, f func(ctx context.Context, ts []task.Task) (task.Task, error)) (task.Task, error)
-	// PreemptTask 获取一个任务
-	PreemptTask(ctx context.Context, tid int64, oldOwner string, newOwner string) error
+	// PreemptTask 获取一个任务，token 是查询到的任务的 fencing token，抢占成功后加一
+	PreemptTask(ctx context.Context, tid int64, oldOwner string, newOwner string, token int64) error
+	// PreemptBatch 抢占最多 n 个任务，抢占到的任务的 owner 都是 owner。
+	// 没有可以执行的任务时返回 errs.ErrNoExecutableTask，任务都被其他调度节点抢走时返回 preempt.ErrNoTaskToPreempt
+	PreemptBatch(ctx context.Context, owner string, n int) ([]task.Task, error)
 	// ReleaseTask 释放任务
 	ReleaseTask(ctx context.Context, t task.Task, owner string) error
+	// RetryTask 释放任务，任务会在 next 重新执行
+	RetryTask(ctx context.Context, tid int64, owner string, attempt int, next time.Time) error
 	// RefreshTask 续约
 	RefreshTask(ctx context.Context, tid int64, owner string) error
+	// HandoverTask 任务保持执行中的状态，但是可以马上被其他调度节点抢占
+	HandoverTask(ctx context.Context, tid int64, owner string) error
 }
 
 type gormTaskRepository struct {
-	db              *gorm.DB
-	batchSize       int
-	refreshInterval time.Duration
+	db        *gorm.DB
+	batchSize int
+	leaseTTL  time.Duration
 }
 
-func newGormTaskRepository(db *gorm.DB, batchSize int, refreshInterval time.Duration) *gormTaskRepository {
+func NewGormTaskRepository(db *gorm.DB, batchSize int, leaseTTL time.Duration) TaskRepository {
 	return &gormTaskRepository{
-		db:              db,
-		batchSize:       batchSize,
-		refreshInterval: refreshInterval,
+		db:        db,
+		batchSize: batchSize,
+		leaseTTL:  leaseTTL,
 	}
 }
 
@@ -218,28 +313,61 @@ func newGormTaskRepository(db *gorm.DB, batchSize int, refreshInterval time.Dura
 func (g *gormTaskRepository) ReleaseTask(ctx context.Context, t task.Task, owner string) error {
 	now := time.Now()
 
-	next, _ := t.NextTime(now)
-	status := task.TaskStatusWaiting
-	if next.IsZero() {
-		status = task.TaskStatusFinished
+	var assignments []clause.Assignment
+	if t.Triggered() {
+		// 手动触发的执行不影响原本的调度计划，只清除本次触发。
+		// 执行过程中再次触发的话，触发时间会变化，这时保留新的触发。trigger_params 判断的是更新前的 trigger_time
+		trigger := toMilli(t.TriggerTime)
+		assignments = keepPaused(task.TaskStatusWaiting,
+			assign("trigger_params", gorm.Expr("CASE WHEN trigger_time = ? THEN '' ELSE trigger_params END", trigger)),
+			assign("trigger_time", gorm.Expr("CASE WHEN trigger_time = ? THEN 0 ELSE trigger_time END", trigger)),
+			assign("utime", now.UnixMilli()))
+	} else {
+		next, _ := t.NextTimeAfterRun(now)
+		status := task.TaskStatusWaiting
+		if next.IsZero() {
+			status = task.TaskStatusFinished
+		}
+		assignments = keepPaused(status,
+			assign("next_exec_time", toMilli(next)),
+			assign("attempt", 0),
+			assign("utime", now.UnixMilli()))
 	}
-	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
-		Where("id = ? AND owner = ?", t.ID, owner).
-		Updates(map[string]interface{}{
-			"status":         status,
-			"utime":          now.UnixMilli(),
-			"next_exec_time": next.UnixMilli(),
-		})
+	res := updateInOrder(g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND owner = ?", t.ID, owner), assignments...)
+
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	return ErrTaskNotHold
+}
 
+func (g *gormTaskRepository) RetryTask(ctx context.Context, tid int64, owner string, attempt int, next time.Time) error {
+	res := updateInOrder(g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND owner = ?", tid, owner),
+		keepPaused(task.TaskStatusWaiting,
+			assign("next_exec_time", next.UnixMilli()),
+			assign("attempt", attempt),
+			assign("utime", time.Now().UnixMilli()))...)
 	if res.RowsAffected > 0 {
 		return nil
 	}
 	return ErrTaskNotHold
 }
 
+// keepPaused 执行过程中被暂停的任务，释放后保持暂停，并且清空 owner 表示执行已经结束。
+// owner 和 status 排在最前面，通过 updateInOrder 更新时两者判断的都是释放前的状态
+func keepPaused(status int8, assignments ...clause.Assignment) []clause.Assignment {
+	return append([]clause.Assignment{
+		assign("owner", gorm.Expr("CASE WHEN status = ? THEN '' ELSE owner END", task.TaskStatusPaused)),
+		assign("status", gorm.Expr("CASE WHEN status = ? THEN status ELSE ? END", task.TaskStatusPaused, status)),
+	}, assignments...)
+}
+
 func (g *gormTaskRepository) RefreshTask(ctx context.Context, tid int64, owner string) error {
 	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
-		Where("id = ? AND owner = ? AND status = ?", tid, owner, task.TaskStatusRunning).
+		// 执行过程中被暂停的任务，本次执行结束前依旧需要续约
+		Where("id = ? AND owner = ? AND status IN ?", tid, owner, []int8{task.TaskStatusRunning, task.TaskStatusPaused}).
 		Updates(map[string]any{
 			"utime": time.Now().UnixMilli(),
 		})
@@ -249,17 +377,29 @@ func (g *gormTaskRepository) RefreshTask(ctx context.Context, tid int64, owner s
 	return ErrTaskNotHold
 }
 
+// HandoverTask 把续约时间改成 0，任务满足 Preemptable 中续约超时的条件
+func (g *gormTaskRepository) HandoverTask(ctx context.Context, tid int64, owner string) error {
+	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND owner = ? AND status = ?", tid, owner, task.TaskStatusRunning).
+		Updates(map[string]any{
+			"utime": 0,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTaskNotHold
+	}
+	return nil
+}
+
 func (g *gormTaskRepository) TryPreempt(ctx context.Context, f func(ctx context.Context, ts []task.Task) (task.Task, error)) (task.Task, error) {
-	now := time.Now()
 	var zero = task.Task{}
-	// 续约的最晚时间
-	t := now.UnixMilli() - g.refreshInterval.Milliseconds()
 	var tasks []TaskInfo
 	// 一次取一批
 	err := g.db.WithContext(ctx).Model(&TaskInfo{}).
-		Where("status = ? AND next_exec_time <= ?", task.TaskStatusWaiting, now.UnixMilli()).
-		Or("status = ? AND utime < ?", task.TaskStatusRunning, t).
-		Find(&tasks).Limit(g.batchSize).Error
+		Where(Preemptable(g.db, time.Now(), g.leaseTTL)).
+		Limit(g.batchSize).Find(&tasks).Error
 	if err != nil {
 		return zero, err
 	}
@@ -268,18 +408,83 @@ func (g *gormTaskRepository) TryPreempt(ctx context.Context, f func(ctx context.
 	}
 	ts := make([]task.Task, len(tasks))
 	for i := 0; i < len(tasks); i++ {
-		ts[i] = toTask(tasks[i])
+		ts[i] = ToTask(tasks[i])
 	}
 	return f(ctx, ts)
 }
 
-func (g *gormTaskRepository) PreemptTask(ctx context.Context, tid int64, oldOwner string, newOwner string) error {
+// Preemptable 可以抢占的任务的查询条件：到了执行时间的任务、续约超时的任务和手动触发的任务。
+// leaseTTL 内没有续约的任务认为持有者已经崩溃
+func Preemptable(db *gorm.DB, now time.Time, leaseTTL time.Duration) *gorm.DB {
+	// 续约的最晚时间
+	t := now.UnixMilli() - leaseTTL.Milliseconds()
+	return db.Where("status = ? AND next_exec_time <= ?", task.TaskStatusWaiting, now.UnixMilli()).
+		Or("status = ? AND utime < ?", task.TaskStatusRunning, t).
+		// 手动触发的任务不需要等到下一次执行时间
+		Or("status = ? AND trigger_time > 0", task.TaskStatusWaiting)
+}
+
+// skipLocked 查询时锁住结果，并且跳过其他调度节点已经锁住的记录。需要 MySQL 8.0 及以上的版本，SQLite 会忽略
+var skipLocked = clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}
+
+// PreemptBatch 在一个事务中执行两条语句：先用 SELECT ... FOR UPDATE SKIP LOCKED 锁住最多 n 个可以抢占的任务，
+// 再用一条 UPDATE 抢占它们。其他调度节点查询时会跳过已经锁住的任务，不会和本节点争抢同一批任务。
+// SQLite 没有行锁，但是写事务是串行的，UPDATE 中依旧带上可以抢占的条件，抢占不到全部任务时放弃本次抢占。
+// 返回的任务的 LastStatus 是抢占前的状态，调度器据此区分正常调度和接手其他节点没有执行完的任务
+func (g *gormTaskRepository) PreemptBatch(ctx context.Context, owner string, n int) ([]task.Task, error) {
+	now := time.Now()
+	var tasks []TaskInfo
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(Preemptable(g.db, now, g.leaseTTL)).
+			Limit(n).Clauses(skipLocked).Find(&tasks).Error
+		if err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return errs.ErrNoExecutableTask
+		}
+		ids := make([]int64, 0, len(tasks))
+		for _, te := range tasks {
+			ids = append(ids, te.ID)
+		}
+		res := tx.Model(&TaskInfo{}).
+			Where("id IN ?", ids).Where(Preemptable(g.db, now, g.leaseTTL)).
+			Updates(map[string]any{
+				"status":        task.TaskStatusRunning,
+				"utime":         now.UnixMilli(),
+				"owner":         owner,
+				"fencing_token": gorm.Expr("fencing_token + 1"),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != int64(len(ids)) {
+			return preempt.ErrNoTaskToPreempt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ts := make([]task.Task, 0, len(tasks))
+	for _, te := range tasks {
+		t := ToTask(te)
+		t.Owner = owner
+		t.FencingToken++
+		t.Utime = time.UnixMilli(now.UnixMilli())
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+func (g *gormTaskRepository) PreemptTask(ctx context.Context, tid int64, oldOwner string, newOwner string, token int64) error {
 	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
-		Where("id = ? AND owner = ?", tid, oldOwner).
+		Where("id = ? AND owner = ? AND fencing_token = ?", tid, oldOwner, token).
 		Updates(map[string]interface{}{
-			"status": task.TaskStatusRunning,
-			"utime":  time.Now().UnixMilli(),
-			"owner":  newOwner,
+			"status":        task.TaskStatusRunning,
+			"utime":         time.Now().UnixMilli(),
+			"owner":         newOwner,
+			"fencing_token": token + 1,
 		})
 	if res.RowsAffected > 0 {
 		return nil
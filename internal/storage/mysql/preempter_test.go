@@ -22,15 +22,15 @@ import (
 func TestPreempt_Preempt(t *testing.T) {
 	testCases := []struct {
 		name     string
-		mock     func(ctrl *gomock.Controller) taskRepository
+		mock     func(ctrl *gomock.Controller) TaskRepository
 		wantErr  error
 		ctxFn    func() context.Context
 		wantTask preempt.TaskLeaser
 	}{
 		{
 			name: "抢占成功",
-			mock: func(ctrl *gomock.Controller) taskRepository {
-				td := daomysqlmocks.NewMocktaskRepository(ctrl)
+			mock: func(ctrl *gomock.Controller) TaskRepository {
+				td := daomysqlmocks.NewMockTaskRepository(ctrl)
 
 				td.EXPECT().TryPreempt(gomock.Any(), gomock.Any()).Return(task.Task{
 					ID: 1,
@@ -49,8 +49,8 @@ func TestPreempt_Preempt(t *testing.T) {
 		},
 		{
 			name: "抢占失败，没有任务了",
-			mock: func(ctrl *gomock.Controller) taskRepository {
-				td := daomysqlmocks.NewMocktaskRepository(ctrl)
+			mock: func(ctrl *gomock.Controller) TaskRepository {
+				td := daomysqlmocks.NewMockTaskRepository(ctrl)
 
 				td.EXPECT().TryPreempt(gomock.Any(), gomock.Any()).Return(task.Task{}, ErrFailedToPreempt)
 
@@ -63,8 +63,8 @@ func TestPreempt_Preempt(t *testing.T) {
 		},
 		{
 			name: "抢占失败，超时",
-			mock: func(ctrl *gomock.Controller) taskRepository {
-				td := daomysqlmocks.NewMocktaskRepository(ctrl)
+			mock: func(ctrl *gomock.Controller) TaskRepository {
+				td := daomysqlmocks.NewMockTaskRepository(ctrl)
 
 				td.EXPECT().TryPreempt(gomock.Any(), gomock.Any()).Return(task.Task{}, context.DeadlineExceeded)
 
@@ -99,15 +99,15 @@ func TestPreempt_Preempt(t *testing.T) {
 func TestPreempt_TaskLeaser_AutoRefresh(t *testing.T) {
 	testCases := []struct {
 		name          string
-		mock          func(ctrl *gomock.Controller) taskRepository
+		mock          func(ctrl *gomock.Controller) TaskRepository
 		wantLeaserErr error
 		wantErr       error
 		ctxFn         func() context.Context
 	}{
 		{
 			name: "UpdateUtime error",
-			mock: func(ctrl *gomock.Controller) taskRepository {
-				td := daomysqlmocks.NewMocktaskRepository(ctrl)
+			mock: func(ctrl *gomock.Controller) TaskRepository {
+				td := daomysqlmocks.NewMockTaskRepository(ctrl)
 
 				t := task.Task{
 					ID:    1,
@@ -127,8 +127,8 @@ func TestPreempt_TaskLeaser_AutoRefresh(t *testing.T) {
 		},
 		{
 			name: "context超时了",
-			mock: func(ctrl *gomock.Controller) taskRepository {
-				td := daomysqlmocks.NewMocktaskRepository(ctrl)
+			mock: func(ctrl *gomock.Controller) TaskRepository {
+				td := daomysqlmocks.NewMockTaskRepository(ctrl)
 
 				t := task.Task{
 					ID:    1,
@@ -147,8 +147,8 @@ func TestPreempt_TaskLeaser_AutoRefresh(t *testing.T) {
 		},
 		{
 			name: "context被取消",
-			mock: func(ctrl *gomock.Controller) taskRepository {
-				td := daomysqlmocks.NewMocktaskRepository(ctrl)
+			mock: func(ctrl *gomock.Controller) TaskRepository {
+				td := daomysqlmocks.NewMockTaskRepository(ctrl)
 
 				t := task.Task{
 					ID:    1,
@@ -206,14 +206,14 @@ func TestPreempt_TaskLeaser_AutoRefresh(t *testing.T) {
 func TestPreempt_TaskLeaser_Release(t *testing.T) {
 	testCases := []struct {
 		name    string
-		mock    func(ctrl *gomock.Controller) taskRepository
+		mock    func(ctrl *gomock.Controller) TaskRepository
 		wantErr error
 		ctxFn   func() context.Context
 	}{
 		{
 			name: "正常结束（release）",
-			mock: func(ctrl *gomock.Controller) taskRepository {
-				td := daomysqlmocks.NewMocktaskRepository(ctrl)
+			mock: func(ctrl *gomock.Controller) TaskRepository {
+				td := daomysqlmocks.NewMockTaskRepository(ctrl)
 
 				t := task.Task{
 					ID:    1,
@@ -283,18 +283,18 @@ func TestPreempt_TaskLeaser_Release(t *testing.T) {
 
 func TestGormTaskRepository_TryPreempt(t *testing.T) {
 	testCases := []struct {
-		name            string
-		batchSize       int
-		refreshInterval time.Duration
-		sqlMock         func(t *testing.T) *sql.DB
-		selectMock      func(ctx context.Context, ts []task.Task) (task.Task, error)
-		wantTask        task.Task
-		wantErr         error
+		name       string
+		batchSize  int
+		leaseTTL   time.Duration
+		sqlMock    func(t *testing.T) *sql.DB
+		selectMock func(ctx context.Context, ts []task.Task) (task.Task, error)
+		wantTask   task.Task
+		wantErr    error
 	}{
 		{
-			name:            "查询数据库错误",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "查询数据库错误",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -306,9 +306,9 @@ func TestGormTaskRepository_TryPreempt(t *testing.T) {
 			wantErr:  errors.New("select error"),
 		},
 		{
-			name:            "当前没有可以执行的任务",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "当前没有可以执行的任务",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -320,9 +320,9 @@ func TestGormTaskRepository_TryPreempt(t *testing.T) {
 			wantErr:  errs.ErrNoExecutableTask,
 		},
 		{
-			name:            "获取任务并抢占成功",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "获取任务并抢占成功",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -373,9 +373,9 @@ func TestGormTaskRepository_TryPreempt(t *testing.T) {
 			wantErr: nil,
 		},
 		{
-			name:            "获取任务并抢占失败",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "获取任务并抢占失败",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -427,7 +427,7 @@ func TestGormTaskRepository_TryPreempt(t *testing.T) {
 			})
 			require.NoError(t, err)
 
-			dao := newGormTaskRepository(db, tc.batchSize, tc.refreshInterval)
+			dao := NewGormTaskRepository(db, tc.batchSize, tc.leaseTTL)
 
 			res, err := dao.TryPreempt(context.Background(), tc.selectMock)
 			if err != nil {
@@ -454,19 +454,19 @@ func TestGormTaskRepository_TryPreemptTask(t *testing.T) {
 	}
 	newOwner := "jack"
 	testCases := []struct {
-		name            string
-		batchSize       int
-		refreshInterval time.Duration
-		sqlMock         func(t *testing.T) *sql.DB
+		name      string
+		batchSize int
+		leaseTTL  time.Duration
+		sqlMock   func(t *testing.T) *sql.DB
 
 		wantErr  error
 		f        func(ctx context.Context, ts []task.Task) (task.Task, error)
 		wantTask task.Task
 	}{
 		{
-			name:            "抢占成功",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "抢占成功",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -494,9 +494,9 @@ func TestGormTaskRepository_TryPreemptTask(t *testing.T) {
 			},
 		},
 		{
-			name:            "没有任务可以抢占了",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "没有任务可以抢占了",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -532,7 +532,7 @@ func TestGormTaskRepository_TryPreemptTask(t *testing.T) {
 			})
 			require.NoError(t, err)
 
-			dao := newGormTaskRepository(db, tc.batchSize, tc.refreshInterval)
+			dao := NewGormTaskRepository(db, tc.batchSize, tc.leaseTTL)
 			tryPreempt, err := dao.TryPreempt(context.Background(), tc.f)
 			assert.Equal(t, tc.wantErr, err)
 			if err == nil {
@@ -543,6 +543,95 @@ func TestGormTaskRepository_TryPreemptTask(t *testing.T) {
 	}
 }
 
+func TestGormTaskRepository_PreemptBatch(t *testing.T) {
+	testCases := []struct {
+		name      string
+		sqlMock   func(t *testing.T) *sql.DB
+		wantErr   error
+		wantTasks []int64
+		// 抢占前的状态
+		wantLastStatus []int8
+		wantTokens     []int64
+	}{
+		{
+			name: "抢占成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `task_info` WHERE .* LIMIT \\? FOR UPDATE SKIP LOCKED").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "owner", "status", "fencing_token"}).
+						AddRow(1, "", task.TaskStatusWaiting, 0).AddRow(3, "tom", task.TaskStatusRunning, 4))
+				mock.ExpectExec("UPDATE `task_info` SET `fencing_token`=fencing_token \\+ 1,`owner`=\\?,`status`=\\?,`utime`=\\? WHERE id IN \\(\\?,\\?\\) AND \\(.*\\)").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+				return mockDB
+			},
+			wantTasks:      []int64{1, 3},
+			wantLastStatus: []int8{task.TaskStatusWaiting, task.TaskStatusRunning},
+			wantTokens:     []int64{1, 5},
+		},
+		{
+			name: "没有可以执行的任务",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `task_info`").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+				return mockDB
+			},
+			wantErr: errs.ErrNoExecutableTask,
+		},
+		{
+			name: "部分任务被其他调度节点抢占了",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `task_info`").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectRollback()
+				return mockDB
+			},
+			wantErr: preempt.ErrNoTaskToPreempt,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.sqlMock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			dao := NewGormTaskRepository(db, 10, time.Minute)
+			ts, err := dao.PreemptBatch(context.Background(), "jack", 3)
+			assert.Equal(t, tc.wantErr, err)
+			ids := make([]int64, 0, len(ts))
+			statuses := make([]int8, 0, len(ts))
+			tokens := make([]int64, 0, len(ts))
+			for _, tk := range ts {
+				assert.Equal(t, "jack", tk.Owner)
+				ids = append(ids, tk.ID)
+				statuses = append(statuses, tk.LastStatus)
+				tokens = append(tokens, tk.FencingToken)
+			}
+			if tc.wantTasks != nil {
+				assert.Equal(t, tc.wantTasks, ids)
+				assert.Equal(t, tc.wantLastStatus, statuses)
+				assert.Equal(t, tc.wantTokens, tokens)
+			}
+		})
+	}
+}
+
 func TestGormTaskRepository_PreemptTask(t *testing.T) {
 
 	zero := task.Task{
@@ -550,25 +639,25 @@ func TestGormTaskRepository_PreemptTask(t *testing.T) {
 		Owner: "tom",
 	}
 	testCases := []struct {
-		name            string
-		batchSize       int
-		refreshInterval time.Duration
-		sqlMock         func(t *testing.T) *sql.DB
-		tid             int64
-		old             string
-		new             string
-		wantErr         error
+		name      string
+		batchSize int
+		leaseTTL  time.Duration
+		sqlMock   func(t *testing.T) *sql.DB
+		tid       int64
+		old       string
+		new       string
+		wantErr   error
 	}{
 		{
-			name:            "抢占成功",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "抢占成功",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
 				//mock.ExpectExec("UPDATE `task_info`").WithArgs(zero.ID, zero.Owner).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("UPDATE `task_info`").
-					WithArgs("jack", sqlmock.AnyArg(), sqlmock.AnyArg(), zero.ID, zero.Owner).WillReturnResult(sqlmock.NewResult(1, 1))
+					WithArgs(int64(1), "jack", sqlmock.AnyArg(), sqlmock.AnyArg(), zero.ID, zero.Owner, int64(0)).WillReturnResult(sqlmock.NewResult(1, 1))
 				return mockDB
 			},
 			tid:     zero.ID,
@@ -577,13 +666,13 @@ func TestGormTaskRepository_PreemptTask(t *testing.T) {
 			wantErr: nil,
 		},
 		{
-			name:            "抢占失败",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "抢占失败",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
-				mock.ExpectExec("UPDATE `task_info`").WithArgs("jack", sqlmock.AnyArg(), sqlmock.AnyArg(), zero.ID, zero.Owner).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE `task_info`").WithArgs(int64(1), "jack", sqlmock.AnyArg(), sqlmock.AnyArg(), zero.ID, zero.Owner, int64(0)).WillReturnResult(sqlmock.NewResult(0, 0))
 				return mockDB
 			},
 			tid:     zero.ID,
@@ -604,9 +693,9 @@ func TestGormTaskRepository_PreemptTask(t *testing.T) {
 			})
 			require.NoError(t, err)
 
-			dao := newGormTaskRepository(db, tc.batchSize, tc.refreshInterval)
+			dao := NewGormTaskRepository(db, tc.batchSize, tc.leaseTTL)
 
-			err = dao.PreemptTask(context.Background(), tc.tid, tc.old, tc.new)
+			err = dao.PreemptTask(context.Background(), tc.tid, tc.old, tc.new, 0)
 			assert.Equal(t, tc.wantErr, err)
 		})
 	}
@@ -619,25 +708,25 @@ func TestGormTaskRepository_RefreshTask(t *testing.T) {
 		Owner: "tom",
 	}
 	testCases := []struct {
-		name            string
-		batchSize       int
-		refreshInterval time.Duration
-		sqlMock         func(t *testing.T) *sql.DB
-		tid             int64
-		owner           string
-		wantErr         error
-		status          int8
+		name      string
+		batchSize int
+		leaseTTL  time.Duration
+		sqlMock   func(t *testing.T) *sql.DB
+		tid       int64
+		owner     string
+		wantErr   error
+		status    int8
 	}{
 		{
-			name:            "续约成功",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "续约成功",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
 				//mock.ExpectExec("UPDATE `task_info`").WithArgs(zero.ID, zero.Owner).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("UPDATE `task_info`").
-					WithArgs(sqlmock.AnyArg(), zero.ID, zero.Owner, task.TaskStatusRunning).WillReturnResult(sqlmock.NewResult(1, 1))
+					WithArgs(sqlmock.AnyArg(), zero.ID, zero.Owner, task.TaskStatusRunning, task.TaskStatusPaused).WillReturnResult(sqlmock.NewResult(1, 1))
 				return mockDB
 			},
 			tid:     zero.ID,
@@ -646,13 +735,13 @@ func TestGormTaskRepository_RefreshTask(t *testing.T) {
 			wantErr: nil,
 		},
 		{
-			name:            "续约失败",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "续约失败",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
-				mock.ExpectExec("UPDATE `task_info`").WithArgs(sqlmock.AnyArg(), zero.ID, zero.Owner, task.TaskStatusRunning).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE `task_info`").WithArgs(sqlmock.AnyArg(), zero.ID, zero.Owner, task.TaskStatusRunning, task.TaskStatusPaused).WillReturnResult(sqlmock.NewResult(0, 0))
 				return mockDB
 			},
 			tid:     zero.ID,
@@ -672,7 +761,7 @@ func TestGormTaskRepository_RefreshTask(t *testing.T) {
 				SkipDefaultTransaction: true,
 			})
 			require.NoError(t, err)
-			dao := newGormTaskRepository(db, tc.batchSize, tc.refreshInterval)
+			dao := NewGormTaskRepository(db, tc.batchSize, tc.leaseTTL)
 			err = dao.RefreshTask(context.Background(), tc.tid, tc.owner)
 			if err != nil {
 				assert.Equal(t, tc.wantErr, err)
@@ -682,6 +771,52 @@ func TestGormTaskRepository_RefreshTask(t *testing.T) {
 	}
 }
 
+func TestGormTaskRepository_HandoverTask(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		wantErr error
+	}{
+		{
+			name: "交还成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET `utime`=\\? WHERE id = \\? AND owner = \\? AND status = \\?").
+					WithArgs(0, int64(1), "tom", task.TaskStatusRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+		},
+		{
+			name: "没有持有任务",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			wantErr: ErrTaskNotHold,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.sqlMock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+			dao := NewGormTaskRepository(db, 10, time.Minute)
+			err = dao.HandoverTask(context.Background(), 1, "tom")
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
 func TestGormTaskRepository_ReleaseTask(t *testing.T) {
 
 	zero := task.Task{
@@ -689,18 +824,19 @@ func TestGormTaskRepository_ReleaseTask(t *testing.T) {
 		Owner: "tom",
 	}
 	testCases := []struct {
-		name            string
-		batchSize       int
-		refreshInterval time.Duration
-		sqlMock         func(t *testing.T) *sql.DB
-		tid             int64
-		owner           string
-		wantErr         error
+		name      string
+		batchSize int
+		leaseTTL  time.Duration
+		sqlMock   func(t *testing.T) *sql.DB
+		tid       int64
+		task      task.Task
+		owner     string
+		wantErr   error
 	}{
 		{
-			name:            "解除成功",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "解除成功",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -713,9 +849,9 @@ func TestGormTaskRepository_ReleaseTask(t *testing.T) {
 			wantErr: nil,
 		},
 		{
-			name:            "解除失败",
-			batchSize:       10,
-			refreshInterval: 10 * time.Second,
+			name:      "解除失败",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
 			sqlMock: func(t *testing.T) *sql.DB {
 				mockDB, mock, err := sqlmock.New()
 				require.NoError(t, err)
@@ -726,6 +862,72 @@ func TestGormTaskRepository_ReleaseTask(t *testing.T) {
 			owner:   "jack",
 			wantErr: ErrTaskNotHold,
 		},
+		{
+			name:      "执行过程中被暂停的任务，释放后保持暂停",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				// owner 和 status 在其他字段之前赋值，判断的都是释放前的状态
+				mock.ExpectExec("UPDATE `task_info` SET " +
+					"`owner`=CASE WHEN status = \\? THEN '' ELSE owner END," +
+					"`status`=CASE WHEN status = \\? THEN status ELSE \\? END," +
+					"`next_exec_time`=\\?,`attempt`=\\?,`utime`=\\? WHERE id = \\? AND owner = \\?").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				return mockDB
+			},
+			tid:     zero.ID,
+			task:    task.Task{CronExp: "0 0 8 * * *"},
+			owner:   zero.Owner,
+			wantErr: nil,
+		},
+		{
+			name:      "只执行一次的任务，释放后结束",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WithArgs(task.TaskStatusPaused, task.TaskStatusPaused, task.TaskStatusFinished, int64(0), 0, sqlmock.AnyArg(), zero.ID, zero.Owner).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				return mockDB
+			},
+			tid: zero.ID,
+			task: task.Task{
+				ScheduleType: task.ScheduleTypeOnce,
+				ExecAt:       time.Now().Add(-time.Second),
+			},
+			owner:   zero.Owner,
+			wantErr: nil,
+		},
+		{
+			name:      "手动触发的执行，释放后不修改下一次执行时间",
+			batchSize: 10,
+			leaseTTL:  10 * time.Second,
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET "+
+					"`owner`=CASE WHEN status = \\? THEN '' ELSE owner END,"+
+					"`status`=CASE WHEN status = \\? THEN status ELSE \\? END,"+
+					"`trigger_params`=CASE WHEN trigger_time = \\? THEN '' ELSE trigger_params END,"+
+					"`trigger_time`=CASE WHEN trigger_time = \\? THEN 0 ELSE trigger_time END,"+
+					"`utime`=\\? WHERE id = \\? AND owner = \\?").
+					WithArgs(task.TaskStatusPaused, task.TaskStatusPaused, task.TaskStatusWaiting,
+						int64(1000), int64(1000), sqlmock.AnyArg(), zero.ID, zero.Owner).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				return mockDB
+			},
+			tid: zero.ID,
+			task: task.Task{
+				CronExp:     "0 0 8 * * *",
+				TriggerTime: time.UnixMilli(1000),
+			},
+			owner:   zero.Owner,
+			wantErr: nil,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -738,13 +940,63 @@ func TestGormTaskRepository_ReleaseTask(t *testing.T) {
 				SkipDefaultTransaction: true,
 			})
 			require.NoError(t, err)
-			dao := newGormTaskRepository(db, tc.batchSize, tc.refreshInterval)
-			ta := task.Task{ID: tc.tid}
+			dao := NewGormTaskRepository(db, tc.batchSize, tc.leaseTTL)
+			ta := tc.task
+			ta.ID = tc.tid
 			err = dao.ReleaseTask(context.Background(), ta, tc.owner)
-			if err != nil {
-				assert.Equal(t, tc.wantErr, err)
-				return
-			}
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestGormTaskRepository_RetryTask(t *testing.T) {
+	next := time.Now().Add(time.Minute)
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		owner   string
+		wantErr error
+	}{
+		{
+			name: "释放成功，等待重试",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WithArgs(task.TaskStatusPaused, task.TaskStatusPaused, task.TaskStatusWaiting, next.UnixMilli(), 2, sqlmock.AnyArg(), int64(1), "tom").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				return mockDB
+			},
+			owner:   "tom",
+			wantErr: nil,
+		},
+		{
+			name: "释放失败，没有持有任务",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			owner:   "jack",
+			wantErr: ErrTaskNotHold,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB := tc.sqlMock(t)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+			dao := NewGormTaskRepository(db, 10, 10*time.Second)
+			err = dao.RetryTask(context.Background(), 1, tc.owner, 2, next)
+			assert.Equal(t, tc.wantErr, err)
 		})
 	}
 }
@@ -2,6 +2,8 @@ package mysql
 
 import (
 	"context"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/ecodeclub/ecron/internal/task"
 	"gorm.io/gorm"
 	"time"
@@ -17,13 +19,177 @@ func NewGormTaskCfgRepository(db *gorm.DB) *GormTaskCfgRepository {
 	}
 }
 
-func (g *GormTaskCfgRepository) Add(ctx context.Context, t task.Task) error {
+func (g *GormTaskCfgRepository) Add(ctx context.Context, t task.Task) (int64, error) {
 	te := toEntity(t)
 	now := time.Now().UnixMilli()
 	te.Status = task.TaskStatusWaiting
+	// 只执行一次的任务，没有指定下次执行时间时在 ExecAt 执行
+	if t.ScheduleType == task.ScheduleTypeOnce && te.NextExecTime == 0 {
+		te.NextExecTime = te.ExecAt
+	}
+	// 依赖上游的任务和执行过的一次性任务一样处于结束状态，直到工作流让它进入等待调度状态
+	if t.ScheduleType == task.ScheduleTypeDependent {
+		te.Status = task.TaskStatusFinished
+	}
 	te.Ctime = now
 	te.Utime = now
-	return g.db.WithContext(ctx).Create(&te).Error
+	err := g.db.WithContext(ctx).Create(&te).Error
+	return te.ID, err
+}
+
+func (g *GormTaskCfgRepository) Update(ctx context.Context, t task.Task) error {
+	te := toEntity(t)
+	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ?", t.ID).Updates(map[string]any{
+		"name":              te.Name,
+		"type":              te.Type,
+		"cron":              te.Cron,
+		"timezone":          te.Timezone,
+		"schedule_type":     te.ScheduleType,
+		"exec_at":           te.ExecAt,
+		"schedule_interval": te.Interval,
+		"executor":          te.Executor,
+		"cfg":               te.Cfg,
+		"retry_policy":      te.RetryPolicy,
+		"misfire_policy":    te.MisfirePolicy,
+		"shard_count":       te.ShardCount,
+		"next_exec_time":    te.NextExecTime,
+		"utime":             time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrTaskNotFound
+	}
+	return nil
+}
+
+func (g *GormTaskCfgRepository) Delete(ctx context.Context, id int64) error {
+	return g.db.WithContext(ctx).Where("id = ?", id).Delete(&TaskInfo{}).Error
+}
+
+func (g *GormTaskCfgRepository) Get(ctx context.Context, id int64) (task.Task, error) {
+	var te TaskInfo
+	err := g.db.WithContext(ctx).Where("id = ?", id).First(&te).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return task.Task{}, errs.ErrTaskNotFound
+	}
+	if err != nil {
+		return task.Task{}, err
+	}
+	return ToTask(te), nil
+}
+
+func (g *GormTaskCfgRepository) GetByName(ctx context.Context, name string) (task.Task, error) {
+	var te TaskInfo
+	err := g.db.WithContext(ctx).Where("name = ?", name).Order("id").First(&te).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return task.Task{}, errs.ErrTaskNotFound
+	}
+	if err != nil {
+		return task.Task{}, err
+	}
+	return ToTask(te), nil
+}
+
+func (g *GormTaskCfgRepository) List(ctx context.Context, offset, limit int) ([]task.Task, int64, error) {
+	var total int64
+	err := g.db.WithContext(ctx).Model(&TaskInfo{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var tes []TaskInfo
+	err = g.db.WithContext(ctx).Order("id DESC").
+		Offset(offset).Limit(limit).Find(&tes).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	res := make([]task.Task, 0, len(tes))
+	for _, te := range tes {
+		res = append(res, ToTask(te))
+	}
+	return res, total, nil
+}
+
+// Pause 暂停的任务 owner 不为空，说明暂停前的执行还没有结束。
+// 需要停止正在执行的任务时清空 owner，持有任务的调度节点续约失败后会停止执行
+func (g *GormTaskCfgRepository) Pause(ctx context.Context, id int64, stop bool) error {
+	var owner any = ""
+	if !stop {
+		owner = gorm.Expr("CASE WHEN status = ? THEN owner ELSE '' END", task.TaskStatusRunning)
+	}
+	res := updateInOrder(g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND status IN ?", id, []int8{task.TaskStatusWaiting, task.TaskStatusRunning}),
+		// owner 判断的是暂停前的状态
+		assign("owner", owner),
+		assign("status", task.TaskStatusPaused),
+		assign("utime", time.Now().UnixMilli()))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrInvalidTaskStatus
+	}
+	return nil
+}
+
+func (g *GormTaskCfgRepository) Resume(ctx context.Context, id int64, next time.Time) error {
+	status := task.TaskStatusWaiting
+	if next.IsZero() {
+		status = task.TaskStatusFinished
+	}
+	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND status = ?", id, task.TaskStatusPaused).Updates(map[string]any{
+		"status":         gorm.Expr("CASE WHEN owner = '' THEN ? ELSE ? END", status, task.TaskStatusRunning),
+		"next_exec_time": toMilli(next),
+		"utime":          time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrInvalidTaskStatus
+	}
+	return nil
+}
+
+// Trigger 只记录手动触发的时间和参数，不修改下一次执行时间，抢占任务时会优先考虑被触发的任务
+func (g *GormTaskCfgRepository) Trigger(ctx context.Context, id int64, params string) error {
+	now := time.Now().UnixMilli()
+	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND status IN ?", id, []int8{task.TaskStatusWaiting, task.TaskStatusRunning}).
+		Updates(map[string]any{
+			"trigger_time":   now,
+			"trigger_params": params,
+			"utime":          now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrInvalidTaskStatus
+	}
+	return nil
+}
+
+func (g *GormTaskCfgRepository) Ready(ctx context.Context, id int64) error {
+	now := time.Now().UnixMilli()
+	res := g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND status = ? AND schedule_type = ?", id, task.TaskStatusFinished, task.ScheduleTypeDependent.ToUint8()).
+		Updates(map[string]any{
+			"status":         task.TaskStatusWaiting,
+			"next_exec_time": now,
+			"attempt":        0,
+			"utime":          now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrInvalidTaskStatus
+	}
+	return nil
 }
 
 func (g *GormTaskCfgRepository) Stop(ctx context.Context, id int64) error {
@@ -40,3 +206,12 @@ func (g *GormTaskCfgRepository) UpdateNextTime(ctx context.Context, id int64, ne
 		"next_exec_time": next.UnixMilli(),
 	}).Error
 }
+
+func (g *GormTaskCfgRepository) ClearTrigger(ctx context.Context, id int64, triggerTime time.Time) error {
+	return g.db.WithContext(ctx).Model(&TaskInfo{}).
+		Where("id = ? AND trigger_time = ?", id, triggerTime.UnixMilli()).Updates(map[string]any{
+		"trigger_time":   0,
+		"trigger_params": "",
+		"utime":          time.Now().UnixMilli(),
+	}).Error
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/ecodeclub/ecron/internal/task"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,6 +21,7 @@ func TestTaskCfgRepository_Add(t *testing.T) {
 		sqlMock func(t *testing.T) *sql.DB
 		in      task.Task
 		wantErr error
+		wantID  int64
 	}{
 		{
 			name: "插入成功",
@@ -34,6 +36,7 @@ func TestTaskCfgRepository_Add(t *testing.T) {
 				Name: "test",
 			},
 			wantErr: nil,
+			wantID:  1,
 		},
 		{
 			name: "插入失败",
@@ -63,8 +66,9 @@ func TestTaskCfgRepository_Add(t *testing.T) {
 			require.NoError(t, err)
 			dao := NewGormTaskCfgRepository(db)
 			require.NoError(t, err)
-			err = dao.Add(context.Background(), tc.in)
+			id, err := dao.Add(context.Background(), tc.in)
 			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantID, id)
 		})
 	}
 }
@@ -109,3 +113,397 @@ func TestTaskCfgRepository_UpdateNextTime(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskCfgRepository_Update(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		in      task.Task
+		wantErr error
+	}{
+		{
+			name: "更新成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET .* WHERE id = \\?").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+			in: task.Task{ID: 1, Name: "test", CronExp: "0 0 8 * * *"},
+		},
+		{
+			name: "任务不存在",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET .* WHERE id = \\?").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			in:      task.Task{ID: 2, Name: "test", CronExp: "0 0 8 * * *"},
+			wantErr: errs.ErrTaskNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.Update(context.Background(), tc.in)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestTaskCfgRepository_Get(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sqlMock  func(t *testing.T) *sql.DB
+		id       int64
+		wantErr  error
+		wantTask task.Task
+	}{
+		{
+			name: "查询成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `task_info` WHERE id = \\?").
+					WithArgs(int64(1), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "cron", "executor", "status", "next_exec_time", "ctime", "utime"}).
+						AddRow(1, "test", "0 0 8 * * *", "HTTP", task.TaskStatusWaiting, 1000, 100, 200))
+				return mockDB
+			},
+			id: 1,
+			wantTask: task.Task{
+				ID:           1,
+				Name:         "test",
+				CronExp:      "0 0 8 * * *",
+				Executor:     "HTTP",
+				LastStatus:   task.TaskStatusWaiting,
+				NextExecTime: time.UnixMilli(1000),
+				Ctime:        time.UnixMilli(100),
+				Utime:        time.UnixMilli(200),
+			},
+		},
+		{
+			name: "任务不存在",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `task_info` WHERE id = \\?").
+					WillReturnError(gorm.ErrRecordNotFound)
+				return mockDB
+			},
+			id:      2,
+			wantErr: errs.ErrTaskNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			res, err := dao.Get(context.Background(), tc.id)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantTask, res)
+		})
+	}
+}
+
+func TestTaskCfgRepository_GetByName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sqlMock  func(t *testing.T) *sql.DB
+		taskName string
+		wantErr  error
+		wantTask task.Task
+	}{
+		{
+			name: "查询成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				// 有多个同名任务时返回最早创建的
+				mock.ExpectQuery("SELECT \\* FROM `task_info` WHERE name = \\? ORDER BY id").
+					WithArgs("test", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "cron", "executor", "status", "next_exec_time", "ctime", "utime"}).
+						AddRow(1, "test", "0 0 8 * * *", "LOCAL", task.TaskStatusWaiting, 1000, 100, 200))
+				return mockDB
+			},
+			taskName: "test",
+			wantTask: task.Task{
+				ID:           1,
+				Name:         "test",
+				CronExp:      "0 0 8 * * *",
+				Executor:     "LOCAL",
+				LastStatus:   task.TaskStatusWaiting,
+				NextExecTime: time.UnixMilli(1000),
+				Ctime:        time.UnixMilli(100),
+				Utime:        time.UnixMilli(200),
+			},
+		},
+		{
+			name: "任务不存在",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `task_info` WHERE name = \\?").
+					WillReturnError(gorm.ErrRecordNotFound)
+				return mockDB
+			},
+			taskName: "unknown",
+			wantErr:  errs.ErrTaskNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			res, err := dao.GetByName(context.Background(), tc.taskName)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantTask, res)
+		})
+	}
+}
+
+func TestTaskCfgRepository_Pause(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		stop    bool
+		wantErr error
+	}{
+		{
+			name: "暂停，正在执行的任务继续执行",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET `owner`=CASE WHEN status = \\? THEN owner ELSE '' END,"+
+					"`status`=\\?,`utime`=\\? WHERE id = \\? AND status IN \\(\\?,\\?\\)").
+					WithArgs(task.TaskStatusRunning, task.TaskStatusPaused, sqlmock.AnyArg(),
+						int64(1), task.TaskStatusWaiting, task.TaskStatusRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+		},
+		{
+			name: "暂停，停止正在执行的任务",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET `owner`=\\?,`status`=\\?,`utime`=\\? WHERE id = \\? AND status IN \\(\\?,\\?\\)").
+					WithArgs("", task.TaskStatusPaused, sqlmock.AnyArg(),
+						int64(1), task.TaskStatusWaiting, task.TaskStatusRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+			stop: true,
+		},
+		{
+			name: "任务已经暂停或者结束",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			wantErr: errs.ErrInvalidTaskStatus,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.Pause(context.Background(), 1, tc.stop)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestTaskCfgRepository_Resume(t *testing.T) {
+	next := time.Now().Add(time.Minute)
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		next    time.Time
+		wantErr error
+	}{
+		{
+			name: "恢复成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET `next_exec_time`=\\?,"+
+					"`status`=CASE WHEN owner = '' THEN \\? ELSE \\? END,`utime`=\\? WHERE id = \\? AND status = \\?").
+					WithArgs(next.UnixMilli(), task.TaskStatusWaiting, task.TaskStatusRunning, sqlmock.AnyArg(),
+						int64(1), task.TaskStatusPaused).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+			next: next,
+		},
+		{
+			name: "不需要再执行的任务，恢复后结束",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WithArgs(int64(0), task.TaskStatusFinished, task.TaskStatusRunning, sqlmock.AnyArg(),
+						int64(1), task.TaskStatusPaused).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+		},
+		{
+			name: "任务没有暂停",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			next:    next,
+			wantErr: errs.ErrInvalidTaskStatus,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.Resume(context.Background(), 1, tc.next)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestTaskCfgRepository_Trigger(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		params  string
+		wantErr error
+	}{
+		{
+			name: "触发成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				// 不会修改下一次执行时间
+				mock.ExpectExec("UPDATE `task_info` SET `trigger_params`=\\?,`trigger_time`=\\?,`utime`=\\? "+
+					"WHERE id = \\? AND status IN \\(\\?,\\?\\)").
+					WithArgs(`{"body":"{}"}`, sqlmock.AnyArg(), sqlmock.AnyArg(),
+						int64(1), task.TaskStatusWaiting, task.TaskStatusRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+			params: `{"body":"{}"}`,
+		},
+		{
+			name: "任务已经暂停或者结束",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			wantErr: errs.ErrInvalidTaskStatus,
+		},
+		{
+			name: "数据库错误",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnError(errors.New("mock db error"))
+				return mockDB
+			},
+			wantErr: errors.New("mock db error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.Trigger(context.Background(), 1, tc.params)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestTaskCfgRepository_ClearTrigger(t *testing.T) {
+	trigger := time.UnixMilli(1000)
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		wantErr error
+	}{
+		{
+			name: "清除本次触发",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				// 执行过程中再次触发的话触发时间不同，不会被清除
+				mock.ExpectExec("UPDATE `task_info` SET `trigger_params`=\\?,`trigger_time`=\\?,`utime`=\\? "+
+					"WHERE id = \\? AND trigger_time = \\?").
+					WithArgs("", 0, sqlmock.AnyArg(), int64(1), int64(1000)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+		},
+		{
+			name: "数据库错误",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnError(errors.New("mock db error"))
+				return mockDB
+			},
+			wantErr: errors.New("mock db error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.ClearTrigger(context.Background(), 1, trigger)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestTaskCfgRepository_Ready(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		wantErr error
+	}{
+		{
+			name: "进入等待调度状态",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info` SET `attempt`=\\?,`next_exec_time`=\\?,`status`=\\?,`utime`=\\? "+
+					"WHERE id = \\? AND status = \\? AND schedule_type = \\?").
+					WithArgs(0, sqlmock.AnyArg(), task.TaskStatusWaiting, sqlmock.AnyArg(),
+						int64(1), task.TaskStatusFinished, task.ScheduleTypeDependent.ToUint8()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+		},
+		{
+			name: "上一次执行还没有结束",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `task_info`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			wantErr: errs.ErrInvalidTaskStatus,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormTaskCfgRepository(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.Ready(context.Background(), 1)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
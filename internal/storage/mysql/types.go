@@ -1,7 +1,10 @@
 package mysql
 
 import (
+	"encoding/json"
 	"github.com/ecodeclub/ecron/internal/task"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
@@ -9,15 +12,37 @@ type TaskInfo struct {
 	ID   int64  `gorm:"column:id;primaryKey;autoIncrement"`
 	Name string `gorm:"column:name"`
 	// 任务类型
-	Type         string `gorm:"column:type"`
-	Cron         string `gorm:"column:cron"`
-	Executor     string `gorm:"column:executor"`
-	Owner        string `gorm:"column:owner"`
-	Status       int8   `gorm:"column:status;index:idx_status_utime;index:idx_status_next_exec_time"`
-	Cfg          string `gorm:"column:cfg"`
-	NextExecTime int64  `gorm:"column:next_exec_time;index:idx_status_next_exec_time"`
-	Ctime        int64  `gorm:"column:ctime"`
-	Utime        int64  `gorm:"column:utime;index:idx_status_utime;"`
+	Type string `gorm:"column:type"`
+	Cron string `gorm:"column:cron"`
+	// cron 表达式使用的时区
+	Timezone string `gorm:"column:timezone"`
+	// 调度方式，0-cron，1-执行一次，2-固定频率，3-固定延迟，4-依赖上游
+	ScheduleType uint8 `gorm:"column:schedule_type"`
+	// 执行一次的任务的执行时间
+	ExecAt int64 `gorm:"column:exec_at"`
+	// 固定频率和固定延迟任务的调度间隔，单位毫秒
+	Interval int64  `gorm:"column:schedule_interval"`
+	Executor string `gorm:"column:executor"`
+	Owner    string `gorm:"column:owner"`
+	Status   int8   `gorm:"column:status;index:idx_status_utime;index:idx_status_next_exec_time;index:idx_status_trigger_time"`
+	Cfg      string `gorm:"column:cfg"`
+	// 重试策略，JSON 格式
+	RetryPolicy string `gorm:"column:retry_policy"`
+	// 错过执行时间后的处理策略，JSON 格式
+	MisfirePolicy string `gorm:"column:misfire_policy"`
+	// 分片数量，大于 1 时每次执行都会拆分成多个分片
+	ShardCount int `gorm:"column:shard_count"`
+	// 本次调度已经执行的次数
+	Attempt int `gorm:"column:attempt"`
+	// 每次抢占任务都会加一
+	FencingToken int64 `gorm:"column:fencing_token"`
+	NextExecTime int64 `gorm:"column:next_exec_time;index:idx_status_next_exec_time"`
+	// 手动触发的时间，0 表示没有等待执行的手动触发
+	TriggerTime int64 `gorm:"column:trigger_time;index:idx_status_trigger_time"`
+	// 手动触发时传入的参数，JSON 格式
+	TriggerParams string `gorm:"column:trigger_params"`
+	Ctime         int64  `gorm:"column:ctime"`
+	Utime         int64  `gorm:"column:utime;index:idx_status_utime;"`
 }
 
 func (TaskInfo) TableName() string {
@@ -26,46 +51,202 @@ func (TaskInfo) TableName() string {
 
 func toEntity(t task.Task) TaskInfo {
 	return TaskInfo{
-		ID:       t.ID,
-		Name:     t.Name,
-		Type:     t.Type.String(),
-		Cron:     t.CronExp,
-		Executor: t.Executor,
-		Cfg:      t.Cfg,
-		Ctime:    t.Ctime.UnixMilli(),
-		Utime:    t.Utime.UnixMilli(),
-		Owner:    t.Owner,
+		ID:            t.ID,
+		Name:          t.Name,
+		Type:          t.Type.String(),
+		Cron:          t.CronExp,
+		Timezone:      t.Timezone,
+		ScheduleType:  t.ScheduleType.ToUint8(),
+		ExecAt:        toMilli(t.ExecAt),
+		Interval:      t.Interval.Milliseconds(),
+		Executor:      t.Executor,
+		Cfg:           t.Cfg,
+		RetryPolicy:   toRetryPolicy(t.RetryPolicy),
+		MisfirePolicy: toMisfirePolicy(t.MisfirePolicy),
+		ShardCount:    t.ShardCount,
+		Attempt:       t.Attempt,
+		NextExecTime:  toMilli(t.NextExecTime),
+		TriggerTime:   toMilli(t.TriggerTime),
+		TriggerParams: t.TriggerParams,
+		Ctime:         t.Ctime.UnixMilli(),
+		Utime:         t.Utime.UnixMilli(),
+		Owner:         t.Owner,
 	}
 }
 
-func toTask(t TaskInfo) task.Task {
+// ToTask 转换为领域对象，其他使用相同表结构的存储实现也会用到
+func ToTask(t TaskInfo) task.Task {
 	return task.Task{
-		ID:         t.ID,
-		Name:       t.Name,
-		Type:       task.Type(t.Type),
-		Executor:   t.Executor,
-		Cfg:        t.Cfg,
-		CronExp:    t.Cron,
-		Ctime:      time.UnixMilli(t.Ctime),
-		Utime:      time.UnixMilli(t.Utime),
-		LastStatus: t.Status,
-		Owner:      t.Owner,
+		ID:            t.ID,
+		Name:          t.Name,
+		Type:          task.Type(t.Type),
+		Executor:      t.Executor,
+		Cfg:           t.Cfg,
+		CronExp:       t.Cron,
+		Timezone:      t.Timezone,
+		ScheduleType:  task.ScheduleType(t.ScheduleType),
+		ExecAt:        fromMilli(t.ExecAt),
+		Interval:      time.Duration(t.Interval) * time.Millisecond,
+		NextExecTime:  fromMilli(t.NextExecTime),
+		RetryPolicy:   fromRetryPolicy(t.RetryPolicy),
+		MisfirePolicy: fromMisfirePolicy(t.MisfirePolicy),
+		ShardCount:    t.ShardCount,
+		Attempt:       t.Attempt,
+		TriggerTime:   fromMilli(t.TriggerTime),
+		TriggerParams: t.TriggerParams,
+		Ctime:         time.UnixMilli(t.Ctime),
+		Utime:         time.UnixMilli(t.Utime),
+		LastStatus:    t.Status,
+		Owner:         t.Owner,
+		FencingToken:  t.FencingToken,
 	}
 }
 
-// Execution 任务执行记录
+// toRetryPolicy 没有配置重试策略时存储为空字符串
+func toRetryPolicy(p task.RetryPolicy) string {
+	if p.MaxAttempts <= 1 {
+		return ""
+	}
+	res, _ := json.Marshal(p)
+	return string(res)
+}
+
+func fromRetryPolicy(p string) task.RetryPolicy {
+	var res task.RetryPolicy
+	if p != "" {
+		_ = json.Unmarshal([]byte(p), &res)
+	}
+	return res
+}
+
+// toMisfirePolicy 使用默认的处理策略时存储为空字符串
+func toMisfirePolicy(p task.MisfirePolicy) string {
+	if p == (task.MisfirePolicy{}) {
+		return ""
+	}
+	res, _ := json.Marshal(p)
+	return string(res)
+}
+
+func fromMisfirePolicy(p string) task.MisfirePolicy {
+	var res task.MisfirePolicy
+	if p != "" {
+		_ = json.Unmarshal([]byte(p), &res)
+	}
+	return res
+}
+
+// updateInOrder 按照 assignments 的顺序生成 SET 子句。
+// MySQL 从左到右依次赋值，后面的表达式读到的是前面已经赋值的新值，PostgreSQL 和 SQLite 读到的都是更新前的值。
+// 引用了其他字段的表达式需要排在被引用的字段之前，这样在所有数据库中判断的都是更新前的值。
+// 不能使用 map 更新，map 生成的 SET 子句的顺序取决于 gorm 的实现
+func updateInOrder(db *gorm.DB, assignments ...clause.Assignment) *gorm.DB {
+	return db.Clauses(clause.Set(assignments)).Updates(map[string]any{})
+}
+
+func assign(column string, value any) clause.Assignment {
+	return clause.Assignment{Column: clause.Column{Name: column}, Value: value}
+}
+
+// toMilli 零值时间存储为 0
+func toMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// fromMilli 0 转换为零值时间
+func fromMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// Execution 任务执行记录，每一次执行对应一条记录
 type Execution struct {
-	ID int64 `gorm:"column:id;primaryKey;autoIncrement"`
-	// 一个任务至多一个执行记录
-	Tid int64 `gorm:"column:tid;uniqueIndex:idx_tid"`
+	ID  int64 `gorm:"column:id;primaryKey;autoIncrement"`
+	Tid int64 `gorm:"column:tid;index:idx_tid_start_time"`
+	// 本次调度的第几次执行
+	Attempt int `gorm:"column:attempt"`
+	// 开始执行时一共错过了多少次执行
+	Misfired int `gorm:"column:misfired"`
+	// 触发方式，0-按照调度计划执行，1-手动触发
+	TriggerType uint8 `gorm:"column:trigger_type"`
 	// 任务执行进度
 	Progress uint8 `gorm:"column:progress"`
-	// 任务执行状态，0-未知，1-运行中，2-成功，3-失败，4-超时，5-主动取消
-	Status uint8 `gorm:"column:status"`
-	Ctime  int64 `gorm:"column:ctime"`
-	Utime  int64 `gorm:"column:utime"`
+	// 任务执行状态，0-未知，1-运行中，2-成功，3-失败，4-超时，5-主动取消，6-跳过，7-分片等待执行
+	Status    uint8 `gorm:"column:status;index:idx_status"`
+	StartTime int64 `gorm:"column:start_time;index:idx_tid_start_time"`
+	// 执行结束的时间，没有结束时为 0
+	EndTime int64 `gorm:"column:end_time"`
+	// 执行失败时的错误信息
+	ErrMsg string `gorm:"column:err_msg"`
+	// 执行任务的调度节点
+	Node string `gorm:"column:node"`
+	// 分片所属的执行记录的 id，不是分片时为 0
+	ParentID int64 `gorm:"column:parent_id;index:idx_parent_id"`
+	// 分片的序号
+	ShardIndex int `gorm:"column:shard_index"`
+	// 分片总数，执行没有分片时为 0
+	ShardTotal int `gorm:"column:shard_total"`
+	// 最后一次写入的租约的 fencing token，更小的 token 写入时会被拒绝
+	FencingToken int64 `gorm:"column:fencing_token"`
+	Ctime        int64 `gorm:"column:ctime"`
+	Utime        int64 `gorm:"column:utime"`
 }
 
 func (Execution) TableName() string {
 	return "execution"
 }
+
+// Workflow 工作流，节点保存在 workflow_node 中
+type Workflow struct {
+	ID    int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	Name  string `gorm:"column:name"`
+	Ctime int64  `gorm:"column:ctime"`
+	Utime int64  `gorm:"column:utime"`
+}
+
+func (Workflow) TableName() string {
+	return "workflow"
+}
+
+// WorkflowNode 工作流的节点，每个任务只能属于一个工作流
+type WorkflowNode struct {
+	ID  int64 `gorm:"column:id;primaryKey;autoIncrement"`
+	Wid int64 `gorm:"column:wid;index:idx_wid"`
+	Tid int64 `gorm:"column:tid;uniqueIndex:uniq_tid"`
+	// 上游任务的 id，JSON 数组
+	Upstreams string `gorm:"column:upstreams"`
+	// 上游任务没有全部执行成功时的处理策略，0-跳过，1-停止工作流，2-依旧执行
+	FailurePolicy uint8 `gorm:"column:failure_policy"`
+	Ctime         int64 `gorm:"column:ctime"`
+	Utime         int64 `gorm:"column:utime"`
+}
+
+func (WorkflowNode) TableName() string {
+	return "workflow_node"
+}
+
+// WorkflowRun 工作流的运行记录
+type WorkflowRun struct {
+	ID  int64 `gorm:"column:id;primaryKey;autoIncrement"`
+	Wid int64 `gorm:"column:wid;index:idx_wid_status"`
+	// 1-运行中，2-成功，3-失败，4-停止
+	Status uint8 `gorm:"column:status;index:idx_wid_status"`
+	// 每个节点的执行状态，JSON 格式，key 是任务 id
+	Nodes     string `gorm:"column:nodes"`
+	StartTime int64  `gorm:"column:start_time"`
+	EndTime   int64  `gorm:"column:end_time"`
+	Version   int64  `gorm:"column:version"`
+	// 运行中时等于 Wid，结束后为 NULL，唯一索引保证每个工作流最多只有一个运行中的记录
+	RunningWid *int64 `gorm:"column:running_wid;uniqueIndex:uk_running_wid"`
+	Ctime      int64  `gorm:"column:ctime"`
+	Utime      int64  `gorm:"column:utime"`
+}
+
+func (WorkflowRun) TableName() string {
+	return "workflow_run"
+}
@@ -0,0 +1,197 @@
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/task"
+	"gorm.io/gorm"
+	"time"
+)
+
+type GormWorkflowDAO struct {
+	db *gorm.DB
+}
+
+func NewGormWorkflowDAO(db *gorm.DB) *GormWorkflowDAO {
+	return &GormWorkflowDAO{db: db}
+}
+
+func (g *GormWorkflowDAO) Create(ctx context.Context, w task.Workflow) (int64, error) {
+	now := time.Now().UnixMilli()
+	we := Workflow{
+		Name:  w.Name,
+		Ctime: now,
+		Utime: now,
+	}
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&we).Error; err != nil {
+			return err
+		}
+		nodes := make([]WorkflowNode, 0, len(w.Nodes))
+		for _, n := range w.Nodes {
+			upstreams, _ := json.Marshal(n.Upstreams)
+			nodes = append(nodes, WorkflowNode{
+				Wid:           we.ID,
+				Tid:           n.Tid,
+				Upstreams:     string(upstreams),
+				FailurePolicy: uint8(n.FailurePolicy),
+				Ctime:         now,
+				Utime:         now,
+			})
+		}
+		return tx.Create(&nodes).Error
+	})
+	return we.ID, err
+}
+
+func (g *GormWorkflowDAO) Get(ctx context.Context, id int64) (task.Workflow, error) {
+	var we Workflow
+	err := g.db.WithContext(ctx).Where("id = ?", id).First(&we).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return task.Workflow{}, errs.ErrWorkflowNotFound
+	}
+	if err != nil {
+		return task.Workflow{}, err
+	}
+	var nodes []WorkflowNode
+	err = g.db.WithContext(ctx).Where("wid = ?", id).Order("id").Find(&nodes).Error
+	if err != nil {
+		return task.Workflow{}, err
+	}
+	return toWorkflow(we, nodes), nil
+}
+
+func (g *GormWorkflowDAO) GetByTask(ctx context.Context, tid int64) (task.Workflow, error) {
+	var node WorkflowNode
+	err := g.db.WithContext(ctx).Where("tid = ?", tid).First(&node).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return task.Workflow{}, errs.ErrWorkflowNotFound
+	}
+	if err != nil {
+		return task.Workflow{}, err
+	}
+	return g.Get(ctx, node.Wid)
+}
+
+// CreateRun 工作流已经有运行中的记录时，running_wid 的唯一索引冲突，返回 errs.ErrConcurrentUpdate。
+// 不同数据库唯一索引冲突的错误不同，所以出错后再查询一次运行中的记录来判断
+func (g *GormWorkflowDAO) CreateRun(ctx context.Context, r task.WorkflowRun) (int64, error) {
+	now := time.Now().UnixMilli()
+	re := toWorkflowRunEntity(r)
+	re.Ctime = now
+	re.Utime = now
+	err := g.db.WithContext(ctx).Create(&re).Error
+	if err != nil && re.RunningWid != nil {
+		if _, er := g.GetRunningRun(ctx, r.Wid); er == nil {
+			return 0, errs.ErrConcurrentUpdate
+		}
+	}
+	return re.ID, err
+}
+
+func (g *GormWorkflowDAO) GetRunningRun(ctx context.Context, wid int64) (task.WorkflowRun, error) {
+	var re WorkflowRun
+	err := g.db.WithContext(ctx).
+		Where("wid = ? AND status = ?", wid, task.WorkflowRunStatusRunning.ToUint8()).
+		Order("id DESC").First(&re).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return task.WorkflowRun{}, errs.ErrWorkflowRunNotFound
+	}
+	if err != nil {
+		return task.WorkflowRun{}, err
+	}
+	return toWorkflowRun(re), nil
+}
+
+func (g *GormWorkflowDAO) UpdateRun(ctx context.Context, r task.WorkflowRun) error {
+	re := toWorkflowRunEntity(r)
+	res := g.db.WithContext(ctx).Model(&WorkflowRun{}).
+		Where("id = ? AND version = ?", r.ID, r.Version).
+		Updates(map[string]any{
+			"status":      re.Status,
+			"nodes":       re.Nodes,
+			"end_time":    re.EndTime,
+			"running_wid": re.RunningWid,
+			"version":     r.Version + 1,
+			"utime":       time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrConcurrentUpdate
+	}
+	return nil
+}
+
+func (g *GormWorkflowDAO) ListRuns(ctx context.Context, wid int64, offset, limit int) ([]task.WorkflowRun, int64, error) {
+	var total int64
+	err := g.db.WithContext(ctx).Model(&WorkflowRun{}).Where("wid = ?", wid).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var res []WorkflowRun
+	err = g.db.WithContext(ctx).Where("wid = ?", wid).Order("id DESC").
+		Offset(offset).Limit(limit).Find(&res).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	runs := make([]task.WorkflowRun, 0, len(res))
+	for _, re := range res {
+		runs = append(runs, toWorkflowRun(re))
+	}
+	return runs, total, nil
+}
+
+func toWorkflow(we Workflow, nodes []WorkflowNode) task.Workflow {
+	w := task.Workflow{
+		ID:    we.ID,
+		Name:  we.Name,
+		Nodes: make([]task.WorkflowNode, 0, len(nodes)),
+		Ctime: time.UnixMilli(we.Ctime),
+		Utime: time.UnixMilli(we.Utime),
+	}
+	for _, n := range nodes {
+		var upstreams []int64
+		_ = json.Unmarshal([]byte(n.Upstreams), &upstreams)
+		w.Nodes = append(w.Nodes, task.WorkflowNode{
+			Tid:           n.Tid,
+			Upstreams:     upstreams,
+			FailurePolicy: task.FailurePolicy(n.FailurePolicy),
+		})
+	}
+	return w
+}
+
+func toWorkflowRunEntity(r task.WorkflowRun) WorkflowRun {
+	nodes, _ := json.Marshal(r.Nodes)
+	re := WorkflowRun{
+		ID:        r.ID,
+		Wid:       r.Wid,
+		Status:    r.Status.ToUint8(),
+		Nodes:     string(nodes),
+		StartTime: toMilli(r.StartTime),
+		EndTime:   toMilli(r.EndTime),
+		Version:   r.Version,
+	}
+	if r.Status == task.WorkflowRunStatusRunning {
+		re.RunningWid = &re.Wid
+	}
+	return re
+}
+
+func toWorkflowRun(re WorkflowRun) task.WorkflowRun {
+	var nodes map[int64]task.ExecStatus
+	_ = json.Unmarshal([]byte(re.Nodes), &nodes)
+	return task.WorkflowRun{
+		ID:        re.ID,
+		Wid:       re.Wid,
+		Status:    task.WorkflowRunStatus(re.Status),
+		Nodes:     nodes,
+		StartTime: fromMilli(re.StartTime),
+		EndTime:   fromMilli(re.EndTime),
+		Version:   re.Version,
+	}
+}
@@ -0,0 +1,239 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGormWorkflowDAO_Create(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		wantErr error
+		wantID  int64
+	}{
+		{
+			name: "创建成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `workflow`").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO `workflow_node`").
+					WithArgs(int64(1), int64(1), "null", uint8(0), sqlmock.AnyArg(), sqlmock.AnyArg(),
+						int64(1), int64(2), "[1]", uint8(1), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectCommit()
+				return mockDB
+			},
+			wantID: 1,
+		},
+		{
+			name: "任务已经属于其他工作流",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `workflow`").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO `workflow_node`").
+					WillReturnError(errors.New("duplicate entry"))
+				mock.ExpectRollback()
+				return mockDB
+			},
+			wantErr: errors.New("duplicate entry"),
+			wantID:  1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormWorkflowDAO(newMockGormDB(t, tc.sqlMock(t)))
+			id, err := dao.Create(context.Background(), task.Workflow{
+				Name: "test",
+				Nodes: []task.WorkflowNode{
+					{Tid: 1},
+					{Tid: 2, Upstreams: []int64{1}, FailurePolicy: task.FailurePolicyHalt},
+				},
+			})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantID, id)
+		})
+	}
+}
+
+func TestGormWorkflowDAO_GetByTask(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sqlMock  func(t *testing.T) *sql.DB
+		wantErr  error
+		wantFlow task.Workflow
+	}{
+		{
+			name: "查询成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `workflow_node` WHERE tid = \\?").
+					WithArgs(int64(2), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "wid", "tid"}).AddRow(2, 1, 2))
+				mock.ExpectQuery("SELECT \\* FROM `workflow` WHERE id = \\?").
+					WithArgs(int64(1), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "ctime", "utime"}).
+						AddRow(1, "test", 1000, 1000))
+				mock.ExpectQuery("SELECT \\* FROM `workflow_node` WHERE wid = \\?").
+					WithArgs(int64(1)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "wid", "tid", "upstreams", "failure_policy"}).
+						AddRow(1, 1, 1, "null", 0).
+						AddRow(2, 1, 2, "[1]", 2))
+				return mockDB
+			},
+			wantFlow: task.Workflow{
+				ID:   1,
+				Name: "test",
+				Nodes: []task.WorkflowNode{
+					{Tid: 1},
+					{Tid: 2, Upstreams: []int64{1}, FailurePolicy: task.FailurePolicyRunAnyway},
+				},
+				Ctime: time.UnixMilli(1000),
+				Utime: time.UnixMilli(1000),
+			},
+		},
+		{
+			name: "任务不属于任何工作流",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `workflow_node` WHERE tid = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return mockDB
+			},
+			wantErr: errs.ErrWorkflowNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormWorkflowDAO(newMockGormDB(t, tc.sqlMock(t)))
+			w, err := dao.GetByTask(context.Background(), 2)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantFlow, w)
+		})
+	}
+}
+
+func TestGormWorkflowDAO_CreateRun(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		wantID  int64
+		wantErr error
+	}{
+		{
+			name: "创建成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				// 运行中的记录带上唯一的 running_wid
+				mock.ExpectExec("INSERT INTO `workflow_run` \\(`wid`,`status`,`nodes`,`start_time`,`end_time`,`version`,`running_wid`,`ctime`,`utime`\\)").
+					WithArgs(int64(1), task.WorkflowRunStatusRunning.ToUint8(), `{"1":2}`, int64(0), int64(0), int64(0),
+						int64(1), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				return mockDB
+			},
+			wantID: 2,
+		},
+		{
+			name: "已经有运行中的记录",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("INSERT INTO `workflow_run`").
+					WillReturnError(errors.New("Duplicate entry '1' for key 'uk_running_wid'"))
+				mock.ExpectQuery("SELECT \\* FROM `workflow_run` WHERE wid = \\? AND status = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "wid", "status"}).
+						AddRow(1, 1, task.WorkflowRunStatusRunning.ToUint8()))
+				return mockDB
+			},
+			wantErr: errs.ErrConcurrentUpdate,
+		},
+		{
+			name: "数据库错误",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("INSERT INTO `workflow_run`").
+					WillReturnError(errors.New("mock db error"))
+				mock.ExpectQuery("SELECT \\* FROM `workflow_run`").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return mockDB
+			},
+			wantErr: errors.New("mock db error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormWorkflowDAO(newMockGormDB(t, tc.sqlMock(t)))
+			id, err := dao.CreateRun(context.Background(), task.WorkflowRun{
+				Wid:    1,
+				Status: task.WorkflowRunStatusRunning,
+				Nodes:  map[int64]task.ExecStatus{1: task.ExecStatusSuccess},
+			})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantID, id)
+		})
+	}
+}
+
+func TestGormWorkflowDAO_UpdateRun(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sqlMock func(t *testing.T) *sql.DB
+		wantErr error
+	}{
+		{
+			name: "更新成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `workflow_run` SET `end_time`=\\?,`nodes`=\\?,`running_wid`=\\?,`status`=\\?,`utime`=\\?,`version`=\\? "+
+					"WHERE id = \\? AND version = \\?").
+					WithArgs(int64(0), `{"1":2,"2":1}`, int64(1), task.WorkflowRunStatusRunning.ToUint8(), sqlmock.AnyArg(),
+						int64(4), int64(1), int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return mockDB
+			},
+		},
+		{
+			name: "已经被其他节点修改",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectExec("UPDATE `workflow_run`").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return mockDB
+			},
+			wantErr: errs.ErrConcurrentUpdate,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormWorkflowDAO(newMockGormDB(t, tc.sqlMock(t)))
+			err := dao.UpdateRun(context.Background(), task.WorkflowRun{
+				ID:      1,
+				Wid:     1,
+				Status:  task.WorkflowRunStatusRunning,
+				Nodes:   map[int64]task.ExecStatus{1: task.ExecStatusSuccess, 2: task.ExecStatusRunning},
+				Version: 3,
+			})
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"github.com/ecodeclub/ecron/internal/task"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var _ storage.ExecutionDAO = (*GormExecutionDAO)(nil)
+
+// GormExecutionDAO 只有抢占分片和 MySQL 不同
+type GormExecutionDAO struct {
+	*mysql.GormExecutionDAO
+	db *gorm.DB
+}
+
+func NewGormExecutionDAO(db *gorm.DB) *GormExecutionDAO {
+	return &GormExecutionDAO{
+		GormExecutionDAO: mysql.NewGormExecutionDAO(db),
+		db:               db,
+	}
+}
+
+// PreemptShard 一条语句完成查询和抢占，其他调度节点锁住的分片直接跳过
+func (g *GormExecutionDAO) PreemptShard(ctx context.Context, node string, leaseTTL time.Duration) (task.Execution, error) {
+	now := time.Now()
+	waiting := g.db.WithContext(ctx).Model(&mysql.Execution{}).Select("id").
+		Where(mysql.ShardPreemptable(g.db, now, leaseTTL)).
+		Order("id").Limit(1).Clauses(skipLocked)
+	var e mysql.Execution
+	res := g.db.WithContext(ctx).Model(&e).Clauses(clause.Returning{}).
+		Where("id = (?)", waiting).
+		Updates(map[string]any{
+			"status":     task.ExecStatusRunning.ToUint8(),
+			"node":       node,
+			"start_time": now.UnixMilli(),
+			"utime":      now.UnixMilli(),
+		})
+	if res.Error != nil {
+		return task.Execution{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return task.Execution{}, errs.ErrNoExecutableTask
+	}
+	return g.ToDomain(e), nil
+}
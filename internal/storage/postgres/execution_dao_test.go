@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGormExecutionDAO_PreemptShard(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sqlMock  func(t *testing.T) *sql.DB
+		wantErr  error
+		wantExec task.Execution
+	}{
+		{
+			name: "抢占成功",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery(`UPDATE "execution" SET "node"=\$1,"start_time"=\$2,"status"=\$3,"utime"=\$4 `+
+					`WHERE id = \(SELECT "id" FROM "execution" WHERE status = \$5 OR \(status = \$6 AND parent_id > 0 AND utime < \$7\) `+
+					`ORDER BY id LIMIT \$8 FOR UPDATE SKIP LOCKED\) RETURNING \*`).
+					WithArgs("node-1", sqlmock.AnyArg(), task.ExecStatusRunning.ToUint8(), sqlmock.AnyArg(),
+						task.ExecStatusWaiting.ToUint8(), task.ExecStatusRunning.ToUint8(), sqlmock.AnyArg(), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "tid", "status", "node", "parent_id", "shard_index", "shard_total"}).
+						AddRow(3, 1, task.ExecStatusRunning.ToUint8(), "node-1", 2, 1, 2))
+				return mockDB
+			},
+			wantExec: task.Execution{
+				ID:         3,
+				Tid:        1,
+				Status:     task.ExecStatusRunning,
+				Node:       "node-1",
+				ParentID:   2,
+				ShardIndex: 1,
+				ShardTotal: 2,
+			},
+		},
+		{
+			name: "没有等待执行的分片",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery(`UPDATE "execution" SET`).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return mockDB
+			},
+			wantErr: errs.ErrNoExecutableTask,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := NewGormExecutionDAO(newMockGormDB(t, tc.sqlMock(t)))
+			e, err := dao.PreemptShard(context.Background(), "node-1", time.Minute)
+			assert.Equal(t, tc.wantErr, err)
+			// 开始执行的时间由数据库层生成
+			e.StartTime, e.Utime, e.Ctime = time.Time{}, time.Time{}, time.Time{}
+			assert.Equal(t, tc.wantExec, e)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"embed"
+	"github.com/ecodeclub/ecron/internal/storage/migrate"
+	"gorm.io/gorm"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// NewMigrator 使用内嵌的 PostgreSQL 迁移脚本，脚本在 migrations 目录下
+func NewMigrator(db *gorm.DB) (*migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	source, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(sqlDB, migrate.Postgres, source)
+}
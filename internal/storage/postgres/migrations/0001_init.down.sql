@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS workflow_run;
+DROP TABLE IF EXISTS workflow_node;
+DROP TABLE IF EXISTS workflow;
+DROP TABLE IF EXISTS execution;
+DROP TABLE IF EXISTS task_info;
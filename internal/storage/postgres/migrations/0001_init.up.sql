@@ -0,0 +1,108 @@
+CREATE TABLE IF NOT EXISTS task_info
+(
+    id                BIGSERIAL PRIMARY KEY,
+    name              VARCHAR(128) NOT NULL,
+    type              VARCHAR(32)  NOT NULL,
+    cron              VARCHAR(32)  NOT NULL,
+    timezone          VARCHAR(64)  NOT NULL DEFAULT '',
+    schedule_type     SMALLINT     NOT NULL DEFAULT 0,
+    exec_at           BIGINT       NOT NULL DEFAULT 0,
+    schedule_interval BIGINT       NOT NULL DEFAULT 0,
+    executor          VARCHAR(32)  NOT NULL,
+    owner             VARCHAR(64)  NOT NULL,
+    status            SMALLINT     NOT NULL DEFAULT 1,
+    cfg               TEXT         NOT NULL,
+    retry_policy      TEXT         NOT NULL,
+    misfire_policy    TEXT         NOT NULL,
+    attempt           INT          NOT NULL DEFAULT 0,
+    shard_count       INT          NOT NULL DEFAULT 0,
+    fencing_token     BIGINT       NOT NULL DEFAULT 0,
+    next_exec_time    BIGINT,
+    trigger_time      BIGINT       NOT NULL DEFAULT 0,
+    trigger_params    TEXT         NOT NULL,
+    ctime             BIGINT       NOT NULL,
+    utime             BIGINT       NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_status_next_exec_time ON task_info (status, next_exec_time);
+CREATE INDEX IF NOT EXISTS idx_status_utime ON task_info (status, utime);
+CREATE INDEX IF NOT EXISTS idx_status_trigger_time ON task_info (status, trigger_time);
+COMMENT ON TABLE task_info IS '任务信息';
+COMMENT ON COLUMN task_info.timezone IS 'cron表达式使用的时区，为空时使用调度节点的本地时区';
+COMMENT ON COLUMN task_info.schedule_type IS '调度方式，0-cron，1-执行一次，2-固定频率，3-固定延迟，4-依赖上游';
+COMMENT ON COLUMN task_info.schedule_interval IS '固定频率和固定延迟任务的调度间隔，单位毫秒';
+COMMENT ON COLUMN task_info.owner IS '用于实现乐观锁';
+COMMENT ON COLUMN task_info.status IS '任务状态，1-等待调度，2-正在执行，3-暂停，4-结束';
+COMMENT ON COLUMN task_info.retry_policy IS '重试策略，JSON格式';
+COMMENT ON COLUMN task_info.misfire_policy IS '错过执行时间后的处理策略，JSON格式';
+COMMENT ON COLUMN task_info.shard_count IS '分片数量，大于1时每次执行都会拆分成多个分片';
+COMMENT ON COLUMN task_info.fencing_token IS '每次抢占任务都会加一';
+COMMENT ON COLUMN task_info.trigger_time IS '手动触发的时间，0表示没有等待执行的手动触发';
+COMMENT ON COLUMN task_info.trigger_params IS '手动触发时传入的参数，JSON格式';
+
+CREATE TABLE IF NOT EXISTS execution
+(
+    id           BIGSERIAL PRIMARY KEY,
+    tid          BIGINT        NOT NULL,
+    attempt      INT           NOT NULL DEFAULT 0,
+    misfired     INT           NOT NULL DEFAULT 0,
+    trigger_type SMALLINT      NOT NULL DEFAULT 0,
+    status       SMALLINT,
+    progress     INT,
+    start_time   BIGINT        NOT NULL DEFAULT 0,
+    end_time     BIGINT        NOT NULL DEFAULT 0,
+    err_msg      VARCHAR(1024) NOT NULL DEFAULT '',
+    node         VARCHAR(128)  NOT NULL DEFAULT '',
+    parent_id    BIGINT        NOT NULL DEFAULT 0,
+    shard_index  INT           NOT NULL DEFAULT 0,
+    shard_total  INT           NOT NULL DEFAULT 0,
+    fencing_token BIGINT       NOT NULL DEFAULT 0,
+    ctime        BIGINT        NOT NULL,
+    utime        BIGINT        NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tid_start_time ON execution (tid, start_time);
+CREATE INDEX IF NOT EXISTS idx_parent_id ON execution (parent_id);
+CREATE INDEX IF NOT EXISTS idx_status ON execution (status);
+COMMENT ON TABLE execution IS '任务执行记录，每一次执行对应一条记录';
+COMMENT ON COLUMN execution.status IS '执行状态，0-未知，1-运行中，2-成功，3-失败，4-超时，5-主动取消，6-跳过，7-分片等待执行';
+COMMENT ON COLUMN execution.trigger_type IS '触发方式，0-按照调度计划执行，1-手动触发';
+COMMENT ON COLUMN execution.parent_id IS '分片所属的执行记录的id，不是分片时为0';
+COMMENT ON COLUMN execution.fencing_token IS '最后一次写入的租约的fencing token，更小的token写入时会被拒绝';
+
+CREATE TABLE IF NOT EXISTS workflow
+(
+    id    BIGSERIAL PRIMARY KEY,
+    name  VARCHAR(128) NOT NULL,
+    ctime BIGINT       NOT NULL,
+    utime BIGINT       NOT NULL
+);
+COMMENT ON TABLE workflow IS '工作流';
+
+CREATE TABLE IF NOT EXISTS workflow_node
+(
+    id             BIGSERIAL PRIMARY KEY,
+    wid            BIGINT   NOT NULL,
+    tid            BIGINT   NOT NULL,
+    upstreams      TEXT     NOT NULL,
+    failure_policy SMALLINT NOT NULL DEFAULT 0,
+    ctime          BIGINT   NOT NULL,
+    utime          BIGINT   NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_wid ON workflow_node (wid);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_tid ON workflow_node (tid);
+COMMENT ON TABLE workflow_node IS '工作流的节点';
+COMMENT ON COLUMN workflow_node.failure_policy IS '上游任务没有全部执行成功时的处理策略，0-跳过，1-停止工作流，2-依旧执行';
+
+CREATE TABLE IF NOT EXISTS workflow_run
+(
+    id         BIGSERIAL PRIMARY KEY,
+    wid        BIGINT   NOT NULL,
+    status     SMALLINT NOT NULL,
+    nodes      TEXT     NOT NULL,
+    start_time BIGINT   NOT NULL DEFAULT 0,
+    end_time   BIGINT   NOT NULL DEFAULT 0,
+    version    BIGINT   NOT NULL DEFAULT 0,
+    ctime      BIGINT   NOT NULL,
+    utime      BIGINT   NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_wid_status ON workflow_run (wid, status);
+COMMENT ON TABLE workflow_run IS '工作流的运行记录';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS uk_running_wid;
+ALTER TABLE workflow_run DROP COLUMN IF EXISTS running_wid;
@@ -0,0 +1,5 @@
+ALTER TABLE workflow_run ADD COLUMN running_wid BIGINT NULL;
+UPDATE workflow_run SET running_wid = wid
+WHERE id IN (SELECT MAX(id) FROM workflow_run WHERE status = 1 GROUP BY wid);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_running_wid ON workflow_run (running_wid);
+COMMENT ON COLUMN workflow_run.running_wid IS '运行中时等于wid，结束后为NULL';
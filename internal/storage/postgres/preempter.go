@@ -0,0 +1,122 @@
+// Package postgres 基于 PostgreSQL 的存储实现，表结构见 migrations 目录下的迁移脚本。
+// 除了抢占任务和分片，其他 SQL 由 gorm 按照 PostgreSQL 的方言生成，直接复用 mysql 包的实现
+package postgres
+
+import (
+	"context"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"github.com/ecodeclub/ecron/internal/task"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// skipLocked 查询时锁住结果，并且跳过其他调度节点已经锁住的记录
+var skipLocked = clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}
+
+func NewPreempter(db *gorm.DB, batchSize int, leaseTTL time.Duration, opts ...mysql.PreempterOption) *mysql.Preempter {
+	return mysql.NewPreempterWithRepository(NewGormTaskRepository(db, batchSize, leaseTTL), opts...)
+}
+
+// txKey 抢占过程中的事务保存在 context 中，PreemptTask 需要在同一个事务中执行
+type txKey struct{}
+
+// gormTaskRepository 释放、重试和续约和 MySQL 一样，只有抢占使用 FOR UPDATE SKIP LOCKED
+type gormTaskRepository struct {
+	mysql.TaskRepository
+	db        *gorm.DB
+	batchSize int
+	leaseTTL  time.Duration
+}
+
+func NewGormTaskRepository(db *gorm.DB, batchSize int, leaseTTL time.Duration) mysql.TaskRepository {
+	return &gormTaskRepository{
+		TaskRepository: mysql.NewGormTaskRepository(db, batchSize, leaseTTL),
+		db:             db,
+		batchSize:      batchSize,
+		leaseTTL:       leaseTTL,
+	}
+}
+
+// TryPreempt 在事务中锁住一批可以执行的任务，再交给 f 抢占其中的一个。
+// 其他调度节点查询时会跳过这些任务，不会因为抢占同一个任务而失败
+func (g *gormTaskRepository) TryPreempt(ctx context.Context, f func(ctx context.Context, ts []task.Task) (task.Task, error)) (task.Task, error) {
+	var res task.Task
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var tasks []mysql.TaskInfo
+		err := tx.Model(&mysql.TaskInfo{}).
+			Where(mysql.Preemptable(g.db, time.Now(), g.leaseTTL)).
+			Limit(g.batchSize).Clauses(skipLocked).
+			Find(&tasks).Error
+		if err != nil {
+			return err
+		}
+		if len(tasks) < 1 {
+			return errs.ErrNoExecutableTask
+		}
+		ts := make([]task.Task, len(tasks))
+		for i := 0; i < len(tasks); i++ {
+			ts[i] = mysql.ToTask(tasks[i])
+		}
+		res, err = f(context.WithValue(ctx, txKey{}, tx), ts)
+		return err
+	})
+	return res, err
+}
+
+// PreemptTask 在 TryPreempt 中调用时使用 TryPreempt 的事务，否则会等待 TryPreempt 释放锁
+func (g *gormTaskRepository) PreemptTask(ctx context.Context, tid int64, oldOwner string, newOwner string, token int64) error {
+	db, ok := ctx.Value(txKey{}).(*gorm.DB)
+	if !ok {
+		db = g.db
+	}
+	res := db.WithContext(ctx).Model(&mysql.TaskInfo{}).
+		Where("id = ? AND owner = ? AND fencing_token = ?", tid, oldOwner, token).
+		Updates(map[string]interface{}{
+			"status":        task.TaskStatusRunning,
+			"utime":         time.Now().UnixMilli(),
+			"owner":         newOwner,
+			"fencing_token": token + 1,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	return mysql.ErrFailedToPreempt
+}
+
+// preemptedTask 抢占到的任务和抢占前的状态
+type preemptedTask struct {
+	mysql.TaskInfo
+	LastStatus int8
+}
+
+// PreemptBatch 一条语句完成查询和抢占，其他调度节点锁住的任务直接跳过。
+// RETURNING 返回的是更新后的任务，抢占前的状态通过 CTE 带出来，调度器据此区分正常调度和接手其他节点没有执行完的任务
+func (g *gormTaskRepository) PreemptBatch(ctx context.Context, owner string, n int) ([]task.Task, error) {
+	now := time.Now()
+	candidates := g.db.Model(&mysql.TaskInfo{}).Select("id", "status").
+		Where(mysql.Preemptable(g.db, now, g.leaseTTL)).
+		Limit(n).Clauses(skipLocked)
+	var tasks []preemptedTask
+	err := g.db.WithContext(ctx).Raw(`WITH candidates AS (?) `+
+		`UPDATE task_info AS t SET status = ?, utime = ?, owner = ?, fencing_token = t.fencing_token + 1 `+
+		`FROM candidates AS c WHERE t.id = c.id RETURNING t.*, c.status AS last_status`,
+		candidates, task.TaskStatusRunning, now.UnixMilli(), owner).Scan(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, errs.ErrNoExecutableTask
+	}
+	ts := make([]task.Task, 0, len(tasks))
+	for _, te := range tasks {
+		t := mysql.ToTask(te.TaskInfo)
+		t.LastStatus = te.LastStatus
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestGormTaskRepository_TryPreempt(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sqlMock  func(t *testing.T) *sql.DB
+		wantErr  error
+		wantTask task.Task
+	}{
+		{
+			name: "在同一个事务中抢占",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "task_info" WHERE .* LIMIT \$6 FOR UPDATE SKIP LOCKED`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "owner", "status"}).
+						AddRow(1, "test", "", task.TaskStatusWaiting))
+				mock.ExpectExec(`UPDATE "task_info" SET "fencing_token"=\$1,"owner"=\$2,"status"=\$3,"utime"=\$4 WHERE id = \$5 AND owner = \$6 AND fencing_token = \$7`).
+					WithArgs(int64(1), "new", task.TaskStatusRunning, sqlmock.AnyArg(), int64(1), "", int64(0)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				return mockDB
+			},
+			wantTask: task.Task{ID: 1, Owner: "new"},
+		},
+		{
+			name: "没有可以执行的任务",
+			sqlMock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "task_info"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+				return mockDB
+			},
+			wantErr: errs.ErrNoExecutableTask,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := NewGormTaskRepository(newMockGormDB(t, tc.sqlMock(t)), 10, time.Minute)
+			res, err := repo.TryPreempt(context.Background(), func(ctx context.Context, ts []task.Task) (task.Task, error) {
+				err := repo.PreemptTask(ctx, ts[0].ID, ts[0].Owner, "new", ts[0].FencingToken)
+				return task.Task{ID: ts[0].ID, Owner: "new"}, err
+			})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantTask, res)
+		})
+	}
+}
+
+func TestGormTaskRepository_PreemptTask(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectExec(`UPDATE "task_info" SET`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewGormTaskRepository(newMockGormDB(t, sqlDB), 10, time.Minute)
+	err = repo.PreemptTask(context.Background(), 1, "old", "new", 0)
+	assert.Equal(t, mysql.ErrFailedToPreempt, err)
+}
+
+func TestGormTaskRepository_PreemptBatch(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectQuery(`WITH candidates AS \(SELECT "id","status" FROM "task_info" WHERE .* LIMIT \$\d+ FOR UPDATE SKIP LOCKED\) ` +
+		`UPDATE task_info AS t SET status = \$\d+, utime = \$\d+, owner = \$\d+, fencing_token = t.fencing_token \+ 1 ` +
+		`FROM candidates AS c WHERE t.id = c.id RETURNING t.\*, c.status AS last_status`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner", "status", "fencing_token", "last_status"}).
+			AddRow(1, "new", task.TaskStatusRunning, 1, task.TaskStatusWaiting).
+			AddRow(2, "new", task.TaskStatusRunning, 3, task.TaskStatusRunning))
+
+	repo := NewGormTaskRepository(newMockGormDB(t, sqlDB), 10, time.Minute)
+	ts, err := repo.PreemptBatch(context.Background(), "new", 2)
+	require.NoError(t, err)
+	require.Len(t, ts, 2)
+	assert.Equal(t, int64(2), ts[1].ID)
+	assert.Equal(t, int64(3), ts[1].FencingToken)
+	// 返回抢占前的状态
+	assert.Equal(t, task.TaskStatusWaiting, ts[0].LastStatus)
+	assert.Equal(t, task.TaskStatusRunning, ts[1].LastStatus)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func newMockGormDB(t *testing.T, sqlDB *sql.DB) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: sqlDB,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	return db
+}
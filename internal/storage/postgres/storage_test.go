@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"github.com/ecodeclub/ecron/internal/storage/storagetest"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"time"
+)
+
+// dsnEnv CI 中通过这个环境变量指定真实的 PostgreSQL，这时连接失败会让测试失败而不是跳过
+const dsnEnv = "ECRON_POSTGRES_DSN"
+
+// TestStorage 使用 PostgreSQL 运行所有存储实现都需要通过的测试。
+// 设置了 ECRON_POSTGRES_DSN 时使用指定的数据库，否则使用嵌入式的 PostgreSQL，
+// 第一次运行时需要下载 PostgreSQL，下载失败时跳过
+func TestStorage(t *testing.T) {
+	dsn, ok := os.LookupEnv(dsnEnv)
+	if !ok {
+		pg := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+			Port(15432).Database("ecron").RuntimePath(t.TempDir()))
+		if err := pg.Start(); err != nil {
+			t.Skipf("启动 PostgreSQL 失败: %v", err)
+		}
+		defer func() {
+			_ = pg.Stop()
+		}()
+		dsn = "host=localhost port=15432 user=postgres password=postgres dbname=ecron sslmode=disable"
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn))
+	require.NoError(t, err)
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+	require.NoError(t, m.Up(context.Background()))
+	suite.Run(t, storagetest.NewStorageSuite(db, NewGormTaskCfgRepository(db), NewGormExecutionDAO(db),
+		NewGormWorkflowDAO(db), NewPreempter(db, 10, time.Minute)))
+}
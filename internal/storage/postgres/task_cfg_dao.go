@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"gorm.io/gorm"
+)
+
+// NewGormTaskCfgRepository 任务配置的读写没有方言相关的 SQL，和 MySQL 使用同一个实现
+func NewGormTaskCfgRepository(db *gorm.DB) *mysql.GormTaskCfgRepository {
+	return mysql.NewGormTaskCfgRepository(db)
+}
+
+// NewGormWorkflowDAO 工作流的读写没有方言相关的 SQL，和 MySQL 使用同一个实现
+func NewGormWorkflowDAO(db *gorm.DB) *mysql.GormWorkflowDAO {
+	return mysql.NewGormWorkflowDAO(db)
+}
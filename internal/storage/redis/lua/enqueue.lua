@@ -0,0 +1,8 @@
+-- KEYS: ready, lease
+-- ARGV: tid, at(ms)
+-- 被持有的任务由持有者在释放时决定下一次执行的时间
+if redis.call('EXISTS', KEYS[2]) == 1 then
+    return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
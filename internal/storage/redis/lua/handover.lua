@@ -0,0 +1,8 @@
+-- KEYS: ready, lease
+-- ARGV: tid, owner, now(ms)
+if redis.call('GET', KEYS[2]) ~= ARGV[2] then
+    return 0
+end
+redis.call('DEL', KEYS[2])
+redis.call('ZADD', KEYS[1], 'XX', ARGV[3], ARGV[1])
+return 1
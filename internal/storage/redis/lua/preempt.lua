@@ -0,0 +1,25 @@
+-- KEYS: ready, running, attempt, fencing_token, lease_1 ... lease_m
+-- ARGV: owner, ttl(ms), now(ms), n, tid_1 ... tid_m
+-- 按照顺序抢占最多 n 个任务，返回 { tid, 上一个持有者是否没有释放, attempt, fencing token, ... }
+local owner, ttl, now, n = ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local res = {}
+for i = 5, #ARGV do
+    if #res >= n * 4 then
+        break
+    end
+    local tid = ARGV[i]
+    local score = redis.call('ZSCORE', KEYS[1], tid)
+    if score and tonumber(score) <= now and redis.call('SET', KEYS[i], owner, 'NX', 'PX', ttl) then
+        -- 租约过期之前其他调度节点不会再查询到这个任务
+        redis.call('ZADD', KEYS[1], now + ttl, tid)
+        local prev = redis.call('HGET', KEYS[2], tid)
+        redis.call('HSET', KEYS[2], tid, owner)
+        local attempt = redis.call('HGET', KEYS[3], tid)
+        local token = redis.call('HINCRBY', KEYS[4], tid, 1)
+        table.insert(res, tonumber(tid))
+        table.insert(res, prev and 1 or 0)
+        table.insert(res, tonumber(attempt or 0))
+        table.insert(res, token)
+    end
+end
+return res
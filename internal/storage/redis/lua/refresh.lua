@@ -0,0 +1,9 @@
+-- KEYS: ready, lease
+-- ARGV: tid, owner, ttl(ms), now(ms)
+if redis.call('GET', KEYS[2]) ~= ARGV[2] then
+    return 0
+end
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+-- 执行过程中被移出调度的任务不再加入
+redis.call('ZADD', KEYS[1], 'XX', tonumber(ARGV[4]) + tonumber(ARGV[3]), ARGV[1])
+return 1
@@ -0,0 +1,19 @@
+-- KEYS: ready, lease, running, attempt
+-- ARGV: tid, owner, next(ms), attempt
+if redis.call('GET', KEYS[2]) ~= ARGV[2] then
+    return 0
+end
+redis.call('DEL', KEYS[2])
+redis.call('HDEL', KEYS[3], ARGV[1])
+if tonumber(ARGV[4]) > 0 then
+    redis.call('HSET', KEYS[4], ARGV[1], ARGV[4])
+else
+    redis.call('HDEL', KEYS[4], ARGV[1])
+end
+if tonumber(ARGV[3]) > 0 then
+    -- 执行过程中被移出调度的任务不再加入
+    redis.call('ZADD', KEYS[1], 'XX', ARGV[3], ARGV[1])
+else
+    redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 1
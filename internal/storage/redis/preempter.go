@@ -0,0 +1,416 @@
+// Package redis 基于 Redis 的 preempt.Preempter，抢占和续约都不需要查询和修改任务表。
+// 任务的配置依旧保存在 storage.TaskCfgRepository 中，修改任务时需要通过 TaskCfgRepository 同步修改 Redis，
+// 第一次使用或者 Redis 的数据丢失后调用 TaskCfgRepository.Load。Redis 只保存调度状态：
+//   - ready：等待调度的任务，有序集合，score 是任务的执行时间。任务被抢占后 score 会推迟到租约过期的时间
+//   - lease:{tid}：任务的租约，值是持有者，过期时间是租约的有效期
+//   - running：已经开始执行但是还没有释放的任务，持有者没有释放就崩溃的话，下一个持有者需要探查上一次执行
+//   - attempt：等待重试的任务本次调度已经执行的次数
+//   - fencing_token：任务最近一次抢占的 fencing token，释放租约时不会删除
+package redis
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/preempt"
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	//go:embed lua/preempt.lua
+	luaPreempt string
+	//go:embed lua/refresh.lua
+	luaRefresh string
+	//go:embed lua/release.lua
+	luaRelease string
+	//go:embed lua/handover.lua
+	luaHandover string
+	//go:embed lua/enqueue.lua
+	luaEnqueue string
+
+	ErrTaskNotHold = errors.New("未持有任务")
+)
+
+// DefaultPrefix 使用 hash tag 保证所有的 key 在 Redis Cluster 的同一个 slot 中，lua 脚本才能同时操作
+const DefaultPrefix = "{ecron}"
+
+// Preempter repo 需要是没有经过 TaskCfgRepository 包装的任务表，释放任务时 Preempter 自己修改 Redis
+type Preempter struct {
+	client    redis.Cmdable
+	repo      storage.TaskCfgRepository
+	prefix    string
+	batchSize int
+	// 租约的有效期
+	leaseTTL  time.Duration
+	randIndex func(num int) int
+	// with options
+	// 自动续约的间隔，默认是租约有效期的三分之一
+	refreshInterval time.Duration
+	// 自动续约时状态 channel 的缓冲大小
+	buffSize int
+	// 续约超时后的最大重试次数
+	maxRetryTimes int
+}
+
+type Option func(p *Preempter)
+
+// WithPrefix 多个集群共用一个 Redis 时使用不同的前缀，前缀需要包含 hash tag
+func WithPrefix(prefix string) Option {
+	return func(p *Preempter) {
+		p.prefix = prefix
+	}
+}
+
+// WithRefreshInterval 自动续约的间隔，需要小于租约的有效期
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(p *Preempter) {
+		p.refreshInterval = interval
+	}
+}
+
+func WithBuffSize(size int) Option {
+	return func(p *Preempter) {
+		p.buffSize = size
+	}
+}
+
+func WithMaxRetryTimes(times int) Option {
+	return func(p *Preempter) {
+		p.maxRetryTimes = times
+	}
+}
+
+func NewPreempter(client redis.Cmdable, repo storage.TaskCfgRepository, batchSize int, leaseTTL time.Duration, opts ...Option) *Preempter {
+	p := &Preempter{
+		client:    client,
+		repo:      repo,
+		prefix:    DefaultPrefix,
+		batchSize: batchSize,
+		leaseTTL:  leaseTTL,
+		randIndex: func(num int) int {
+			return rand.Intn(num)
+		},
+		refreshInterval: leaseTTL / 3,
+		buffSize:        10,
+		maxRetryTimes:   3,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Enqueue 任务会在 at 之后被调度，任务已经在等待调度时会修改执行时间。
+// 任务被持有时不做修改，由持有者释放时决定下一次执行的时间
+func (p *Preempter) Enqueue(ctx context.Context, tid int64, at time.Time) error {
+	return enqueue(ctx, p.client, p.prefix, tid, at)
+}
+
+// Remove 任务不会再被调度，正在执行的任务不受影响，但是释放后也不会再被调度
+func (p *Preempter) Remove(ctx context.Context, tid int64) error {
+	return p.client.ZRem(ctx, p.readyKey(), tid).Err()
+}
+
+func (p *Preempter) Preempt(ctx context.Context) (preempt.TaskLeaser, error) {
+	ls, err := p.preempt(ctx, p.batchSize, 1)
+	if err != nil {
+		return nil, err
+	}
+	return ls[0], nil
+}
+
+func (p *Preempter) PreemptBatch(ctx context.Context, n int) ([]preempt.TaskLeaser, error) {
+	return p.preempt(ctx, max(p.batchSize, n), n)
+}
+
+// preempt 查询 size 个到了执行时间的任务，从随机的位置开始抢占最多 n 个
+func (p *Preempter) preempt(ctx context.Context, size int, n int) ([]preempt.TaskLeaser, error) {
+	now := time.Now().UnixMilli()
+	tids, err := p.client.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     p.readyKey(),
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(now, 10),
+		ByScore: true,
+		Count:   int64(size),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(tids) == 0 {
+		return nil, errs.ErrNoExecutableTask
+	}
+	owner := uuid.New().String()
+	index := p.randIndex(len(tids))
+	keys := []string{p.readyKey(), p.prefix + ":running", p.prefix + ":attempt", p.prefix + ":fencing_token"}
+	args := []any{owner, p.leaseTTL.Milliseconds(), now, n}
+	for i := range tids {
+		tid := tids[(index+i)%len(tids)]
+		keys = append(keys, leaseKey(p.prefix, tid))
+		args = append(args, tid)
+	}
+	res, err := p.client.Eval(ctx, luaPreempt, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	ls := make([]preempt.TaskLeaser, 0, len(res)/4)
+	for i := 0; i+3 < len(res); i += 4 {
+		var t task.Task
+		// 上一个持有者没有释放任务
+		running := res[i+1] == 1
+		t, err = p.load(ctx, res[i], owner, int(res[i+2]), running)
+		if err != nil {
+			continue
+		}
+		t.Attempt = int(res[i+2])
+		t.FencingToken = res[i+3]
+		if running {
+			t.LastStatus = task.TaskStatusRunning
+		}
+		ls = append(ls, &taskLeaser{
+			t:    t,
+			p:    p,
+			done: make(chan struct{}),
+		})
+	}
+	if len(ls) > 0 {
+		return ls, nil
+	}
+	if err != nil && !errors.Is(err, preempt.ErrNoTaskToPreempt) {
+		return nil, err
+	}
+	return nil, preempt.ErrNoTaskToPreempt
+}
+
+// load 查询抢占到的任务，任务已经被暂停、结束、删除或者还没有到执行时间时返回 preempt.ErrNoTaskToPreempt，
+// 出错时会归还租约
+func (p *Preempter) load(ctx context.Context, tid int64, owner string, attempt int, running bool) (task.Task, error) {
+	t, err := p.repo.Get(ctx, tid)
+	now := time.Now()
+	switch {
+	case errors.Is(err, errs.ErrTaskNotFound) || (err == nil && t.LastStatus == task.TaskStatusFinished):
+		_ = p.release(ctx, tid, owner, 0, 0)
+		return task.Task{}, preempt.ErrNoTaskToPreempt
+	case err == nil && t.LastStatus == task.TaskStatusPaused:
+		// 暂停的任务恢复后还需要调度，不能移出等待调度的集合。
+		// 推迟到下一次执行时间，最少推迟一个租约的有效期，避免一直抢占暂停的任务
+		next := max(t.NextExecTime.UnixMilli(), now.Add(p.leaseTTL).UnixMilli())
+		_ = p.release(ctx, tid, owner, attempt, next)
+		return task.Task{}, preempt.ErrNoTaskToPreempt
+	case err != nil:
+		// 任务可以马上再次被抢占
+		_ = p.release(ctx, tid, owner, attempt, now.UnixMilli())
+		return task.Task{}, err
+	case attempt == 0 && !running && !t.Triggered() && t.NextExecTime.After(now):
+		// 同步 Redis 失败时 Redis 中的执行时间可能早于任务表，以任务表为准
+		_ = p.release(ctx, tid, owner, 0, t.NextExecTime.UnixMilli())
+		return task.Task{}, preempt.ErrNoTaskToPreempt
+	}
+	t.Owner = owner
+	t.LastStatus = task.TaskStatusWaiting
+	return t, nil
+}
+
+// release 释放租约。next 为 0 时任务不再调度，attempt 大于 0 时任务会在 next 重试
+func (p *Preempter) release(ctx context.Context, tid int64, owner string, attempt int, next int64) error {
+	res, err := p.client.Eval(ctx, luaRelease, p.keys(tid), tid, owner, next, attempt).Int()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrTaskNotHold
+	}
+	return nil
+}
+
+func (p *Preempter) keys(tid int64) []string {
+	return []string{
+		p.readyKey(),
+		leaseKey(p.prefix, tid),
+		p.prefix + ":running",
+		p.prefix + ":attempt",
+	}
+}
+
+func (p *Preempter) readyKey() string {
+	return readyKey(p.prefix)
+}
+
+// requeueTriggered 任务在执行过程中被手动触发的话，释放后马上再次调度。
+// 触发时任务被持有，没有修改 Redis，任务表中记录了触发
+func (p *Preempter) requeueTriggered(ctx context.Context, tid int64) error {
+	t, err := p.repo.Get(ctx, tid)
+	if err != nil {
+		return err
+	}
+	if t.LastStatus != task.TaskStatusWaiting || !t.Triggered() {
+		return nil
+	}
+	return p.Enqueue(ctx, tid, time.Now())
+}
+
+// enqueue 任务被持有时不做修改
+func enqueue(ctx context.Context, client redis.Cmdable, prefix string, tid int64, at time.Time) error {
+	return client.Eval(ctx, luaEnqueue, []string{readyKey(prefix), leaseKey(prefix, tid)}, tid, at.UnixMilli()).Err()
+}
+
+func readyKey(prefix string) string {
+	return prefix + ":ready"
+}
+
+func leaseKey(prefix string, tid any) string {
+	return fmt.Sprintf("%s:lease:%v", prefix, tid)
+}
+
+type taskLeaser struct {
+	t       task.Task
+	p       *Preempter
+	done    chan struct{}
+	hasDone atomic.Bool
+}
+
+func (l *taskLeaser) GetTask() task.Task {
+	return l.t
+}
+
+func (l *taskLeaser) FencingToken() int64 {
+	return l.t.FencingToken
+}
+
+func (l *taskLeaser) Refresh(ctx context.Context) error {
+	if l.hasDone.Load() {
+		return preempt.ErrLeaserHasRelease
+	}
+	keys := l.p.keys(l.t.ID)[:2]
+	res, err := l.p.client.Eval(ctx, luaRefresh, keys,
+		l.t.ID, l.t.Owner, l.p.leaseTTL.Milliseconds(), time.Now().UnixMilli()).Int()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrTaskNotHold
+	}
+	return nil
+}
+
+// Release 任务表中只需要更新下一次执行时间，不再调度的任务标记为结束。
+// 手动触发的执行不影响原本的调度计划，任务回到原本的执行时间，只清除本次触发。
+// 执行过程中任务又被手动触发的话，释放后马上再次调度
+func (l *taskLeaser) Release(ctx context.Context) error {
+	if !l.finish() {
+		return preempt.ErrLeaserHasRelease
+	}
+	if err := l.release(ctx); err != nil {
+		return err
+	}
+	return l.p.requeueTriggered(ctx, l.t.ID)
+}
+
+func (l *taskLeaser) release(ctx context.Context) error {
+	if l.t.Triggered() {
+		if err := l.p.release(ctx, l.t.ID, l.t.Owner, 0, l.t.NextExecTime.UnixMilli()); err != nil {
+			return err
+		}
+		return l.p.repo.ClearTrigger(ctx, l.t.ID, l.t.TriggerTime)
+	}
+	next, _ := l.t.NextTimeAfterRun(time.Now())
+	if next.IsZero() {
+		if err := l.p.release(ctx, l.t.ID, l.t.Owner, 0, 0); err != nil {
+			return err
+		}
+		return l.p.repo.Stop(ctx, l.t.ID)
+	}
+	if err := l.p.release(ctx, l.t.ID, l.t.Owner, 0, next.UnixMilli()); err != nil {
+		return err
+	}
+	return l.p.repo.UpdateNextTime(ctx, l.t.ID, next)
+}
+
+func (l *taskLeaser) Retry(ctx context.Context, attempt int, next time.Time) error {
+	if !l.finish() {
+		return preempt.ErrLeaserHasRelease
+	}
+	return l.p.release(ctx, l.t.ID, l.t.Owner, attempt, next.UnixMilli())
+}
+
+// Handover 删除租约，保留 running 中的记录，下一个持有者会探查本次执行
+func (l *taskLeaser) Handover(ctx context.Context) error {
+	if !l.finish() {
+		return preempt.ErrLeaserHasRelease
+	}
+	keys := l.p.keys(l.t.ID)[:2]
+	res, err := l.p.client.Eval(ctx, luaHandover, keys, l.t.ID, l.t.Owner, time.Now().UnixMilli()).Int()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrTaskNotHold
+	}
+	return nil
+}
+
+// finish 第一次调用时返回 true
+func (l *taskLeaser) finish() bool {
+	if !l.hasDone.CompareAndSwap(false, true) {
+		return false
+	}
+	close(l.done)
+	return true
+}
+
+func (l *taskLeaser) AutoRefresh(ctx context.Context) (<-chan preempt.Status, error) {
+	if l.hasDone.Load() {
+		return nil, preempt.ErrLeaserHasRelease
+	}
+	sch := make(chan preempt.Status, l.p.buffSize)
+	go func() {
+		defer close(sch)
+		ticker := time.NewTicker(l.p.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				send2Ch(sch, preempt.NewDefaultStatus(l.refresh(ctx)))
+			case <-l.done:
+				send2Ch(sch, preempt.NewDefaultStatus(preempt.ErrLeaserHasRelease))
+				return
+			case <-ctx.Done():
+				send2Ch(sch, preempt.NewDefaultStatus(ctx.Err()))
+				return
+			}
+		}
+	}()
+	return sch, nil
+}
+
+// refresh 超时的时候重试，所有重试的时间不能超过续约间隔
+func (l *taskLeaser) refresh(ctx context.Context) error {
+	var err error
+	for i := 0; i < l.p.maxRetryTimes; i++ {
+		if ctx.Err() != nil {
+			return err
+		}
+		ctx1, cancel := context.WithTimeout(ctx, l.p.leaseTTL/10)
+		err = l.Refresh(ctx1)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+	}
+	return err
+}
+
+func send2Ch(ch chan<- preempt.Status, st preempt.Status) {
+	select {
+	case ch <- st:
+	default:
+	}
+}
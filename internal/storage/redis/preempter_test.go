@@ -0,0 +1,485 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/preempt"
+	"github.com/ecodeclub/ecron/internal/storage"
+	daomocks "github.com/ecodeclub/ecron/internal/storage/mocks"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPreempter(t *testing.T, repo storage.TaskCfgRepository, leaseTTL time.Duration) (*Preempter, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return NewPreempter(client, repo, 10, leaseTTL), m
+}
+
+func newTask(id int64, next time.Time) task.Task {
+	return task.Task{
+		ID:           id,
+		Name:         "test",
+		CronExp:      "0 0 * * * *",
+		NextExecTime: next,
+		LastStatus:   task.TaskStatusWaiting,
+	}
+}
+
+func TestPreempter_Preempt(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name     string
+		mock     func(ctrl *gomock.Controller) storage.TaskCfgRepository
+		before   func(t *testing.T, p *Preempter)
+		wantErr  error
+		wantTask task.Task
+	}{
+		{
+			name: "没有任务",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				return daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			before:  func(t *testing.T, p *Preempter) {},
+			wantErr: errs.ErrNoExecutableTask,
+		},
+		{
+			name: "还没有到执行时间",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				return daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			before: func(t *testing.T, p *Preempter) {
+				require.NoError(t, p.Enqueue(context.Background(), 1, now.Add(time.Minute)))
+			},
+			wantErr: errs.ErrNoExecutableTask,
+		},
+		{
+			name: "抢占成功",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil)
+				return repo
+			},
+			before: func(t *testing.T, p *Preempter) {
+				require.NoError(t, p.Enqueue(context.Background(), 1, now))
+			},
+			wantTask: newTask(1, now),
+		},
+		{
+			name: "抢占等待重试的任务",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil)
+				return repo
+			},
+			before: func(t *testing.T, p *Preempter) {
+				require.NoError(t, p.Enqueue(context.Background(), 1, now))
+				require.NoError(t, p.client.HSet(context.Background(), p.prefix+":attempt", 1, 2).Err())
+			},
+			wantTask: func() task.Task {
+				t := newTask(1, now)
+				t.Attempt = 2
+				return t
+			}(),
+		},
+		{
+			name: "上一个持有者没有释放",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil)
+				return repo
+			},
+			before: func(t *testing.T, p *Preempter) {
+				require.NoError(t, p.Enqueue(context.Background(), 1, now))
+				require.NoError(t, p.client.HSet(context.Background(), p.prefix+":running", 1, "old").Err())
+			},
+			wantTask: func() task.Task {
+				t := newTask(1, now)
+				t.LastStatus = task.TaskStatusRunning
+				return t
+			}(),
+		},
+		{
+			name: "任务已经暂停",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				t := newTask(1, now)
+				t.LastStatus = task.TaskStatusPaused
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(t, nil)
+				return repo
+			},
+			before: func(t *testing.T, p *Preempter) {
+				require.NoError(t, p.Enqueue(context.Background(), 1, now))
+			},
+			wantErr: preempt.ErrNoTaskToPreempt,
+		},
+		{
+			name: "任务表中的执行时间更晚",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now.Add(time.Hour)), nil)
+				return repo
+			},
+			before: func(t *testing.T, p *Preempter) {
+				// 修改任务后同步 Redis 失败
+				require.NoError(t, p.Enqueue(context.Background(), 1, now))
+			},
+			wantErr: preempt.ErrNoTaskToPreempt,
+		},
+		{
+			name: "手动触发的任务",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				t := newTask(1, now.Add(time.Hour))
+				t.TriggerTime, t.TriggerParams = now, `{"body":"{}"}`
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(t, nil)
+				return repo
+			},
+			before: func(t *testing.T, p *Preempter) {
+				require.NoError(t, p.Enqueue(context.Background(), 1, now))
+			},
+			// 保留触发的时间和参数
+			wantTask: func() task.Task {
+				t := newTask(1, now.Add(time.Hour))
+				t.TriggerTime, t.TriggerParams = now, `{"body":"{}"}`
+				return t
+			}(),
+		},
+		{
+			name: "查询任务失败",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{}, errors.New("db error"))
+				return repo
+			},
+			before: func(t *testing.T, p *Preempter) {
+				require.NoError(t, p.Enqueue(context.Background(), 1, now))
+			},
+			wantErr: errors.New("db error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			p, _ := newTestPreempter(t, tc.mock(ctrl), time.Minute)
+			tc.before(t, p)
+			l, err := p.Preempt(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				if errors.Is(err, preempt.ErrNoTaskToPreempt) {
+					// 暂停的任务保留在等待调度的集合中，推迟一个租约的有效期
+					score, err := p.client.ZScore(context.Background(), p.readyKey(), "1").Result()
+					require.NoError(t, err)
+					assert.GreaterOrEqual(t, score, float64(now.Add(time.Minute).UnixMilli()))
+				}
+				return
+			}
+			got := l.GetTask()
+			assert.NotEmpty(t, got.Owner)
+			tc.wantTask.Owner = got.Owner
+			tc.wantTask.FencingToken = 1
+			assert.Equal(t, tc.wantTask, got)
+			// 租约过期之前不会被再次抢占
+			_, err = p.Preempt(context.Background())
+			assert.Equal(t, errs.ErrNoExecutableTask, err)
+		})
+	}
+}
+
+func TestPreempter_Release(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.Now()
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil).Times(3)
+	var next time.Time
+	repo.EXPECT().UpdateNextTime(gomock.Any(), int64(1), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id int64, t time.Time) error {
+			next = t
+			return nil
+		})
+	p, _ := newTestPreempter(t, repo, time.Minute)
+	ctx := context.Background()
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+
+	l, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	require.NoError(t, l.Refresh(ctx))
+	require.NoError(t, l.Retry(ctx, 1, now))
+	assert.Equal(t, preempt.ErrLeaserHasRelease, l.Release(ctx))
+	assert.Equal(t, preempt.ErrLeaserHasRelease, l.Refresh(ctx))
+
+	l, err = p.Preempt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, l.GetTask().Attempt)
+	require.NoError(t, l.Release(ctx))
+	assert.True(t, next.After(now))
+	score, err := p.client.ZScore(ctx, p.readyKey(), "1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, float64(next.UnixMilli()), score)
+	exists, err := p.client.Exists(ctx, p.keys(1)[1], p.keys(1)[2], p.keys(1)[3]).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+	_, err = p.Preempt(ctx)
+	assert.Equal(t, errs.ErrNoExecutableTask, err)
+}
+
+func TestPreempter_ReleaseFinished(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.Now()
+	once := newTask(1, now)
+	once.ScheduleType = task.ScheduleTypeOnce
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(once, nil).Times(2)
+	repo.EXPECT().Stop(gomock.Any(), int64(1)).Return(nil)
+	p, _ := newTestPreempter(t, repo, time.Minute)
+	ctx := context.Background()
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+
+	l, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	require.NoError(t, l.Release(ctx))
+	_, err = p.client.ZScore(ctx, p.readyKey(), "1").Result()
+	assert.Equal(t, redis.Nil, err)
+}
+
+// TestPreempter_ReleaseTriggered 手动触发的执行结束后回到原本的调度计划，只清除本次触发
+func TestPreempter_ReleaseTriggered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.UnixMilli(time.Now().UnixMilli())
+	triggered := newTask(1, now.Add(time.Hour))
+	triggered.TriggerTime = now
+	gomock.InOrder(
+		repo.EXPECT().Get(gomock.Any(), int64(1)).Return(triggered, nil),
+		repo.EXPECT().ClearTrigger(gomock.Any(), int64(1), now).Return(nil),
+		repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, triggered.NextExecTime), nil),
+	)
+	p, _ := newTestPreempter(t, repo, time.Minute)
+	ctx := context.Background()
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+
+	l, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	assert.True(t, l.GetTask().Triggered())
+	require.NoError(t, l.Release(ctx))
+	score, err := p.client.ZScore(ctx, p.readyKey(), "1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, float64(triggered.NextExecTime.UnixMilli()), score)
+}
+
+// TestPreempter_TriggeredWhileRunning 执行过程中被手动触发的任务，释放后马上再次调度
+func TestPreempter_TriggeredWhileRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.UnixMilli(time.Now().UnixMilli())
+	triggered := newTask(1, now.Add(time.Hour))
+	triggered.TriggerTime = now
+	gomock.InOrder(
+		repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil),
+		repo.EXPECT().UpdateNextTime(gomock.Any(), int64(1), gomock.Any()).Return(nil),
+		repo.EXPECT().Get(gomock.Any(), int64(1)).Return(triggered, nil),
+	)
+	p, _ := newTestPreempter(t, repo, time.Minute)
+	ctx := context.Background()
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+
+	l, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	// 被持有的任务不受影响
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+	score, err := p.client.ZScore(ctx, p.readyKey(), "1").Result()
+	require.NoError(t, err)
+	assert.Greater(t, score, float64(time.Now().UnixMilli()))
+
+	require.NoError(t, l.Release(ctx))
+	score, err = p.client.ZScore(ctx, p.readyKey(), "1").Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, score, float64(time.Now().UnixMilli()))
+}
+
+// TestPreempter_LeaseExpired 持有者没有续约，租约过期后任务会被其他调度节点抢占
+func TestPreempter_LeaseExpired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.Now()
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil).Times(2)
+	const ttl = 100 * time.Millisecond
+	p, m := newTestPreempter(t, repo, ttl)
+	ctx := context.Background()
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+
+	old, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	time.Sleep(ttl)
+	m.FastForward(ttl)
+
+	l, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, old.GetTask().Owner, l.GetTask().Owner)
+	assert.Equal(t, old.FencingToken()+1, l.FencingToken())
+	assert.Equal(t, task.TaskStatusRunning, l.GetTask().LastStatus)
+	// 原来的持有者不能续约和释放
+	assert.Equal(t, ErrTaskNotHold, old.Refresh(ctx))
+	assert.Equal(t, ErrTaskNotHold, old.Retry(ctx, 1, now))
+	require.NoError(t, l.Refresh(ctx))
+}
+
+func TestPreempter_Handover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.Now()
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil).Times(2)
+	p, _ := newTestPreempter(t, repo, time.Minute)
+	ctx := context.Background()
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+
+	old, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	require.NoError(t, old.Handover(ctx))
+	assert.Equal(t, preempt.ErrLeaserHasRelease, old.Handover(ctx))
+
+	// 不需要等到租约过期，下一个持有者继续探查本次执行
+	l, err := p.Preempt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, task.TaskStatusRunning, l.GetTask().LastStatus)
+	assert.Equal(t, old.FencingToken()+1, l.FencingToken())
+}
+
+func TestPreempter_AutoRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.Now()
+	repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, now), nil)
+	p, m := newTestPreempter(t, repo, 150*time.Millisecond)
+	ctx := context.Background()
+	require.NoError(t, p.Enqueue(ctx, 1, now))
+	l, err := p.Preempt(ctx)
+	require.NoError(t, err)
+
+	ctx1, cancel := context.WithCancel(ctx)
+	ch, err := l.AutoRefresh(ctx1)
+	require.NoError(t, err)
+	s := <-ch
+	assert.NoError(t, s.Err())
+	assert.Equal(t, 150*time.Millisecond, m.TTL(p.keys(1)[1]))
+
+	// 租约被其他节点获取后续约失败
+	m.Set(p.keys(1)[1], "other")
+	s = <-ch
+	assert.Equal(t, ErrTaskNotHold, s.Err())
+
+	cancel()
+	for s = range ch {
+	}
+	assert.Equal(t, context.Canceled, s.Err())
+	_, err = l.AutoRefresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ErrTaskNotHold, l.Retry(ctx, 1, now))
+	_, err = l.AutoRefresh(ctx)
+	assert.Equal(t, preempt.ErrLeaserHasRelease, err)
+}
+
+func TestPreempter_PreemptBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.Now()
+	paused := newTask(3, now)
+	paused.LastStatus = task.TaskStatusPaused
+	repo.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, id int64) (task.Task, error) {
+		if id == 3 {
+			return paused, nil
+		}
+		return newTask(id, now), nil
+	}).AnyTimes()
+	p, _ := newTestPreempter(t, repo, time.Minute)
+	p.randIndex = func(num int) int {
+		return 0
+	}
+	ctx := context.Background()
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, p.Enqueue(ctx, int64(i), now))
+	}
+
+	ls, err := p.PreemptBatch(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, ls, 2)
+	assert.Equal(t, int64(1), ls[0].GetTask().ID)
+	assert.Equal(t, int64(2), ls[1].GetTask().ID)
+	assert.Equal(t, ls[0].GetTask().Owner, ls[1].GetTask().Owner)
+
+	// 暂停的任务推迟调度，恢复之前不会再被抢占
+	ls, err = p.PreemptBatch(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, ls, 1)
+	assert.Equal(t, int64(4), ls[0].GetTask().ID)
+
+	_, err = p.PreemptBatch(ctx, 2)
+	assert.Equal(t, errs.ErrNoExecutableTask, err)
+	_, err = p.client.ZScore(ctx, p.readyKey(), "3").Result()
+	assert.NoError(t, err)
+}
+
+// TestPreempter_PreemptConcurrently 多个调度节点同时抢占时，每个任务只会被抢占一次
+func TestPreempter_PreemptConcurrently(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.Now()
+	repo.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, id int64) (task.Task, error) {
+		return newTask(id, now), nil
+	}).AnyTimes()
+	p, _ := newTestPreempter(t, repo, time.Minute)
+	ctx := context.Background()
+	const cnt = 20
+	for i := 1; i <= cnt; i++ {
+		require.NoError(t, p.Enqueue(ctx, int64(i), now))
+	}
+
+	var mu sync.Mutex
+	preempted := make(map[int64]int, cnt)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				l, err := p.Preempt(ctx)
+				if errors.Is(err, errs.ErrNoExecutableTask) {
+					return
+				}
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				preempted[l.GetTask().ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, preempted, cnt)
+	for id, n := range preempted {
+		assert.Equal(t, 1, n, "任务 %s 被抢占了多次", strconv.FormatInt(id, 10))
+	}
+}
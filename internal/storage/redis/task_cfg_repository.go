@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// TaskCfgRepository 修改任务表之后同步修改 Redis 中等待调度的任务，使用 Preempter 时所有的修改都需要经过它。
+// 任务表修改成功、Redis 修改失败时返回错误，Preempter 抢占到任务后会以任务表为准
+type TaskCfgRepository struct {
+	storage.TaskCfgRepository
+	client redis.Cmdable
+	prefix string
+	// Load 每次从任务表中查询的任务数量
+	batchSize int
+}
+
+// NewTaskCfgRepository repo 是任务表，prefix 需要和 Preempter 的前缀一致
+func NewTaskCfgRepository(repo storage.TaskCfgRepository, client redis.Cmdable, prefix string) *TaskCfgRepository {
+	return &TaskCfgRepository{
+		TaskCfgRepository: repo,
+		client:            client,
+		prefix:            prefix,
+		batchSize:         100,
+	}
+}
+
+func (r *TaskCfgRepository) Add(ctx context.Context, t task.Task) (int64, error) {
+	id, err := r.TaskCfgRepository.Add(ctx, t)
+	if err != nil {
+		return id, err
+	}
+	return id, r.sync(ctx, id)
+}
+
+func (r *TaskCfgRepository) Update(ctx context.Context, t task.Task) error {
+	if err := r.TaskCfgRepository.Update(ctx, t); err != nil {
+		return err
+	}
+	return r.sync(ctx, t.ID)
+}
+
+func (r *TaskCfgRepository) Delete(ctx context.Context, id int64) error {
+	if err := r.TaskCfgRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.remove(ctx, id)
+}
+
+// Pause 暂停的任务依旧等待调度，被抢占后 Preempter 会推迟它的执行时间。
+// stop 为 true 时删除租约，持有任务的调度节点续约失败后会停止正在执行的任务
+func (r *TaskCfgRepository) Pause(ctx context.Context, id int64, stop bool) error {
+	if err := r.TaskCfgRepository.Pause(ctx, id, stop); err != nil {
+		return err
+	}
+	if !stop {
+		return nil
+	}
+	return r.client.Del(ctx, leaseKey(r.prefix, id)).Err()
+}
+
+func (r *TaskCfgRepository) Resume(ctx context.Context, id int64, next time.Time) error {
+	if err := r.TaskCfgRepository.Resume(ctx, id, next); err != nil {
+		return err
+	}
+	return r.sync(ctx, id)
+}
+
+// Trigger 正在执行的任务由 Preempter 在释放时再次调度
+func (r *TaskCfgRepository) Trigger(ctx context.Context, id int64, params string) error {
+	if err := r.TaskCfgRepository.Trigger(ctx, id, params); err != nil {
+		return err
+	}
+	return enqueue(ctx, r.client, r.prefix, id, time.Now())
+}
+
+func (r *TaskCfgRepository) Ready(ctx context.Context, id int64) error {
+	if err := r.TaskCfgRepository.Ready(ctx, id); err != nil {
+		return err
+	}
+	return enqueue(ctx, r.client, r.prefix, id, time.Now())
+}
+
+func (r *TaskCfgRepository) Stop(ctx context.Context, id int64) error {
+	if err := r.TaskCfgRepository.Stop(ctx, id); err != nil {
+		return err
+	}
+	return r.remove(ctx, id)
+}
+
+func (r *TaskCfgRepository) UpdateNextTime(ctx context.Context, id int64, next time.Time) error {
+	if err := r.TaskCfgRepository.UpdateNextTime(ctx, id, next); err != nil {
+		return err
+	}
+	return enqueue(ctx, r.client, r.prefix, id, next)
+}
+
+// Load 把任务表中没有结束的任务加入等待调度的集合，已经在集合中的任务不受影响。
+// 第一次使用 Redis 调度或者 Redis 的数据丢失后调用
+func (r *TaskCfgRepository) Load(ctx context.Context) error {
+	for offset := 0; ; offset += r.batchSize {
+		ts, _, err := r.List(ctx, offset, r.batchSize)
+		if err != nil {
+			return err
+		}
+		members := make([]redis.Z, 0, len(ts))
+		for _, t := range ts {
+			if t.LastStatus == task.TaskStatusFinished {
+				continue
+			}
+			members = append(members, redis.Z{Score: float64(readyAt(t).UnixMilli()), Member: t.ID})
+		}
+		if len(members) > 0 {
+			if err = r.client.ZAddNX(ctx, readyKey(r.prefix), members...).Err(); err != nil {
+				return err
+			}
+		}
+		if len(ts) < r.batchSize {
+			return nil
+		}
+	}
+}
+
+// sync 按照任务表中的状态修改等待调度的任务
+func (r *TaskCfgRepository) sync(ctx context.Context, id int64) error {
+	t, err := r.Get(ctx, id)
+	switch {
+	case errors.Is(err, errs.ErrTaskNotFound):
+		return r.remove(ctx, id)
+	case err != nil:
+		return err
+	case t.LastStatus == task.TaskStatusFinished:
+		return r.remove(ctx, id)
+	}
+	return enqueue(ctx, r.client, r.prefix, id, readyAt(t))
+}
+
+// remove 正在执行的任务不受影响，但是释放后也不会再被调度
+func (r *TaskCfgRepository) remove(ctx context.Context, id int64) error {
+	return r.client.ZRem(ctx, readyKey(r.prefix), id).Err()
+}
+
+// readyAt 手动触发的任务马上调度
+func readyAt(t task.Task) time.Time {
+	if t.Triggered() {
+		return time.Now()
+	}
+	return t.NextExecTime
+}
@@ -0,0 +1,265 @@
+package redis
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ecodeclub/ecron/internal/errs"
+	daomocks "github.com/ecodeclub/ecron/internal/storage/mocks"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func newTestTaskCfgRepository(t *testing.T, repo *daomocks.MockTaskCfgRepository) (*TaskCfgRepository, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return NewTaskCfgRepository(repo, client, DefaultPrefix), m
+}
+
+func TestTaskCfgRepository_Sync(t *testing.T) {
+	now := time.UnixMilli(time.Now().UnixMilli())
+	next := now.Add(time.Hour)
+	testCases := []struct {
+		name string
+		mock func(repo *daomocks.MockTaskCfgRepository)
+		// 修改前已经在等待调度的任务
+		before func(t *testing.T, r *TaskCfgRepository)
+		write  func(r *TaskCfgRepository) error
+		// 任务 1 的执行时间，nil 表示不在等待调度的集合中，零值表示马上调度
+		wantAt *time.Time
+	}{
+		{
+			name: "添加任务",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Add(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, next), nil)
+			},
+			write: func(r *TaskCfgRepository) error {
+				_, err := r.Add(context.Background(), newTask(0, next))
+				return err
+			},
+			wantAt: &next,
+		},
+		{
+			name: "添加依赖上游的任务",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				t := newTask(1, time.Time{})
+				t.LastStatus = task.TaskStatusFinished
+				repo.EXPECT().Add(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(t, nil)
+			},
+			write: func(r *TaskCfgRepository) error {
+				_, err := r.Add(context.Background(), newTask(0, time.Time{}))
+				return err
+			},
+		},
+		{
+			name: "修改执行时间",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, next), nil)
+			},
+			before: func(t *testing.T, r *TaskCfgRepository) {
+				require.NoError(t, enqueue(context.Background(), r.client, r.prefix, 1, now))
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Update(context.Background(), newTask(1, next))
+			},
+			wantAt: &next,
+		},
+		{
+			name: "修改失败",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(errs.ErrTaskNotFound)
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Update(context.Background(), newTask(1, next))
+			},
+		},
+		{
+			name: "删除任务",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Delete(gomock.Any(), int64(1)).Return(nil)
+			},
+			before: func(t *testing.T, r *TaskCfgRepository) {
+				require.NoError(t, enqueue(context.Background(), r.client, r.prefix, 1, now))
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Delete(context.Background(), 1)
+			},
+		},
+		{
+			name: "恢复任务",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Resume(gomock.Any(), int64(1), next).Return(nil)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(newTask(1, next), nil)
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Resume(context.Background(), 1, next)
+			},
+			wantAt: &next,
+		},
+		{
+			name: "恢复后直接结束",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				t := newTask(1, time.Time{})
+				t.LastStatus = task.TaskStatusFinished
+				repo.EXPECT().Resume(gomock.Any(), int64(1), time.Time{}).Return(nil)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(t, nil)
+			},
+			before: func(t *testing.T, r *TaskCfgRepository) {
+				require.NoError(t, enqueue(context.Background(), r.client, r.prefix, 1, now))
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Resume(context.Background(), 1, time.Time{})
+			},
+		},
+		{
+			name: "手动触发",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Trigger(gomock.Any(), int64(1), "").Return(nil)
+			},
+			before: func(t *testing.T, r *TaskCfgRepository) {
+				require.NoError(t, enqueue(context.Background(), r.client, r.prefix, 1, next))
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Trigger(context.Background(), 1, "")
+			},
+			wantAt: &time.Time{},
+		},
+		{
+			name: "手动触发被持有的任务",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Trigger(gomock.Any(), int64(1), "").Return(nil)
+			},
+			before: func(t *testing.T, r *TaskCfgRepository) {
+				ctx := context.Background()
+				require.NoError(t, enqueue(ctx, r.client, r.prefix, 1, next))
+				require.NoError(t, r.client.Set(ctx, leaseKey(r.prefix, 1), "node", time.Minute).Err())
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Trigger(context.Background(), 1, "")
+			},
+			// 持有者释放时再次调度
+			wantAt: &next,
+		},
+		{
+			name: "上游执行结束",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Ready(gomock.Any(), int64(1)).Return(nil)
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Ready(context.Background(), 1)
+			},
+			wantAt: &time.Time{},
+		},
+		{
+			name: "停止任务",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().Stop(gomock.Any(), int64(1)).Return(nil)
+			},
+			before: func(t *testing.T, r *TaskCfgRepository) {
+				require.NoError(t, enqueue(context.Background(), r.client, r.prefix, 1, now))
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.Stop(context.Background(), 1)
+			},
+		},
+		{
+			name: "更新下一次执行时间",
+			mock: func(repo *daomocks.MockTaskCfgRepository) {
+				repo.EXPECT().UpdateNextTime(gomock.Any(), int64(1), next).Return(nil)
+			},
+			before: func(t *testing.T, r *TaskCfgRepository) {
+				require.NoError(t, enqueue(context.Background(), r.client, r.prefix, 1, now))
+			},
+			write: func(r *TaskCfgRepository) error {
+				return r.UpdateNextTime(context.Background(), 1, next)
+			},
+			wantAt: &next,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := daomocks.NewMockTaskCfgRepository(ctrl)
+			tc.mock(repo)
+			r, _ := newTestTaskCfgRepository(t, repo)
+			if tc.before != nil {
+				tc.before(t, r)
+			}
+			start := time.Now()
+			err := tc.write(r)
+			ctx := context.Background()
+			score, zerr := r.client.ZScore(ctx, readyKey(r.prefix), "1").Result()
+			if tc.wantAt == nil {
+				assert.ErrorIs(t, zerr, redis.Nil)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, zerr)
+			if tc.wantAt.IsZero() {
+				assert.GreaterOrEqual(t, score, float64(start.UnixMilli()))
+				assert.LessOrEqual(t, score, float64(time.Now().UnixMilli()))
+				return
+			}
+			assert.Equal(t, float64(tc.wantAt.UnixMilli()), score)
+		})
+	}
+}
+
+func TestTaskCfgRepository_Pause(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	repo.EXPECT().Pause(gomock.Any(), int64(1), false).Return(nil)
+	repo.EXPECT().Pause(gomock.Any(), int64(1), true).Return(nil)
+	r, m := newTestTaskCfgRepository(t, repo)
+	ctx := context.Background()
+	require.NoError(t, r.client.Set(ctx, leaseKey(r.prefix, 1), "node", time.Minute).Err())
+
+	// 本次执行正常结束
+	require.NoError(t, r.Pause(ctx, 1, false))
+	assert.True(t, m.Exists(leaseKey(r.prefix, 1)))
+	// 持有者续约失败后停止执行
+	require.NoError(t, r.Pause(ctx, 1, true))
+	assert.False(t, m.Exists(leaseKey(r.prefix, 1)))
+}
+
+func TestTaskCfgRepository_Load(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	now := time.UnixMilli(time.Now().UnixMilli())
+	paused := newTask(3, now)
+	paused.LastStatus = task.TaskStatusPaused
+	finished := newTask(4, now)
+	finished.LastStatus = task.TaskStatusFinished
+	ts := []task.Task{newTask(1, now), newTask(2, now.Add(time.Hour)), paused, finished}
+	repo.EXPECT().List(gomock.Any(), 0, 2).Return(ts[:2], int64(4), nil)
+	repo.EXPECT().List(gomock.Any(), 2, 2).Return(ts[2:], int64(4), nil)
+	repo.EXPECT().List(gomock.Any(), 4, 2).Return(nil, int64(4), nil)
+	r, _ := newTestTaskCfgRepository(t, repo)
+	r.batchSize = 2
+	ctx := context.Background()
+	// 已经在等待调度的任务不受影响
+	require.NoError(t, enqueue(ctx, r.client, r.prefix, 2, now))
+
+	require.NoError(t, r.Load(ctx))
+	res, err := r.client.ZRangeWithScores(ctx, readyKey(r.prefix), 0, -1).Result()
+	require.NoError(t, err)
+	// 暂停的任务恢复后还需要调度
+	assert.Equal(t, []redis.Z{
+		{Score: float64(now.UnixMilli()), Member: "1"},
+		{Score: float64(now.UnixMilli()), Member: "2"},
+		{Score: float64(now.UnixMilli()), Member: "3"},
+	}, res)
+}
@@ -0,0 +1,19 @@
+package sqlite
+
+import (
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"gorm.io/gorm"
+)
+
+func NewGormTaskCfgRepository(db *gorm.DB) *mysql.GormTaskCfgRepository {
+	return mysql.NewGormTaskCfgRepository(db)
+}
+
+// NewGormExecutionDAO SQLite 不支持 FOR UPDATE，抢占分片和 MySQL 一样先查询再按照状态比较并更新
+func NewGormExecutionDAO(db *gorm.DB) *mysql.GormExecutionDAO {
+	return mysql.NewGormExecutionDAO(db)
+}
+
+func NewGormWorkflowDAO(db *gorm.DB) *mysql.GormWorkflowDAO {
+	return mysql.NewGormWorkflowDAO(db)
+}
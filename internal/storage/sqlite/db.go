@@ -0,0 +1,36 @@
+// Package sqlite 基于 SQLite 的存储实现，适合单节点部署和测试，不需要启动外部的数据库。
+// SQL 由 gorm 按照 SQLite 的方言生成，直接复用 mysql 包的实现
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 写冲突时最多等待的时间
+const busyTimeout = 5 * time.Second
+
+// Open 打开 path 对应的数据库文件，不存在时会创建，并且把表结构迁移到最新的版本。
+// SQLite 同一时间只允许一个写事务：开启 WAL 让读写互不阻塞，
+// 事务开始时直接获取写锁，写冲突时等待 busyTimeout，而不是直接返回 SQLITE_BUSY
+func Open(path string, opts ...gorm.Option) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_txlock=immediate",
+		path, busyTimeout.Milliseconds())
+	db, err := gorm.Open(sqlite.Open(dsn), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db, InitTables(db)
+}
+
+// InitTables 执行所有还没有执行的迁移脚本
+func InitTables(db *gorm.DB) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	return m.Up(context.Background())
+}
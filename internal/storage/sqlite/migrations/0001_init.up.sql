@@ -0,0 +1,88 @@
+-- 字段的含义见 mysql 包中同名的迁移脚本
+CREATE TABLE IF NOT EXISTS task_info
+(
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    name              TEXT    NOT NULL,
+    type              TEXT    NOT NULL,
+    cron              TEXT    NOT NULL,
+    timezone          TEXT    NOT NULL DEFAULT '',
+    schedule_type     INTEGER NOT NULL DEFAULT 0,
+    exec_at           INTEGER NOT NULL DEFAULT 0,
+    schedule_interval INTEGER NOT NULL DEFAULT 0,
+    executor          TEXT    NOT NULL,
+    owner             TEXT    NOT NULL,
+    status            INTEGER NOT NULL DEFAULT 1,
+    cfg               TEXT    NOT NULL,
+    retry_policy      TEXT    NOT NULL,
+    misfire_policy    TEXT    NOT NULL,
+    attempt           INTEGER NOT NULL DEFAULT 0,
+    shard_count       INTEGER NOT NULL DEFAULT 0,
+    fencing_token     INTEGER NOT NULL DEFAULT 0,
+    next_exec_time    INTEGER,
+    trigger_time      INTEGER NOT NULL DEFAULT 0,
+    trigger_params    TEXT    NOT NULL,
+    ctime             INTEGER NOT NULL,
+    utime             INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_status_next_exec_time ON task_info (status, next_exec_time);
+CREATE INDEX IF NOT EXISTS idx_status_utime ON task_info (status, utime);
+CREATE INDEX IF NOT EXISTS idx_status_trigger_time ON task_info (status, trigger_time);
+
+CREATE TABLE IF NOT EXISTS execution
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    tid           INTEGER NOT NULL,
+    attempt       INTEGER NOT NULL DEFAULT 0,
+    misfired      INTEGER NOT NULL DEFAULT 0,
+    trigger_type  INTEGER NOT NULL DEFAULT 0,
+    status        INTEGER,
+    progress      INTEGER,
+    start_time    INTEGER NOT NULL DEFAULT 0,
+    end_time      INTEGER NOT NULL DEFAULT 0,
+    err_msg       TEXT    NOT NULL DEFAULT '',
+    node          TEXT    NOT NULL DEFAULT '',
+    parent_id     INTEGER NOT NULL DEFAULT 0,
+    shard_index   INTEGER NOT NULL DEFAULT 0,
+    shard_total   INTEGER NOT NULL DEFAULT 0,
+    fencing_token INTEGER NOT NULL DEFAULT 0,
+    ctime         INTEGER NOT NULL,
+    utime         INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tid_start_time ON execution (tid, start_time);
+CREATE INDEX IF NOT EXISTS idx_parent_id ON execution (parent_id);
+CREATE INDEX IF NOT EXISTS idx_status ON execution (status);
+
+CREATE TABLE IF NOT EXISTS workflow
+(
+    id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    name  TEXT    NOT NULL,
+    ctime INTEGER NOT NULL,
+    utime INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS workflow_node
+(
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    wid            INTEGER NOT NULL,
+    tid            INTEGER NOT NULL,
+    upstreams      TEXT    NOT NULL,
+    failure_policy INTEGER NOT NULL DEFAULT 0,
+    ctime          INTEGER NOT NULL,
+    utime          INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_wid ON workflow_node (wid);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_tid ON workflow_node (tid);
+
+CREATE TABLE IF NOT EXISTS workflow_run
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    wid        INTEGER NOT NULL,
+    status     INTEGER NOT NULL,
+    nodes      TEXT    NOT NULL,
+    start_time INTEGER NOT NULL DEFAULT 0,
+    end_time   INTEGER NOT NULL DEFAULT 0,
+    version    INTEGER NOT NULL DEFAULT 0,
+    ctime      INTEGER NOT NULL,
+    utime      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_wid_status ON workflow_run (wid, status);
@@ -0,0 +1,5 @@
+-- 字段的含义见 mysql 包中同名的迁移脚本
+ALTER TABLE workflow_run ADD COLUMN running_wid INTEGER NULL;
+UPDATE workflow_run SET running_wid = wid
+WHERE id IN (SELECT MAX(id) FROM workflow_run WHERE status = 1 GROUP BY wid);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_running_wid ON workflow_run (running_wid);
@@ -0,0 +1,17 @@
+package sqlite
+
+import (
+	"github.com/ecodeclub/ecron/internal/storage/mysql"
+	"gorm.io/gorm"
+	"time"
+)
+
+// NewPreempter SQLite 的写操作是串行的，和 MySQL 一样按照 owner 比较并更新，
+// 同一个进程中的多个 goroutine 同时抢占时只有一个能成功
+func NewPreempter(db *gorm.DB, batchSize int, leaseTTL time.Duration, opts ...mysql.PreempterOption) *mysql.Preempter {
+	return mysql.NewPreempterWithRepository(NewGormTaskRepository(db, batchSize, leaseTTL), opts...)
+}
+
+func NewGormTaskRepository(db *gorm.DB, batchSize int, leaseTTL time.Duration) mysql.TaskRepository {
+	return mysql.NewGormTaskRepository(db, batchSize, leaseTTL)
+}
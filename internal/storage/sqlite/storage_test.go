@@ -0,0 +1,18 @@
+package sqlite
+
+import (
+	"github.com/ecodeclub/ecron/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestStorage 和其他存储实现运行同样的测试
+func TestStorage(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "ecron.db"))
+	require.NoError(t, err)
+	suite.Run(t, storagetest.NewStorageSuite(db, NewGormTaskCfgRepository(db), NewGormExecutionDAO(db),
+		NewGormWorkflowDAO(db), NewPreempter(db, 10, time.Minute)))
+}
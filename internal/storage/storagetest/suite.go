@@ -0,0 +1,471 @@
+// Package storagetest 所有存储实现都需要通过的测试，由各个存储实现准备好数据库之后运行
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/preempt"
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type StorageSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	repo         storage.TaskCfgRepository
+	executionDAO storage.ExecutionDAO
+	workflowDAO  storage.WorkflowDAO
+	pe           preempt.Preempter
+}
+
+// NewStorageSuite db 中需要已经创建好表，每个测试结束后会清空数据
+func NewStorageSuite(db *gorm.DB, repo storage.TaskCfgRepository, executionDAO storage.ExecutionDAO,
+	workflowDAO storage.WorkflowDAO, pe preempt.Preempter) *StorageSuite {
+	return &StorageSuite{
+		db:           db,
+		repo:         repo,
+		executionDAO: executionDAO,
+		workflowDAO:  workflowDAO,
+		pe:           pe,
+	}
+}
+
+func (s *StorageSuite) TearDownTest() {
+	s.Require().NoError(s.db.Exec("DELETE FROM task_info").Error)
+	s.Require().NoError(s.db.Exec("DELETE FROM execution").Error)
+	s.Require().NoError(s.db.Exec("DELETE FROM workflow_run").Error)
+}
+
+func (s *StorageSuite) TestTaskCfgRepository() {
+	ctx := context.Background()
+	next := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	id, err := s.repo.Add(ctx, s.newTask("test", next))
+	s.Require().NoError(err)
+
+	t, err := s.repo.Get(ctx, id)
+	s.Require().NoError(err)
+	s.Equal("test", t.Name)
+	s.Equal(next, t.NextExecTime)
+	s.Equal(task.TaskStatusWaiting, t.LastStatus)
+	s.Equal(task.RetryPolicy{MaxAttempts: 3, Interval: time.Second}, t.RetryPolicy)
+
+	t.Name = "updated"
+	t.ShardCount = 3
+	s.Require().NoError(s.repo.Update(ctx, t))
+	ts, total, err := s.repo.List(ctx, 0, 10)
+	s.Require().NoError(err)
+	s.Equal(int64(1), total)
+	s.Equal("updated", ts[0].Name)
+	s.Equal(3, ts[0].ShardCount)
+
+	s.Require().NoError(s.repo.Delete(ctx, id))
+	_, err = s.repo.Get(ctx, id)
+	s.Equal(errs.ErrTaskNotFound, err)
+}
+
+func (s *StorageSuite) TestPauseResume() {
+	ctx := context.Background()
+	id, err := s.repo.Add(ctx, s.newTask("test", time.Now().Add(time.Hour)))
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.repo.Pause(ctx, id, false))
+	t, err := s.repo.Get(ctx, id)
+	s.Require().NoError(err)
+	s.Equal(task.TaskStatusPaused, t.LastStatus)
+	// 暂停的任务不能手动触发
+	s.Equal(errs.ErrInvalidTaskStatus, s.repo.Trigger(ctx, id, ""))
+
+	next := time.UnixMilli(time.Now().Add(time.Minute).UnixMilli())
+	s.Require().NoError(s.repo.Resume(ctx, id, next))
+	t, err = s.repo.Get(ctx, id)
+	s.Require().NoError(err)
+	s.Equal(task.TaskStatusWaiting, t.LastStatus)
+	s.Equal(next, t.NextExecTime)
+	s.Equal(errs.ErrInvalidTaskStatus, s.repo.Resume(ctx, id, next))
+}
+
+func (s *StorageSuite) TestPreempt() {
+	ctx := context.Background()
+	id, err := s.repo.Add(ctx, s.newTask("test", time.Now().Add(-time.Second)))
+	s.Require().NoError(err)
+	// 还没有到执行时间的任务不会被抢占
+	_, err = s.repo.Add(ctx, s.newTask("future", time.Now().Add(time.Hour)))
+	s.Require().NoError(err)
+
+	l, err := s.pe.Preempt(ctx)
+	s.Require().NoError(err)
+	s.Equal(id, l.GetTask().ID)
+	s.Equal(int64(1), l.FencingToken())
+	t, err := s.repo.Get(ctx, id)
+	s.Require().NoError(err)
+	s.Equal(task.TaskStatusRunning, t.LastStatus)
+
+	_, err = s.pe.Preempt(ctx)
+	s.Equal(errs.ErrNoExecutableTask, err)
+
+	s.Require().NoError(l.Refresh(ctx))
+	s.Require().NoError(l.Release(ctx))
+	t, err = s.repo.Get(ctx, id)
+	s.Require().NoError(err)
+	s.Equal(task.TaskStatusWaiting, t.LastStatus)
+	s.True(t.NextExecTime.After(time.Now()))
+	s.Equal("", t.TriggerParams)
+}
+
+func (s *StorageSuite) TestPreemptTrigger() {
+	ctx := context.Background()
+	next := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	id, err := s.repo.Add(ctx, s.newTask("test", next))
+	s.Require().NoError(err)
+	s.Require().NoError(s.repo.Trigger(ctx, id, `{"id":1}`))
+
+	// 手动触发的任务不需要等到下一次执行时间
+	l, err := s.pe.Preempt(ctx)
+	s.Require().NoError(err)
+	s.True(l.GetTask().Triggered())
+	s.Equal(`{"id":1}`, l.GetTask().TriggerParams)
+
+	s.Require().NoError(l.Release(ctx))
+	t, err := s.repo.Get(ctx, id)
+	s.Require().NoError(err)
+	s.False(t.Triggered())
+	s.Equal(next, t.NextExecTime)
+}
+
+func (s *StorageSuite) TestPreemptBatch() {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := s.repo.Add(ctx, s.newTask("test", time.Now().Add(-time.Second)))
+		s.Require().NoError(err)
+	}
+
+	ls, err := s.pe.PreemptBatch(ctx, 2)
+	s.Require().NoError(err)
+	s.Len(ls, 2)
+	for _, l := range ls {
+		s.Equal(int64(1), l.FencingToken())
+		// 返回的是抢占前的状态，存储的是抢占后的状态
+		s.Equal(task.TaskStatusWaiting, l.GetTask().LastStatus)
+		t, err := s.repo.Get(ctx, l.GetTask().ID)
+		s.Require().NoError(err)
+		s.Equal(task.TaskStatusRunning, t.LastStatus)
+	}
+	ls, err = s.pe.PreemptBatch(ctx, 2)
+	s.Require().NoError(err)
+	s.Len(ls, 1)
+	_, err = s.pe.PreemptBatch(ctx, 2)
+	s.Equal(errs.ErrNoExecutableTask, err)
+
+	// 接手其他调度节点没有执行完的任务
+	s.Require().NoError(ls[0].Handover(ctx))
+	ls, err = s.pe.PreemptBatch(ctx, 2)
+	s.Require().NoError(err)
+	s.Require().Len(ls, 1)
+	s.Equal(task.TaskStatusRunning, ls[0].GetTask().LastStatus)
+	s.Equal(int64(2), ls[0].FencingToken())
+}
+
+// TestPreemptConcurrently 多个调度节点同时抢占时，每个任务只会被抢占一次
+func (s *StorageSuite) TestPreemptConcurrently() {
+	ctx := context.Background()
+	const cnt = 20
+	for i := 0; i < cnt; i++ {
+		_, err := s.repo.Add(ctx, s.newTask("test", time.Now().Add(-time.Second)))
+		s.Require().NoError(err)
+	}
+
+	var mu sync.Mutex
+	preempted := make(map[int64]int, cnt)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				l, err := s.pe.Preempt(ctx)
+				if errors.Is(err, errs.ErrNoExecutableTask) {
+					return
+				}
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				preempted[l.GetTask().ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	s.Len(preempted, cnt)
+	for id, n := range preempted {
+		s.Equal(1, n, "任务 %d 被抢占了多次", id)
+	}
+}
+
+// TestPreemptBatchConcurrently 多个调度节点同时批量抢占时，每个任务只会被抢占一次
+func (s *StorageSuite) TestPreemptBatchConcurrently() {
+	ctx := context.Background()
+	const cnt = 20
+	for i := 0; i < cnt; i++ {
+		_, err := s.repo.Add(ctx, s.newTask("test", time.Now().Add(-time.Second)))
+		s.Require().NoError(err)
+	}
+
+	var mu sync.Mutex
+	preempted := make(map[int64]int, cnt)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				ls, err := s.pe.PreemptBatch(ctx, 3)
+				if errors.Is(err, errs.ErrNoExecutableTask) {
+					return
+				}
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				for _, l := range ls {
+					preempted[l.GetTask().ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	s.Len(preempted, cnt)
+	for id, n := range preempted {
+		s.Equal(1, n, "任务 %d 被抢占了多次", id)
+	}
+}
+
+func (s *StorageSuite) TestExecutionDAO() {
+	ctx := context.Background()
+	eid, err := s.executionDAO.Create(ctx, task.Execution{
+		Tid:     1,
+		Attempt: 1,
+		Status:  task.ExecStatusRunning,
+		Node:    "node-1",
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(s.executionDAO.UpdateProgressStatus(ctx, eid, 0, 50, task.ExecStatusRunning))
+	s.Require().NoError(s.executionDAO.Finish(ctx, eid, 0, 50, task.ExecStatusFailed, "request failed"))
+
+	e, err := s.executionDAO.GetLastExecution(ctx, 1)
+	s.Require().NoError(err)
+	s.Equal(eid, e.ID)
+	s.Equal(task.ExecStatusFailed, e.Status)
+	s.Equal(uint8(50), e.Progress)
+	s.Equal("request failed", e.ErrMsg)
+	s.Equal("node-1", e.Node)
+	s.False(e.EndTime.IsZero())
+
+	execs, total, err := s.executionDAO.ListByTask(ctx, 1, storage.ExecutionQuery{Limit: 10})
+	s.Require().NoError(err)
+	s.Equal(int64(1), total)
+	s.Equal(eid, execs[0].ID)
+}
+
+// TestFencingToken 新的持有者写入执行记录后，持有过期租约的调度节点不能再写入
+func (s *StorageSuite) TestFencingToken() {
+	ctx := context.Background()
+	eid, err := s.executionDAO.Create(ctx, task.Execution{
+		Tid:          1,
+		Attempt:      1,
+		Status:       task.ExecStatusRunning,
+		FencingToken: 1,
+	})
+	s.Require().NoError(err)
+	// 相同的 token 可以重复写入
+	s.Require().NoError(s.executionDAO.UpdateProgressStatus(ctx, eid, 1, 10, task.ExecStatusRunning))
+	s.Require().NoError(s.executionDAO.UpdateProgressStatus(ctx, eid, 1, 10, task.ExecStatusRunning))
+
+	// 新的持有者接手了执行记录
+	s.Require().NoError(s.executionDAO.UpdateProgressStatus(ctx, eid, 2, 20, task.ExecStatusRunning))
+	s.Equal(errs.ErrStaleFencingToken, s.executionDAO.UpdateProgressStatus(ctx, eid, 1, 30, task.ExecStatusRunning))
+	s.Equal(errs.ErrStaleFencingToken, s.executionDAO.Finish(ctx, eid, 1, 30, task.ExecStatusSuccess, ""))
+	_, err = s.executionDAO.Create(ctx, task.Execution{Tid: 1, Attempt: 1, Status: task.ExecStatusRunning, FencingToken: 1})
+	s.Equal(errs.ErrStaleFencingToken, err)
+
+	e, err := s.executionDAO.GetLastExecution(ctx, 1)
+	s.Require().NoError(err)
+	s.Equal(eid, e.ID)
+	s.Equal(uint8(20), e.Progress)
+	s.Equal(int64(2), e.FencingToken)
+	s.Equal(task.ExecStatusRunning, e.Status)
+}
+
+// TestCreateConcurrently 不同 token 的持有者同时创建执行记录时，token 更小的执行记录不会在 token 更大的之后写入
+func (s *StorageSuite) TestCreateConcurrently() {
+	ctx := context.Background()
+	id, err := s.repo.Add(ctx, s.newTask("test", time.Now()))
+	s.Require().NoError(err)
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(token int64) {
+			defer wg.Done()
+			_, err := s.executionDAO.Create(ctx, task.Execution{
+				Tid: id, Attempt: 1, Status: task.ExecStatusRunning, FencingToken: token,
+			})
+			if err != nil {
+				s.ErrorIs(err, errs.ErrStaleFencingToken)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	// 按照写入的顺序，token 严格递增
+	var tokens []int64
+	err = s.db.Table("execution").Where("tid = ?", id).Order("id").Pluck("fencing_token", &tokens).Error
+	s.Require().NoError(err)
+	s.Require().NotEmpty(tokens)
+	for i := 1; i < len(tokens); i++ {
+		s.Less(tokens[i-1], tokens[i])
+	}
+}
+
+func (s *StorageSuite) TestShards() {
+	ctx := context.Background()
+	parent := task.Execution{Tid: 1, Attempt: 1, Status: task.ExecStatusRunning, ShardTotal: 3}
+	eid, err := s.executionDAO.Create(ctx, parent)
+	s.Require().NoError(err)
+	parent.ID = eid
+	s.Require().NoError(s.executionDAO.CreateShards(ctx, parent))
+
+	// 两个调度节点各抢占一个分片
+	var wg sync.WaitGroup
+	shards := make([]task.Execution, 2)
+	for i := range shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e, err := s.executionDAO.PreemptShard(ctx, "node", time.Minute)
+			s.NoError(err)
+			shards[i] = e
+		}(i)
+	}
+	wg.Wait()
+	s.NotEqual(shards[0].ID, shards[1].ID)
+	s.Equal(task.ExecStatusRunning, shards[0].Status)
+	s.Equal(eid, shards[0].ParentID)
+
+	s.Require().NoError(s.executionDAO.FinishWaitingShards(ctx, eid, 0, task.ExecStatusCancelled, "cancelled"))
+	_, err = s.executionDAO.PreemptShard(ctx, "node", time.Minute)
+	s.Equal(errs.ErrNoExecutableTask, err)
+
+	res, err := s.executionDAO.ListShards(ctx, eid)
+	s.Require().NoError(err)
+	s.Len(res, 3)
+	cancelled := 0
+	for i, e := range res {
+		s.Equal(i, e.ShardIndex)
+		if e.Status == task.ExecStatusCancelled {
+			cancelled++
+		}
+	}
+	s.Equal(1, cancelled)
+
+	// 分片不会出现在任务的执行记录中
+	e, err := s.executionDAO.GetLastExecution(ctx, 1)
+	s.Require().NoError(err)
+	s.Equal(eid, e.ID)
+}
+
+// TestReclaimShard 执行分片的调度节点崩溃后不再续约，其他调度节点在租约过期后接手分片
+func (s *StorageSuite) TestReclaimShard() {
+	ctx := context.Background()
+	parent := task.Execution{Tid: 1, Attempt: 1, Status: task.ExecStatusRunning, ShardTotal: 1, FencingToken: 1}
+	eid, err := s.executionDAO.Create(ctx, parent)
+	s.Require().NoError(err)
+	parent.ID = eid
+	s.Require().NoError(s.executionDAO.CreateShards(ctx, parent))
+
+	shard, err := s.executionDAO.PreemptShard(ctx, "node-1", time.Minute)
+	s.Require().NoError(err)
+	s.Equal("node-1", shard.Node)
+	// 租约没有过期
+	_, err = s.executionDAO.PreemptShard(ctx, "node-2", time.Minute)
+	s.Equal(errs.ErrNoExecutableTask, err)
+	s.NoError(s.executionDAO.RefreshShard(ctx, shard.ID, "node-1"))
+
+	// node-1 超过租约的时间没有续约
+	stale := time.Now().Add(-2 * time.Minute).UnixMilli()
+	s.Require().NoError(s.db.Table("execution").Where("id = ?", shard.ID).Update("utime", stale).Error)
+	reclaimed, err := s.executionDAO.PreemptShard(ctx, "node-2", time.Minute)
+	s.Require().NoError(err)
+	s.Equal(shard.ID, reclaimed.ID)
+	s.Equal("node-2", reclaimed.Node)
+	s.Equal(task.ExecStatusRunning, reclaimed.Status)
+	s.Equal(int64(1), reclaimed.FencingToken)
+	s.Equal(errs.ErrShardReclaimed, s.executionDAO.RefreshShard(ctx, shard.ID, "node-1"))
+	s.NoError(s.executionDAO.RefreshShard(ctx, shard.ID, "node-2"))
+
+	// 结束的分片不能再续约
+	s.Require().NoError(s.executionDAO.Finish(ctx, shard.ID, 1, 100, task.ExecStatusSuccess, ""))
+	s.Equal(errs.ErrShardReclaimed, s.executionDAO.RefreshShard(ctx, shard.ID, "node-2"))
+	_, err = s.executionDAO.PreemptShard(ctx, "node-2", 0)
+	s.Equal(errs.ErrNoExecutableTask, err)
+}
+
+// TestCreateRunConcurrently 多个根节点同时结束时，工作流只会有一个运行中的记录
+func (s *StorageSuite) TestCreateRunConcurrently() {
+	ctx := context.Background()
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int64
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(tid int64) {
+			defer wg.Done()
+			_, err := s.workflowDAO.CreateRun(ctx, task.WorkflowRun{
+				Wid:       1,
+				Status:    task.WorkflowRunStatusRunning,
+				Nodes:     map[int64]task.ExecStatus{tid: task.ExecStatusSuccess},
+				StartTime: time.Now(),
+			})
+			if err == nil {
+				created.Add(1)
+				return
+			}
+			s.ErrorIs(err, errs.ErrConcurrentUpdate)
+		}(int64(i + 1))
+	}
+	wg.Wait()
+	s.Equal(int64(1), created.Load())
+
+	// 运行结束后可以开始新的运行
+	r, err := s.workflowDAO.GetRunningRun(ctx, 1)
+	s.Require().NoError(err)
+	r.Status = task.WorkflowRunStatusSuccess
+	r.EndTime = time.Now()
+	s.Require().NoError(s.workflowDAO.UpdateRun(ctx, r))
+	_, err = s.workflowDAO.GetRunningRun(ctx, 1)
+	s.Equal(errs.ErrWorkflowRunNotFound, err)
+	_, err = s.workflowDAO.CreateRun(ctx, task.WorkflowRun{Wid: 1, Status: task.WorkflowRunStatusRunning})
+	s.NoError(err)
+	// 其他工作流不受影响
+	_, err = s.workflowDAO.CreateRun(ctx, task.WorkflowRun{Wid: 2, Status: task.WorkflowRunStatusRunning})
+	s.NoError(err)
+}
+
+func (s *StorageSuite) newTask(name string, next time.Time) task.Task {
+	return task.Task{
+		Name:         name,
+		Type:         task.TypeHttp,
+		Executor:     "HTTP",
+		Cfg:          "{}",
+		CronExp:      "0 0 * * * *",
+		NextExecTime: next,
+		RetryPolicy:  task.RetryPolicy{MaxAttempts: 3, Interval: time.Second},
+	}
+}
@@ -9,17 +9,93 @@ import (
 //go:generate mockgen -source=./types.go -package=daomocks -destination=./mocks/dao.mock.go
 
 type TaskCfgRepository interface {
-	// Add 添加任务
-	Add(ctx context.Context, t task.Task) error
+	// Add 添加任务，返回任务的 id
+	Add(ctx context.Context, t task.Task) (int64, error)
+	// Update 修改任务的配置和下一次执行时间，不会修改任务的状态
+	Update(ctx context.Context, t task.Task) error
+	// Delete 删除任务，任务的执行记录会保留
+	Delete(ctx context.Context, id int64) error
+	// Get 查询任务，任务不存在时返回 errs.ErrTaskNotFound
+	Get(ctx context.Context, id int64) (task.Task, error)
+	// GetByName 按照名称查询任务，有多个同名任务时返回 id 最小的，任务不存在时返回 errs.ErrTaskNotFound
+	GetByName(ctx context.Context, name string) (task.Task, error)
+	// List 按照 id 倒序分页查询任务，同时返回任务总数
+	List(ctx context.Context, offset, limit int) ([]task.Task, int64, error)
+	// Pause 暂停等待调度或者正在执行的任务。
+	// stop 为 true 时，持有任务的调度节点会在续约失败后停止正在执行的任务；
+	// 否则本次执行会正常结束，结束后任务保持暂停
+	Pause(ctx context.Context, id int64, stop bool) error
+	// Resume 恢复暂停的任务，任务会在 next 再次执行，next 为零值时任务直接结束。
+	// 如果暂停前的执行还没有结束，任务恢复为执行中，下一次执行时间在本次执行结束后计算
+	Resume(ctx context.Context, id int64, next time.Time) error
+	// Trigger 手动触发任务，任务会被立刻调度执行一次，不会影响原本的调度计划。
+	// params 不为空时必须是 JSON 对象，本次执行时会覆盖 Cfg 中的同名字段。
+	// 只能触发等待调度和正在执行的任务，正在执行的任务会在本次执行结束后再执行
+	Trigger(ctx context.Context, id int64, params string) error
+	// Ready 让结束状态的 ScheduleTypeDependent 任务立刻进入等待调度状态，由工作流在上游节点执行结束后调用
+	Ready(ctx context.Context, id int64) error
 	// Stop 停止任务
 	Stop(ctx context.Context, id int64) error
 	// UpdateNextTime 更新下次执行时间
 	UpdateNextTime(ctx context.Context, id int64, next time.Time) error
+	// ClearTrigger 手动触发的执行结束后清除 triggerTime 这一次触发，执行过程中再次触发的话保留新的触发
+	ClearTrigger(ctx context.Context, id int64, triggerTime time.Time) error
 }
 
-// ExecutionDAO 任务执行情况
+// ExecutionDAO 任务执行情况，每一次执行都会保留一条记录。
+// 写入执行记录时需要带上租约的 fencing token，token 小于执行记录中的 token 时返回 errs.ErrStaleFencingToken
 type ExecutionDAO interface {
-	// Upsert 记录任务执行状态和进度
-	Upsert(ctx context.Context, id int64, status task.ExecStatus, progress uint8) (int64, error)
+	// Create 开始执行任务时创建执行记录，返回执行记录的 id。
+	// 任务已经有 token 更大的执行记录时返回 errs.ErrStaleFencingToken
+	Create(ctx context.Context, e task.Execution) (int64, error)
+	// UpdateProgressStatus 记录执行过程中的状态和进度
+	UpdateProgressStatus(ctx context.Context, eid int64, token int64, progress uint8, status task.ExecStatus) error
+	// Finish 记录执行的最终状态、结束时间和错误信息
+	Finish(ctx context.Context, eid int64, token int64, progress uint8, status task.ExecStatus, errMsg string) error
+	// GetLastExecution 获取任务最近的一次执行记录，不包括分片
 	GetLastExecution(ctx context.Context, tid int64) (task.Execution, error)
+	// ListByTask 按照开始时间倒序，分页查询任务的执行记录，同时返回符合条件的总数。分片不在结果中
+	ListByTask(ctx context.Context, tid int64, q ExecutionQuery) ([]task.Execution, int64, error)
+	// CreateShards 为执行记录 parent 创建 parent.ShardTotal 个等待执行的分片
+	CreateShards(ctx context.Context, parent task.Execution) error
+	// PreemptShard 抢占一个等待执行的分片，或者超过 leaseTTL 没有续约的分片，说明执行它的调度节点已经崩溃。
+	// 没有可以执行的分片时返回 errs.ErrNoExecutableTask
+	PreemptShard(ctx context.Context, node string, leaseTTL time.Duration) (task.Execution, error)
+	// RefreshShard 执行分片的调度节点定时更新分片的 utime 续约，
+	// 分片已经被其他调度节点接手或者已经结束时返回 errs.ErrShardReclaimed
+	RefreshShard(ctx context.Context, eid int64, node string) error
+	// ListShards 按照分片序号查询执行记录的所有分片
+	ListShards(ctx context.Context, parentID int64) ([]task.Execution, error)
+	// FinishWaitingShards 结束所有还没有被抢占的分片
+	FinishWaitingShards(ctx context.Context, parentID int64, token int64, status task.ExecStatus, errMsg string) error
+}
+
+// ExecutionQuery 执行记录的查询条件
+type ExecutionQuery struct {
+	// 开始时间在 [Start, End) 之间的执行记录，零值表示不限制
+	Start time.Time
+	End   time.Time
+
+	Offset int
+	Limit  int
+}
+
+// WorkflowDAO 工作流的定义和运行记录
+type WorkflowDAO interface {
+	// Create 创建工作流，返回工作流的 id。一个任务只能属于一个工作流
+	Create(ctx context.Context, w task.Workflow) (int64, error)
+	// Get 查询工作流，工作流不存在时返回 errs.ErrWorkflowNotFound
+	Get(ctx context.Context, id int64) (task.Workflow, error)
+	// GetByTask 查询任务所在的工作流，任务不属于任何工作流时返回 errs.ErrWorkflowNotFound
+	GetByTask(ctx context.Context, tid int64) (task.Workflow, error)
+	// CreateRun 创建工作流的运行记录，返回运行记录的 id。
+	// 每个工作流最多只有一个运行中的记录，已经有运行中的记录时返回 errs.ErrConcurrentUpdate
+	CreateRun(ctx context.Context, r task.WorkflowRun) (int64, error)
+	// GetRunningRun 查询工作流正在运行的记录，没有时返回 errs.ErrWorkflowRunNotFound
+	GetRunningRun(ctx context.Context, wid int64) (task.WorkflowRun, error)
+	// UpdateRun 更新运行记录的状态，通过 Version 实现乐观锁，
+	// 运行记录已经被其他调度节点修改时返回 errs.ErrConcurrentUpdate
+	UpdateRun(ctx context.Context, r task.WorkflowRun) error
+	// ListRuns 按照 id 倒序分页查询工作流的运行记录，同时返回总数
+	ListRuns(ctx context.Context, wid int64, offset, limit int) ([]task.WorkflowRun, int64, error)
 }
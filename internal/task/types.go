@@ -1,21 +1,60 @@
 package task
 
 import (
+	"encoding/json"
+	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/robfig/cron/v3"
+	"strings"
 	"time"
 )
 
 type Task struct {
-	ID         int64
-	Name       string
-	Type       Type
-	Executor   string
-	Cfg        string
-	CronExp    string
-	Owner      string
-	LastStatus int8
-	Ctime      time.Time
-	Utime      time.Time
+	ID       int64
+	Name     string
+	Type     Type
+	Executor string
+	Cfg      string
+	// cron 表达式，支持 CRON_TZ= 或者 TZ= 前缀指定时区，例如 CRON_TZ=Asia/Shanghai 0 0 8 * * *
+	CronExp string
+	// cron 表达式使用的时区，例如 Asia/Shanghai。为空时使用调度节点的本地时区。
+	// CronExp 中通过 CRON_TZ= 前缀指定的时区优先级更高
+	Timezone string
+	// 调度方式，默认按照 cron 表达式调度
+	ScheduleType ScheduleType
+	// ScheduleTypeOnce 的执行时间
+	ExecAt time.Time
+	// ScheduleTypeFixedRate 和 ScheduleTypeFixedDelay 的调度间隔
+	Interval time.Duration
+	// 本次计划的执行时间
+	NextExecTime time.Time
+	// 执行失败后的重试策略
+	RetryPolicy RetryPolicy
+	// 错过执行时间后的处理策略
+	MisfirePolicy MisfirePolicy
+	// 本次调度已经执行的次数，第一次执行时为 0，每重试一次加一
+	Attempt int
+	// 分片数量，大于 1 时每次执行都会拆分成多个分片，由调度节点并行执行
+	ShardCount int
+	// 正在执行的分片，只有执行分片时才有值
+	Shard Shard
+	// 手动触发的时间，零值表示没有等待执行的手动触发
+	TriggerTime time.Time
+	// 手动触发时传入的参数，JSON 格式，执行时会覆盖 Cfg 中的同名字段
+	TriggerParams string
+	Owner         string
+	// 本次租约的 fencing token，每次抢占任务都会递增。
+	// 执行记录只接受不小于记录中 token 的写入，持有过期租约的调度节点无法覆盖新持有者的结果
+	FencingToken int64
+	LastStatus   int8
+	Ctime        time.Time
+	Utime        time.Time
+}
+
+// Shard 任务的一个分片
+type Shard struct {
+	// 分片的序号，从 0 开始
+	Index int
+	Total int
 }
 
 type Type string
@@ -30,25 +69,465 @@ func (t Type) String() string {
 	return string(t)
 }
 
+type ScheduleType uint8
+
+const (
+	// ScheduleTypeCron 按照 cron 表达式调度
+	ScheduleTypeCron ScheduleType = iota
+	// ScheduleTypeOnce 在 ExecAt 执行一次
+	ScheduleTypeOnce
+	// ScheduleTypeFixedRate 按照固定频率调度，每两次计划执行时间之间相隔 Interval，不受执行时长影响
+	ScheduleTypeFixedRate
+	// ScheduleTypeFixedDelay 上一次执行结束后，间隔 Interval 再执行
+	ScheduleTypeFixedDelay
+	// ScheduleTypeDependent 没有自己的调度计划，作为工作流的下游节点，在上游节点执行结束后执行
+	ScheduleTypeDependent
+)
+
+func (s ScheduleType) ToUint8() uint8 {
+	return uint8(s)
+}
+
+func (s ScheduleType) String() string {
+	switch s {
+	case ScheduleTypeCron:
+		return "cron"
+	case ScheduleTypeOnce:
+		return "once"
+	case ScheduleTypeFixedRate:
+		return "fixed_rate"
+	case ScheduleTypeFixedDelay:
+		return "fixed_delay"
+	case ScheduleTypeDependent:
+		return "dependent"
+	default:
+		return "unknown"
+	}
+}
+
 var parser = cron.NewParser(
 	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
 )
 
+// NextTime 计算 time2 之后的下一次执行时间。返回零值表示任务不需要再执行了。
+// 对于 ScheduleTypeFixedDelay，time2 应该是上一次执行结束的时间。
 func (t Task) NextTime(time2 time.Time) (time.Time, error) {
-	s, err := parser.Parse(t.CronExp)
+	switch t.ScheduleType {
+	case ScheduleTypeCron:
+		s, err := t.schedule()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return s.Next(time2), nil
+	case ScheduleTypeOnce:
+		if t.ExecAt.After(time2) {
+			return t.ExecAt, nil
+		}
+		return time.Time{}, nil
+	case ScheduleTypeFixedRate:
+		if t.Interval <= 0 {
+			return time.Time{}, errs.ErrInvalidSchedule
+		}
+		// 以本次计划执行时间为基准，找到 time2 之后的第一个执行时间，
+		// 执行时间过长错过的执行时间点会被跳过
+		base := t.NextExecTime
+		if base.IsZero() {
+			return time2.Add(t.Interval), nil
+		}
+		if base.After(time2) {
+			return base, nil
+		}
+		n := time2.Sub(base)/t.Interval + 1
+		return base.Add(n * t.Interval), nil
+	case ScheduleTypeFixedDelay:
+		if t.Interval <= 0 {
+			return time.Time{}, errs.ErrInvalidSchedule
+		}
+		return time2.Add(t.Interval), nil
+	case ScheduleTypeDependent:
+		// 由工作流决定什么时候执行
+		return time.Time{}, nil
+	default:
+		return time.Time{}, errs.ErrInvalidSchedule
+	}
+}
+
+// Validate 校验任务的调度配置
+func (t Task) Validate() error {
+	switch t.ScheduleType {
+	case ScheduleTypeCron:
+		if _, err := t.schedule(); err != nil {
+			return errs.ErrInvalidSchedule
+		}
+	case ScheduleTypeOnce:
+		if t.ExecAt.IsZero() {
+			return errs.ErrInvalidSchedule
+		}
+	case ScheduleTypeFixedRate, ScheduleTypeFixedDelay:
+		if t.Interval <= 0 {
+			return errs.ErrInvalidSchedule
+		}
+	case ScheduleTypeDependent:
+	default:
+		return errs.ErrInvalidSchedule
+	}
+	return nil
+}
+
+func (t Task) schedule() (cron.Schedule, error) {
+	exp := t.CronExp
+	if t.Timezone != "" && !strings.HasPrefix(exp, "CRON_TZ=") && !strings.HasPrefix(exp, "TZ=") {
+		exp = "CRON_TZ=" + t.Timezone + " " + exp
+	}
+	s, err := parser.Parse(exp)
 	if err != nil {
-		return time.Time{}, err
+		return nil, err
+	}
+	if spec, ok := s.(*cron.SpecSchedule); ok {
+		return dstSchedule{SpecSchedule: spec}, nil
+	}
+	return s, nil
+}
+
+// dstSchedule 修正 robfig/cron 在夏令时切换时的行为：
+//  1. 时钟拨快时，原本落在被跳过的时间段内的执行，会在切换后立刻执行，而不是被跳过；
+//  2. 时钟拨回时，重复出现的时间段内只执行一次。
+//
+// 和 vixie cron 一样，只对指定了小时的表达式做修正。每个小时都会执行的表达式，本来就是按照真实流逝的时间执行的。
+type dstSchedule struct {
+	*cron.SpecSchedule
+}
+
+func (s dstSchedule) Next(t time.Time) time.Time {
+	next := s.SpecSchedule.Next(t)
+	if next.IsZero() || s.everyHour() {
+		return next
+	}
+	if skipped, ok := s.skippedInGap(t, next); ok {
+		return skipped
+	}
+	// 重复的时间段最多一个小时，这里的循环次数是有限的
+	for s.repeated(next) {
+		next = s.SpecSchedule.Next(next)
+	}
+	return next
+}
+
+func (s dstSchedule) everyHour() bool {
+	const allHours = 1<<24 - 1
+	return s.Hour&allHours == allHours
+}
+
+// skippedInGap 判断 (t, next) 之间有没有因为时钟拨快而被跳过的执行，有的话返回切换的时刻
+func (s dstSchedule) skippedInGap(t, next time.Time) (time.Time, bool) {
+	cur := t.In(s.Location)
+	for {
+		_, end := cur.ZoneBounds()
+		if end.IsZero() || !end.Before(next) {
+			return time.Time{}, false
+		}
+		_, before := cur.Zone()
+		_, after := end.Zone()
+		if after > before {
+			// 被跳过的本地时间，在切换前的时区里对应 [end, end + 拨快的时长) 这个区间
+			spec := *s.SpecSchedule
+			spec.Location = time.FixedZone("", before)
+			from := end.Add(-time.Nanosecond)
+			if from.Before(t) {
+				from = t
+			}
+			m := spec.Next(from)
+			if !m.IsZero() && m.Before(end.Add(time.Duration(after-before)*time.Second)) {
+				return end.In(s.Location), true
+			}
+		}
+		cur = end
+	}
+}
+
+// repeated 判断 next 是不是时钟拨回后第二次出现的本地时间。
+// 这个本地时间第一次出现时已经被调度过了，不需要再执行。
+func (s dstSchedule) repeated(next time.Time) bool {
+	next = next.In(s.Location)
+	start, _ := next.ZoneBounds()
+	if start.IsZero() {
+		return false
+	}
+	_, before := start.Add(-time.Nanosecond).Zone()
+	_, cur := next.Zone()
+	return before > cur && next.Before(start.Add(time.Duration(before-cur)*time.Second))
+}
+
+type MisfireStrategy uint8
+
+const (
+	// MisfireStrategyFireOnce 错过的执行只补执行一次
+	MisfireStrategyFireOnce MisfireStrategy = iota
+	// MisfireStrategyFireAll 依次补执行每一次错过的执行，最多 MaxRuns 次
+	MisfireStrategyFireAll
+	// MisfireStrategySkip 跳过错过的执行，等待下一次执行
+	MisfireStrategySkip
+)
+
+const (
+	DefaultMisfireThreshold = time.Minute
+	DefaultMisfireMaxRuns   = 10
+	// 计算错过的执行次数时最多计算这么多次，避免长时间宕机后执行频率很高的任务计算量过大
+	misfireCountLimit = 10000
+)
+
+// MisfirePolicy 任务错过执行时间后的处理策略。
+// 抢占到任务时，如果距离计划执行时间已经超过 Threshold，就认为错过了执行
+type MisfirePolicy struct {
+	Strategy MisfireStrategy `json:"strategy"`
+	// 小于等于 0 时使用 DefaultMisfireThreshold
+	Threshold time.Duration `json:"threshold"`
+	// MisfireStrategyFireAll 最多补执行的次数，包括错过的第一次执行。小于等于 0 时使用 DefaultMisfireMaxRuns
+	MaxRuns int `json:"maxRuns"`
+}
+
+func (p MisfirePolicy) threshold() time.Duration {
+	if p.Threshold <= 0 {
+		return DefaultMisfireThreshold
+	}
+	return p.Threshold
+}
+
+func (p MisfirePolicy) maxRuns() int {
+	if p.MaxRuns <= 0 {
+		return DefaultMisfireMaxRuns
+	}
+	return p.MaxRuns
+}
+
+// Misfired 计算任务在 now 执行时一共错过了多少次执行，包括计划在 NextExecTime 的这一次。
+// 距离计划执行时间没有超过阈值时不算错过，返回 0
+func (t Task) Misfired(now time.Time) int {
+	if t.NextExecTime.IsZero() || now.Sub(t.NextExecTime) <= t.MisfirePolicy.threshold() {
+		return 0
 	}
-	return s.Next(time2), nil
+	return len(t.missedTimes(now)) + 1
+}
+
+// NextTimeAfterRun 计算本次执行结束后的下一次执行时间。
+// MisfireStrategyFireAll 的任务还有错过的执行没有补上时，返回最早一次需要补执行的时间
+func (t Task) NextTimeAfterRun(now time.Time) (time.Time, error) {
+	if t.MisfirePolicy.Strategy == MisfireStrategyFireAll && t.ScheduleType != ScheduleTypeFixedDelay {
+		missed := t.missedTimes(now)
+		// 本次执行也算一次，剩下的最多补执行 MaxRuns - 1 次，更早的直接跳过
+		if n := t.MisfirePolicy.maxRuns() - 1; len(missed) > n {
+			missed = missed[len(missed)-n:]
+		}
+		if len(missed) > 0 {
+			return missed[0], nil
+		}
+	}
+	return t.NextTime(now)
+}
+
+// missedTimes 返回 NextExecTime 之后，不晚于 now 的计划执行时间
+func (t Task) missedTimes(now time.Time) []time.Time {
+	if t.NextExecTime.IsZero() {
+		return nil
+	}
+	var res []time.Time
+	from := t.NextExecTime
+	for len(res) < misfireCountLimit {
+		next, err := t.NextTime(from)
+		if err != nil || next.IsZero() || next.After(now) {
+			break
+		}
+		res = append(res, next)
+		from = next
+	}
+	return res
+}
+
+// Triggered 本次执行是否是手动触发的
+func (t Task) Triggered() bool {
+	return !t.TriggerTime.IsZero()
+}
+
+// MergeCfg 把手动触发的参数合并到任务配置中，params 中的字段覆盖 cfg 中的同名字段。
+// cfg 和 params 都必须是 JSON 对象，为空时当作空对象处理
+func MergeCfg(cfg, params string) (string, error) {
+	if params == "" {
+		return cfg, nil
+	}
+	res := make(map[string]json.RawMessage)
+	if cfg != "" {
+		if err := json.Unmarshal([]byte(cfg), &res); err != nil {
+			return "", errs.ErrInCorrectConfig
+		}
+	}
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(params), &overrides); err != nil || overrides == nil {
+		return "", errs.ErrInCorrectConfig
+	}
+	for k, v := range overrides {
+		res[k] = v
+	}
+	merged, err := json.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+type ResumePolicy uint8
+
+const (
+	// ResumePolicySkip 跳过暂停期间错过的执行，从恢复的时间开始计算下一次执行时间
+	ResumePolicySkip ResumePolicy = iota
+	// ResumePolicyFireOnce 暂停期间错过了执行的话，恢复后立刻补执行一次
+	ResumePolicyFireOnce
+)
+
+// ResumeTime 计算暂停的任务在 now 恢复后的下一次执行时间。返回零值表示任务不需要再执行了
+func (t Task) ResumeTime(now time.Time, policy ResumePolicy) (time.Time, error) {
+	if policy == ResumePolicyFireOnce && !t.NextExecTime.IsZero() && !t.NextExecTime.After(now) {
+		return now, nil
+	}
+	return t.NextTime(now)
+}
+
+type BackoffType string
+
+const (
+	// BackoffFixed 每次重试的间隔都是 Interval
+	BackoffFixed BackoffType = "fixed"
+	// BackoffExponential 第 n 次重试的间隔是 Interval * 2^(n-1)，不超过 MaxInterval
+	BackoffExponential BackoffType = "exponential"
+)
+
+// RetryPolicy 任务执行失败后的重试策略
+type RetryPolicy struct {
+	// 最大执行次数，包含第一次执行。小于等于 1 表示不重试
+	MaxAttempts int         `json:"maxAttempts"`
+	Backoff     BackoffType `json:"backoff"`
+	// 重试间隔
+	Interval time.Duration `json:"interval"`
+	// 指数退避时重试间隔的上限，小于等于 0 表示没有上限
+	MaxInterval time.Duration `json:"maxInterval"`
+	// 可以重试的执行状态，为空时重试 ExecStatusFailed 和 ExecStatusDeadlineExceeded
+	RetryableStatuses []ExecStatus `json:"retryableStatuses"`
+}
+
+// ShouldRetry 第 attempt 次执行的结果为 status 时，是否需要重试
+func (p RetryPolicy) ShouldRetry(status ExecStatus, attempt int) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	statuses := p.RetryableStatuses
+	if len(statuses) == 0 {
+		statuses = []ExecStatus{ExecStatusFailed, ExecStatusDeadlineExceeded}
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// NextInterval 第 attempt 次执行失败后，到下一次重试的间隔
+func (p RetryPolicy) NextInterval(attempt int) time.Duration {
+	if p.Backoff != BackoffExponential || attempt <= 1 {
+		return p.Interval
+	}
+	interval := p.Interval
+	for i := 1; i < attempt; i++ {
+		interval *= 2
+		if p.MaxInterval > 0 && interval >= p.MaxInterval {
+			return p.MaxInterval
+		}
+	}
+	return interval
 }
 
 type Execution struct {
-	ID       int64
-	Tid      int64
-	Status   ExecStatus
-	Progress uint8
-	Ctime    time.Time
-	Utime    time.Time
+	ID  int64
+	Tid int64
+	// 本次调度的第几次执行，从 1 开始
+	Attempt int
+	// 开始执行时一共错过了多少次执行，没有错过时为 0
+	Misfired    int
+	TriggerType TriggerType
+	Status      ExecStatus
+	Progress    uint8
+	StartTime   time.Time
+	// 执行还没有结束时为零值
+	EndTime time.Time
+	ErrMsg  string
+	// 执行任务的调度节点
+	Node string
+	// 分片所属的执行记录的 id，不是分片时为 0
+	ParentID int64
+	// 分片的序号，从 0 开始
+	ShardIndex int
+	// 分片总数，执行没有分片时为 0
+	ShardTotal int
+	// 最后一次写入执行记录的租约的 fencing token
+	FencingToken int64
+	Ctime        time.Time
+	Utime        time.Time
+}
+
+// Duration 执行时长，执行还没有结束时返回 0
+func (e Execution) Duration() time.Duration {
+	if e.EndTime.IsZero() {
+		return 0
+	}
+	return e.EndTime.Sub(e.StartTime)
+}
+
+// AggregateShards 汇总所有分片的执行情况，返回分片所属的执行的状态和进度。
+// 所有分片都执行结束后才会结束，只有所有分片都执行成功才算成功
+func AggregateShards(shards []Execution) (ExecStatus, uint8) {
+	if len(shards) == 0 {
+		return ExecStatusUnknown, 0
+	}
+	status := ExecStatusSuccess
+	total := 0
+	for _, s := range shards {
+		switch s.Status {
+		case ExecStatusSuccess:
+			total += 100
+			continue
+		case ExecStatusWaiting, ExecStatusRunning:
+			status = ExecStatusRunning
+		default:
+			if status != ExecStatusRunning {
+				status = ExecStatusFailed
+			}
+		}
+		total += int(s.Progress)
+	}
+	return status, uint8(total / len(shards))
+}
+
+type TriggerType uint8
+
+const (
+	// TriggerTypeSchedule 按照调度计划执行
+	TriggerTypeSchedule TriggerType = iota
+	// TriggerTypeManual 手动触发执行
+	TriggerTypeManual
+)
+
+func (t TriggerType) ToUint8() uint8 {
+	return uint8(t)
+}
+
+func (t TriggerType) String() string {
+	switch t {
+	case TriggerTypeSchedule:
+		return "schedule"
+	case TriggerTypeManual:
+		return "manual"
+	default:
+		return "unknown"
+	}
 }
 
 type ExecStatus uint8
@@ -60,6 +539,10 @@ const (
 	ExecStatusFailed
 	ExecStatusDeadlineExceeded
 	ExecStatusCancelled
+	// ExecStatusSkipped 错过了执行时间，按照 MisfireStrategySkip 跳过了本次执行
+	ExecStatusSkipped
+	// ExecStatusWaiting 分片等待调度节点抢占执行
+	ExecStatusWaiting
 )
 
 func (s ExecStatus) ToUint8() uint8 {
@@ -78,6 +561,10 @@ func (s ExecStatus) String() string {
 		return "deadline_exceeded"
 	case ExecStatusCancelled:
 		return "cancelled"
+	case ExecStatusSkipped:
+		return "skipped"
+	case ExecStatusWaiting:
+		return "waiting"
 	default:
 		return "unknown"
 
@@ -2,7 +2,9 @@ package task
 
 import (
 	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"strings"
 	"testing"
 	"time"
@@ -47,3 +49,624 @@ func TestTask_NextTime(t *testing.T) {
 		})
 	}
 }
+
+func TestTask_NextTime_ScheduleType(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		task     Task
+		from     time.Time
+		wantTime time.Time
+		wantErr  error
+	}{
+		{
+			name: "执行一次，还没到执行时间",
+			task: Task{
+				ScheduleType: ScheduleTypeOnce,
+				ExecAt:       now.Add(time.Hour),
+			},
+			from:     now,
+			wantTime: now.Add(time.Hour),
+		},
+		{
+			name: "执行一次，已经过了执行时间",
+			task: Task{
+				ScheduleType: ScheduleTypeOnce,
+				ExecAt:       now.Add(-time.Hour),
+			},
+			from:     now,
+			wantTime: time.Time{},
+		},
+		{
+			name: "固定频率，以计划执行时间为基准",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedRate,
+				Interval:     time.Minute,
+				NextExecTime: now.Add(-10 * time.Second),
+			},
+			from:     now,
+			wantTime: now.Add(50 * time.Second),
+		},
+		{
+			name: "固定频率，执行时间过长，跳过错过的执行时间",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedRate,
+				Interval:     time.Minute,
+				NextExecTime: now.Add(-150 * time.Second),
+			},
+			from:     now,
+			wantTime: now.Add(30 * time.Second),
+		},
+		{
+			name: "固定频率，没有计划执行时间",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedRate,
+				Interval:     time.Minute,
+			},
+			from:     now,
+			wantTime: now.Add(time.Minute),
+		},
+		{
+			name: "固定延迟",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedDelay,
+				Interval:     time.Minute,
+				NextExecTime: now.Add(-time.Hour),
+			},
+			from:     now,
+			wantTime: now.Add(time.Minute),
+		},
+		{
+			name: "固定延迟，间隔不合法",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedDelay,
+			},
+			from:    now,
+			wantErr: errs.ErrInvalidSchedule,
+		},
+		{
+			name: "未知调度方式",
+			task: Task{
+				ScheduleType: ScheduleType(100),
+			},
+			from:    now,
+			wantErr: errs.ErrInvalidSchedule,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.task.NextTime(tc.from)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantTime, res)
+		})
+	}
+}
+
+func TestTask_NextTime_Timezone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	testCases := []struct {
+		name     string
+		cronExp  string
+		timezone string
+		from     time.Time
+		// 依次调用 NextTime 得到的执行时间
+		wantTimes []time.Time
+		wantErr   bool
+	}{
+		{
+			name:     "使用任务的时区",
+			cronExp:  "0 0 8 * * *",
+			timezone: "Asia/Shanghai",
+			from:     time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			wantTimes: []time.Time{
+				time.Date(2024, 6, 2, 8, 0, 0, 0, shanghai),
+				time.Date(2024, 6, 3, 8, 0, 0, 0, shanghai),
+			},
+		},
+		{
+			name:    "CRON_TZ前缀",
+			cronExp: "CRON_TZ=Asia/Shanghai 0 0 8 * * *",
+			from:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			wantTimes: []time.Time{
+				time.Date(2024, 6, 2, 8, 0, 0, 0, shanghai),
+			},
+		},
+		{
+			name:     "CRON_TZ前缀优先于任务的时区",
+			cronExp:  "CRON_TZ=Asia/Shanghai 0 0 8 * * *",
+			timezone: "America/New_York",
+			from:     time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			wantTimes: []time.Time{
+				time.Date(2024, 6, 2, 8, 0, 0, 0, shanghai),
+			},
+		},
+		{
+			name:     "未知时区",
+			cronExp:  "0 0 8 * * *",
+			timezone: "Mars/Olympus",
+			from:     time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			wantErr:  true,
+		},
+		{
+			name:     "夏令时开始，被跳过的执行在切换后立刻执行",
+			cronExp:  "0 30 2 * * *",
+			timezone: "America/New_York",
+			from:     time.Date(2024, 3, 9, 12, 0, 0, 0, newYork),
+			wantTimes: []time.Time{
+				// 2024-03-10 02:00 EST 拨快到 03:00 EDT，当天没有 02:30
+				time.Date(2024, 3, 10, 3, 0, 0, 0, newYork),
+				time.Date(2024, 3, 11, 2, 30, 0, 0, newYork),
+			},
+		},
+		{
+			name:     "夏令时开始，没有落在跳过时间段内的执行不受影响",
+			cronExp:  "0 30 1,3 * * *",
+			timezone: "America/New_York",
+			from:     time.Date(2024, 3, 10, 0, 0, 0, 0, newYork),
+			wantTimes: []time.Time{
+				time.Date(2024, 3, 10, 1, 30, 0, 0, newYork),
+				time.Date(2024, 3, 10, 3, 30, 0, 0, newYork),
+				time.Date(2024, 3, 11, 1, 30, 0, 0, newYork),
+			},
+		},
+		{
+			name:     "夏令时结束，重复出现的时间只执行一次",
+			cronExp:  "0 30 1 * * *",
+			timezone: "America/New_York",
+			from:     time.Date(2024, 11, 2, 12, 0, 0, 0, newYork),
+			wantTimes: []time.Time{
+				// 2024-11-03 02:00 EDT 拨回到 01:00 EST，01:30 出现了两次
+				time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC),
+				time.Date(2024, 11, 4, 1, 30, 0, 0, newYork),
+			},
+		},
+		{
+			name:     "夏令时结束，每小时执行的任务按照真实时间执行",
+			cronExp:  "0 0 * * * *",
+			timezone: "America/New_York",
+			from:     time.Date(2024, 11, 3, 0, 30, 0, 0, newYork),
+			wantTimes: []time.Time{
+				time.Date(2024, 11, 3, 5, 0, 0, 0, time.UTC),
+				time.Date(2024, 11, 3, 6, 0, 0, 0, time.UTC),
+				time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task := Task{
+				CronExp:  tc.cronExp,
+				Timezone: tc.timezone,
+			}
+			from := tc.from
+			if tc.wantErr {
+				_, err := task.NextTime(from)
+				assert.Error(t, err)
+				return
+			}
+			for _, want := range tc.wantTimes {
+				next, err := task.NextTime(from)
+				require.NoError(t, err)
+				assert.True(t, want.Equal(next), "want %s, got %s", want, next)
+				from = next
+			}
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		policy      RetryPolicy
+		status      ExecStatus
+		attempt     int
+		wantRetry   bool
+		wantBackoff time.Duration
+	}{
+		{
+			name:      "没有配置重试",
+			policy:    RetryPolicy{},
+			status:    ExecStatusFailed,
+			attempt:   1,
+			wantRetry: false,
+		},
+		{
+			name: "默认重试失败的执行",
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     BackoffFixed,
+				Interval:    time.Second,
+			},
+			status:      ExecStatusFailed,
+			attempt:     2,
+			wantRetry:   true,
+			wantBackoff: time.Second,
+		},
+		{
+			name: "默认重试超时的执行",
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				Interval:    time.Second,
+			},
+			status:      ExecStatusDeadlineExceeded,
+			attempt:     1,
+			wantRetry:   true,
+			wantBackoff: time.Second,
+		},
+		{
+			name: "默认不重试取消的执行",
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+			},
+			status:    ExecStatusCancelled,
+			attempt:   1,
+			wantRetry: false,
+		},
+		{
+			name: "达到最大执行次数",
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+			},
+			status:    ExecStatusFailed,
+			attempt:   3,
+			wantRetry: false,
+		},
+		{
+			name: "只重试指定的状态",
+			policy: RetryPolicy{
+				MaxAttempts:       3,
+				RetryableStatuses: []ExecStatus{ExecStatusDeadlineExceeded},
+			},
+			status:    ExecStatusFailed,
+			attempt:   1,
+			wantRetry: false,
+		},
+		{
+			name: "指数退避",
+			policy: RetryPolicy{
+				MaxAttempts: 5,
+				Backoff:     BackoffExponential,
+				Interval:    time.Second,
+			},
+			status:      ExecStatusFailed,
+			attempt:     3,
+			wantRetry:   true,
+			wantBackoff: 4 * time.Second,
+		},
+		{
+			name: "指数退避，不超过最大间隔",
+			policy: RetryPolicy{
+				MaxAttempts: 10,
+				Backoff:     BackoffExponential,
+				Interval:    time.Second,
+				MaxInterval: 5 * time.Second,
+			},
+			status:      ExecStatusFailed,
+			attempt:     6,
+			wantRetry:   true,
+			wantBackoff: 5 * time.Second,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantRetry, tc.policy.ShouldRetry(tc.status, tc.attempt))
+			if tc.wantRetry {
+				assert.Equal(t, tc.wantBackoff, tc.policy.NextInterval(tc.attempt))
+			}
+		})
+	}
+}
+
+func TestTask_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		task    Task
+		wantErr error
+	}{
+		{
+			name: "合法的cron表达式",
+			task: Task{CronExp: "0 0 8 * * *", Timezone: "Asia/Shanghai"},
+		},
+		{
+			name:    "非法的cron表达式",
+			task:    Task{CronExp: "*/5 * * *"},
+			wantErr: errs.ErrInvalidSchedule,
+		},
+		{
+			name:    "非法的时区",
+			task:    Task{CronExp: "0 0 8 * * *", Timezone: "Mars/Olympus"},
+			wantErr: errs.ErrInvalidSchedule,
+		},
+		{
+			name:    "执行一次的任务没有执行时间",
+			task:    Task{ScheduleType: ScheduleTypeOnce},
+			wantErr: errs.ErrInvalidSchedule,
+		},
+		{
+			name: "执行一次",
+			task: Task{ScheduleType: ScheduleTypeOnce, ExecAt: time.Now()},
+		},
+		{
+			name:    "固定频率没有间隔",
+			task:    Task{ScheduleType: ScheduleTypeFixedRate},
+			wantErr: errs.ErrInvalidSchedule,
+		},
+		{
+			name: "固定延迟",
+			task: Task{ScheduleType: ScheduleTypeFixedDelay, Interval: time.Second},
+		},
+		{
+			name:    "未知的调度方式",
+			task:    Task{ScheduleType: ScheduleType(100)},
+			wantErr: errs.ErrInvalidSchedule,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantErr, tc.task.Validate())
+		})
+	}
+}
+
+func TestTask_ResumeTime(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name     string
+		task     Task
+		policy   ResumePolicy
+		wantTime time.Time
+	}{
+		{
+			name: "跳过错过的执行",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedDelay,
+				Interval:     time.Minute,
+				NextExecTime: now.Add(-time.Hour),
+			},
+			policy:   ResumePolicySkip,
+			wantTime: now.Add(time.Minute),
+		},
+		{
+			name: "错过了执行，立刻补执行一次",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedDelay,
+				Interval:     time.Minute,
+				NextExecTime: now.Add(-time.Hour),
+			},
+			policy:   ResumePolicyFireOnce,
+			wantTime: now,
+		},
+		{
+			name: "没有错过执行",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedRate,
+				Interval:     time.Minute,
+				NextExecTime: now.Add(time.Second),
+			},
+			policy:   ResumePolicyFireOnce,
+			wantTime: now.Add(time.Second),
+		},
+		{
+			name: "错过了执行时间的一次性任务",
+			task: Task{
+				ScheduleType: ScheduleTypeOnce,
+				ExecAt:       now.Add(-time.Hour),
+				NextExecTime: now.Add(-time.Hour),
+			},
+			policy: ResumePolicySkip,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next, err := tc.task.ResumeTime(now, tc.policy)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantTime, next)
+		})
+	}
+}
+
+func TestTask_Misfired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+	testCases := []struct {
+		name       string
+		task       Task
+		wantMissed int
+	}{
+		{
+			name: "没有超过阈值",
+			task: Task{
+				ScheduleType: ScheduleTypeFixedRate,
+				Interval:     time.Minute,
+				NextExecTime: now.Add(-30 * time.Second),
+			},
+		},
+		{
+			name: "错过了多次执行",
+			task: Task{
+				CronExp:      "0 * * * * *",
+				Timezone:     "UTC",
+				NextExecTime: now.Add(-5*time.Minute - 30*time.Second),
+			},
+			wantMissed: 6,
+		},
+		{
+			name: "自定义阈值",
+			task: Task{
+				ScheduleType:  ScheduleTypeFixedRate,
+				Interval:      time.Minute,
+				NextExecTime:  now.Add(-30 * time.Second),
+				MisfirePolicy: MisfirePolicy{Threshold: 10 * time.Second},
+			},
+			wantMissed: 1,
+		},
+		{
+			name: "一次性任务",
+			task: Task{
+				ScheduleType: ScheduleTypeOnce,
+				ExecAt:       now.Add(-time.Hour),
+				NextExecTime: now.Add(-time.Hour),
+			},
+			wantMissed: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantMissed, tc.task.Misfired(now))
+		})
+	}
+}
+
+func TestTask_NextTimeAfterRun(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		task     Task
+		wantTime time.Time
+	}{
+		{
+			name: "补执行一次，从当前时间计算下一次执行时间",
+			task: Task{
+				CronExp:      "0 * * * * *",
+				Timezone:     "UTC",
+				NextExecTime: now.Add(-5*time.Minute - 30*time.Second),
+			},
+			wantTime: now.Add(30 * time.Second),
+		},
+		{
+			name: "依次补执行错过的执行",
+			task: Task{
+				CronExp:       "0 * * * * *",
+				Timezone:      "UTC",
+				NextExecTime:  now.Add(-5*time.Minute - 30*time.Second),
+				MisfirePolicy: MisfirePolicy{Strategy: MisfireStrategyFireAll},
+			},
+			wantTime: now.Add(-4*time.Minute - 30*time.Second),
+		},
+		{
+			name: "补执行的次数超过上限，跳过更早的执行",
+			task: Task{
+				CronExp:       "0 * * * * *",
+				Timezone:      "UTC",
+				NextExecTime:  now.Add(-5*time.Minute - 30*time.Second),
+				MisfirePolicy: MisfirePolicy{Strategy: MisfireStrategyFireAll, MaxRuns: 3},
+			},
+			wantTime: now.Add(-time.Minute - 30*time.Second),
+		},
+		{
+			name: "已经补执行完了",
+			task: Task{
+				CronExp:       "0 * * * * *",
+				Timezone:      "UTC",
+				NextExecTime:  now.Add(-30 * time.Second),
+				MisfirePolicy: MisfirePolicy{Strategy: MisfireStrategyFireAll},
+			},
+			wantTime: now.Add(30 * time.Second),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next, err := tc.task.NextTimeAfterRun(now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantTime, next)
+		})
+	}
+}
+
+func TestMergeCfg(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     string
+		params  string
+		wantCfg string
+		wantErr error
+	}{
+		{
+			name:    "没有参数",
+			cfg:     `{"url":"http://localhost:8080/test"}`,
+			wantCfg: `{"url":"http://localhost:8080/test"}`,
+		},
+		{
+			name:    "覆盖同名字段",
+			cfg:     `{"url":"http://localhost:8080/test","body":"{}"}`,
+			params:  `{"body":"{\"id\":1}","timeout":1000}`,
+			wantCfg: `{"body":"{\"id\":1}","timeout":1000,"url":"http://localhost:8080/test"}`,
+		},
+		{
+			name:    "配置为空",
+			params:  `{"name":"test"}`,
+			wantCfg: `{"name":"test"}`,
+		},
+		{
+			name:    "参数不是JSON对象",
+			cfg:     `{"url":"http://localhost:8080/test"}`,
+			params:  `[1,2]`,
+			wantErr: errs.ErrInCorrectConfig,
+		},
+		{
+			name:    "配置不是JSON对象",
+			cfg:     `abc`,
+			params:  `{"name":"test"}`,
+			wantErr: errs.ErrInCorrectConfig,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := MergeCfg(tc.cfg, tc.params)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCfg, cfg)
+		})
+	}
+}
+
+func TestAggregateShards(t *testing.T) {
+	testCases := []struct {
+		name         string
+		shards       []Execution
+		wantStatus   ExecStatus
+		wantProgress uint8
+	}{
+		{
+			name: "还有分片没有执行结束",
+			shards: []Execution{
+				{Status: ExecStatusSuccess},
+				{Status: ExecStatusRunning, Progress: 50},
+				{Status: ExecStatusWaiting},
+				{Status: ExecStatusFailed, Progress: 10},
+			},
+			wantStatus:   ExecStatusRunning,
+			wantProgress: 40,
+		},
+		{
+			name: "所有分片执行成功",
+			shards: []Execution{
+				{Status: ExecStatusSuccess},
+				{Status: ExecStatusSuccess, Progress: 100},
+			},
+			wantStatus:   ExecStatusSuccess,
+			wantProgress: 100,
+		},
+		{
+			name: "有分片执行失败",
+			shards: []Execution{
+				{Status: ExecStatusSuccess},
+				{Status: ExecStatusDeadlineExceeded, Progress: 60},
+			},
+			wantStatus:   ExecStatusFailed,
+			wantProgress: 80,
+		},
+		{
+			name:       "没有分片",
+			wantStatus: ExecStatusUnknown,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, progress := AggregateShards(tc.shards)
+			assert.Equal(t, tc.wantStatus, status)
+			assert.Equal(t, tc.wantProgress, progress)
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package task
+
+import (
+	"github.com/ecodeclub/ecron/internal/errs"
+	"time"
+)
+
+// Workflow 由多个任务组成的有向无环图。
+// 根节点按照自己的调度计划执行，下游节点使用 ScheduleTypeDependent，上游节点全部执行结束后才会执行
+type Workflow struct {
+	ID    int64
+	Name  string
+	Nodes []WorkflowNode
+	Ctime time.Time
+	Utime time.Time
+}
+
+type WorkflowNode struct {
+	Tid int64
+	// 上游任务的 id，为空表示根节点
+	Upstreams []int64
+	// 上游任务没有全部执行成功时的处理策略
+	FailurePolicy FailurePolicy
+}
+
+type FailurePolicy uint8
+
+const (
+	// FailurePolicySkip 跳过当前节点，当前节点的下游节点按照各自的策略处理
+	FailurePolicySkip FailurePolicy = iota
+	// FailurePolicyHalt 停止整个工作流，不再执行任何节点
+	FailurePolicyHalt
+	// FailurePolicyRunAnyway 依旧执行当前节点
+	FailurePolicyRunAnyway
+)
+
+// Node 查询任务对应的节点
+func (w Workflow) Node(tid int64) (WorkflowNode, bool) {
+	for _, n := range w.Nodes {
+		if n.Tid == tid {
+			return n, true
+		}
+	}
+	return WorkflowNode{}, false
+}
+
+// Downstreams 查询直接依赖 tid 的下游节点
+func (w Workflow) Downstreams(tid int64) []WorkflowNode {
+	var res []WorkflowNode
+	for _, n := range w.Nodes {
+		for _, up := range n.Upstreams {
+			if up == tid {
+				res = append(res, n)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Validate 校验工作流的节点，上游节点必须在工作流中，并且不能有环
+func (w Workflow) Validate() error {
+	if w.Name == "" || len(w.Nodes) == 0 {
+		return errs.ErrInvalidWorkflow
+	}
+	// 每个节点还没有处理的上游节点数量
+	indegree := make(map[int64]int, len(w.Nodes))
+	for _, n := range w.Nodes {
+		if _, ok := indegree[n.Tid]; ok {
+			return errs.ErrInvalidWorkflow
+		}
+		indegree[n.Tid] = len(n.Upstreams)
+	}
+	var queue []int64
+	for _, n := range w.Nodes {
+		for _, up := range n.Upstreams {
+			if _, ok := indegree[up]; !ok || up == n.Tid {
+				return errs.ErrInvalidWorkflow
+			}
+		}
+		if len(n.Upstreams) == 0 {
+			queue = append(queue, n.Tid)
+		}
+	}
+	// 拓扑排序，能够访问到所有节点说明没有环
+	visited := 0
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, n := range w.Downstreams(cur) {
+			indegree[n.Tid]--
+			if indegree[n.Tid] == 0 {
+				queue = append(queue, n.Tid)
+			}
+		}
+	}
+	if visited != len(w.Nodes) {
+		return errs.ErrInvalidWorkflow
+	}
+	return nil
+}
+
+type WorkflowRunStatus uint8
+
+const (
+	WorkflowRunStatusUnknown WorkflowRunStatus = iota
+	WorkflowRunStatusRunning
+	// WorkflowRunStatusSuccess 所有节点都执行成功
+	WorkflowRunStatusSuccess
+	// WorkflowRunStatusFailed 所有节点都执行结束，但是有节点没有执行成功
+	WorkflowRunStatusFailed
+	// WorkflowRunStatusHalted 有节点按照 FailurePolicyHalt 停止了工作流
+	WorkflowRunStatusHalted
+)
+
+func (s WorkflowRunStatus) ToUint8() uint8 {
+	return uint8(s)
+}
+
+func (s WorkflowRunStatus) String() string {
+	switch s {
+	case WorkflowRunStatusRunning:
+		return "running"
+	case WorkflowRunStatusSuccess:
+		return "success"
+	case WorkflowRunStatusFailed:
+		return "failed"
+	case WorkflowRunStatusHalted:
+		return "halted"
+	default:
+		return "unknown"
+	}
+}
+
+// WorkflowRun 工作流的一次运行，从根节点执行结束开始，到所有节点执行结束或者工作流被停止为止
+type WorkflowRun struct {
+	ID     int64
+	Wid    int64
+	Status WorkflowRunStatus
+	// 每个节点的执行状态，key 是任务 id。
+	// 已经可以执行但是还没有执行结束的节点为 ExecStatusRunning，还没有轮到的节点不在里面
+	Nodes     map[int64]ExecStatus
+	StartTime time.Time
+	// 运行还没有结束时为零值
+	EndTime time.Time
+	// 用于实现乐观锁，每次更新加一
+	Version int64
+}
+
+// Advance 记录节点 tid 执行结束的状态，推进工作流，返回可以开始执行的下游节点。
+// 运行结束时会更新 Status 和 EndTime
+func (r *WorkflowRun) Advance(w Workflow, tid int64, status ExecStatus, now time.Time) []int64 {
+	if r.Status != WorkflowRunStatusRunning {
+		return nil
+	}
+	if r.Nodes == nil {
+		r.Nodes = make(map[int64]ExecStatus, len(w.Nodes))
+	}
+	r.Nodes[tid] = status
+	var ready []int64
+	// 被跳过的节点也算执行结束，需要继续处理它的下游节点
+	finished := []int64{tid}
+	for len(finished) > 0 {
+		cur := finished[0]
+		finished = finished[1:]
+		for _, n := range w.Downstreams(cur) {
+			if _, ok := r.Nodes[n.Tid]; ok {
+				continue
+			}
+			done, success := r.upstreamsDone(n)
+			if !done {
+				continue
+			}
+			switch {
+			case success || n.FailurePolicy == FailurePolicyRunAnyway:
+				r.Nodes[n.Tid] = ExecStatusRunning
+				ready = append(ready, n.Tid)
+			case n.FailurePolicy == FailurePolicyHalt:
+				// 已经标记为可以执行的节点也不再执行
+				for _, id := range ready {
+					delete(r.Nodes, id)
+				}
+				r.finish(WorkflowRunStatusHalted, now)
+				return nil
+			default:
+				r.Nodes[n.Tid] = ExecStatusSkipped
+				finished = append(finished, n.Tid)
+			}
+		}
+	}
+	r.tryFinish(w, now)
+	return ready
+}
+
+// upstreamsDone 返回节点的上游节点是否都已经执行结束，以及是否都执行成功
+func (r *WorkflowRun) upstreamsDone(n WorkflowNode) (bool, bool) {
+	success := true
+	for _, up := range n.Upstreams {
+		s, ok := r.Nodes[up]
+		if !ok || s == ExecStatusRunning {
+			return false, false
+		}
+		success = success && s == ExecStatusSuccess
+	}
+	return true, success
+}
+
+// tryFinish 所有节点都执行结束时，结束本次运行
+func (r *WorkflowRun) tryFinish(w Workflow, now time.Time) {
+	status := WorkflowRunStatusSuccess
+	for _, n := range w.Nodes {
+		s, ok := r.Nodes[n.Tid]
+		if !ok || s == ExecStatusRunning {
+			return
+		}
+		if s != ExecStatusSuccess {
+			status = WorkflowRunStatusFailed
+		}
+	}
+	r.finish(status, now)
+}
+
+func (r *WorkflowRun) finish(status WorkflowRunStatus, now time.Time) {
+	r.Status = status
+	r.EndTime = now
+}
@@ -0,0 +1,153 @@
+package task
+
+import (
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWorkflow_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		nodes   []WorkflowNode
+		wantErr error
+	}{
+		{
+			name: "合法的工作流",
+			nodes: []WorkflowNode{
+				{Tid: 1},
+				{Tid: 2, Upstreams: []int64{1}},
+				{Tid: 3, Upstreams: []int64{1, 2}},
+			},
+		},
+		{
+			name:    "没有节点",
+			wantErr: errs.ErrInvalidWorkflow,
+		},
+		{
+			name: "重复的节点",
+			nodes: []WorkflowNode{
+				{Tid: 1},
+				{Tid: 1},
+			},
+			wantErr: errs.ErrInvalidWorkflow,
+		},
+		{
+			name: "上游节点不在工作流中",
+			nodes: []WorkflowNode{
+				{Tid: 1},
+				{Tid: 2, Upstreams: []int64{3}},
+			},
+			wantErr: errs.ErrInvalidWorkflow,
+		},
+		{
+			name: "有环",
+			nodes: []WorkflowNode{
+				{Tid: 1},
+				{Tid: 2, Upstreams: []int64{1, 3}},
+				{Tid: 3, Upstreams: []int64{2}},
+			},
+			wantErr: errs.ErrInvalidWorkflow,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := Workflow{Name: "test", Nodes: tc.nodes}
+			assert.Equal(t, tc.wantErr, w.Validate())
+		})
+	}
+}
+
+func TestWorkflowRun_Advance(t *testing.T) {
+	now := time.Now()
+	// 1 -> 2 -> 4
+	// 1 -> 3 -> 4
+	newWorkflow := func(policy FailurePolicy) Workflow {
+		return Workflow{
+			Nodes: []WorkflowNode{
+				{Tid: 1},
+				{Tid: 2, Upstreams: []int64{1}, FailurePolicy: policy},
+				{Tid: 3, Upstreams: []int64{1}, FailurePolicy: policy},
+				{Tid: 4, Upstreams: []int64{2, 3}, FailurePolicy: policy},
+			},
+		}
+	}
+	testCases := []struct {
+		name      string
+		workflow  Workflow
+		nodes     map[int64]ExecStatus
+		tid       int64
+		status    ExecStatus
+		wantReady []int64
+		wantNodes map[int64]ExecStatus
+		wantRun   WorkflowRunStatus
+	}{
+		{
+			name:      "上游执行成功",
+			workflow:  newWorkflow(FailurePolicySkip),
+			tid:       1,
+			status:    ExecStatusSuccess,
+			wantReady: []int64{2, 3},
+			wantNodes: map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusRunning, 3: ExecStatusRunning},
+			wantRun:   WorkflowRunStatusRunning,
+		},
+		{
+			name:      "还有上游没有执行结束",
+			workflow:  newWorkflow(FailurePolicySkip),
+			nodes:     map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusRunning, 3: ExecStatusRunning},
+			tid:       2,
+			status:    ExecStatusSuccess,
+			wantNodes: map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusSuccess, 3: ExecStatusRunning},
+			wantRun:   WorkflowRunStatusRunning,
+		},
+		{
+			name:      "所有节点执行成功",
+			workflow:  newWorkflow(FailurePolicySkip),
+			nodes:     map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusSuccess, 3: ExecStatusSuccess, 4: ExecStatusRunning},
+			tid:       4,
+			status:    ExecStatusSuccess,
+			wantNodes: map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusSuccess, 3: ExecStatusSuccess, 4: ExecStatusSuccess},
+			wantRun:   WorkflowRunStatusSuccess,
+		},
+		{
+			name:      "上游失败，跳过所有下游",
+			workflow:  newWorkflow(FailurePolicySkip),
+			tid:       1,
+			status:    ExecStatusFailed,
+			wantNodes: map[int64]ExecStatus{1: ExecStatusFailed, 2: ExecStatusSkipped, 3: ExecStatusSkipped, 4: ExecStatusSkipped},
+			wantRun:   WorkflowRunStatusFailed,
+		},
+		{
+			name:      "上游失败，停止工作流",
+			workflow:  newWorkflow(FailurePolicyHalt),
+			nodes:     map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusSuccess, 3: ExecStatusRunning},
+			tid:       3,
+			status:    ExecStatusFailed,
+			wantNodes: map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusSuccess, 3: ExecStatusFailed},
+			wantRun:   WorkflowRunStatusHalted,
+		},
+		{
+			name:      "上游失败，依旧执行",
+			workflow:  newWorkflow(FailurePolicyRunAnyway),
+			nodes:     map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusSuccess, 3: ExecStatusRunning},
+			tid:       3,
+			status:    ExecStatusFailed,
+			wantReady: []int64{4},
+			wantNodes: map[int64]ExecStatus{1: ExecStatusSuccess, 2: ExecStatusSuccess, 3: ExecStatusFailed, 4: ExecStatusRunning},
+			wantRun:   WorkflowRunStatusRunning,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := WorkflowRun{Status: WorkflowRunStatusRunning, Nodes: tc.nodes}
+			ready := r.Advance(tc.workflow, tc.tid, tc.status, now)
+			assert.Equal(t, tc.wantReady, ready)
+			assert.Equal(t, tc.wantNodes, r.Nodes)
+			assert.Equal(t, tc.wantRun, r.Status)
+			if tc.wantRun != WorkflowRunStatusRunning {
+				assert.Equal(t, now, r.EndTime)
+			}
+		})
+	}
+}
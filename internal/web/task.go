@@ -0,0 +1,339 @@
+package web
+
+import (
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/executor"
+	"github.com/ecodeclub/ecron/internal/scheduler"
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// TaskHandler 任务管理的接口
+type TaskHandler struct {
+	repo         storage.TaskCfgRepository
+	executionDAO storage.ExecutionDAO
+	// 暂停和恢复任务，本节点正在执行的任务可以立刻停止
+	sche *scheduler.PreemptScheduler
+	// 用于校验任务配置，key 是执行器的名称
+	executors map[string]executor.Executor
+	logger    *slog.Logger
+}
+
+func NewTaskHandler(repo storage.TaskCfgRepository, executionDAO storage.ExecutionDAO, sche *scheduler.PreemptScheduler,
+	logger *slog.Logger, execs ...executor.Executor) *TaskHandler {
+	h := &TaskHandler{
+		repo:         repo,
+		executionDAO: executionDAO,
+		sche:         sche,
+		executors:    make(map[string]executor.Executor, len(execs)),
+		logger:       logger,
+	}
+	for _, exec := range execs {
+		h.executors[exec.Name()] = exec
+	}
+	return h
+}
+
+func (h *TaskHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/tasks")
+	g.POST("", h.Create)
+	g.GET("", h.List)
+	g.GET("/:id", h.Get)
+	g.PUT("/:id", h.Update)
+	g.DELETE("/:id", h.Delete)
+	g.POST("/:id/pause", h.Pause)
+	g.POST("/:id/resume", h.Resume)
+	g.POST("/:id/trigger", h.Trigger)
+	g.GET("/:id/executions", h.ListExecutions)
+	g.GET("/:id/executions/:eid/shards", h.ListShards)
+}
+
+func (h *TaskHandler) Create(ctx *gin.Context) {
+	var req TaskReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, Result{Msg: "参数错误"})
+		return
+	}
+	t := req.toTask()
+	if err := h.prepare(&t); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	id, err := h.repo.Add(ctx, t)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: id})
+}
+
+func (h *TaskHandler) Update(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	var req TaskReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, Result{Msg: "参数错误"})
+		return
+	}
+	t := req.toTask()
+	t.ID = id
+	if err := h.prepare(&t); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if err := h.repo.Update(ctx, t); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+func (h *TaskHandler) Delete(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(ctx, id); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+func (h *TaskHandler) Get(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	t, err := h.repo.Get(ctx, id)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: newTaskVO(t)})
+}
+
+func (h *TaskHandler) List(ctx *gin.Context) {
+	offset, limit := pageParams(ctx)
+	ts, total, err := h.repo.List(ctx, offset, limit)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	res := ListResp[TaskVO]{Total: total, List: make([]TaskVO, 0, len(ts))}
+	for _, t := range ts {
+		res.List = append(res.List, newTaskVO(t))
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: res})
+}
+
+// Pause 暂停任务，stop=true 时会停止正在执行的任务
+func (h *TaskHandler) Pause(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	stop, _ := strconv.ParseBool(ctx.Query("stop"))
+	if err := h.sche.Pause(ctx, id, stop); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Resume 恢复任务，policy=fire_once 时暂停期间错过的执行会立刻补执行一次，默认跳过
+func (h *TaskHandler) Resume(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	policy := task.ResumePolicySkip
+	if ctx.Query("policy") == "fire_once" {
+		policy = task.ResumePolicyFireOnce
+	}
+	if err := h.sche.Resume(ctx, id, policy); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Trigger 让任务立刻执行一次，不影响任务原本的调度计划。
+// 请求体中的 params 会覆盖本次执行的任务配置，正在执行的任务会在本次执行结束后再执行
+func (h *TaskHandler) Trigger(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	var req TriggerReq
+	if ctx.Request.Body != nil && ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, Result{Msg: "参数错误"})
+			return
+		}
+	}
+	t, err := h.repo.Get(ctx, id)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if t.LastStatus != task.TaskStatusWaiting && t.LastStatus != task.TaskStatusRunning {
+		writeError(ctx, h.logger, errs.ErrInvalidTaskStatus)
+		return
+	}
+	params := string(req.Params)
+	if err = h.validateParams(t, params); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if err = h.repo.Trigger(ctx, id, params); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// ListExecutions 查询任务的执行记录，可以通过 start 和 end 两个毫秒时间戳限定开始执行的时间
+func (h *TaskHandler) ListExecutions(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	offset, limit := pageParams(ctx)
+	q := storage.ExecutionQuery{Offset: offset, Limit: limit}
+	if start, err := strconv.ParseInt(ctx.Query("start"), 10, 64); err == nil && start > 0 {
+		q.Start = time.UnixMilli(start)
+	}
+	if end, err := strconv.ParseInt(ctx.Query("end"), 10, 64); err == nil && end > 0 {
+		q.End = time.UnixMilli(end)
+	}
+	execs, total, err := h.executionDAO.ListByTask(ctx, id, q)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	res := ListResp[ExecutionVO]{Total: total, List: make([]ExecutionVO, 0, len(execs))}
+	for _, e := range execs {
+		res.List = append(res.List, newExecutionVO(e))
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: res})
+}
+
+// ListShards 查询执行记录的所有分片
+func (h *TaskHandler) ListShards(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	eid, err := strconv.ParseInt(ctx.Param("eid"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, Result{Msg: "执行记录 id 错误"})
+		return
+	}
+	shards, err := h.executionDAO.ListShards(ctx, eid)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	res := make([]ExecutionVO, 0, len(shards))
+	for _, s := range shards {
+		// 执行记录不属于这个任务时返回空列表
+		if s.Tid == id {
+			res = append(res, newExecutionVO(s))
+		}
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: res})
+}
+
+// prepare 校验任务的调度方式和执行器配置，并计算下一次执行时间
+func (h *TaskHandler) prepare(t *task.Task) error {
+	if t.Name == "" || t.ShardCount < 0 {
+		return errs.ErrInCorrectConfig
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	exec, ok := h.executors[t.Executor]
+	if !ok {
+		return errs.ErrUnknownExecutor
+	}
+	if err := exec.Validate(*t); err != nil {
+		return err
+	}
+	next, err := t.NextTime(time.Now())
+	if err != nil {
+		return err
+	}
+	t.NextExecTime = next
+	return nil
+}
+
+// validateParams 校验手动触发的参数合并到任务配置后，执行器能不能正常执行
+func (h *TaskHandler) validateParams(t task.Task, params string) error {
+	if params == "" {
+		return nil
+	}
+	cfg, err := task.MergeCfg(t.Cfg, params)
+	if err != nil {
+		return err
+	}
+	exec, ok := h.executors[t.Executor]
+	if !ok {
+		return errs.ErrUnknownExecutor
+	}
+	t.Cfg = cfg
+	return exec.Validate(t)
+}
+
+func paramID(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, Result{Msg: "任务 id 错误"})
+		return 0, false
+	}
+	return id, true
+}
+
+func pageParams(ctx *gin.Context) (int, int) {
+	offset, _ := strconv.Atoi(ctx.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	limit, err := strconv.Atoi(ctx.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return offset, limit
+}
+
+func writeError(ctx *gin.Context, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, errs.ErrTaskNotFound), errors.Is(err, errs.ErrWorkflowNotFound):
+		ctx.JSON(http.StatusNotFound, Result{Msg: err.Error()})
+	case errors.Is(err, errs.ErrInvalidTaskStatus):
+		ctx.JSON(http.StatusConflict, Result{Msg: err.Error()})
+	case errors.Is(err, errs.ErrInvalidSchedule), errors.Is(err, errs.ErrInCorrectConfig),
+		errors.Is(err, errs.ErrUnknownExecutor), errors.Is(err, errs.ErrUnknownTask),
+		errors.Is(err, errs.ErrInvalidWorkflow):
+		ctx.JSON(http.StatusBadRequest, Result{Msg: err.Error()})
+	default:
+		logger.Error("处理请求失败", slog.String("path", ctx.FullPath()), slog.Any("error", err))
+		ctx.JSON(http.StatusInternalServerError, Result{Msg: "系统错误"})
+	}
+}
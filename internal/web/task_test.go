@@ -0,0 +1,436 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/executor"
+	"github.com/ecodeclub/ecron/internal/scheduler"
+	"github.com/ecodeclub/ecron/internal/storage"
+	daomocks "github.com/ecodeclub/ecron/internal/storage/mocks"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/sync/semaphore"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskHandler_Create(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mock     func(ctrl *gomock.Controller) storage.TaskCfgRepository
+		req      TaskReq
+		wantCode int
+		wantRes  Result
+	}{
+		{
+			name: "创建成功",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				// 创建任务时会计算下一次执行时间
+				repo.EXPECT().Add(gomock.Any(), gomock.Cond(func(x any) bool {
+					return x.(task.Task).Name == "test" && !x.(task.Task).NextExecTime.IsZero()
+				})).Return(int64(1), nil)
+				return repo
+			},
+			req: TaskReq{
+				Name:     "test",
+				Executor: "HTTP",
+				Cfg:      `{"url":"http://localhost:8080/test"}`,
+				CronExp:  "0 0 8 * * *",
+			},
+			wantCode: http.StatusOK,
+			wantRes:  Result{Msg: "OK", Data: float64(1)},
+		},
+		{
+			name: "cron表达式错误",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				return daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			req: TaskReq{
+				Name:     "test",
+				Executor: "HTTP",
+				Cfg:      `{"url":"http://localhost:8080/test"}`,
+				CronExp:  "*/5 * * *",
+			},
+			wantCode: http.StatusBadRequest,
+			wantRes:  Result{Msg: errs.ErrInvalidSchedule.Error()},
+		},
+		{
+			name: "未知的执行器",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				return daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			req: TaskReq{
+				Name:     "test",
+				Executor: "UNKNOWN",
+				CronExp:  "0 0 8 * * *",
+			},
+			wantCode: http.StatusBadRequest,
+			wantRes:  Result{Msg: errs.ErrUnknownExecutor.Error()},
+		},
+		{
+			name: "执行器配置错误",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				return daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			req: TaskReq{
+				Name:     "test",
+				Executor: "HTTP",
+				Cfg:      `{"body":"{}"}`,
+				CronExp:  "0 0 8 * * *",
+			},
+			wantCode: http.StatusBadRequest,
+			wantRes:  Result{Msg: errs.ErrInCorrectConfig.Error()},
+		},
+		{
+			name: "数据库错误",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Add(gomock.Any(), gomock.Any()).
+					Return(int64(0), errors.New("mock db error"))
+				return repo
+			},
+			req: TaskReq{
+				Name:     "test",
+				Executor: "HTTP",
+				Cfg:      `{"url":"http://localhost:8080/test"}`,
+				CronExp:  "0 0 8 * * *",
+			},
+			wantCode: http.StatusInternalServerError,
+			wantRes:  Result{Msg: "系统错误"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			server := newServer(tc.mock(ctrl), daomocks.NewMockExecutionDAO(ctrl))
+
+			body, err := json.Marshal(tc.req)
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			code, res := serve(t, server, req)
+			assert.Equal(t, tc.wantCode, code)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestTaskHandler_Get(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mock     func(ctrl *gomock.Controller) storage.TaskCfgRepository
+		path     string
+		wantCode int
+	}{
+		{
+			name: "查询成功",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).
+					Return(task.Task{ID: 1, Name: "test", LastStatus: task.TaskStatusWaiting}, nil)
+				return repo
+			},
+			path:     "/tasks/1",
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "任务不存在",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(2)).
+					Return(task.Task{}, errs.ErrTaskNotFound)
+				return repo
+			},
+			path:     "/tasks/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name: "id错误",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				return daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			path:     "/tasks/abc",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			server := newServer(tc.mock(ctrl), daomocks.NewMockExecutionDAO(ctrl))
+
+			req, err := http.NewRequest(http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+			code, _ := serve(t, server, req)
+			assert.Equal(t, tc.wantCode, code)
+		})
+	}
+}
+
+func TestTaskHandler_Trigger(t *testing.T) {
+	cfg := `{"url":"http://localhost:8080/test"}`
+	testCases := []struct {
+		name     string
+		mock     func(ctrl *gomock.Controller) storage.TaskCfgRepository
+		body     string
+		wantCode int
+	}{
+		{
+			name: "立刻执行",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).
+					Return(task.Task{ID: 1, Executor: "HTTP", Cfg: cfg, LastStatus: task.TaskStatusWaiting}, nil)
+				repo.EXPECT().Trigger(gomock.Any(), int64(1), "").Return(nil)
+				return repo
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "覆盖本次执行的配置",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).
+					Return(task.Task{ID: 1, Executor: "HTTP", Cfg: cfg, LastStatus: task.TaskStatusRunning}, nil)
+				repo.EXPECT().Trigger(gomock.Any(), int64(1), `{"body":"{\"id\":1}"}`).Return(nil)
+				return repo
+			},
+			body:     `{"params":{"body":"{\"id\":1}"}}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "参数不是JSON对象",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).
+					Return(task.Task{ID: 1, Executor: "HTTP", Cfg: cfg, LastStatus: task.TaskStatusWaiting}, nil)
+				return repo
+			},
+			body:     `{"params":[1,2]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "覆盖后的配置错误",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).
+					Return(task.Task{ID: 1, Executor: "HTTP", Cfg: cfg, LastStatus: task.TaskStatusWaiting}, nil)
+				return repo
+			},
+			body:     `{"params":{"url":""}}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "任务已经暂停",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).
+					Return(task.Task{ID: 1, LastStatus: task.TaskStatusPaused}, nil)
+				return repo
+			},
+			wantCode: http.StatusConflict,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			server := newServer(tc.mock(ctrl), daomocks.NewMockExecutionDAO(ctrl))
+
+			req, err := http.NewRequest(http.MethodPost, "/tasks/1/trigger", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			code, _ := serve(t, server, req)
+			assert.Equal(t, tc.wantCode, code)
+		})
+	}
+}
+
+func TestTaskHandler_Pause(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := daomocks.NewMockTaskCfgRepository(ctrl)
+	repo.EXPECT().Pause(gomock.Any(), int64(1), true).Return(nil)
+	server := newServer(repo, daomocks.NewMockExecutionDAO(ctrl))
+
+	req, err := http.NewRequest(http.MethodPost, "/tasks/1/pause?stop=true", nil)
+	require.NoError(t, err)
+	code, _ := serve(t, server, req)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestTaskHandler_Resume(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name     string
+		mock     func(ctrl *gomock.Controller) storage.TaskCfgRepository
+		query    string
+		wantCode int
+	}{
+		{
+			name: "补执行一次",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{
+					ID: 1, CronExp: "0 0 * * * *", NextExecTime: now.Add(-time.Hour), LastStatus: task.TaskStatusPaused,
+				}, nil)
+				// 错过的执行马上执行
+				repo.EXPECT().Resume(gomock.Any(), int64(1), gomock.Cond(func(x any) bool {
+					return !x.(time.Time).After(time.Now())
+				})).Return(nil)
+				return repo
+			},
+			query:    "?policy=fire_once",
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "任务没有暂停",
+			mock: func(ctrl *gomock.Controller) storage.TaskCfgRepository {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).
+					Return(task.Task{ID: 1, LastStatus: task.TaskStatusWaiting}, nil)
+				return repo
+			},
+			wantCode: http.StatusConflict,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			server := newServer(tc.mock(ctrl), daomocks.NewMockExecutionDAO(ctrl))
+
+			req, err := http.NewRequest(http.MethodPost, "/tasks/1/resume"+tc.query, nil)
+			require.NoError(t, err)
+			code, _ := serve(t, server, req)
+			assert.Equal(t, tc.wantCode, code)
+		})
+	}
+}
+
+func TestTaskHandler_ListExecutions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().ListByTask(gomock.Any(), int64(1), storage.ExecutionQuery{
+		Start:  time.UnixMilli(1000),
+		Offset: 10,
+		Limit:  maxLimit,
+	}).Return([]task.Execution{
+		{
+			ID:        2,
+			Tid:       1,
+			Attempt:   1,
+			Status:    task.ExecStatusFailed,
+			StartTime: time.UnixMilli(2000),
+			EndTime:   time.UnixMilli(2500),
+			ErrMsg:    "request failed",
+			Node:      "node-1",
+		},
+	}, int64(11), nil)
+	server := newServer(daomocks.NewMockTaskCfgRepository(ctrl), executionDAO)
+
+	req, err := http.NewRequest(http.MethodGet, "/tasks/1/executions?offset=10&limit=1000&start=1000", nil)
+	require.NoError(t, err)
+	code, res := serve(t, server, req)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{
+		"total": float64(11),
+		"list": []any{
+			map[string]any{
+				"id":          float64(2),
+				"tid":         float64(1),
+				"attempt":     float64(1),
+				"misfired":    float64(0),
+				"triggerType": "schedule",
+				"status":      "failed",
+				"progress":    float64(0),
+				"startTime":   float64(2000),
+				"endTime":     float64(2500),
+				"duration":    float64(500),
+				"errMsg":      "request failed",
+				"node":        "node-1",
+				"parentId":    float64(0),
+				"shardIndex":  float64(0),
+				"shardTotal":  float64(0),
+			},
+		},
+	}, res.Data)
+}
+
+func TestTaskHandler_ListShards(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	executionDAO := daomocks.NewMockExecutionDAO(ctrl)
+	executionDAO.EXPECT().ListShards(gomock.Any(), int64(2)).Return([]task.Execution{
+		{
+			ID:         3,
+			Tid:        1,
+			Attempt:    1,
+			Status:     task.ExecStatusRunning,
+			Progress:   50,
+			StartTime:  time.UnixMilli(2000),
+			Node:       "node-2",
+			ParentID:   2,
+			ShardIndex: 1,
+			ShardTotal: 2,
+		},
+	}, nil)
+	server := newServer(daomocks.NewMockTaskCfgRepository(ctrl), executionDAO)
+
+	req, err := http.NewRequest(http.MethodGet, "/tasks/1/executions/2/shards", nil)
+	require.NoError(t, err)
+	code, res := serve(t, server, req)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []any{
+		map[string]any{
+			"id":          float64(3),
+			"tid":         float64(1),
+			"attempt":     float64(1),
+			"misfired":    float64(0),
+			"triggerType": "schedule",
+			"status":      "running",
+			"progress":    float64(50),
+			"startTime":   float64(2000),
+			"endTime":     float64(0),
+			"duration":    float64(0),
+			"errMsg":      "",
+			"node":        "node-2",
+			"parentId":    float64(2),
+			"shardIndex":  float64(1),
+			"shardTotal":  float64(2),
+		},
+	}, res.Data)
+}
+
+func newServer(repo storage.TaskCfgRepository, executionDAO storage.ExecutionDAO) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	server := gin.New()
+	sche := scheduler.NewPreemptScheduler(executionDAO, time.Second, semaphore.NewWeighted(1), logger, nil, repo)
+	NewTaskHandler(repo, executionDAO, sche, logger,
+		executor.NewHttpExecutor(logger, http.DefaultClient, 1)).RegisterRoutes(server)
+	return server
+}
+
+func serve(t *testing.T, server *gin.Engine, req *http.Request) (int, Result) {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	var res Result
+	err := json.NewDecoder(recorder.Body).Decode(&res)
+	require.NoError(t, err)
+	return recorder.Code, res
+}
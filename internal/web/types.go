@@ -0,0 +1,256 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/ecodeclub/ecron/internal/task"
+	"time"
+)
+
+// Result 所有接口统一的返回格式
+type Result struct {
+	Msg  string `json:"msg"`
+	Data any    `json:"data,omitempty"`
+}
+
+// TaskReq 创建和修改任务的请求
+type TaskReq struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Executor string `json:"executor"`
+	Cfg      string `json:"cfg"`
+	CronExp  string `json:"cronExp"`
+	Timezone string `json:"timezone"`
+	// 调度方式，0-cron，1-执行一次，2-固定频率，3-固定延迟，4-依赖上游
+	ScheduleType uint8 `json:"scheduleType"`
+	// 执行一次的任务的执行时间，毫秒时间戳
+	ExecAt int64 `json:"execAt"`
+	// 固定频率和固定延迟任务的调度间隔，单位毫秒
+	Interval      int64              `json:"interval"`
+	RetryPolicy   task.RetryPolicy   `json:"retryPolicy"`
+	MisfirePolicy task.MisfirePolicy `json:"misfirePolicy"`
+	// 分片数量，大于 1 时每次执行都会拆分成多个分片并行执行
+	ShardCount int `json:"shardCount"`
+}
+
+func (r TaskReq) toTask() task.Task {
+	t := task.Task{
+		Name:          r.Name,
+		Type:          task.Type(r.Type),
+		Executor:      r.Executor,
+		Cfg:           r.Cfg,
+		CronExp:       r.CronExp,
+		Timezone:      r.Timezone,
+		ScheduleType:  task.ScheduleType(r.ScheduleType),
+		Interval:      time.Duration(r.Interval) * time.Millisecond,
+		RetryPolicy:   r.RetryPolicy,
+		MisfirePolicy: r.MisfirePolicy,
+		ShardCount:    r.ShardCount,
+	}
+	if r.ExecAt > 0 {
+		t.ExecAt = time.UnixMilli(r.ExecAt)
+	}
+	return t
+}
+
+// TriggerReq 手动触发任务的请求
+type TriggerReq struct {
+	// 本次执行覆盖任务配置的参数，必须是 JSON 对象
+	Params json.RawMessage `json:"params"`
+}
+
+type TaskVO struct {
+	ID            int64              `json:"id"`
+	Name          string             `json:"name"`
+	Type          string             `json:"type"`
+	Executor      string             `json:"executor"`
+	Cfg           string             `json:"cfg"`
+	CronExp       string             `json:"cronExp"`
+	Timezone      string             `json:"timezone"`
+	ScheduleType  uint8              `json:"scheduleType"`
+	ExecAt        int64              `json:"execAt"`
+	Interval      int64              `json:"interval"`
+	RetryPolicy   task.RetryPolicy   `json:"retryPolicy"`
+	MisfirePolicy task.MisfirePolicy `json:"misfirePolicy"`
+	ShardCount    int                `json:"shardCount"`
+	Status        string             `json:"status"`
+	NextExecTime  int64              `json:"nextExecTime"`
+	// 等待执行的手动触发的时间，没有时为 0
+	TriggerTime int64 `json:"triggerTime"`
+	Ctime       int64 `json:"ctime"`
+	Utime       int64 `json:"utime"`
+}
+
+func newTaskVO(t task.Task) TaskVO {
+	return TaskVO{
+		ID:            t.ID,
+		Name:          t.Name,
+		Type:          t.Type.String(),
+		Executor:      t.Executor,
+		Cfg:           t.Cfg,
+		CronExp:       t.CronExp,
+		Timezone:      t.Timezone,
+		ScheduleType:  t.ScheduleType.ToUint8(),
+		ExecAt:        toMilli(t.ExecAt),
+		Interval:      t.Interval.Milliseconds(),
+		RetryPolicy:   t.RetryPolicy,
+		MisfirePolicy: t.MisfirePolicy,
+		ShardCount:    t.ShardCount,
+		Status:        taskStatus(t.LastStatus),
+		NextExecTime:  toMilli(t.NextExecTime),
+		TriggerTime:   toMilli(t.TriggerTime),
+		Ctime:         t.Ctime.UnixMilli(),
+		Utime:         t.Utime.UnixMilli(),
+	}
+}
+
+func taskStatus(status int8) string {
+	switch status {
+	case task.TaskStatusWaiting:
+		return "waiting"
+	case task.TaskStatusRunning:
+		return "running"
+	case task.TaskStatusPaused:
+		return "paused"
+	case task.TaskStatusFinished:
+		return "finished"
+	default:
+		return "unknown"
+	}
+}
+
+type ExecutionVO struct {
+	ID      int64 `json:"id"`
+	Tid     int64 `json:"tid"`
+	Attempt int   `json:"attempt"`
+	// 开始执行时一共错过了多少次执行
+	Misfired int `json:"misfired"`
+	// 触发方式，schedule-按照调度计划执行，manual-手动触发
+	TriggerType string `json:"triggerType"`
+	Status      string `json:"status"`
+	// 执行进度，取值 0-100
+	Progress  uint8 `json:"progress"`
+	StartTime int64 `json:"startTime"`
+	EndTime   int64 `json:"endTime"`
+	// 执行时长，单位毫秒，执行还没有结束时为 0
+	Duration int64  `json:"duration"`
+	ErrMsg   string `json:"errMsg"`
+	Node     string `json:"node"`
+	// 分片所属的执行记录的 id，不是分片时为 0
+	ParentID   int64 `json:"parentId"`
+	ShardIndex int   `json:"shardIndex"`
+	// 分片总数，执行没有分片时为 0
+	ShardTotal int `json:"shardTotal"`
+}
+
+func newExecutionVO(e task.Execution) ExecutionVO {
+	return ExecutionVO{
+		ID:          e.ID,
+		Tid:         e.Tid,
+		Attempt:     e.Attempt,
+		Misfired:    e.Misfired,
+		TriggerType: e.TriggerType.String(),
+		Status:      e.Status.String(),
+		Progress:    e.Progress,
+		StartTime:   toMilli(e.StartTime),
+		EndTime:     toMilli(e.EndTime),
+		Duration:    e.Duration().Milliseconds(),
+		ErrMsg:      e.ErrMsg,
+		Node:        e.Node,
+		ParentID:    e.ParentID,
+		ShardIndex:  e.ShardIndex,
+		ShardTotal:  e.ShardTotal,
+	}
+}
+
+// WorkflowReq 创建工作流的请求
+type WorkflowReq struct {
+	Name  string            `json:"name"`
+	Nodes []WorkflowNodeReq `json:"nodes"`
+}
+
+type WorkflowNodeReq struct {
+	Tid int64 `json:"tid"`
+	// 上游任务的 id，为空表示根节点
+	Upstreams []int64 `json:"upstreams"`
+	// 上游任务没有全部执行成功时的处理策略，0-跳过，1-停止工作流，2-依旧执行
+	FailurePolicy uint8 `json:"failurePolicy"`
+}
+
+func (r WorkflowReq) toWorkflow() task.Workflow {
+	w := task.Workflow{
+		Name:  r.Name,
+		Nodes: make([]task.WorkflowNode, 0, len(r.Nodes)),
+	}
+	for _, n := range r.Nodes {
+		w.Nodes = append(w.Nodes, task.WorkflowNode{
+			Tid:           n.Tid,
+			Upstreams:     n.Upstreams,
+			FailurePolicy: task.FailurePolicy(n.FailurePolicy),
+		})
+	}
+	return w
+}
+
+type WorkflowVO struct {
+	ID    int64             `json:"id"`
+	Name  string            `json:"name"`
+	Nodes []WorkflowNodeReq `json:"nodes"`
+	Ctime int64             `json:"ctime"`
+	Utime int64             `json:"utime"`
+}
+
+func newWorkflowVO(w task.Workflow) WorkflowVO {
+	vo := WorkflowVO{
+		ID:    w.ID,
+		Name:  w.Name,
+		Nodes: make([]WorkflowNodeReq, 0, len(w.Nodes)),
+		Ctime: w.Ctime.UnixMilli(),
+		Utime: w.Utime.UnixMilli(),
+	}
+	for _, n := range w.Nodes {
+		vo.Nodes = append(vo.Nodes, WorkflowNodeReq{
+			Tid:           n.Tid,
+			Upstreams:     n.Upstreams,
+			FailurePolicy: uint8(n.FailurePolicy),
+		})
+	}
+	return vo
+}
+
+type WorkflowRunVO struct {
+	ID     int64  `json:"id"`
+	Wid    int64  `json:"wid"`
+	Status string `json:"status"`
+	// 每个节点的执行状态，key 是任务 id
+	Nodes     map[int64]string `json:"nodes"`
+	StartTime int64            `json:"startTime"`
+	EndTime   int64            `json:"endTime"`
+}
+
+func newWorkflowRunVO(r task.WorkflowRun) WorkflowRunVO {
+	vo := WorkflowRunVO{
+		ID:        r.ID,
+		Wid:       r.Wid,
+		Status:    r.Status.String(),
+		Nodes:     make(map[int64]string, len(r.Nodes)),
+		StartTime: toMilli(r.StartTime),
+		EndTime:   toMilli(r.EndTime),
+	}
+	for tid, s := range r.Nodes {
+		vo.Nodes[tid] = s.String()
+	}
+	return vo
+}
+
+// ListResp 分页查询的返回结果
+type ListResp[T any] struct {
+	Total int64 `json:"total"`
+	List  []T   `json:"list"`
+}
+
+func toMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
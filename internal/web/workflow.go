@@ -0,0 +1,77 @@
+package web
+
+import (
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/workflow"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+)
+
+// WorkflowHandler 工作流管理的接口
+type WorkflowHandler struct {
+	engine *workflow.Engine
+	dao    storage.WorkflowDAO
+	logger *slog.Logger
+}
+
+func NewWorkflowHandler(engine *workflow.Engine, dao storage.WorkflowDAO, logger *slog.Logger) *WorkflowHandler {
+	return &WorkflowHandler{
+		engine: engine,
+		dao:    dao,
+		logger: logger,
+	}
+}
+
+func (h *WorkflowHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/workflows")
+	g.POST("", h.Create)
+	g.GET("/:id", h.Get)
+	g.GET("/:id/runs", h.ListRuns)
+}
+
+func (h *WorkflowHandler) Create(ctx *gin.Context) {
+	var req WorkflowReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, Result{Msg: "参数错误"})
+		return
+	}
+	id, err := h.engine.Create(ctx, req.toWorkflow())
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: id})
+}
+
+func (h *WorkflowHandler) Get(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	w, err := h.dao.Get(ctx, id)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: newWorkflowVO(w)})
+}
+
+// ListRuns 按照 id 倒序分页查询工作流的运行记录
+func (h *WorkflowHandler) ListRuns(ctx *gin.Context) {
+	id, ok := paramID(ctx)
+	if !ok {
+		return
+	}
+	offset, limit := pageParams(ctx)
+	runs, total, err := h.dao.ListRuns(ctx, id, offset, limit)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	res := ListResp[WorkflowRunVO]{Total: total, List: make([]WorkflowRunVO, 0, len(runs))}
+	for _, r := range runs {
+		res.List = append(res.List, newWorkflowRunVO(r))
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK", Data: res})
+}
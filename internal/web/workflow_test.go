@@ -0,0 +1,125 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ecodeclub/ecron/internal/errs"
+	daomocks "github.com/ecodeclub/ecron/internal/storage/mocks"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/ecodeclub/ecron/internal/workflow"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWorkflowHandler_Create(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mock     func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository)
+		req      WorkflowReq
+		wantCode int
+		wantRes  Result
+	}{
+		{
+			name: "创建成功",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{ID: 1}, nil)
+				repo.EXPECT().Get(gomock.Any(), int64(2)).
+					Return(task.Task{ID: 2, ScheduleType: task.ScheduleTypeDependent}, nil)
+				dao := daomocks.NewMockWorkflowDAO(ctrl)
+				dao.EXPECT().Create(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+				return dao, repo
+			},
+			req: WorkflowReq{
+				Name: "test",
+				Nodes: []WorkflowNodeReq{
+					{Tid: 1},
+					{Tid: 2, Upstreams: []int64{1}},
+				},
+			},
+			wantCode: http.StatusOK,
+			wantRes:  Result{Msg: "OK", Data: float64(1)},
+		},
+		{
+			name: "有环",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				return daomocks.NewMockWorkflowDAO(ctrl), daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			req: WorkflowReq{
+				Name: "test",
+				Nodes: []WorkflowNodeReq{
+					{Tid: 1, Upstreams: []int64{2}},
+					{Tid: 2, Upstreams: []int64{1}},
+				},
+			},
+			wantCode: http.StatusBadRequest,
+			wantRes:  Result{Msg: errs.ErrInvalidWorkflow.Error()},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			server := newWorkflowServer(tc.mock(ctrl))
+
+			body, err := json.Marshal(tc.req)
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodPost, "/workflows", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			code, res := serve(t, server, req)
+			assert.Equal(t, tc.wantCode, code)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestWorkflowHandler_ListRuns(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dao := daomocks.NewMockWorkflowDAO(ctrl)
+	dao.EXPECT().ListRuns(gomock.Any(), int64(1), 0, defaultLimit).Return([]task.WorkflowRun{
+		{
+			ID:        1,
+			Wid:       1,
+			Status:    task.WorkflowRunStatusHalted,
+			Nodes:     map[int64]task.ExecStatus{1: task.ExecStatusSuccess, 2: task.ExecStatusFailed},
+			StartTime: time.UnixMilli(1000),
+			EndTime:   time.UnixMilli(2000),
+		},
+	}, int64(1), nil)
+	server := newWorkflowServer(dao, daomocks.NewMockTaskCfgRepository(ctrl))
+
+	req, err := http.NewRequest(http.MethodGet, "/workflows/1/runs", nil)
+	require.NoError(t, err)
+	code, res := serve(t, server, req)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{
+		"total": float64(1),
+		"list": []any{
+			map[string]any{
+				"id":        float64(1),
+				"wid":       float64(1),
+				"status":    "halted",
+				"nodes":     map[string]any{"1": "success", "2": "failed"},
+				"startTime": float64(1000),
+				"endTime":   float64(2000),
+			},
+		},
+	}, res.Data)
+}
+
+func newWorkflowServer(dao *daomocks.MockWorkflowDAO, repo *daomocks.MockTaskCfgRepository) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	server := gin.New()
+	NewWorkflowHandler(workflow.NewEngine(dao, repo, logger), dao, logger).RegisterRoutes(server)
+	return server
+}
@@ -0,0 +1,108 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/storage"
+	"github.com/ecodeclub/ecron/internal/task"
+	"log/slog"
+	"time"
+)
+
+// 乐观锁更新运行记录失败时最多重试的次数
+const maxAdvanceTimes = 3
+
+// Engine 根据任务的执行结果推进工作流。
+// 根节点执行结束时如果工作流没有正在运行的记录，就开始一次新的运行
+type Engine struct {
+	dao    storage.WorkflowDAO
+	repo   storage.TaskCfgRepository
+	logger *slog.Logger
+}
+
+func NewEngine(dao storage.WorkflowDAO, repo storage.TaskCfgRepository, logger *slog.Logger) *Engine {
+	return &Engine{
+		dao:    dao,
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Create 创建工作流。根节点需要有自己的调度计划，其他节点必须是 task.ScheduleTypeDependent 的任务
+func (e *Engine) Create(ctx context.Context, w task.Workflow) (int64, error) {
+	if err := w.Validate(); err != nil {
+		return 0, err
+	}
+	for _, n := range w.Nodes {
+		t, err := e.repo.Get(ctx, n.Tid)
+		if err != nil {
+			return 0, err
+		}
+		dependent := t.ScheduleType == task.ScheduleTypeDependent
+		if dependent == (len(n.Upstreams) == 0) {
+			return 0, errs.ErrInvalidWorkflow
+		}
+	}
+	return e.dao.Create(ctx, w)
+}
+
+// OnFinished 任务的一次调度结束后调用，等待重试的执行不算结束。
+// 会记录节点的执行状态，并且让可以开始执行的下游节点进入等待调度状态
+func (e *Engine) OnFinished(ctx context.Context, t task.Task, status task.ExecStatus) {
+	w, err := e.dao.GetByTask(ctx, t.ID)
+	if errors.Is(err, errs.ErrWorkflowNotFound) {
+		return
+	}
+	if err != nil {
+		e.logger.Error("查询任务所在的工作流失败", slog.Int64("task_id", t.ID), slog.Any("error", err))
+		return
+	}
+	for i := 0; i < maxAdvanceTimes; i++ {
+		var ready []int64
+		ready, err = e.advance(ctx, w, t.ID, status)
+		if errors.Is(err, errs.ErrConcurrentUpdate) {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		for _, tid := range ready {
+			if err = e.repo.Ready(ctx, tid); err != nil {
+				e.logger.Error("下游任务进入等待调度状态失败", slog.Int64("workflow_id", w.ID),
+					slog.Int64("task_id", tid), slog.Any("error", err))
+			}
+		}
+		return
+	}
+	e.logger.Error("推进工作流失败", slog.Int64("workflow_id", w.ID),
+		slog.Int64("task_id", t.ID), slog.Any("error", err))
+}
+
+// advance 在工作流正在运行的记录上记录节点的执行状态，返回可以开始执行的下游节点
+func (e *Engine) advance(ctx context.Context, w task.Workflow, tid int64, status task.ExecStatus) ([]int64, error) {
+	now := time.Now()
+	r, err := e.dao.GetRunningRun(ctx, w.ID)
+	switch {
+	case errors.Is(err, errs.ErrWorkflowRunNotFound):
+		node, _ := w.Node(tid)
+		if len(node.Upstreams) > 0 {
+			// 不属于任何一次运行的下游节点，例如运行已经被停止了
+			return nil, nil
+		}
+		r = task.WorkflowRun{
+			Wid:       w.ID,
+			Status:    task.WorkflowRunStatusRunning,
+			StartTime: now,
+		}
+		ready := r.Advance(w, tid, status, now)
+		// 多个根节点在不同的调度节点上同时结束时只有一个能创建成功，
+		// 其他的返回 errs.ErrConcurrentUpdate，重新推进时会查询到已经创建的运行记录
+		_, err = e.dao.CreateRun(ctx, r)
+		return ready, err
+	case err != nil:
+		return nil, err
+	}
+	ready := r.Advance(w, tid, status, now)
+	return ready, e.dao.UpdateRun(ctx, r)
+}
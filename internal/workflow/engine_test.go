@@ -0,0 +1,200 @@
+package workflow
+
+import (
+	"context"
+	"github.com/ecodeclub/ecron/internal/errs"
+	daomocks "github.com/ecodeclub/ecron/internal/storage/mocks"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestEngine_Create(t *testing.T) {
+	w := task.Workflow{
+		Name: "test",
+		Nodes: []task.WorkflowNode{
+			{Tid: 1},
+			{Tid: 2, Upstreams: []int64{1}},
+		},
+	}
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository)
+		wantErr error
+		wantID  int64
+	}{
+		{
+			name: "创建成功",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{ID: 1, CronExp: "0 0 8 * * *"}, nil)
+				repo.EXPECT().Get(gomock.Any(), int64(2)).
+					Return(task.Task{ID: 2, ScheduleType: task.ScheduleTypeDependent}, nil)
+				dao := daomocks.NewMockWorkflowDAO(ctrl)
+				dao.EXPECT().Create(gomock.Any(), w).Return(int64(1), nil)
+				return dao, repo
+			},
+			wantID: 1,
+		},
+		{
+			name: "下游节点有自己的调度计划",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Get(gomock.Any(), int64(1)).Return(task.Task{ID: 1, CronExp: "0 0 8 * * *"}, nil)
+				repo.EXPECT().Get(gomock.Any(), int64(2)).Return(task.Task{ID: 2, CronExp: "0 0 9 * * *"}, nil)
+				return daomocks.NewMockWorkflowDAO(ctrl), repo
+			},
+			wantErr: errs.ErrInvalidWorkflow,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			dao, repo := tc.mock(ctrl)
+			id, err := newEngine(dao, repo).Create(context.Background(), w)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantID, id)
+		})
+	}
+}
+
+func TestEngine_OnFinished(t *testing.T) {
+	w := task.Workflow{
+		ID: 1,
+		Nodes: []task.WorkflowNode{
+			{Tid: 1},
+			{Tid: 2, Upstreams: []int64{1}},
+			{Tid: 3, Upstreams: []int64{1, 2}},
+		},
+	}
+	testCases := []struct {
+		name   string
+		mock   func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository)
+		tid    int64
+		status task.ExecStatus
+	}{
+		{
+			name: "不属于任何工作流",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				dao := daomocks.NewMockWorkflowDAO(ctrl)
+				dao.EXPECT().GetByTask(gomock.Any(), int64(1)).Return(task.Workflow{}, errs.ErrWorkflowNotFound)
+				return dao, daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			tid:    1,
+			status: task.ExecStatusSuccess,
+		},
+		{
+			name: "根节点执行成功，开始新的运行",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				dao := daomocks.NewMockWorkflowDAO(ctrl)
+				dao.EXPECT().GetByTask(gomock.Any(), int64(1)).Return(w, nil)
+				dao.EXPECT().GetRunningRun(gomock.Any(), int64(1)).
+					Return(task.WorkflowRun{}, errs.ErrWorkflowRunNotFound)
+				dao.EXPECT().CreateRun(gomock.Any(), gomock.Cond(func(x any) bool {
+					r := x.(task.WorkflowRun)
+					return r.Status == task.WorkflowRunStatusRunning &&
+						r.Nodes[1] == task.ExecStatusSuccess && r.Nodes[2] == task.ExecStatusRunning
+				})).Return(int64(1), nil)
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Ready(gomock.Any(), int64(2)).Return(nil)
+				return dao, repo
+			},
+			tid:    1,
+			status: task.ExecStatusSuccess,
+		},
+		{
+			name: "运行记录被其他节点修改，重新推进",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				dao := daomocks.NewMockWorkflowDAO(ctrl)
+				dao.EXPECT().GetByTask(gomock.Any(), int64(2)).Return(w, nil)
+				// 每次都重新查询到最新的运行记录
+				dao.EXPECT().GetRunningRun(gomock.Any(), int64(1)).
+					DoAndReturn(func(ctx context.Context, wid int64) (task.WorkflowRun, error) {
+						return task.WorkflowRun{
+							ID:      1,
+							Wid:     wid,
+							Status:  task.WorkflowRunStatusRunning,
+							Nodes:   map[int64]task.ExecStatus{1: task.ExecStatusSuccess, 2: task.ExecStatusRunning},
+							Version: 1,
+						}, nil
+					}).Times(2)
+				dao.EXPECT().UpdateRun(gomock.Any(), gomock.Any()).Return(errs.ErrConcurrentUpdate)
+				dao.EXPECT().UpdateRun(gomock.Any(), gomock.Cond(func(x any) bool {
+					r := x.(task.WorkflowRun)
+					return r.Nodes[2] == task.ExecStatusSuccess && r.Nodes[3] == task.ExecStatusRunning
+				})).Return(nil)
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Ready(gomock.Any(), int64(3)).Return(nil)
+				return dao, repo
+			},
+			tid:    2,
+			status: task.ExecStatusSuccess,
+		},
+		{
+			name: "另一个根节点已经开始了运行",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				roots := task.Workflow{
+					ID: 1,
+					Nodes: []task.WorkflowNode{
+						{Tid: 1},
+						{Tid: 4},
+						{Tid: 3, Upstreams: []int64{1, 4}},
+					},
+				}
+				dao := daomocks.NewMockWorkflowDAO(ctrl)
+				dao.EXPECT().GetByTask(gomock.Any(), int64(4)).Return(roots, nil)
+				gomock.InOrder(
+					dao.EXPECT().GetRunningRun(gomock.Any(), int64(1)).
+						Return(task.WorkflowRun{}, errs.ErrWorkflowRunNotFound),
+					dao.EXPECT().CreateRun(gomock.Any(), gomock.Any()).Return(int64(0), errs.ErrConcurrentUpdate),
+					// 重新查询到根节点 1 创建的运行记录
+					dao.EXPECT().GetRunningRun(gomock.Any(), int64(1)).Return(task.WorkflowRun{
+						ID:      1,
+						Wid:     1,
+						Status:  task.WorkflowRunStatusRunning,
+						Nodes:   map[int64]task.ExecStatus{1: task.ExecStatusSuccess},
+						Version: 1,
+					}, nil),
+					dao.EXPECT().UpdateRun(gomock.Any(), gomock.Cond(func(x any) bool {
+						r := x.(task.WorkflowRun)
+						return r.ID == 1 && r.Nodes[1] == task.ExecStatusSuccess && r.Nodes[4] == task.ExecStatusSuccess &&
+							r.Nodes[3] == task.ExecStatusRunning
+					})).Return(nil),
+				)
+				repo := daomocks.NewMockTaskCfgRepository(ctrl)
+				repo.EXPECT().Ready(gomock.Any(), int64(3)).Return(nil)
+				return dao, repo
+			},
+			tid:    4,
+			status: task.ExecStatusSuccess,
+		},
+		{
+			name: "没有正在运行的记录的下游节点",
+			mock: func(ctrl *gomock.Controller) (*daomocks.MockWorkflowDAO, *daomocks.MockTaskCfgRepository) {
+				dao := daomocks.NewMockWorkflowDAO(ctrl)
+				dao.EXPECT().GetByTask(gomock.Any(), int64(3)).Return(w, nil)
+				dao.EXPECT().GetRunningRun(gomock.Any(), int64(1)).
+					Return(task.WorkflowRun{}, errs.ErrWorkflowRunNotFound)
+				return dao, daomocks.NewMockTaskCfgRepository(ctrl)
+			},
+			tid:    3,
+			status: task.ExecStatusSuccess,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			dao, repo := tc.mock(ctrl)
+			newEngine(dao, repo).OnFinished(context.Background(), task.Task{ID: tc.tid}, tc.status)
+		})
+	}
+}
+
+func newEngine(dao *daomocks.MockWorkflowDAO, repo *daomocks.MockTaskCfgRepository) *Engine {
+	return NewEngine(dao, repo, slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"github.com/ecodeclub/ecron/internal/executor"
+	"github.com/ecodeclub/ecron/internal/scheduler"
+	"github.com/ecodeclub/ecron/internal/storage/backend"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/ecodeclub/ecron/internal/workflow"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/semaphore"
+	"gorm.io/gorm"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// 探查业务方执行情况连续失败的次数上限
+const maxExploreFailCount = 5
+
+// Builder 组装 Ecron，没有设置的字段使用默认值
+type Builder struct {
+	db             *gorm.DB
+	logger         *slog.Logger
+	maxConcurrency int64
+	// 每次查询的候选任务数量
+	batchSize int
+	// 租约的有效期，持有者超过这个时间没有续约的话，任务可以被其他进程抢占
+	leaseTTL time.Duration
+	// 自动续约的间隔，需要小于 leaseTTL
+	leaseRefreshInterval time.Duration
+	// 汇总分片执行情况的间隔
+	refreshInterval time.Duration
+	autoMigrate     bool
+	httpClient      *http.Client
+	// 不为 nil 时使用 Redis 抢占任务
+	redis       redis.Cmdable
+	redisPrefix string
+}
+
+// NewBuilder 支持 MySQL、PostgreSQL 和 SQLite，按照 db 的方言选择存储实现
+func NewBuilder(db *gorm.DB) *Builder {
+	return &Builder{
+		db:                   db,
+		logger:               slog.Default(),
+		maxConcurrency:       100,
+		batchSize:            10,
+		leaseTTL:             15 * time.Second,
+		leaseRefreshInterval: 5 * time.Second,
+		refreshInterval:      5 * time.Second,
+		httpClient:           http.DefaultClient,
+	}
+}
+
+func (b *Builder) Logger(logger *slog.Logger) *Builder {
+	b.logger = logger
+	return b
+}
+
+// MaxConcurrency 同时执行的任务数量上限
+func (b *Builder) MaxConcurrency(n int64) *Builder {
+	b.maxConcurrency = n
+	return b
+}
+
+func (b *Builder) BatchSize(n int) *Builder {
+	b.batchSize = n
+	return b
+}
+
+func (b *Builder) LeaseTTL(ttl time.Duration) *Builder {
+	b.leaseTTL = ttl
+	return b
+}
+
+// LeaseRefreshInterval 自动续约的间隔，需要小于 LeaseTTL，否则 Build 返回错误
+func (b *Builder) LeaseRefreshInterval(interval time.Duration) *Builder {
+	b.leaseRefreshInterval = interval
+	return b
+}
+
+// RefreshInterval 汇总分片执行情况的间隔
+func (b *Builder) RefreshInterval(interval time.Duration) *Builder {
+	b.refreshInterval = interval
+	return b
+}
+
+// AutoMigrate Start 时把表结构升级到最新的版本。默认只检查版本，不一致时 Start 返回错误
+func (b *Builder) AutoMigrate() *Builder {
+	b.autoMigrate = true
+	return b
+}
+
+// HTTPClient 执行 HTTP 任务时使用的客户端，默认使用 http.DefaultClient
+func (b *Builder) HTTPClient(client *http.Client) *Builder {
+	b.httpClient = client
+	return b
+}
+
+// Redis 使用 Redis 抢占任务，不需要定时查询任务表。prefix 为空时使用默认的前缀，
+// 多个集群共用一个 Redis 时使用不同的前缀。同一个 db 的所有进程，包括管理接口，都需要使用同一个 Redis
+func (b *Builder) Redis(client redis.Cmdable, prefix string) *Builder {
+	b.redis = client
+	b.redisPrefix = prefix
+	return b
+}
+
+// Build 除了本地任务，也会执行通过管理接口创建的 HTTP 和 gRPC 任务
+func (b *Builder) Build() (*Ecron, error) {
+	be, err := backend.New("", b.db)
+	if err != nil {
+		return nil, err
+	}
+	if b.redis != nil {
+		be.UseRedis(b.redis, b.redisPrefix)
+	}
+	pe, err := be.NewPreempter(b.batchSize, b.leaseTTL, b.leaseRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	local := executor.NewLocalExecutor(b.logger)
+	sche := scheduler.NewPreemptScheduler(be.ExecutionDAO, b.refreshInterval,
+		semaphore.NewWeighted(b.maxConcurrency), b.logger, pe, be.TaskRepo)
+	sche.RegisterExecutor(local,
+		executor.NewHttpExecutor(b.logger, b.httpClient, maxExploreFailCount),
+		executor.NewGrpcExecutor(b.logger, maxExploreFailCount))
+	sche.RegisterFinishedHandler(workflow.NewEngine(be.WorkflowDAO, be.TaskRepo, b.logger).OnFinished)
+	return &Ecron{
+		backend:     be,
+		sche:        sche,
+		local:       local,
+		logger:      b.logger,
+		autoMigrate: b.autoMigrate,
+		funcs:       make(map[string]task.Task),
+	}, nil
+}
@@ -1,5 +1,5 @@
+// Package lib 对外提供 SDK，把 ecron 嵌入到业务进程中使用。
+// 用户传入 db，通过 Builder 初始化好调度器、执行器和存储，
+// 再通过 RegisterLocalFunc 传入任务的名称、cron 表达式和执行的方法就可以了，
+// 其它的交由调度器来完成。多个进程使用同一个 db 时，每次执行只会由其中一个进程完成
 package lib
-
-// 这个包，是对外用来提供sdk形态的。
-// 用户传入 db，初始化好调度器和执行器，传入任务的名称、cron表达式就可以了
-// 其它的交由register来完成
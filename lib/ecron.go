@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ecodeclub/ecron/internal/errs"
+	"github.com/ecodeclub/ecron/internal/executor"
+	"github.com/ecodeclub/ecron/internal/scheduler"
+	"github.com/ecodeclub/ecron/internal/storage/backend"
+	"github.com/ecodeclub/ecron/internal/task"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Execution 本地任务的一次执行，可以获取执行记录的 id 和第几次执行，上报进度，
+// 通过 Logger 记录带有任务信息的日志，通过 CancelCause 获取执行被取消的原因
+type Execution = executor.LocalExecution
+
+// Ecron 嵌入到业务进程中的调度节点，通过 Builder 创建
+type Ecron struct {
+	backend     *backend.Backend
+	sche        *scheduler.PreemptScheduler
+	local       *executor.LocalExecutor
+	logger      *slog.Logger
+	autoMigrate bool
+
+	mu sync.Mutex
+	// 注册的本地任务，Start 时保存到数据库，key 是任务名称
+	funcs   map[string]task.Task
+	started bool
+	cancel  context.CancelFunc
+	// Schedule 的返回值
+	done chan error
+}
+
+// RegisterLocalFunc 注册一个按照 cron 表达式执行的本地任务，fn 返回 error 表示执行失败，
+// 执行时间比较长的任务可以通过 exec.ReportProgress 上报进度。
+// cron 表达式包含秒，例如 "0 */5 * * * *" 表示每五分钟执行一次。
+// 任务以 name 为标识保存到数据库中，已经存在时只会更新 cron 表达式，所以多个进程可以注册同一个任务。
+// 多个进程第一次同时注册同一个任务时可能会创建重复的任务，可以先在一个进程中启动。
+// 只能在 Start 之前调用
+func (e *Ecron) RegisterLocalFunc(name, cron string, fn func(ctx context.Context, exec *Execution) error) error {
+	if name == "" || fn == nil {
+		return fmt.Errorf("%w: 任务名称和执行的方法不能为空", errs.ErrInCorrectConfig)
+	}
+	t := task.Task{
+		Name:         name,
+		Type:         task.TypeLocal,
+		Executor:     e.local.Name(),
+		CronExp:      cron,
+		ScheduleType: task.ScheduleTypeCron,
+	}
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", err, cron)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.started {
+		return errs.ErrAlreadyStarted
+	}
+	if _, ok := e.funcs[name]; ok {
+		return fmt.Errorf("%w: 任务 %s 已经注册", errs.ErrInCorrectConfig, name)
+	}
+	e.funcs[name] = t
+	e.local.RegisterFunc(name, fn)
+	return nil
+}
+
+// Start 检查表结构的版本，使用 Redis 时把任务表中的任务加入 Redis，保存注册的任务，然后在后台开始调度。
+// ctx 只控制启动的过程，调度会一直持续到调用 Stop
+func (e *Ecron) Start(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.started {
+		return errs.ErrAlreadyStarted
+	}
+	migrator, err := e.backend.NewMigrator()
+	if err != nil {
+		return err
+	}
+	if e.autoMigrate {
+		err = migrator.Up(ctx)
+	} else {
+		err = migrator.Check(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if err = e.backend.Load(ctx); err != nil {
+		return err
+	}
+	for _, t := range e.funcs {
+		if err = e.save(ctx, t); err != nil {
+			return err
+		}
+	}
+
+	scheduleCtx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan error, 1)
+	e.started = true
+	go func() {
+		e.done <- e.sche.Schedule(scheduleCtx)
+	}()
+	return nil
+}
+
+// Stop 停止抢占新的任务，等待正在执行的任务结束。
+// ctx 结束时还没有执行完的任务会交给其他进程继续处理。Stop 之后不能再次 Start
+func (e *Ecron) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started || e.cancel == nil {
+		return nil
+	}
+	err := e.sche.Shutdown(ctx)
+	e.cancel()
+	e.cancel = nil
+	if er := <-e.done; er != nil {
+		e.logger.Error("调度异常退出", slog.Any("error", er))
+	}
+	return err
+}
+
+// save 按照名称保存任务，任务已经存在并且 cron 表达式不同时更新 cron 表达式和下一次执行时间
+func (e *Ecron) save(ctx context.Context, t task.Task) error {
+	repo := e.backend.TaskRepo
+	old, err := repo.GetByName(ctx, t.Name)
+	switch {
+	case errors.Is(err, errs.ErrTaskNotFound):
+		if t.NextExecTime, err = t.NextTime(time.Now()); err != nil {
+			return err
+		}
+		_, err = repo.Add(ctx, t)
+		return err
+	case err != nil:
+		return err
+	case old.Executor != t.Executor:
+		return fmt.Errorf("%w: 任务 %s 已经存在，执行器是 %s", errs.ErrInCorrectConfig, t.Name, old.Executor)
+	case old.ScheduleType == t.ScheduleType && old.CronExp == t.CronExp:
+		return nil
+	default:
+		old.ScheduleType, old.CronExp = t.ScheduleType, t.CronExp
+		if old.NextExecTime, err = old.NextTime(time.Now()); err != nil {
+			return err
+		}
+		return repo.Update(ctx, old)
+	}
+}
@@ -0,0 +1,203 @@
+package lib
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ecodeclub/ecron/internal/errs"
+	ecronredis "github.com/ecodeclub/ecron/internal/storage/redis"
+	"github.com/ecodeclub/ecron/internal/storage/sqlite"
+	"github.com/ecodeclub/ecron/internal/task"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEcron_RegisterLocalFunc(t *testing.T) {
+	fn := func(ctx context.Context, exec *Execution) error { return nil }
+	testCases := []struct {
+		name     string
+		before   func(t *testing.T, e *Ecron)
+		taskName string
+		cron     string
+		fn       func(ctx context.Context, exec *Execution) error
+		wantErr  error
+	}{
+		{
+			name:     "注册成功",
+			before:   func(t *testing.T, e *Ecron) {},
+			taskName: "hello",
+			cron:     "0 */5 * * * *",
+			fn:       fn,
+		},
+		{
+			name:    "名称为空",
+			before:  func(t *testing.T, e *Ecron) {},
+			cron:    "0 */5 * * * *",
+			fn:      fn,
+			wantErr: errs.ErrInCorrectConfig,
+		},
+		{
+			name:     "方法为空",
+			before:   func(t *testing.T, e *Ecron) {},
+			taskName: "hello",
+			cron:     "0 */5 * * * *",
+			wantErr:  errs.ErrInCorrectConfig,
+		},
+		{
+			name:     "cron 表达式错误",
+			before:   func(t *testing.T, e *Ecron) {},
+			taskName: "hello",
+			cron:     "abc",
+			fn:       fn,
+			wantErr:  errs.ErrInvalidSchedule,
+		},
+		{
+			name: "重复注册",
+			before: func(t *testing.T, e *Ecron) {
+				require.NoError(t, e.RegisterLocalFunc("hello", "0 */5 * * * *", fn))
+			},
+			taskName: "hello",
+			cron:     "0 */5 * * * *",
+			fn:       fn,
+			wantErr:  errs.ErrInCorrectConfig,
+		},
+		{
+			name: "已经启动",
+			before: func(t *testing.T, e *Ecron) {
+				require.NoError(t, e.Start(context.Background()))
+				t.Cleanup(func() {
+					require.NoError(t, e.Stop(context.Background()))
+				})
+			},
+			taskName: "hello",
+			cron:     "0 */5 * * * *",
+			fn:       fn,
+			wantErr:  errs.ErrAlreadyStarted,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTestEcron(t, openTestDB(t))
+			tc.before(t, e)
+			err := e.RegisterLocalFunc(tc.taskName, tc.cron, tc.fn)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestEcron_Start(t *testing.T) {
+	db := openTestDB(t)
+	fn := func(ctx context.Context, exec *Execution) error { return nil }
+
+	// 第一次启动时创建任务
+	e := newTestEcron(t, db)
+	require.NoError(t, e.RegisterLocalFunc("hello", "0 0 * * * *", fn))
+	require.NoError(t, e.Start(context.Background()))
+	assert.ErrorIs(t, e.Start(context.Background()), errs.ErrAlreadyStarted)
+	require.NoError(t, e.Stop(context.Background()))
+	first, err := e.backend.TaskRepo.GetByName(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "0 0 * * * *", first.CronExp)
+	assert.Equal(t, task.Type(task.TypeLocal), first.Type)
+
+	// 再次启动时 cron 表达式没有变化，不会创建新的任务
+	e = newTestEcron(t, db)
+	require.NoError(t, e.RegisterLocalFunc("hello", "0 0 * * * *", fn))
+	require.NoError(t, e.Start(context.Background()))
+	require.NoError(t, e.Stop(context.Background()))
+	second, err := e.backend.TaskRepo.GetByName(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, first.NextExecTime, second.NextExecTime)
+
+	// cron 表达式变化时更新
+	e = newTestEcron(t, db)
+	require.NoError(t, e.RegisterLocalFunc("hello", "0 30 * * * *", fn))
+	require.NoError(t, e.Start(context.Background()))
+	require.NoError(t, e.Stop(context.Background()))
+	third, err := e.backend.TaskRepo.GetByName(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, third.ID)
+	assert.Equal(t, "0 30 * * * *", third.CronExp)
+	assert.Equal(t, 30, third.NextExecTime.Minute())
+}
+
+// TestEcron_Redis 使用 Redis 抢占时，启动后注册的任务也会被调度执行
+func TestEcron_Redis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer client.Close()
+	var calls atomic.Int32
+	e, err := NewBuilder(openTestDB(t)).Logger(slog.New(slog.NewTextHandler(io.Discard, nil))).
+		Redis(client, "").Build()
+	require.NoError(t, err)
+	require.NoError(t, e.RegisterLocalFunc("hello", "* * * * * *", func(ctx context.Context, exec *Execution) error {
+		calls.Add(1)
+		return nil
+	}))
+	require.NoError(t, e.Start(context.Background()))
+	defer func() {
+		require.NoError(t, e.Stop(context.Background()))
+	}()
+	hello, err := e.backend.TaskRepo.GetByName(context.Background(), "hello")
+	require.NoError(t, err)
+	// 保存任务时加入了 Redis
+	_, err = client.ZScore(context.Background(), ecronredis.DefaultPrefix+":ready", strconv.FormatInt(hello.ID, 10)).Result()
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return calls.Load() >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name     string
+		leaseTTL time.Duration
+		interval time.Duration
+		wantErr  error
+	}{
+		{
+			name:     "续约间隔小于租约的有效期",
+			leaseTTL: 3 * time.Second,
+			interval: time.Second,
+		},
+		{
+			name:     "续约间隔等于租约的有效期",
+			leaseTTL: 3 * time.Second,
+			interval: 3 * time.Second,
+			wantErr:  errs.ErrInCorrectConfig,
+		},
+		{
+			name:     "续约间隔为 0",
+			leaseTTL: 3 * time.Second,
+			wantErr:  errs.ErrInCorrectConfig,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := NewBuilder(openTestDB(t)).LeaseTTL(tc.leaseTTL).LeaseRefreshInterval(tc.interval).Build()
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantErr == nil, e != nil)
+		})
+	}
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "ecron.db"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	return db
+}
+
+func newTestEcron(t *testing.T, db *gorm.DB) *Ecron {
+	e, err := NewBuilder(db).Logger(slog.New(slog.NewTextHandler(io.Discard, nil))).Build()
+	require.NoError(t, err)
+	return e
+}
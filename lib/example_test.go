@@ -0,0 +1,65 @@
+package lib_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ecodeclub/ecron/lib"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+func Example() {
+	dir, err := os.MkdirTemp("", "ecron")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate",
+		filepath.Join(dir, "ecron.db"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		panic(err)
+	}
+
+	e, err := lib.NewBuilder(db).
+		Logger(slog.New(slog.NewTextHandler(io.Discard, nil))).
+		AutoMigrate().
+		Build()
+	if err != nil {
+		panic(err)
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	// 每秒执行一次
+	err = e.RegisterLocalFunc("hello", "* * * * * *", func(ctx context.Context, exec *lib.Execution) error {
+		once.Do(func() {
+			fmt.Println("hello ecron")
+			close(done)
+		})
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if err = e.Start(context.Background()); err != nil {
+		panic(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = e.Stop(ctx); err != nil {
+		panic(err)
+	}
+	// Output: hello ecron
+}
@@ -1,13 +1,7 @@
 package main
 
-import (
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
-)
+import "github.com/ecodeclub/ecron/cmd"
 
 func main() {
-	db, err := gorm.Open(mysql.Open("root:root@tcp(localhost:13316)/webook"))
-	if err != nil {
-		panic(err)
-	}
+	cmd.Execute()
 }